@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/grpc/client"
 	"tunnel_pls/internal/key"
@@ -31,11 +31,12 @@ type Bootstrap struct {
 	GrpcClient      client.Client
 	ErrChan         chan error
 	SignalChan      chan os.Signal
+	Quiet           bool
 }
 
 func New(config config.Config, port port.Port) (*Bootstrap, error) {
 	randomizer := random.New()
-	sessionRegistry := registry.NewRegistry()
+	sessionRegistry := registry.NewRegistry(config.SlugReuseGrace(), config.MaxSlugLength())
 
 	if err := port.AddRange(config.AllowedPortsStart(), config.AllowedPortsEnd()); err != nil {
 		return nil, err
@@ -60,12 +61,29 @@ func New(config config.Config, port port.Port) (*Bootstrap, error) {
 	}, nil
 }
 
-func newSSHConfig(sshKeyPath string) (*ssh.ServerConfig, error) {
+func newSSHConfig(sshKeyPath, hostKeyPEM string) (*ssh.ServerConfig, error) {
 	sshCfg := &ssh.ServerConfig{
 		NoClientAuth:  true,
 		ServerVersion: fmt.Sprintf("SSH-2.0-TunnelPlease-%s", version.GetShortVersion()),
 	}
 
+	private, err := loadHostKey(sshKeyPath, hostKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	sshCfg.AddHostKey(private)
+	return sshCfg, nil
+}
+
+func loadHostKey(sshKeyPath, hostKeyPEM string) (ssh.Signer, error) {
+	if hostKeyPEM != "" {
+		private, err := ssh.ParsePrivateKey([]byte(hostKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("parse SSH_HOST_KEY: %w", err)
+		}
+		return private, nil
+	}
+
 	if err := key.GenerateSSHKeyIfNotExist(sshKeyPath); err != nil {
 		return nil, fmt.Errorf("generate ssh key: %w", err)
 	}
@@ -77,14 +95,11 @@ func newSSHConfig(sshKeyPath string) (*ssh.ServerConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("parse private key: %w", err)
 	}
-	sshCfg.AddHostKey(private)
-	return sshCfg, nil
+	return private, nil
 }
 
 func (b *Bootstrap) startGRPCClient(ctx context.Context, conf config.Config, errChan chan<- error) error {
-	healthCtx, healthCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer healthCancel()
-	if err := b.GrpcClient.CheckServerHealth(healthCtx); err != nil {
+	if err := b.GrpcClient.WaitForServerHealth(ctx); err != nil {
 		return fmt.Errorf("gRPC health check failed: %w", err)
 	}
 
@@ -145,8 +160,35 @@ func startPprof(pprofPort string, errChan chan<- error) {
 		errChan <- fmt.Errorf("pprof server error: %v", err)
 	}
 }
+func startupBanner(conf config.Config) string {
+	mode := "standalone"
+	if conf.Mode() == types.ServerModeNODE {
+		mode = "node"
+	}
+	httpAddr := ":" + conf.HTTPPort()
+	if conf.HTTPSOnly() {
+		httpAddr = "disabled"
+	}
+	httpsAddr := "disabled"
+	tlsStatus := "disabled"
+	if conf.TLSEnabled() {
+		httpsAddr = ":" + conf.HTTPSPort()
+		tlsStatus = "enabled"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", version.GetVersion())
+	fmt.Fprintf(&b, "  mode:   %s\n", mode)
+	fmt.Fprintf(&b, "  domain: %s\n", conf.Domain())
+	fmt.Fprintf(&b, "  ssh:    :%s\n", conf.SSHPort())
+	fmt.Fprintf(&b, "  http:   %s\n", httpAddr)
+	fmt.Fprintf(&b, "  https:  %s\n", httpsAddr)
+	fmt.Fprintf(&b, "  tls:    %s\n", tlsStatus)
+	return b.String()
+}
+
 func (b *Bootstrap) Run() error {
-	sshConfig, err := newSSHConfig(b.Config.KeyLoc())
+	sshConfig, err := newSSHConfig(b.Config.KeyLoc(), b.Config.SSHHostKey())
 	if err != nil {
 		return fmt.Errorf("failed to create SSH config: %w", err)
 	}
@@ -169,10 +211,13 @@ func (b *Bootstrap) Run() error {
 		}(b.GrpcClient)
 	}
 
-	go startHTTPServer(b.Config, b.SessionRegistry, b.ErrChan)
+	if !b.Config.HTTPSOnly() {
+		go startHTTPServer(b.Config, b.SessionRegistry, b.ErrChan)
+	}
 
 	if b.Config.TLSEnabled() {
 		go startHTTPSServer(b.Config, b.SessionRegistry, b.ErrChan)
+		defer transport.StopTLSManager()
 	}
 
 	go func() {
@@ -183,7 +228,14 @@ func (b *Bootstrap) Run() error {
 		go startPprof(b.Config.PprofPort(), b.ErrChan)
 	}
 
+	if interval := b.Config.RegistrySweepInterval(); interval > 0 {
+		go registry.NewSweeper(b.SessionRegistry, b.Port, interval).Run(ctx)
+	}
+
 	log.Println("All services started successfully")
+	if !b.Quiet {
+		fmt.Print(startupBanner(b.Config))
+	}
 
 	select {
 	case err = <-b.ErrChan:
@@ -2,6 +2,9 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"net/http"
@@ -16,9 +19,11 @@ import (
 	"tunnel_pls/internal/registry"
 	"tunnel_pls/internal/session/slug"
 	"tunnel_pls/internal/types"
+	"tunnel_pls/internal/version"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/ssh"
 	"google.golang.org/grpc"
 )
 
@@ -61,6 +66,11 @@ func (m *MockSessionRegistry) GetAllSessionFromUser(user string) []registry.Sess
 	return args.Get(0).([]registry.Session)
 }
 
+func (m *MockSessionRegistry) Sessions() map[registry.Key]registry.Session {
+	args := m.Called()
+	return args.Get(0).(map[registry.Key]registry.Session)
+}
+
 func (m *MockSessionRegistry) Slug() slug.Slug {
 	args := m.Called()
 	return args.Get(0).(slug.Slug)
@@ -79,23 +89,75 @@ type MockConfig struct {
 	mock.Mock
 }
 
-func (m *MockConfig) Domain() string            { return m.Called().String(0) }
-func (m *MockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *MockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *MockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *MockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *MockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *MockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *MockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *MockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) AllowedPortsStart() uint16 { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) AllowedPortsEnd() uint16   { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *MockConfig) PprofPort() string         { return m.Called().String(0) }
+func (m *MockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *MockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *MockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *MockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *MockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *MockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *MockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *MockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) TLSStoragePath() string           { return m.Called().String(0) }
+func (m *MockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *MockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *MockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *MockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *MockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *MockConfig) AllowedPortsStart() uint16        { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) AllowedPortsEnd() uint16          { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *MockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *MockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *MockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *MockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *MockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *MockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *MockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *MockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *MockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *MockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *MockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *MockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *MockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *MockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *MockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *MockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *MockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *MockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *MockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *MockConfig) PprofPort() string                    { return m.Called().String(0) }
 func (m *MockConfig) Mode() types.ServerMode {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -110,10 +172,30 @@ func (m *MockConfig) Mode() types.ServerMode {
 		return types.ServerMode(args.Int(0))
 	}
 }
-func (m *MockConfig) GRPCAddress() string { return m.Called().String(0) }
-func (m *MockConfig) GRPCPort() string    { return m.Called().String(0) }
-func (m *MockConfig) NodeToken() string   { return m.Called().String(0) }
-func (m *MockConfig) KeyLoc() string      { return m.Called().String(0) }
+func (m *MockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *MockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *MockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *MockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *MockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *MockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *MockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *MockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *MockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *MockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *MockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *MockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *MockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *MockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *MockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) KeyLoc() string                       { return m.Called().String(0) }
+func (m *MockConfig) SSHHostKey() string                   { return m.Called().String(0) }
 
 type MockPort struct {
 	mock.Mock
@@ -149,6 +231,13 @@ func (m *MockPort) SetStatus(port uint16, assigned bool) error {
 func (m *MockPort) Claim(port uint16) bool {
 	return m.Called(port).Bool(0)
 }
+func (m *MockPort) Assigned() []uint16 {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]uint16)
+}
 
 type MockGRPCClient struct {
 	mock.Mock
@@ -169,6 +258,11 @@ func (m *MockGRPCClient) CheckServerHealth(ctx context.Context) error {
 	return args.Error(0)
 }
 
+func (m *MockGRPCClient) WaitForServerHealth(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func (m *MockGRPCClient) SubscribeEvents(ctx context.Context, domain, token string) error {
 	args := m.Called(ctx, domain, token)
 	return args.Error(0)
@@ -256,6 +350,102 @@ func randomAvailablePort() (string, error) {
 	return strconv.Itoa(mPort), nil
 }
 
+func TestLoadHostKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.NoError(t, err)
+	hostKeyPEM := string(pem.EncodeToMemory(block))
+
+	expected, err := ssh.NewSignerFromKey(priv)
+	assert.NoError(t, err)
+
+	t.Run("uses key from SSH_HOST_KEY", func(t *testing.T) {
+		keyLoc := filepath.Join(t.TempDir(), "key.key")
+		t.Setenv("SSH_HOST_KEY", hostKeyPEM)
+
+		conf, err := config.MustLoad()
+		assert.NoError(t, err)
+		signer, err := loadHostKey(keyLoc, conf.SSHHostKey())
+		assert.NoError(t, err)
+		assert.Equal(t, expected.PublicKey().Marshal(), signer.PublicKey().Marshal())
+
+		_, err = os.Stat(keyLoc)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := loadHostKey(filepath.Join(t.TempDir(), "key.key"), "not a key")
+		assert.ErrorContains(t, err, "parse SSH_HOST_KEY")
+	})
+
+	t.Run("falls back to key file", func(t *testing.T) {
+		keyLoc := filepath.Join(t.TempDir(), "key.key")
+		assert.NoError(t, os.WriteFile(keyLoc, []byte(hostKeyPEM), 0o600))
+
+		signer, err := loadHostKey(keyLoc, "")
+		assert.NoError(t, err)
+		assert.Equal(t, expected.PublicKey().Marshal(), signer.PublicKey().Marshal())
+	})
+
+	t.Run("ssh config carries the host key", func(t *testing.T) {
+		sshCfg, err := newSSHConfig(filepath.Join(t.TempDir(), "key.key"), hostKeyPEM)
+		assert.NoError(t, err)
+		assert.NotNil(t, sshCfg)
+	})
+}
+
+func TestStartupBanner(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      types.ServerMode
+		tls       bool
+		httpsOnly bool
+		contains  []string
+	}{
+		{
+			name:     "standalone without tls",
+			mode:     types.ServerModeSTANDALONE,
+			contains: []string{"mode:   standalone", "http:   :8080", "https:  disabled", "tls:    disabled"},
+		},
+		{
+			name:     "node with tls",
+			mode:     types.ServerModeNODE,
+			tls:      true,
+			contains: []string{"mode:   node", "http:   :8080", "https:  :8443", "tls:    enabled"},
+		},
+		{
+			name:      "https only",
+			mode:      types.ServerModeSTANDALONE,
+			tls:       true,
+			httpsOnly: true,
+			contains:  []string{"http:   disabled", "https:  :8443"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockConfig.On("Mode").Return(tt.mode)
+			mockConfig.On("TLSEnabled").Return(tt.tls)
+			mockConfig.On("HTTPSOnly").Return(tt.httpsOnly)
+			mockConfig.On("HTTPSPort").Return("8443").Maybe()
+			mockConfig.On("Domain").Return("tunnel.example.com")
+			mockConfig.On("SSHPort").Return("2200")
+			mockConfig.On("HTTPPort").Return("8080")
+
+			banner := startupBanner(mockConfig)
+
+			assert.Contains(t, banner, version.GetVersion())
+			assert.Contains(t, banner, "domain: tunnel.example.com")
+			assert.Contains(t, banner, "ssh:    :2200")
+			for _, want := range tt.contains {
+				assert.Contains(t, banner, want)
+			}
+		})
+	}
+}
+
 func TestRun(t *testing.T) {
 	mockRandom := &MockRandom{}
 	mockErrChan := make(chan error, 1)
@@ -278,20 +468,65 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
+				mockConfig.On("ACMEEmail").Return("test@example.com")
+				mockConfig.On("CFAPIToken").Return("fake-token")
+				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
+				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
+				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
+				mockConfig.On("BufferSize").Return(4096)
+				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
+				mockConfig.On("PprofPort").Return("0")
+				mockConfig.On("GRPCAddress").Return("localhost")
+				mockConfig.On("GRPCPort").Return("0")
+				mockConfig.On("NodeToken").Return("fake-node-token")
+				return mockConfig
+			},
+			expectError: false,
+		},
+		{
+			name: "https-only does not open the http listener",
+			setupConfig: func() *MockConfig {
+				mockConfig := &MockConfig{}
+				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
+				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
+				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
+				mockConfig.On("SSHPort").Return("0")
+				mockConfig.On("HTTPPort").Return("invalid").Maybe()
+				mockConfig.On("HTTPSPort").Return("0")
+				mockConfig.On("TLSEnabled").Return(false)
+				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(true)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -305,20 +540,29 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("invalid")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -332,20 +576,29 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("invalid")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -360,21 +613,30 @@ func TestRun(t *testing.T) {
 				tempDir := os.TempDir()
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("invalid")
 				mockConfig.On("TLSEnabled").Return(true)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("TLSStoragePath").Return(tempDir)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -388,20 +650,29 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeNODE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("invalid")
@@ -410,7 +681,7 @@ func TestRun(t *testing.T) {
 			},
 			setupGrpcClient: func() *MockGRPCClient {
 				mockGRPCClient := &MockGRPCClient{}
-				mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(fmt.Errorf("health check failed"))
+				mockGRPCClient.On("WaitForServerHealth", mock.Anything).Return(fmt.Errorf("health check failed"))
 				return mockGRPCClient
 			},
 			expectError: true,
@@ -421,20 +692,29 @@ func TestRun(t *testing.T) {
 				mockConfig := &MockConfig{}
 				pprofPort, _ := randomAvailablePort()
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(true)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return(pprofPort)
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -447,20 +727,29 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeNODE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -469,7 +758,8 @@ func TestRun(t *testing.T) {
 			},
 			setupGrpcClient: func() *MockGRPCClient {
 				mockGRPCClient := &MockGRPCClient{}
-				mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(nil)
+				mockGRPCClient.On("WaitForServerHealth", mock.Anything).Return(nil)
+				mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(nil).Maybe()
 				mockGRPCClient.On("SubscribeEvents", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 				mockGRPCClient.On("Close").Return(nil)
 				return mockGRPCClient
@@ -480,20 +770,29 @@ func TestRun(t *testing.T) {
 			setupConfig: func() *MockConfig {
 				mockConfig := &MockConfig{}
 				mockConfig.On("KeyLoc").Return(keyLoc)
+				mockConfig.On("SSHHostKey").Return("").Maybe()
 				mockConfig.On("Mode").Return(types.ServerModeNODE)
 				mockConfig.On("Domain").Return("example.com")
+				mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+				mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+				mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("SSHPort").Return("0")
 				mockConfig.On("HTTPPort").Return("0")
 				mockConfig.On("HTTPSPort").Return("0")
 				mockConfig.On("TLSEnabled").Return(false)
 				mockConfig.On("TLSRedirect").Return(false)
+				mockConfig.On("HTTPSOnly").Return(false)
 				mockConfig.On("ACMEEmail").Return("test@example.com")
 				mockConfig.On("CFAPIToken").Return("fake-token")
 				mockConfig.On("ACMEStaging").Return(true)
+				mockConfig.On("ACMEDirectoryURL").Return("").Maybe()
+				mockConfig.On("ACMEHTTPPort").Return("")
 				mockConfig.On("AllowedPortsStart").Return(uint16(1024))
 				mockConfig.On("AllowedPortsEnd").Return(uint16(65535))
 				mockConfig.On("BufferSize").Return(4096)
 				mockConfig.On("PprofEnabled").Return(false)
+				mockConfig.On("RegistrySweepInterval").Return(time.Duration(0))
 				mockConfig.On("PprofPort").Return("0")
 				mockConfig.On("GRPCAddress").Return("localhost")
 				mockConfig.On("GRPCPort").Return("0")
@@ -502,7 +801,8 @@ func TestRun(t *testing.T) {
 			},
 			setupGrpcClient: func() *MockGRPCClient {
 				mockGRPCClient := &MockGRPCClient{}
-				mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(nil)
+				mockGRPCClient.On("WaitForServerHealth", mock.Anything).Return(nil)
+				mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(nil).Maybe()
 				mockGRPCClient.On("SubscribeEvents", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 				mockGRPCClient.On("Close").Return(fmt.Errorf("you fucked up, buddy"))
 				return mockGRPCClient
@@ -0,0 +1,98 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+	"tunnel_pls/internal/transport"
+	"tunnel_pls/internal/types"
+)
+
+type selfTestCheck struct {
+	name string
+	run  func() error
+}
+
+// SelfTest briefly binds every configured listener, checks that TLS can
+// serve a certificate for the domain and, in node mode, that the gRPC
+// server is healthy. It writes one PASS/FAIL line per check to w and
+// returns an error if any check failed.
+func (b *Bootstrap) SelfTest(w io.Writer) error {
+	checks := b.selfTestChecks()
+
+	failed := 0
+	for _, check := range checks {
+		if err := check.run(); err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "FAIL  %s: %v\n", check.name, err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "PASS  %s\n", check.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-test checks failed", failed, len(checks))
+	}
+	_, _ = fmt.Fprintf(w, "All %d self-test checks passed\n", len(checks))
+	return nil
+}
+
+func (b *Bootstrap) selfTestChecks() []selfTestCheck {
+	conf := b.Config
+	checks := []selfTestCheck{
+		{name: "ssh host key", run: func() error {
+			_, err := newSSHConfig(conf.KeyLoc(), conf.SSHHostKey())
+			return err
+		}},
+		{name: "ssh listener :" + conf.SSHPort(), run: bindCheck(":" + conf.SSHPort())},
+	}
+
+	if !conf.HTTPSOnly() {
+		checks = append(checks, selfTestCheck{name: "http listener :" + conf.HTTPPort(), run: bindCheck(":" + conf.HTTPPort())})
+	}
+	if conf.TLSEnabled() {
+		checks = append(checks, selfTestCheck{name: "https listener :" + conf.HTTPSPort(), run: bindCheck(":" + conf.HTTPSPort())})
+		if acmePort := conf.ACMEHTTPPort(); acmePort != "" {
+			checks = append(checks, selfTestCheck{name: "acme challenge listener :" + acmePort, run: bindCheck(":" + acmePort)})
+		}
+		checks = append(checks, selfTestCheck{name: "tls certificate for " + conf.Domain(), run: b.checkTLSCertificate})
+	}
+	if conf.PprofEnabled() {
+		checks = append(checks, selfTestCheck{name: "pprof listener localhost:" + conf.PprofPort(), run: bindCheck("localhost:" + conf.PprofPort())})
+	}
+	if conf.Mode() == types.ServerModeNODE {
+		checks = append(checks, selfTestCheck{name: "grpc health", run: b.checkGRPCHealth})
+	}
+
+	return checks
+}
+
+func bindCheck(addr string) func() error {
+	return func() error {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return ln.Close()
+	}
+}
+
+func (b *Bootstrap) checkTLSCertificate() error {
+	tlsCfg, err := transport.NewTLSConfig(b.Config)
+	if err != nil {
+		return err
+	}
+	defer transport.StopTLSManager()
+
+	_, err = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: b.Config.Domain()})
+	return err
+}
+
+func (b *Bootstrap) checkGRPCHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return b.GrpcClient.CheckServerHealth(ctx)
+}
@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer func() {
+		_ = busy.Close()
+	}()
+	busyPort := fmt.Sprint(busy.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name      string
+		mode      types.ServerMode
+		sshPort   string
+		httpsOnly bool
+		health    error
+		wantErr   bool
+		contains  []string
+	}{
+		{
+			name:     "valid config passes",
+			mode:     types.ServerModeSTANDALONE,
+			sshPort:  "0",
+			contains: []string{"PASS  ssh host key", "PASS  ssh listener :0", "PASS  http listener :0", "All 3 self-test checks passed"},
+		},
+		{
+			name:     "busy port fails",
+			mode:     types.ServerModeSTANDALONE,
+			sshPort:  busyPort,
+			wantErr:  true,
+			contains: []string{"FAIL  ssh listener :" + busyPort, "PASS  http listener :0"},
+		},
+		{
+			name:      "https only skips the http listener",
+			mode:      types.ServerModeSTANDALONE,
+			sshPort:   "0",
+			httpsOnly: true,
+			contains:  []string{"PASS  ssh listener :0", "All 2 self-test checks passed"},
+		},
+		{
+			name:     "unhealthy grpc server fails in node mode",
+			mode:     types.ServerModeNODE,
+			sshPort:  "0",
+			health:   fmt.Errorf("connection refused"),
+			wantErr:  true,
+			contains: []string{"FAIL  grpc health: connection refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockConfig.On("KeyLoc").Return(filepath.Join(t.TempDir(), "key.key"))
+			mockConfig.On("SSHHostKey").Return("")
+			mockConfig.On("SSHPort").Return(tt.sshPort)
+			mockConfig.On("HTTPPort").Return("0").Maybe()
+			mockConfig.On("HTTPSOnly").Return(tt.httpsOnly)
+			mockConfig.On("TLSEnabled").Return(false)
+			mockConfig.On("PprofEnabled").Return(false)
+			mockConfig.On("Mode").Return(tt.mode)
+
+			mockGRPCClient := &MockGRPCClient{}
+			mockGRPCClient.On("CheckServerHealth", mock.Anything).Return(tt.health).Maybe()
+
+			b := &Bootstrap{Config: mockConfig, GrpcClient: mockGRPCClient}
+
+			var report bytes.Buffer
+			err := b.SelfTest(&report)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			for _, want := range tt.contains {
+				assert.Contains(t, report.String(), want)
+			}
+			if tt.httpsOnly {
+				assert.NotContains(t, report.String(), "http listener")
+			}
+		})
+	}
+}
@@ -1,32 +1,78 @@
 package config
 
 import (
+	"time"
 	"tunnel_pls/internal/types"
 )
 
 type Config interface {
 	Domain() string
+	Domains() []string
 	FrontendURL() string
+	CustomDomains() map[string]string
 	SSHPort() string
 
 	HTTPPort() string
 	HTTPSPort() string
 
 	KeyLoc() string
+	SSHHostKey() string
 
 	TLSEnabled() bool
 	TLSRedirect() bool
+	HTTPSOnly() bool
 	TLSStoragePath() string
 
 	ACMEEmail() string
 	CFAPIToken() string
 	ACMEStaging() bool
+	ACMEDirectoryURL() string
+	ACMEHTTPPort() string
+	CertRenewBeforeDays() int
 
 	AllowedPortsStart() uint16
 	AllowedPortsEnd() uint16
+	TCPEnabled() bool
+	UDPEnabled() bool
+	DirectTCPIPEnabled() bool
+	DirectTCPIPAllowlist() []string
+	HTTPForwardPorts() []uint16
+	DefaultTunnelType() types.TunnelType
+	InvalidHostAction() types.HostAction
+	SlugCollisionPolicy() types.CollisionPolicy
 
 	BufferSize() int
+	ResponseWriteBuffer() int
 	HeaderSize() int
+	MaxResponseHeaderSize() int
+	MaxRequestLineSize() int
+	MaxURILength() int
+	HeaderReadTimeout() time.Duration
+	BadGatewayPage() string
+	MaintenanceMode() bool
+	MaintenancePage() string
+	WelcomeURL() string
+	MaxInteractiveSessions() int
+	InteractiveKeepalive() time.Duration
+	ComingSoonDisabled() bool
+	RandomKeybindingDisabled() bool
+	MaxForwardedChannels() int
+	ChannelOpenQueue() int
+	ChannelOpenQueueTimeout() time.Duration
+	TCPByteBudget() int64
+	UDPByteBudget() int64
+	NodeBandwidthLimit() int64
+	TCPInitialReadTimeout() time.Duration
+	TCPKeepAliveInterval() time.Duration
+	TCPKeepAliveCount() int
+	SlugChangeCooldown() time.Duration
+	SlugReuseGrace() time.Duration
+	MaxSlugLength() int
+	RequireStrongSlugs() bool
+	RequireTLSForAdmin() bool
+	MaxConcurrentAccepts() int
+	MaxConcurrentTLSHandshakes() int
+	MaxRequestsPerIP() int
 
 	PprofEnabled() bool
 	PprofPort() string
@@ -35,6 +81,25 @@ type Config interface {
 	GRPCAddress() string
 	GRPCPort() string
 	NodeToken() string
+	NodeTokenFile() string
+	NodeID() string
+	NodeRegion() string
+	ServedByHeader() bool
+	WhoamiEnabled() bool
+	MetadataToken() string
+	TunnelEventsWebhook() string
+	TunnelURLBanner() bool
+	LogConnections() bool
+	LogTunnelType() bool
+	AccessLogSampleRate() float64
+	TunnelLogDir() string
+	TunnelLogMaxSize() int64
+	GRPCInitialBackoff() time.Duration
+	GRPCBackoffMultiplier() float64
+	GRPCMaxBackoff() time.Duration
+	GRPCEventConcurrency() int
+	GRPCHealthRetries() int
+	RegistrySweepInterval() time.Duration
 }
 
 func MustLoad() (Config, error) {
@@ -50,25 +115,102 @@ func MustLoad() (Config, error) {
 	return cfg, nil
 }
 
-func (c *config) Domain() string            { return c.domain }
-func (c *config) FrontendURL() string       { return c.frontendURL }
-func (c *config) SSHPort() string           { return c.sshPort }
-func (c *config) HTTPPort() string          { return c.httpPort }
-func (c *config) HTTPSPort() string         { return c.httpsPort }
-func (c *config) KeyLoc() string            { return c.keyLoc }
-func (c *config) TLSEnabled() bool          { return c.tlsEnabled }
-func (c *config) TLSRedirect() bool         { return c.tlsRedirect }
-func (c *config) TLSStoragePath() string    { return c.tlsStoragePath }
-func (c *config) ACMEEmail() string         { return c.acmeEmail }
-func (c *config) CFAPIToken() string        { return c.cfAPIToken }
-func (c *config) ACMEStaging() bool         { return c.acmeStaging }
-func (c *config) AllowedPortsStart() uint16 { return c.allowedPortsStart }
-func (c *config) AllowedPortsEnd() uint16   { return c.allowedPortsEnd }
-func (c *config) BufferSize() int           { return c.bufferSize }
-func (c *config) HeaderSize() int           { return c.headerSize }
-func (c *config) PprofEnabled() bool        { return c.pprofEnabled }
-func (c *config) PprofPort() string         { return c.pprofPort }
-func (c *config) Mode() types.ServerMode    { return c.mode }
-func (c *config) GRPCAddress() string       { return c.grpcAddress }
-func (c *config) GRPCPort() string          { return c.grpcPort }
-func (c *config) NodeToken() string         { return c.nodeToken }
+func (c *config) Domain() string                             { return c.domain }
+func (c *config) Domains() []string                          { return c.domains }
+func (c *config) FrontendURL() string                        { return c.frontendURL }
+func (c *config) CustomDomains() map[string]string           { return c.customDomains }
+func (c *config) SSHPort() string                            { return c.sshPort }
+func (c *config) HTTPPort() string                           { return c.httpPort }
+func (c *config) HTTPSPort() string                          { return c.httpsPort }
+func (c *config) KeyLoc() string                             { return c.keyLoc }
+func (c *config) SSHHostKey() string                         { return c.sshHostKey }
+func (c *config) TLSEnabled() bool                           { return c.tlsEnabled }
+func (c *config) TLSRedirect() bool                          { return c.tlsRedirect }
+func (c *config) HTTPSOnly() bool                            { return c.httpsOnly }
+func (c *config) TLSStoragePath() string                     { return c.tlsStoragePath }
+func (c *config) ACMEEmail() string                          { return c.acmeEmail }
+func (c *config) CFAPIToken() string                         { return c.cfAPIToken }
+func (c *config) ACMEStaging() bool                          { return c.acmeStaging }
+func (c *config) ACMEDirectoryURL() string                   { return c.acmeDirectoryURL }
+func (c *config) ACMEHTTPPort() string                       { return c.acmeHTTPPort }
+func (c *config) CertRenewBeforeDays() int                   { return c.certRenewBeforeDays }
+func (c *config) AllowedPortsStart() uint16                  { return c.allowedPortsStart }
+func (c *config) AllowedPortsEnd() uint16                    { return c.allowedPortsEnd }
+func (c *config) TCPEnabled() bool                           { return c.tcpEnabled }
+func (c *config) UDPEnabled() bool                           { return c.udpEnabled }
+func (c *config) DirectTCPIPEnabled() bool                   { return c.directTCPIPEnabled }
+func (c *config) DirectTCPIPAllowlist() []string             { return c.directTCPIPAllowlist }
+func (c *config) HTTPForwardPorts() []uint16                 { return c.httpForwardPorts }
+func (c *config) DefaultTunnelType() types.TunnelType        { return c.defaultTunnelType }
+func (c *config) InvalidHostAction() types.HostAction        { return c.invalidHostAction }
+func (c *config) SlugCollisionPolicy() types.CollisionPolicy { return c.slugCollisionPolicy }
+func (c *config) BufferSize() int                            { return c.bufferSize }
+func (c *config) ResponseWriteBuffer() int                   { return c.responseWriteBuffer }
+func (c *config) HeaderSize() int                            { return c.headerSize }
+func (c *config) MaxResponseHeaderSize() int                 { return c.maxRespHeaderSize }
+func (c *config) MaxRequestLineSize() int                    { return c.maxRequestLineSize }
+func (c *config) MaxURILength() int                          { return c.maxURILength }
+func (c *config) HeaderReadTimeout() time.Duration           { return c.headerReadTimeout }
+func (c *config) BadGatewayPage() string                     { return c.badGatewayPage }
+func (c *config) MaintenanceMode() bool                      { return c.maintenanceMode }
+func (c *config) MaintenancePage() string                    { return c.maintenancePage }
+func (c *config) WelcomeURL() string                         { return c.welcomeURL }
+func (c *config) MaxInteractiveSessions() int                { return c.maxInteractiveSessions }
+func (c *config) InteractiveKeepalive() time.Duration        { return c.interactiveKeepalive }
+func (c *config) ComingSoonDisabled() bool                   { return c.comingSoonDisabled }
+func (c *config) RandomKeybindingDisabled() bool             { return c.randomKeybindingDisabled }
+func (c *config) MaxForwardedChannels() int                  { return c.maxForwardedChannels }
+func (c *config) ChannelOpenQueue() int                      { return c.channelOpenQueue }
+func (c *config) ChannelOpenQueueTimeout() time.Duration     { return c.channelOpenQueueTimeout }
+func (c *config) TCPByteBudget() int64                       { return c.tcpByteBudget }
+func (c *config) UDPByteBudget() int64                       { return c.udpByteBudget }
+func (c *config) NodeBandwidthLimit() int64                  { return c.nodeBandwidthLimit }
+func (c *config) TCPInitialReadTimeout() time.Duration       { return c.tcpInitialReadTimeout }
+func (c *config) TCPKeepAliveInterval() time.Duration        { return c.tcpKeepAliveInterval }
+func (c *config) TCPKeepAliveCount() int                     { return c.tcpKeepAliveCount }
+func (c *config) SlugChangeCooldown() time.Duration          { return c.slugChangeCooldown }
+func (c *config) SlugReuseGrace() time.Duration              { return c.slugReuseGrace }
+func (c *config) MaxSlugLength() int                         { return c.maxSlugLength }
+func (c *config) RequireStrongSlugs() bool                   { return c.requireStrongSlugs }
+func (c *config) RequireTLSForAdmin() bool                   { return c.requireTLSForAdmin }
+func (c *config) MaxConcurrentAccepts() int                  { return c.maxConcurrentAccepts }
+func (c *config) MaxConcurrentTLSHandshakes() int            { return c.maxConcurrentTLSHandshakes }
+func (c *config) MaxRequestsPerIP() int                      { return c.maxRequestsPerIP }
+func (c *config) PprofEnabled() bool                         { return c.pprofEnabled }
+func (c *config) PprofPort() string                          { return c.pprofPort }
+func (c *config) Mode() types.ServerMode                     { return c.mode }
+func (c *config) GRPCAddress() string                        { return c.grpcAddress }
+func (c *config) GRPCPort() string                           { return c.grpcPort }
+func (c *config) NodeToken() string                          { return c.nodeToken }
+func (c *config) NodeTokenFile() string                      { return c.nodeTokenFile }
+func (c *config) NodeID() string                             { return c.nodeID }
+func (c *config) NodeRegion() string                         { return c.nodeRegion }
+func (c *config) ServedByHeader() bool                       { return c.servedByHeader }
+func (c *config) WhoamiEnabled() bool                        { return c.whoamiEnabled }
+func (c *config) MetadataToken() string                      { return c.metadataToken }
+func (c *config) TunnelEventsWebhook() string                { return c.tunnelEventsWebhook }
+func (c *config) TunnelURLBanner() bool                      { return c.tunnelURLBanner }
+func (c *config) LogConnections() bool                       { return c.logConnections }
+func (c *config) LogTunnelType() bool                        { return c.logTunnelType }
+func (c *config) AccessLogSampleRate() float64               { return c.accessLogSampleRate }
+func (c *config) TunnelLogDir() string                       { return c.tunnelLogDir }
+func (c *config) TunnelLogMaxSize() int64                    { return c.tunnelLogMaxSize }
+func (c *config) GRPCInitialBackoff() time.Duration          { return c.grpcInitialBackoff }
+func (c *config) GRPCBackoffMultiplier() float64             { return c.grpcBackoffMultiplier }
+func (c *config) GRPCMaxBackoff() time.Duration              { return c.grpcMaxBackoff }
+func (c *config) GRPCEventConcurrency() int                  { return c.grpcEventConcurrency }
+func (c *config) GRPCHealthRetries() int                     { return c.grpcHealthRetries }
+func (c *config) RegistrySweepInterval() time.Duration       { return c.registrySweepInterval }
+
+func TunnelDomain(c Config) string {
+	if region := c.NodeRegion(); region != "" {
+		return region + "." + c.Domain()
+	}
+	return c.Domain()
+}
+
+// RandomSlugLength is the length of generated slugs: 20 characters, or
+// MAX_SLUG_LENGTH when that is shorter.
+func RandomSlugLength(c Config) int {
+	return min(20, c.MaxSlugLength())
+}
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"tunnel_pls/internal/types"
 
 	"github.com/joho/godotenv"
@@ -13,34 +19,104 @@ import (
 
 type config struct {
 	domain      string
+	domains     []string
 	frontendURL string
 	sshPort     string
 
+	customDomains map[string]string
+
 	httpPort  string
 	httpsPort string
 
-	keyLoc string
-
-	tlsEnabled     bool
-	tlsRedirect    bool
-	tlsStoragePath string
-	acmeEmail      string
-	cfAPIToken     string
-	acmeStaging    bool
-
-	allowedPortsStart uint16
-	allowedPortsEnd   uint16
-
-	bufferSize int
-	headerSize int
+	keyLoc     string
+	sshHostKey string
+
+	tlsEnabled       bool
+	tlsRedirect      bool
+	httpsOnly        bool
+	tlsStoragePath   string
+	acmeEmail        string
+	cfAPIToken       string
+	acmeStaging      bool
+	acmeDirectoryURL string
+	acmeHTTPPort     string
+
+	certRenewBeforeDays int
+
+	allowedPortsStart    uint16
+	allowedPortsEnd      uint16
+	tcpEnabled           bool
+	udpEnabled           bool
+	directTCPIPEnabled   bool
+	directTCPIPAllowlist []string
+	httpForwardPorts     []uint16
+	defaultTunnelType    types.TunnelType
+	invalidHostAction    types.HostAction
+	slugCollisionPolicy  types.CollisionPolicy
+
+	bufferSize          int
+	responseWriteBuffer int
+	headerSize          int
+	maxRespHeaderSize   int
+	maxRequestLineSize  int
+	maxURILength        int
+	headerReadTimeout   time.Duration
+	badGatewayPage      string
+	maintenanceMode     bool
+	maintenancePage     string
+	welcomeURL          string
+
+	maxInteractiveSessions     int
+	interactiveKeepalive       time.Duration
+	comingSoonDisabled         bool
+	randomKeybindingDisabled   bool
+	maxForwardedChannels       int
+	channelOpenQueue           int
+	channelOpenQueueTimeout    time.Duration
+	tcpByteBudget              int64
+	udpByteBudget              int64
+	nodeBandwidthLimit         int64
+	tcpInitialReadTimeout      time.Duration
+	tcpKeepAliveInterval       time.Duration
+	tcpKeepAliveCount          int
+	slugChangeCooldown         time.Duration
+	slugReuseGrace             time.Duration
+	maxSlugLength              int
+	requireStrongSlugs         bool
+	requireTLSForAdmin         bool
+	maxConcurrentAccepts       int
+	maxConcurrentTLSHandshakes int
+	maxRequestsPerIP           int
 
 	pprofEnabled bool
 	pprofPort    string
 
-	mode        types.ServerMode
-	grpcAddress string
-	grpcPort    string
-	nodeToken   string
+	mode          types.ServerMode
+	grpcAddress   string
+	grpcPort      string
+	nodeToken     string
+	nodeTokenFile string
+
+	nodeID              string
+	nodeRegion          string
+	servedByHeader      bool
+	whoamiEnabled       bool
+	metadataToken       string
+	tunnelEventsWebhook string
+	tunnelURLBanner     bool
+	logConnections      bool
+	logTunnelType       bool
+	accessLogSampleRate float64
+	tunnelLogDir        string
+	tunnelLogMaxSize    int64
+
+	grpcInitialBackoff    time.Duration
+	grpcBackoffMultiplier float64
+	grpcMaxBackoff        time.Duration
+	grpcEventConcurrency  int
+	grpcHealthRetries     int
+
+	registrySweepInterval time.Duration
 }
 
 func parse() (*config, error) {
@@ -50,33 +126,117 @@ func parse() (*config, error) {
 	}
 
 	domain := getenv("DOMAIN", "localhost")
+	domains, err := parseDomains(domain)
+	if err != nil {
+		return nil, err
+	}
 	frontendURL := getenv("FRONTEND_URL", "https://"+domain)
 	sshPort := getenv("PORT", "2200")
 
+	customDomains, err := parseCustomDomains()
+	if err != nil {
+		return nil, err
+	}
+
 	httpPort := getenv("HTTP_PORT", "8080")
 	httpsPort := getenv("HTTPS_PORT", "8443")
 
 	keyLoc := getenv("KEY_LOC", "certs/privkey.pem")
+	sshHostKey, err := parseSSHHostKey()
+	if err != nil {
+		return nil, err
+	}
 
 	tlsEnabled := getenvBool("TLS_ENABLED", false)
 	tlsRedirect := tlsEnabled && getenvBool("TLS_REDIRECT", false)
+	httpsOnly := tlsEnabled && getenvBool("HTTPS_ONLY", false)
 	tlsStoragePath := getenv("TLS_STORAGE_PATH", "certs/tls/")
 
 	acmeEmail := getenv("ACME_EMAIL", "admin@"+domain)
 	acmeStaging := getenvBool("ACME_STAGING", false)
+	acmeDirectoryURL, err := parseACMEDirectoryURL()
+	if err != nil {
+		return nil, err
+	}
+	acmeHTTPPort, err := parseACMEHTTPPort()
+	if err != nil {
+		return nil, err
+	}
+	certRenewBeforeDays := parseCertRenewBeforeDays()
 
 	cfToken := getenv("CF_API_TOKEN", "")
-	if tlsEnabled && cfToken == "" {
-		return nil, fmt.Errorf("CF_API_TOKEN is required when TLS is enabled")
+	if tlsEnabled && cfToken == "" && acmeHTTPPort == "" {
+		return nil, fmt.Errorf("CF_API_TOKEN or ACME_HTTP_PORT is required when TLS is enabled")
 	}
 
 	start, end, err := parseAllowedPorts()
 	if err != nil {
 		return nil, err
 	}
+	tcpEnabled := getenvBool("TCP_ENABLED", true) && !strings.EqualFold(getenv("ALLOWED_PORTS", ""), "none")
+	udpEnabled := getenvBool("UDP_ENABLED", true) && !strings.EqualFold(getenv("ALLOWED_PORTS", ""), "none")
+	directTCPIPEnabled := getenvBool("DIRECT_TCPIP_ENABLED", false)
+	directTCPIPAllowlist, err := parseDirectTCPIPAllowlist()
+	if err != nil {
+		return nil, err
+	}
+
+	httpForwardPorts, err := parseHTTPForwardPorts()
+	if err != nil {
+		return nil, err
+	}
+	defaultTunnelType, err := parseDefaultTunnelType()
+	if err != nil {
+		return nil, err
+	}
+	invalidHostAction, err := parseInvalidHostAction()
+	if err != nil {
+		return nil, err
+	}
+	slugCollisionPolicy, err := parseSlugCollisionPolicy()
+	if err != nil {
+		return nil, err
+	}
 
 	bufferSize := parseBufferSize()
+	responseWriteBuffer := parseResponseWriteBuffer()
 	headerSize := parseHeaderSize()
+	maxRespHeaderSize := parseMaxResponseHeaderSize()
+	maxRequestLineSize := parseMaxRequestLineSize()
+	maxURILength := parseMaxURILength()
+	headerReadTimeout := parseHeaderReadTimeout()
+	badGatewayPage, err := parseBadGatewayPage()
+	if err != nil {
+		return nil, err
+	}
+	maintenanceMode := getenvBool("MAINTENANCE_MODE", false)
+	maintenancePage, err := parseMaintenancePage()
+	if err != nil {
+		return nil, err
+	}
+	welcomeURL, err := parseWelcomeURL()
+	if err != nil {
+		return nil, err
+	}
+	maxInteractiveSessions := parseMaxInteractiveSessions()
+	interactiveKeepalive := parseInteractiveKeepalive()
+	comingSoonDisabled := getenvBool("COMING_SOON_DISABLED", false)
+	randomKeybindingDisabled := getenvBool("RANDOM_KEYBINDING_DISABLED", false)
+	maxForwardedChannels := parseMaxForwardedChannels()
+	channelOpenQueue, channelOpenQueueTimeout := parseChannelOpenQueue()
+	tcpByteBudget := parseTCPByteBudget()
+	udpByteBudget := parseUDPByteBudget()
+	nodeBandwidthLimit := parseNodeBandwidthLimit()
+	tcpInitialReadTimeout := parseTCPInitialReadTimeout()
+	tcpKeepAliveInterval, tcpKeepAliveCount := parseTCPKeepAlive()
+	slugChangeCooldown := parseSlugChangeCooldown()
+	slugReuseGrace := parseSlugReuseGrace()
+	maxSlugLength := parseMaxSlugLength()
+	requireStrongSlugs := getenvBool("REQUIRE_STRONG_SLUGS", false)
+	requireTLSForAdmin := getenvBool("REQUIRE_TLS_FOR_ADMIN", false)
+	maxConcurrentAccepts := parseMaxConcurrentAccepts()
+	maxConcurrentTLSHandshakes := parseMaxConcurrentTLSHandshakes()
+	maxRequestsPerIP := parseMaxRequestsPerIP()
 
 	pprofEnabled := getenvBool("PPROF_ENABLED", false)
 	pprofPort := getenv("PPROF_PORT", "6060")
@@ -84,35 +244,159 @@ func parse() (*config, error) {
 	grpcHost := getenv("GRPC_ADDRESS", "localhost")
 	grpcPort := getenv("GRPC_PORT", "8080")
 
-	nodeToken := getenv("NODE_TOKEN", "")
+	nodeToken, nodeTokenFile, err := parseNodeToken()
+	if err != nil {
+		return nil, err
+	}
 	if mode == types.ServerModeNODE && nodeToken == "" {
-		return nil, fmt.Errorf("NODE_TOKEN is required in node mode")
-	}
-
-	return &config{
-		domain:            domain,
-		frontendURL:       frontendURL,
-		sshPort:           sshPort,
-		httpPort:          httpPort,
-		httpsPort:         httpsPort,
-		keyLoc:            keyLoc,
-		tlsEnabled:        tlsEnabled,
-		tlsRedirect:       tlsRedirect,
-		tlsStoragePath:    tlsStoragePath,
-		acmeEmail:         acmeEmail,
-		cfAPIToken:        cfToken,
-		acmeStaging:       acmeStaging,
-		allowedPortsStart: start,
-		allowedPortsEnd:   end,
-		bufferSize:        bufferSize,
-		headerSize:        headerSize,
-		pprofEnabled:      pprofEnabled,
-		pprofPort:         pprofPort,
-		mode:              mode,
-		grpcAddress:       grpcHost,
-		grpcPort:          grpcPort,
-		nodeToken:         nodeToken,
-	}, nil
+		return nil, fmt.Errorf("NODE_TOKEN or NODE_TOKEN_FILE is required in node mode")
+	}
+
+	nodeID := getenv("NODE_ID", defaultNodeID())
+	nodeRegion, err := parseNodeRegion()
+	if err != nil {
+		return nil, err
+	}
+	servedByHeader := getenvBool("SERVED_BY_HEADER", false)
+	whoamiEnabled := getenvBool("WHOAMI_ENABLED", false)
+	metadataToken := getenv("METADATA_TOKEN", "")
+	tunnelEventsWebhook := getenv("TUNNEL_EVENTS_WEBHOOK", "")
+	tunnelURLBanner := getenvBool("TUNNEL_URL_BANNER", false)
+	logConnections := getenvBool("LOG_CONNECTIONS", false)
+	logTunnelType := getenvBool("LOG_TUNNEL_TYPE", false)
+	accessLogSampleRate := parseAccessLogSampleRate()
+	tunnelLogDir := getenv("TUNNEL_LOG_DIR", "")
+	tunnelLogMaxSize := parseTunnelLogMaxSize()
+
+	grpcInitialBackoff, grpcBackoffMultiplier, grpcMaxBackoff, err := parseGRPCBackoff()
+	if err != nil {
+		return nil, err
+	}
+	grpcEventConcurrency := parseGRPCEventConcurrency()
+	grpcHealthRetries := parseGRPCHealthRetries()
+	registrySweepInterval := parseRegistrySweepInterval()
+
+	cfg := &config{
+		domain:                     domain,
+		frontendURL:                frontendURL,
+		sshPort:                    sshPort,
+		domains:                    domains,
+		customDomains:              customDomains,
+		httpPort:                   httpPort,
+		httpsPort:                  httpsPort,
+		keyLoc:                     keyLoc,
+		sshHostKey:                 sshHostKey,
+		tlsEnabled:                 tlsEnabled,
+		tlsRedirect:                tlsRedirect,
+		httpsOnly:                  httpsOnly,
+		tlsStoragePath:             tlsStoragePath,
+		acmeEmail:                  acmeEmail,
+		cfAPIToken:                 cfToken,
+		acmeStaging:                acmeStaging,
+		acmeDirectoryURL:           acmeDirectoryURL,
+		acmeHTTPPort:               acmeHTTPPort,
+		certRenewBeforeDays:        certRenewBeforeDays,
+		allowedPortsStart:          start,
+		allowedPortsEnd:            end,
+		tcpEnabled:                 tcpEnabled,
+		udpEnabled:                 udpEnabled,
+		directTCPIPEnabled:         directTCPIPEnabled,
+		directTCPIPAllowlist:       directTCPIPAllowlist,
+		httpForwardPorts:           httpForwardPorts,
+		defaultTunnelType:          defaultTunnelType,
+		invalidHostAction:          invalidHostAction,
+		slugCollisionPolicy:        slugCollisionPolicy,
+		bufferSize:                 bufferSize,
+		responseWriteBuffer:        responseWriteBuffer,
+		headerSize:                 headerSize,
+		maxRespHeaderSize:          maxRespHeaderSize,
+		maxRequestLineSize:         maxRequestLineSize,
+		maxURILength:               maxURILength,
+		headerReadTimeout:          headerReadTimeout,
+		badGatewayPage:             badGatewayPage,
+		maintenanceMode:            maintenanceMode,
+		maintenancePage:            maintenancePage,
+		welcomeURL:                 welcomeURL,
+		maxInteractiveSessions:     maxInteractiveSessions,
+		interactiveKeepalive:       interactiveKeepalive,
+		comingSoonDisabled:         comingSoonDisabled,
+		randomKeybindingDisabled:   randomKeybindingDisabled,
+		maxForwardedChannels:       maxForwardedChannels,
+		channelOpenQueue:           channelOpenQueue,
+		channelOpenQueueTimeout:    channelOpenQueueTimeout,
+		tcpByteBudget:              tcpByteBudget,
+		udpByteBudget:              udpByteBudget,
+		nodeBandwidthLimit:         nodeBandwidthLimit,
+		tcpInitialReadTimeout:      tcpInitialReadTimeout,
+		tcpKeepAliveInterval:       tcpKeepAliveInterval,
+		tcpKeepAliveCount:          tcpKeepAliveCount,
+		slugChangeCooldown:         slugChangeCooldown,
+		slugReuseGrace:             slugReuseGrace,
+		maxSlugLength:              maxSlugLength,
+		requireStrongSlugs:         requireStrongSlugs,
+		requireTLSForAdmin:         requireTLSForAdmin,
+		maxConcurrentAccepts:       maxConcurrentAccepts,
+		maxConcurrentTLSHandshakes: maxConcurrentTLSHandshakes,
+		maxRequestsPerIP:           maxRequestsPerIP,
+		pprofEnabled:               pprofEnabled,
+		pprofPort:                  pprofPort,
+		mode:                       mode,
+		grpcAddress:                grpcHost,
+		grpcPort:                   grpcPort,
+		nodeToken:                  nodeToken,
+		nodeTokenFile:              nodeTokenFile,
+		nodeID:                     nodeID,
+		nodeRegion:                 nodeRegion,
+		servedByHeader:             servedByHeader,
+		whoamiEnabled:              whoamiEnabled,
+		metadataToken:              metadataToken,
+		tunnelEventsWebhook:        tunnelEventsWebhook,
+		tunnelURLBanner:            tunnelURLBanner,
+		logConnections:             logConnections,
+		logTunnelType:              logTunnelType,
+		accessLogSampleRate:        accessLogSampleRate,
+		tunnelLogDir:               tunnelLogDir,
+		tunnelLogMaxSize:           tunnelLogMaxSize,
+		grpcInitialBackoff:         grpcInitialBackoff,
+		grpcBackoffMultiplier:      grpcBackoffMultiplier,
+		grpcMaxBackoff:             grpcMaxBackoff,
+		grpcEventConcurrency:       grpcEventConcurrency,
+		grpcHealthRetries:          grpcHealthRetries,
+		registrySweepInterval:      registrySweepInterval,
+	}
+	if err = validatePorts(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func validatePorts(c *config) error {
+	type listener struct {
+		name string
+		port string
+	}
+	listeners := []listener{{"PORT", c.sshPort}}
+	if !c.httpsOnly {
+		listeners = append(listeners, listener{"HTTP_PORT", c.httpPort})
+	}
+	if c.tlsEnabled {
+		listeners = append(listeners, listener{"HTTPS_PORT", c.httpsPort})
+		if c.acmeHTTPPort != "" {
+			listeners = append(listeners, listener{"ACME_HTTP_PORT", c.acmeHTTPPort})
+		}
+	}
+	if c.pprofEnabled {
+		listeners = append(listeners, listener{"PPROF_PORT", c.pprofPort})
+	}
+
+	seen := make(map[string]string, len(listeners))
+	for _, l := range listeners {
+		if other, ok := seen[l.port]; ok {
+			return fmt.Errorf("port conflict: %s and %s both use port %s", other, l.name, l.port)
+		}
+		seen[l.port] = l.name
+	}
+	return nil
 }
 
 func loadEnvFile() error {
@@ -133,9 +417,94 @@ func parseMode() (types.ServerMode, error) {
 	}
 }
 
+func parseDomains(primary string) ([]string, error) {
+	domains := []string{strings.ToLower(primary)}
+	for _, raw := range strings.Split(getenv("DOMAINS", ""), ",") {
+		domain := strings.ToLower(strings.TrimSpace(raw))
+		if domain == "" || slices.Contains(domains, domain) {
+			continue
+		}
+		if strings.ContainsAny(domain, "/:*") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+			return nil, fmt.Errorf("invalid DOMAINS entry %q", raw)
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+func parseCustomDomains() (map[string]string, error) {
+	domains := make(map[string]string)
+	raw := getenv("CUSTOM_DOMAINS", "")
+	if raw == "" {
+		return domains, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, slug, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		slug = strings.TrimSpace(slug)
+		if !ok || host == "" || slug == "" {
+			return nil, fmt.Errorf("invalid CUSTOM_DOMAINS entry %q", entry)
+		}
+		domains[host] = slug
+	}
+
+	return domains, nil
+}
+
+func defaultNodeID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "unknown"
+	}
+	return hostname
+}
+
+func parseNodeRegion() (string, error) {
+	region := strings.ToLower(strings.TrimSpace(getenv("NODE_REGION", "")))
+	if region == "" {
+		return "", nil
+	}
+	if len(region) > 63 || strings.HasPrefix(region, "-") || strings.HasSuffix(region, "-") {
+		return "", fmt.Errorf("invalid NODE_REGION value %q", region)
+	}
+	for _, r := range region {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return "", fmt.Errorf("invalid NODE_REGION value %q", region)
+		}
+	}
+	return region, nil
+}
+
+func parseSSHHostKey() (string, error) {
+	if raw := getenv("SSH_HOST_KEY", ""); raw != "" {
+		if !strings.Contains(raw, "\n") {
+			raw = strings.ReplaceAll(raw, `\n`, "\n")
+		}
+		return raw, nil
+	}
+
+	dir := getenv("SECRETS_DIR", "")
+	if dir == "" {
+		return "", nil
+	}
+	key, err := os.ReadFile(filepath.Join(dir, "ssh_host_key"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read ssh_host_key from SECRETS_DIR: %w", err)
+	}
+	return string(key), nil
+}
+
 func parseAllowedPorts() (uint16, uint16, error) {
 	raw := getenv("ALLOWED_PORTS", "")
-	if raw == "" {
+	if raw == "" || strings.EqualFold(raw, "none") {
 		return 0, 0, nil
 	}
 
@@ -157,6 +526,78 @@ func parseAllowedPorts() (uint16, uint16, error) {
 	return uint16(start), uint16(end), nil
 }
 
+func parseHTTPForwardPorts() ([]uint16, error) {
+	var ports []uint16
+	for _, raw := range strings.Split(getenv("HTTP_FORWARD_PORTS", "80,443"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(raw, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP_FORWARD_PORTS value %q", raw)
+		}
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
+
+func parseDirectTCPIPAllowlist() ([]string, error) {
+	var allowlist []string
+	for _, raw := range strings.Split(getenv("DIRECT_TCPIP_ALLOWLIST", ""), ",") {
+		raw = strings.ToLower(strings.TrimSpace(raw))
+		if raw == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(raw)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("invalid DIRECT_TCPIP_ALLOWLIST entry %q", raw)
+		}
+		if port != "*" {
+			if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid DIRECT_TCPIP_ALLOWLIST entry %q", raw)
+			}
+		}
+		allowlist = append(allowlist, net.JoinHostPort(host, port))
+	}
+	return allowlist, nil
+}
+
+func parseDefaultTunnelType() (types.TunnelType, error) {
+	switch strings.ToLower(getenv("DEFAULT_TUNNEL_TYPE", "tcp")) {
+	case "tcp":
+		return types.TunnelTypeTCP, nil
+	case "http":
+		return types.TunnelTypeHTTP, nil
+	default:
+		return 0, fmt.Errorf("invalid DEFAULT_TUNNEL_TYPE value")
+	}
+}
+
+func parseInvalidHostAction() (types.HostAction, error) {
+	switch strings.ToLower(getenv("INVALID_HOST_ACTION", "reject")) {
+	case "reject":
+		return types.HostActionREJECT, nil
+	case "log":
+		return types.HostActionLOG, nil
+	case "drop":
+		return types.HostActionDROP, nil
+	default:
+		return 0, fmt.Errorf("invalid INVALID_HOST_ACTION value")
+	}
+}
+
+func parseSlugCollisionPolicy() (types.CollisionPolicy, error) {
+	switch strings.ToLower(getenv("SLUG_COLLISION_POLICY", "reject")) {
+	case "reject":
+		return types.CollisionPolicyREJECT, nil
+	case "suffix":
+		return types.CollisionPolicySUFFIX, nil
+	default:
+		return 0, fmt.Errorf("invalid SLUG_COLLISION_POLICY value")
+	}
+}
+
 func parseBufferSize() int {
 	raw := getenv("BUFFER_SIZE", "32768")
 	size, err := strconv.Atoi(raw)
@@ -167,6 +608,16 @@ func parseBufferSize() int {
 	return size
 }
 
+func parseResponseWriteBuffer() int {
+	raw := getenv("RESPONSE_WRITE_BUFFER", "0")
+	size, err := strconv.Atoi(raw)
+	if err != nil || (size != 0 && (size < 4096 || size > 1048576)) {
+		log.Println("Invalid RESPONSE_WRITE_BUFFER, falling back to 0 (disabled)")
+		return 0
+	}
+	return size
+}
+
 func parseHeaderSize() int {
 	raw := getenv("MAX_HEADER_SIZE", "4096")
 	size, err := strconv.Atoi(raw)
@@ -177,6 +628,352 @@ func parseHeaderSize() int {
 	return size
 }
 
+func parseMaxResponseHeaderSize() int {
+	raw := getenv("MAX_RESPONSE_HEADER_SIZE", "16384")
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 4096 || size > 131072 {
+		log.Println("Invalid MAX_RESPONSE_HEADER_SIZE, falling back to 16384")
+		return 16384
+	}
+	return size
+}
+
+func parseMaxRequestLineSize() int {
+	raw := getenv("MAX_REQUEST_LINE_SIZE", "2048")
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 256 || size > 131072 {
+		log.Println("Invalid MAX_REQUEST_LINE_SIZE, falling back to 2048")
+		return 2048
+	}
+	return size
+}
+
+func parseMaxURILength() int {
+	raw := getenv("MAX_URI_LENGTH", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_URI_LENGTH, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseHeaderReadTimeout() time.Duration {
+	timeout := getenvDuration("HEADER_READ_TIMEOUT", 10*time.Second)
+	if timeout <= 0 {
+		log.Println("Invalid HEADER_READ_TIMEOUT, falling back to 10s")
+		return 10 * time.Second
+	}
+	return timeout
+}
+
+func parseNodeToken() (string, string, error) {
+	path := getenv("NODE_TOKEN_FILE", "")
+	if path == "" {
+		return getenv("NODE_TOKEN", ""), "", nil
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read NODE_TOKEN_FILE: %w", err)
+	}
+	return strings.TrimSpace(string(token)), path, nil
+}
+
+func parseBadGatewayPage() (string, error) {
+	path := getenv("BAD_GATEWAY_PAGE", "")
+	if path == "" {
+		return "", nil
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read BAD_GATEWAY_PAGE: %w", err)
+	}
+	return string(page), nil
+}
+
+func parseMaintenancePage() (string, error) {
+	path := getenv("MAINTENANCE_PAGE", "")
+	if path == "" {
+		return "", nil
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read MAINTENANCE_PAGE: %w", err)
+	}
+	return string(page), nil
+}
+
+func parseWelcomeURL() (string, error) {
+	raw := getenv("WELCOME_URL", "")
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid WELCOME_URL %q: must be an absolute http(s) URL", raw)
+	}
+	return raw, nil
+}
+
+func parseACMEDirectoryURL() (string, error) {
+	raw := getenv("ACME_DIRECTORY_URL", "")
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid ACME_DIRECTORY_URL %q: must be an absolute http(s) URL", raw)
+	}
+	return raw, nil
+}
+
+func parseACMEHTTPPort() (string, error) {
+	raw := getenv("ACME_HTTP_PORT", "")
+	if raw == "" {
+		return "", nil
+	}
+	port, err := strconv.ParseUint(raw, 10, 16)
+	if err != nil || port == 0 {
+		return "", fmt.Errorf("invalid ACME_HTTP_PORT %q: must be a port between 1 and 65535", raw)
+	}
+	return raw, nil
+}
+
+func parseCertRenewBeforeDays() int {
+	raw := getenv("CERT_RENEW_BEFORE_DAYS", "30")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > 90 {
+		log.Println("Invalid CERT_RENEW_BEFORE_DAYS, falling back to 30")
+		return 30
+	}
+	return n
+}
+
+func parseMaxInteractiveSessions() int {
+	raw := getenv("MAX_INTERACTIVE_SESSIONS", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_INTERACTIVE_SESSIONS, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseInteractiveKeepalive() time.Duration {
+	interval := getenvDuration("INTERACTIVE_KEEPALIVE", 0)
+	if interval < 0 {
+		log.Println("Invalid INTERACTIVE_KEEPALIVE, falling back to 0 (disabled)")
+		return 0
+	}
+	return interval
+}
+
+func parseMaxForwardedChannels() int {
+	raw := getenv("MAX_FORWARDED_CHANNELS", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_FORWARDED_CHANNELS, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseChannelOpenQueue() (int, time.Duration) {
+	raw := getenv("CHANNEL_OPEN_QUEUE", "0")
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 0 {
+		log.Println("Invalid CHANNEL_OPEN_QUEUE, falling back to 0 (unbounded)")
+		size = 0
+	}
+	timeout := getenvDuration("CHANNEL_OPEN_QUEUE_TIMEOUT", time.Second)
+	if timeout <= 0 {
+		log.Println("Invalid CHANNEL_OPEN_QUEUE_TIMEOUT, falling back to 1s")
+		timeout = time.Second
+	}
+	return size, timeout
+}
+
+func parseTCPByteBudget() int64 {
+	raw := getenv("TCP_BYTE_BUDGET", "0")
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		log.Println("Invalid TCP_BYTE_BUDGET, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseUDPByteBudget() int64 {
+	raw := getenv("UDP_BYTE_BUDGET", "0")
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		log.Println("Invalid UDP_BYTE_BUDGET, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseNodeBandwidthLimit() int64 {
+	raw := getenv("NODE_BANDWIDTH_LIMIT", "0")
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		log.Println("Invalid NODE_BANDWIDTH_LIMIT, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseTCPInitialReadTimeout() time.Duration {
+	timeout := getenvDuration("TCP_INITIAL_READ_TIMEOUT", 0)
+	if timeout < 0 {
+		log.Println("Invalid TCP_INITIAL_READ_TIMEOUT, falling back to 0 (disabled)")
+		return 0
+	}
+	return timeout
+}
+
+func parseTCPKeepAlive() (time.Duration, int) {
+	interval := getenvDuration("TCP_KEEPALIVE_INTERVAL", 0)
+	if interval < 0 {
+		log.Println("Invalid TCP_KEEPALIVE_INTERVAL, falling back to 0 (disabled)")
+		interval = 0
+	}
+	raw := getenv("TCP_KEEPALIVE_COUNT", "9")
+	count, err := strconv.Atoi(raw)
+	if err != nil || count <= 0 {
+		log.Println("Invalid TCP_KEEPALIVE_COUNT, falling back to 9")
+		count = 9
+	}
+	return interval, count
+}
+
+func parseSlugChangeCooldown() time.Duration {
+	cooldown := getenvDuration("SLUG_CHANGE_COOLDOWN", 0)
+	if cooldown < 0 {
+		log.Println("Invalid SLUG_CHANGE_COOLDOWN, falling back to 0 (disabled)")
+		return 0
+	}
+	return cooldown
+}
+
+func parseSlugReuseGrace() time.Duration {
+	grace := getenvDuration("SLUG_REUSE_GRACE", 0)
+	if grace < 0 {
+		log.Println("Invalid SLUG_REUSE_GRACE, falling back to 0 (disabled)")
+		return 0
+	}
+	return grace
+}
+
+func parseMaxSlugLength() int {
+	raw := getenv("MAX_SLUG_LENGTH", "20")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 12 || n > 63 {
+		log.Println("Invalid MAX_SLUG_LENGTH, falling back to 20")
+		return 20
+	}
+	return n
+}
+
+func parseMaxConcurrentAccepts() int {
+	raw := getenv("MAX_CONCURRENT_ACCEPTS", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_CONCURRENT_ACCEPTS, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseMaxConcurrentTLSHandshakes() int {
+	raw := getenv("MAX_CONCURRENT_TLS_HANDSHAKES", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_CONCURRENT_TLS_HANDSHAKES, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseMaxRequestsPerIP() int {
+	raw := getenv("MAX_REQUESTS_PER_IP", "0")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Println("Invalid MAX_REQUESTS_PER_IP, falling back to 0 (unlimited)")
+		return 0
+	}
+	return n
+}
+
+func parseAccessLogSampleRate() float64 {
+	rate := getenvFloat("ACCESS_LOG_SAMPLE_RATE", 1)
+	if rate < 0 || rate > 1 {
+		log.Println("Invalid ACCESS_LOG_SAMPLE_RATE, falling back to 1")
+		return 1
+	}
+	return rate
+}
+
+func parseTunnelLogMaxSize() int64 {
+	raw := getenv("TUNNEL_LOG_MAX_SIZE", "10485760")
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 4096 {
+		log.Println("Invalid TUNNEL_LOG_MAX_SIZE, falling back to 10485760")
+		return 10485760
+	}
+	return n
+}
+
+func parseGRPCBackoff() (time.Duration, float64, time.Duration, error) {
+	initial := getenvDuration("GRPC_INITIAL_BACKOFF", time.Second)
+	if initial <= 0 {
+		log.Println("Invalid GRPC_INITIAL_BACKOFF, falling back to 1s")
+		initial = time.Second
+	}
+
+	multiplier := getenvFloat("GRPC_BACKOFF_MULTIPLIER", 2)
+	if multiplier < 1 {
+		log.Println("Invalid GRPC_BACKOFF_MULTIPLIER, falling back to 2")
+		multiplier = 2
+	}
+
+	maxBackoff := getenvDuration("GRPC_MAX_BACKOFF", 30*time.Second)
+	if maxBackoff < initial {
+		return 0, 0, 0, fmt.Errorf("GRPC_MAX_BACKOFF must not be less than GRPC_INITIAL_BACKOFF")
+	}
+
+	return initial, multiplier, maxBackoff, nil
+}
+
+func parseGRPCEventConcurrency() int {
+	raw := getenv("GRPC_EVENT_CONCURRENCY", "4")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > 256 {
+		log.Println("Invalid GRPC_EVENT_CONCURRENCY, falling back to 4")
+		return 4
+	}
+	return n
+}
+
+func parseGRPCHealthRetries() int {
+	raw := getenv("GRPC_HEALTH_RETRIES", "3")
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 || n > 100 {
+		log.Println("Invalid GRPC_HEALTH_RETRIES, falling back to 3")
+		return 3
+	}
+	return n
+}
+
+func parseRegistrySweepInterval() time.Duration {
+	interval := getenvDuration("REGISTRY_SWEEP_INTERVAL", time.Minute)
+	if interval < 0 {
+		log.Println("Invalid REGISTRY_SWEEP_INTERVAL, falling back to 1m")
+		return time.Minute
+	}
+	return interval
+}
+
 func getenv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -191,3 +988,29 @@ func getenvBool(key string, def bool) bool {
 	}
 	return val == "true"
 }
+
+func getenvDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("Invalid %s, falling back to %s", key, def)
+		return def
+	}
+	return d
+}
+
+func getenvFloat(key string, def float64) float64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		log.Printf("Invalid %s, falling back to %v", key, def)
+		return def
+	}
+	return f
+}
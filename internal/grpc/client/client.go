@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"strings"
+	"sync"
 	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/registry"
@@ -27,25 +30,39 @@ type Client interface {
 	AuthorizeConn(ctx context.Context, token string) (authorized bool, user string, err error)
 	Close() error
 	CheckServerHealth(ctx context.Context) error
+	WaitForServerHealth(ctx context.Context) error
 }
 type client struct {
 	config                     config.Config
+	mu                         sync.RWMutex
 	conn                       *grpc.ClientConn
 	address                    string
+	endpoints                  []string
+	endpointIndex              int
+	dialOptions                []grpc.DialOption
 	sessionRegistry            registry.Registry
 	eventService               proto.EventServiceClient
 	authorizeConnectionService proto.UserServiceClient
 	closing                    bool
+	backoffInitial             time.Duration
+	backoffMultiplier          float64
+	backoffMax                 time.Duration
+	eventConcurrency           int
+	healthRetries              int
 }
 
 var (
 	grpcNewClient         = grpc.NewClient
 	healthNewHealthClient = grpc_health_v1.NewHealthClient
 	initialBackoff        = time.Second
+	backoffMultiplier     = 2.0
+	maxBackoff            = 30 * time.Second
+	healthCheckTimeout    = 5 * time.Second
 )
 
 func New(config config.Config, sessionRegistry registry.Registry) (Client, error) {
-	address := fmt.Sprintf("%s:%s", config.GRPCAddress(), config.GRPCPort())
+	endpoints := parseEndpoints(config.GRPCAddress(), config.GRPCPort())
+	address := endpoints[0]
 
 	var opts []grpc.DialOption
 
@@ -78,14 +95,65 @@ func New(config config.Config, sessionRegistry registry.Registry) (Client, error
 		config:                     config,
 		conn:                       conn,
 		address:                    address,
+		endpoints:                  endpoints,
+		dialOptions:                opts,
 		sessionRegistry:            sessionRegistry,
 		eventService:               eventService,
 		authorizeConnectionService: authorizeConnectionService,
+		backoffInitial:             config.GRPCInitialBackoff(),
+		backoffMultiplier:          config.GRPCBackoffMultiplier(),
+		backoffMax:                 config.GRPCMaxBackoff(),
+		eventConcurrency:           config.GRPCEventConcurrency(),
+		healthRetries:              config.GRPCHealthRetries(),
 	}, nil
 }
 
+func parseEndpoints(addresses, defaultPort string) []string {
+	var endpoints []string
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, defaultPort)
+		}
+		endpoints = append(endpoints, address)
+	}
+	if len(endpoints) == 0 {
+		endpoints = append(endpoints, net.JoinHostPort("localhost", defaultPort))
+	}
+	return endpoints
+}
+
+func (c *client) failover() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || len(c.endpoints) < 2 {
+		return
+	}
+
+	next := (c.endpointIndex + 1) % len(c.endpoints)
+	address := c.endpoints[next]
+	conn, err := grpcNewClient(address, c.dialOptions...)
+	if err != nil {
+		log.Printf("Failed to switch gRPC connection to %s: %v", address, err)
+		return
+	}
+
+	log.Printf("Switching gRPC connection from %s to %s", c.address, address)
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn = conn
+	c.address = address
+	c.endpointIndex = next
+	c.eventService = proto.NewEventServiceClient(conn)
+	c.authorizeConnectionService = proto.NewUserServiceClient(conn)
+}
+
 func (c *client) SubscribeEvents(ctx context.Context, identity, authToken string) error {
-	backoff := initialBackoff
+	backoff := c.baseBackoff()
 
 	for {
 		if err := c.subscribeAndProcess(ctx, identity, authToken, &backoff); err != nil {
@@ -95,7 +163,11 @@ func (c *client) SubscribeEvents(ctx context.Context, identity, authToken string
 }
 
 func (c *client) subscribeAndProcess(ctx context.Context, identity, authToken string, backoff *time.Duration) error {
-	subscribe, err := c.eventService.Subscribe(ctx)
+	c.mu.RLock()
+	eventService := c.eventService
+	c.mu.RUnlock()
+
+	subscribe, err := eventService.Subscribe(ctx)
 	if err != nil {
 		return c.handleSubscribeError(ctx, err, backoff)
 	}
@@ -115,7 +187,7 @@ func (c *client) subscribeAndProcess(ctx context.Context, identity, authToken st
 	}
 
 	log.Println("Authentication Successfully sent to gRPC server")
-	*backoff = time.Second
+	*backoff = c.baseBackoff()
 
 	return c.handleStreamError(ctx, c.processEventStream(subscribe), backoff)
 }
@@ -130,6 +202,7 @@ func (c *client) handleSubscribeError(ctx context.Context, err error, backoff *t
 	if err = c.wait(ctx, *backoff); err != nil {
 		return err
 	}
+	c.failover()
 	c.growBackoff(backoff)
 	log.Printf("Reconnect to controller within %v sec", backoff.Seconds())
 	return nil
@@ -143,6 +216,7 @@ func (c *client) handleAuthError(ctx context.Context, err error, backoff *time.D
 	if err := c.wait(ctx, *backoff); err != nil {
 		return err
 	}
+	c.failover()
 	c.growBackoff(backoff)
 	return nil
 }
@@ -158,6 +232,7 @@ func (c *client) handleStreamError(ctx context.Context, err error, backoff *time
 	if err := c.wait(ctx, *backoff); err != nil {
 		return err
 	}
+	c.failover()
 	c.growBackoff(backoff)
 	return nil
 }
@@ -175,14 +250,33 @@ func (c *client) wait(ctx context.Context, duration time.Duration) error {
 }
 
 func (c *client) growBackoff(backoff *time.Duration) {
-	const maxBackoff = 30 * time.Second
-	*backoff *= 2
-	if *backoff > maxBackoff {
-		*backoff = maxBackoff
+	multiplier := backoffMultiplier
+	if c.backoffMultiplier >= 1 {
+		multiplier = c.backoffMultiplier
+	}
+	limit := maxBackoff
+	if c.backoffMax > 0 {
+		limit = c.backoffMax
+	}
+
+	*backoff = time.Duration(float64(*backoff) * multiplier)
+	if *backoff > limit {
+		*backoff = limit
+	}
+}
+
+func (c *client) baseBackoff() time.Duration {
+	if c.backoffInitial > 0 {
+		return c.backoffInitial
 	}
+	return initialBackoff
 }
 
 func (c *client) processEventStream(subscribe grpc.BidiStreamingClient[proto.Node, proto.Events]) error {
+	if c.eventConcurrency > 1 {
+		return c.processEventStreamConcurrent(subscribe)
+	}
+
 	handlers := c.eventHandlers(subscribe)
 
 	for {
@@ -203,6 +297,126 @@ func (c *client) processEventStream(subscribe grpc.BidiStreamingClient[proto.Nod
 	}
 }
 
+func (c *client) processEventStreamConcurrent(subscribe grpc.BidiStreamingClient[proto.Node, proto.Events]) error {
+	handlers := c.eventHandlers(&syncStream{BidiStreamingClient: subscribe})
+	dispatcher := newEventDispatcher(c.eventConcurrency)
+	defer dispatcher.wait()
+
+	for {
+		if err := dispatcher.err(); err != nil {
+			return err
+		}
+
+		recv, err := subscribe.Recv()
+		if err != nil {
+			return err
+		}
+
+		handler, ok := handlers[recv.GetType()]
+		if !ok {
+			log.Printf("Unknown event type received: %v", recv.GetType())
+			continue
+		}
+
+		dispatcher.dispatch(eventKey(recv), func() error {
+			return handler(recv)
+		})
+	}
+}
+
+func eventKey(evt *proto.Events) string {
+	switch evt.GetType() {
+	case proto.EventType_SLUG_CHANGE:
+		return evt.GetSlugEvent().GetUser()
+	case proto.EventType_GET_SESSIONS:
+		return evt.GetGetSessionsEvent().GetIdentity()
+	case proto.EventType_TERMINATE_SESSION:
+		return evt.GetTerminateSessionEvent().GetUser()
+	default:
+		return ""
+	}
+}
+
+type syncStream struct {
+	grpc.BidiStreamingClient[proto.Node, proto.Events]
+	mu sync.Mutex
+}
+
+func (s *syncStream) Send(node *proto.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.BidiStreamingClient.Send(node)
+}
+
+type eventDispatcher struct {
+	slots    chan struct{}
+	mu       sync.Mutex
+	tails    map[string]chan struct{}
+	wg       sync.WaitGroup
+	firstErr error
+}
+
+func newEventDispatcher(limit int) *eventDispatcher {
+	return &eventDispatcher{
+		slots: make(chan struct{}, limit),
+		tails: make(map[string]chan struct{}),
+	}
+}
+
+// dispatch runs fn after the previous event with the same key. An event only
+// takes a concurrency slot once its predecessor is done, so events queued
+// behind a slow handler never starve other keys of slots.
+func (d *eventDispatcher) dispatch(key string, fn func() error) {
+	d.mu.Lock()
+	prev := d.tails[key]
+	done := make(chan struct{})
+	d.tails[key] = done
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.finish(key, done)
+
+		if prev != nil {
+			<-prev
+		}
+		d.slots <- struct{}{}
+		defer func() { <-d.slots }()
+
+		if err := fn(); err != nil {
+			d.setErr(err)
+		}
+	}()
+}
+
+func (d *eventDispatcher) finish(key string, done chan struct{}) {
+	d.mu.Lock()
+	if d.tails[key] == done {
+		delete(d.tails, key)
+	}
+	d.mu.Unlock()
+	close(done)
+}
+
+func (d *eventDispatcher) setErr(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.firstErr == nil {
+		d.firstErr = err
+	}
+}
+
+func (d *eventDispatcher) err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.firstErr
+}
+
+func (d *eventDispatcher) wait() {
+	d.wg.Wait()
+}
+
 func (c *client) eventHandlers(subscribe grpc.BidiStreamingClient[proto.Node, proto.Events]) map[proto.EventType]func(*proto.Events) error {
 	return map[proto.EventType]func(*proto.Events) error{
 		proto.EventType_SLUG_CHANGE:       func(evt *proto.Events) error { return c.handleSlugChange(subscribe, evt) },
@@ -320,11 +534,17 @@ func (c *client) protoToTunnelType(t proto.TunnelType) (types.TunnelType, error)
 }
 
 func (c *client) ClientConn() *grpc.ClientConn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.conn
 }
 
 func (c *client) AuthorizeConn(ctx context.Context, token string) (authorized bool, user string, err error) {
-	check, err := c.authorizeConnectionService.Check(ctx, &proto.CheckRequest{AuthToken: token})
+	c.mu.RLock()
+	authorizeConnectionService := c.authorizeConnectionService
+	c.mu.RUnlock()
+
+	check, err := authorizeConnectionService.Check(ctx, &proto.CheckRequest{AuthToken: token})
 	if err != nil {
 		return false, "UNAUTHORIZED", err
 	}
@@ -349,7 +569,31 @@ func (c *client) CheckServerHealth(ctx context.Context) error {
 	return nil
 }
 
+func (c *client) WaitForServerHealth(ctx context.Context) error {
+	backoff := c.baseBackoff()
+
+	for attempt := 0; ; attempt++ {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := c.CheckServerHealth(checkCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.healthRetries || ctx.Err() != nil || !c.isConnectionError(err) {
+			return err
+		}
+		log.Printf("gRPC health check failed, retrying within %v sec: %v", backoff.Seconds(), err)
+		if err := c.wait(ctx, backoff); err != nil {
+			return err
+		}
+		c.failover()
+		c.growBackoff(&backoff)
+	}
+}
+
 func (c *client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.conn != nil {
 		log.Printf("Closing gRPC connection to %s", c.address)
 		c.closing = true
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 	"tunnel_pls/internal/session/forwarder"
@@ -364,6 +365,7 @@ func TestProcessEventStream(t *testing.T) {
 				mCfg := &MockConfig{}
 				c.config = mCfg
 				mCfg.On("Domain").Return("test.com").Maybe()
+				mCfg.On("NodeRegion").Return("").Maybe()
 
 				switch et {
 				case proto.EventType_SLUG_CHANGE:
@@ -400,6 +402,226 @@ func TestProcessEventStream(t *testing.T) {
 	})
 }
 
+func TestProcessEventStreamConcurrent(t *testing.T) {
+	nodeType := func(et proto.EventType) interface{} {
+		return mock.MatchedBy(func(n *proto.Node) bool { return n.GetType() == et })
+	}
+
+	t.Run("NoHeadOfLineBlocking", func(t *testing.T) {
+		mockReg := &mockRegistry{}
+		mockStream := &mockSubscribeClient{}
+		c := &client{eventConcurrency: 4, sessionRegistry: mockReg, config: &MockConfig{}}
+
+		release := make(chan struct{})
+		allowEOF := make(chan struct{})
+		fastDone := make(chan struct{})
+
+		mockReg.On("GetAllSessionFromUser", "slow").Run(func(args mock.Arguments) {
+			<-release
+		}).Return(nil).Once()
+		mockReg.On("Get", mock.Anything).Return(nil, errors.New("not found")).Once()
+
+		mockStream.On("Recv").Return(&proto.Events{
+			Type:    proto.EventType_GET_SESSIONS,
+			Payload: &proto.Events_GetSessionsEvent{GetSessionsEvent: &proto.GetSessionsEvent{Identity: "slow"}},
+		}, nil).Once()
+		mockStream.On("Recv").Return(&proto.Events{
+			Type:    proto.EventType_SLUG_CHANGE,
+			Payload: &proto.Events_SlugEvent{SlugEvent: &proto.SlugChangeEvent{User: "fast"}},
+		}, nil).Once()
+		mockStream.On("Recv").Run(func(args mock.Arguments) {
+			<-allowEOF
+		}).Return(nil, io.EOF).Once()
+		mockStream.On("Send", nodeType(proto.EventType_SLUG_CHANGE_RESPONSE)).Run(func(args mock.Arguments) {
+			close(fastDone)
+		}).Return(nil).Once()
+		mockStream.On("Send", nodeType(proto.EventType_GET_SESSIONS)).Return(nil).Once()
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- c.processEventStream(mockStream)
+		}()
+
+		select {
+		case <-fastDone:
+		case <-time.After(2 * time.Second):
+			t.Fatal("slug change was blocked behind slow GET_SESSIONS")
+		}
+
+		close(release)
+		close(allowEOF)
+
+		select {
+		case err := <-errCh:
+			assert.ErrorIs(t, err, io.EOF)
+		case <-time.After(2 * time.Second):
+			t.Fatal("processEventStream did not return")
+		}
+		mockReg.AssertExpectations(t)
+		mockStream.AssertExpectations(t)
+	})
+
+	t.Run("QueuedEventsDoNotHoldSlots", func(t *testing.T) {
+		mockReg := &mockRegistry{}
+		mockStream := &mockSubscribeClient{}
+		c := &client{eventConcurrency: 2, sessionRegistry: mockReg, config: &MockConfig{}}
+
+		release := make(chan struct{})
+		allowEOF := make(chan struct{})
+		fastDone := make(chan struct{})
+
+		mockReg.On("GetAllSessionFromUser", "slow").Run(func(args mock.Arguments) {
+			<-release
+		}).Return(nil).Twice()
+		mockReg.On("Get", mock.Anything).Return(nil, errors.New("not found")).Once()
+
+		slowEvent := &proto.Events{
+			Type:    proto.EventType_GET_SESSIONS,
+			Payload: &proto.Events_GetSessionsEvent{GetSessionsEvent: &proto.GetSessionsEvent{Identity: "slow"}},
+		}
+		mockStream.On("Recv").Return(slowEvent, nil).Twice()
+		mockStream.On("Recv").Return(&proto.Events{
+			Type:    proto.EventType_SLUG_CHANGE,
+			Payload: &proto.Events_SlugEvent{SlugEvent: &proto.SlugChangeEvent{User: "fast"}},
+		}, nil).Once()
+		mockStream.On("Recv").Run(func(args mock.Arguments) {
+			<-allowEOF
+		}).Return(nil, io.EOF).Once()
+		mockStream.On("Send", nodeType(proto.EventType_SLUG_CHANGE_RESPONSE)).Run(func(args mock.Arguments) {
+			close(fastDone)
+		}).Return(nil).Once()
+		mockStream.On("Send", nodeType(proto.EventType_GET_SESSIONS)).Return(nil).Twice()
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- c.processEventStream(mockStream)
+		}()
+
+		select {
+		case <-fastDone:
+		case <-time.After(2 * time.Second):
+			t.Fatal("slug change was blocked by an event queued behind slow GET_SESSIONS")
+		}
+
+		close(release)
+		close(allowEOF)
+
+		select {
+		case err := <-errCh:
+			assert.ErrorIs(t, err, io.EOF)
+		case <-time.After(2 * time.Second):
+			t.Fatal("processEventStream did not return")
+		}
+		mockReg.AssertExpectations(t)
+		mockStream.AssertExpectations(t)
+	})
+
+	t.Run("PreservesPerUserOrdering", func(t *testing.T) {
+		mockReg := &mockRegistry{}
+		mockStream := &mockSubscribeClient{}
+		c := &client{eventConcurrency: 4, sessionRegistry: mockReg, config: &MockConfig{}}
+
+		var mu sync.Mutex
+		var order []string
+		record := func(step string) {
+			mu.Lock()
+			order = append(order, step)
+			mu.Unlock()
+		}
+
+		mockReg.On("GetAllSessionFromUser", "alice").Run(func(args mock.Arguments) {
+			record("get-start")
+			time.Sleep(50 * time.Millisecond)
+			record("get-end")
+		}).Return(nil).Once()
+		mockReg.On("GetWithUser", "alice", mock.Anything).Run(func(args mock.Arguments) {
+			record("terminate")
+		}).Return(nil, errors.New("not found")).Once()
+
+		mockStream.On("Recv").Return(&proto.Events{
+			Type:    proto.EventType_GET_SESSIONS,
+			Payload: &proto.Events_GetSessionsEvent{GetSessionsEvent: &proto.GetSessionsEvent{Identity: "alice"}},
+		}, nil).Once()
+		mockStream.On("Recv").Return(&proto.Events{
+			Type: proto.EventType_TERMINATE_SESSION,
+			Payload: &proto.Events_TerminateSessionEvent{TerminateSessionEvent: &proto.TerminateSessionEvent{
+				User:       "alice",
+				TunnelType: proto.TunnelType_HTTP,
+			}},
+		}, nil).Once()
+		mockStream.On("Recv").Return(nil, io.EOF).Once()
+		mockStream.On("Send", mock.Anything).Return(nil).Twice()
+
+		err := c.processEventStream(mockStream)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, []string{"get-start", "get-end", "terminate"}, order)
+		mockStream.AssertExpectations(t)
+	})
+
+	t.Run("HandlerErrorStopsStream", func(t *testing.T) {
+		mockReg := &mockRegistry{}
+		mockStream := &mockSubscribeClient{}
+		c := &client{eventConcurrency: 4, sessionRegistry: mockReg}
+
+		mockReg.On("Get", mock.Anything).Return(nil, errors.New("fail")).Once()
+
+		handled := make(chan struct{})
+		expectedErr := status.Error(codes.Unavailable, "send fail")
+		mockStream.On("Send", mock.Anything).Run(func(args mock.Arguments) {
+			close(handled)
+		}).Return(expectedErr).Once()
+
+		mockStream.On("Recv").Return(&proto.Events{
+			Type:    proto.EventType_SLUG_CHANGE,
+			Payload: &proto.Events_SlugEvent{SlugEvent: &proto.SlugChangeEvent{User: "bob"}},
+		}, nil).Once()
+		mockStream.On("Recv").Run(func(args mock.Arguments) {
+			<-handled
+		}).Return(&proto.Events{Type: proto.EventType(999)}, nil).Once()
+
+		err := c.processEventStream(mockStream)
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func TestEventKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		evt      *proto.Events
+		expected string
+	}{
+		{
+			name: "slug change",
+			evt: &proto.Events{Type: proto.EventType_SLUG_CHANGE,
+				Payload: &proto.Events_SlugEvent{SlugEvent: &proto.SlugChangeEvent{User: "u1"}}},
+			expected: "u1",
+		},
+		{
+			name: "get sessions",
+			evt: &proto.Events{Type: proto.EventType_GET_SESSIONS,
+				Payload: &proto.Events_GetSessionsEvent{GetSessionsEvent: &proto.GetSessionsEvent{Identity: "u2"}}},
+			expected: "u2",
+		},
+		{
+			name: "terminate session",
+			evt: &proto.Events{Type: proto.EventType_TERMINATE_SESSION,
+				Payload: &proto.Events_TerminateSessionEvent{TerminateSessionEvent: &proto.TerminateSessionEvent{User: "u3"}}},
+			expected: "u3",
+		},
+		{
+			name:     "unknown",
+			evt:      &proto.Events{Type: proto.EventType(999)},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, eventKey(tt.evt))
+		})
+	}
+}
+
 func TestSendNode(t *testing.T) {
 	c := &client{}
 
@@ -518,6 +740,7 @@ func TestHandleGetSessions(t *testing.T) {
 
 		mockReg.On("GetAllSessionFromUser", "mas-fuad").Return([]registry.Session{mockSess}).Once()
 		mockCfg.On("Domain").Return("test.com").Once()
+		mockCfg.On("NodeRegion").Return("").Maybe()
 
 		mockStream.On("Send", mock.MatchedBy(func(n *proto.Node) bool {
 			if n.Type != proto.EventType_GET_SESSIONS {
@@ -533,6 +756,33 @@ func TestHandleGetSessions(t *testing.T) {
 		mockStream.AssertExpectations(t)
 		mockCfg.AssertExpectations(t)
 	})
+
+	t.Run("NodeIdentityIgnoresRegion", func(t *testing.T) {
+		regionCfg := &MockConfig{}
+		rc := &client{config: regionCfg, sessionRegistry: mockReg}
+		mockSess := &mockSession{}
+		mockSess.On("Detail").Return(&types.Detail{
+			ForwardingType: "http",
+			Slug:           "myslug",
+			UserID:         "mas-fuad",
+			Active:         true,
+			StartedAt:      time.Now(),
+		}).Once()
+
+		mockReg.On("GetAllSessionFromUser", "mas-fuad").Return([]registry.Session{mockSess}).Once()
+		regionCfg.On("Domain").Return("test.com")
+		regionCfg.On("NodeRegion").Return("eu-west").Maybe()
+
+		mockStream.On("Send", mock.MatchedBy(func(n *proto.Node) bool {
+			details := n.GetGetSessionsEvent().Details
+			return len(details) == 1 && details[0].Node == "test.com"
+		})).Return(nil).Once()
+
+		err := rc.handleGetSessions(mockStream, evt)
+		assert.NoError(t, err)
+		mockStream.AssertExpectations(t)
+		regionCfg.AssertExpectations(t)
+	})
 }
 
 func TestHandleTerminateSession(t *testing.T) {
@@ -712,6 +962,93 @@ func TestCheckServerHealth(t *testing.T) {
 	})
 }
 
+func TestWaitForServerHealth(t *testing.T) {
+	old := healthNewHealthClient
+	defer func() { healthNewHealthClient = old }()
+
+	serving := &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	tests := []struct {
+		name        string
+		retries     int
+		setup       func(*mockHealthClient)
+		expectErr   bool
+		expectCalls int
+	}{
+		{
+			name:    "recovers after transient failures",
+			retries: 3,
+			setup: func(m *mockHealthClient) {
+				m.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(nil, unavailable).Twice()
+				m.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(serving, nil).Once()
+			},
+			expectCalls: 3,
+		},
+		{
+			name:    "gives up after retries",
+			retries: 2,
+			setup: func(m *mockHealthClient) {
+				m.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(nil, unavailable)
+			},
+			expectErr:   true,
+			expectCalls: 3,
+		},
+		{
+			name:    "does not retry non-connection errors",
+			retries: 3,
+			setup: func(m *mockHealthClient) {
+				m.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(nil, status.Error(codes.PermissionDenied, "denied"))
+			},
+			expectErr:   true,
+			expectCalls: 1,
+		},
+		{
+			name:    "retries disabled",
+			retries: 0,
+			setup: func(m *mockHealthClient) {
+				m.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(nil, unavailable)
+			},
+			expectErr:   true,
+			expectCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHealth := &mockHealthClient{}
+			tt.setup(mockHealth)
+			healthNewHealthClient = func(cc grpc.ClientConnInterface) grpc_health_v1.HealthClient {
+				return mockHealth
+			}
+
+			c := &client{backoffInitial: time.Millisecond, backoffMax: 5 * time.Millisecond, healthRetries: tt.retries}
+			err := c.WaitForServerHealth(context.Background())
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockHealth.AssertNumberOfCalls(t, "Check", tt.expectCalls)
+		})
+	}
+
+	t.Run("stops when context is cancelled", func(t *testing.T) {
+		mockHealth := &mockHealthClient{}
+		mockHealth.On("Check", mock.Anything, mock.Anything, mock.Anything).Return(nil, unavailable)
+		healthNewHealthClient = func(cc grpc.ClientConnInterface) grpc_health_v1.HealthClient {
+			return mockHealth
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := &client{backoffInitial: time.Hour, healthRetries: 3}
+		err := c.WaitForServerHealth(ctx)
+		assert.Error(t, err)
+		mockHealth.AssertNumberOfCalls(t, "Check", 1)
+	})
+}
+
 func TestNew_Error(t *testing.T) {
 	old := grpcNewClient
 	grpcNewClient = func(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
@@ -736,6 +1073,11 @@ func TestNew(t *testing.T) {
 	mockReg := &mockRegistry{}
 	mockConfig.On("GRPCAddress").Return("localhost")
 	mockConfig.On("GRPCPort").Return("1234")
+	mockConfig.On("GRPCInitialBackoff").Return(2 * time.Second)
+	mockConfig.On("GRPCBackoffMultiplier").Return(1.5)
+	mockConfig.On("GRPCMaxBackoff").Return(time.Minute)
+	mockConfig.On("GRPCEventConcurrency").Return(8)
+	mockConfig.On("GRPCHealthRetries").Return(3)
 	cli, err := New(mockConfig, mockReg)
 	if err != nil {
 		t.Errorf("New() error = %v", err)
@@ -746,34 +1088,226 @@ func TestNew(t *testing.T) {
 	defer func(cli Client) {
 		_ = cli.Close()
 	}(cli)
+
+	c := cli.(*client)
+	assert.Equal(t, 2*time.Second, c.backoffInitial)
+	assert.Equal(t, 1.5, c.backoffMultiplier)
+	assert.Equal(t, time.Minute, c.backoffMax)
+	assert.Equal(t, 8, c.eventConcurrency)
+	assert.Equal(t, 3, c.healthRetries)
+}
+
+func TestNew_Endpoints(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockConfig.On("GRPCAddress").Return("cp1.example.com, cp2.example.com:9090")
+	mockConfig.On("GRPCPort").Return("8080")
+	mockConfig.On("GRPCInitialBackoff").Return(time.Duration(0))
+	mockConfig.On("GRPCBackoffMultiplier").Return(0.0)
+	mockConfig.On("GRPCMaxBackoff").Return(time.Duration(0))
+	mockConfig.On("GRPCEventConcurrency").Return(1)
+	mockConfig.On("GRPCHealthRetries").Return(3)
+	cli, err := New(mockConfig, &mockRegistry{})
+	assert.NoError(t, err)
+	defer func(cli Client) {
+		_ = cli.Close()
+	}(cli)
+
+	c := cli.(*client)
+	assert.Equal(t, []string{"cp1.example.com:8080", "cp2.example.com:9090"}, c.endpoints)
+	assert.Equal(t, "cp1.example.com:8080", c.address)
+}
+
+func TestSubscribeEvents_Failover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var dialed []string
+	old := grpcNewClient
+	grpcNewClient = func(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		mu.Lock()
+		dialed = append(dialed, target)
+		if len(dialed) == 2 {
+			cancel()
+		}
+		mu.Unlock()
+		return old(target, opts...)
+	}
+	defer func() { grpcNewClient = old }()
+
+	mockConfig := &MockConfig{}
+	mockConfig.On("GRPCAddress").Return("127.0.0.1:1,127.0.0.1:2")
+	mockConfig.On("GRPCPort").Return("8080")
+	mockConfig.On("GRPCInitialBackoff").Return(time.Millisecond)
+	mockConfig.On("GRPCBackoffMultiplier").Return(1.0)
+	mockConfig.On("GRPCMaxBackoff").Return(time.Millisecond)
+	mockConfig.On("GRPCEventConcurrency").Return(1)
+	mockConfig.On("GRPCHealthRetries").Return(3)
+	cli, err := New(mockConfig, &mockRegistry{})
+	assert.NoError(t, err)
+	defer func(cli Client) {
+		_ = cli.Close()
+	}(cli)
+
+	err = cli.SubscribeEvents(ctx, "id", "token")
+	assert.Error(t, err)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, dialed)
+	assert.Equal(t, "127.0.0.1:2", cli.(*client).address)
+}
+
+func TestFailover_SingleEndpoint(t *testing.T) {
+	conn := &grpc.ClientConn{}
+	c := &client{conn: conn, address: "localhost:8080", endpoints: []string{"localhost:8080"}}
+	c.failover()
+	assert.Same(t, conn, c.conn)
+	assert.Equal(t, "localhost:8080", c.address)
+}
+
+func TestGrowBackoff_Configured(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *client
+		start  time.Duration
+		want   []time.Duration
+	}{
+		{
+			name:   "custom multiplier and max",
+			client: &client{backoffMultiplier: 3, backoffMax: 10 * time.Second},
+			start:  time.Second,
+			want:   []time.Duration{3 * time.Second, 9 * time.Second, 10 * time.Second},
+		},
+		{
+			name:   "fractional multiplier",
+			client: &client{backoffMultiplier: 1.5, backoffMax: time.Minute},
+			start:  2 * time.Second,
+			want:   []time.Duration{3 * time.Second, 4500 * time.Millisecond},
+		},
+		{
+			name:   "multiplier below one falls back to default",
+			client: &client{backoffMultiplier: 0.5},
+			start:  time.Second,
+			want:   []time.Duration{2 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := tt.start
+			for _, want := range tt.want {
+				tt.client.growBackoff(&backoff)
+				assert.Equal(t, want, backoff)
+			}
+		})
+	}
+}
+
+func TestBaseBackoff(t *testing.T) {
+	assert.Equal(t, initialBackoff, (&client{}).baseBackoff())
+	assert.Equal(t, 250*time.Millisecond, (&client{backoffInitial: 250 * time.Millisecond}).baseBackoff())
 }
 
 type MockConfig struct {
 	mock.Mock
 }
 
-func (m *MockConfig) Domain() string            { return m.Called().String(0) }
-func (m *MockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *MockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *MockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *MockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *MockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *MockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *MockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *MockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) AllowedPortsStart() uint16 { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) AllowedPortsEnd() uint16   { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *MockConfig) PprofPort() string         { return m.Called().String(0) }
-func (m *MockConfig) Mode() types.ServerMode    { return m.Called().Get(0).(types.ServerMode) }
-func (m *MockConfig) GRPCAddress() string       { return m.Called().String(0) }
-func (m *MockConfig) GRPCPort() string          { return m.Called().String(0) }
-func (m *MockConfig) NodeToken() string         { return m.Called().String(0) }
-func (m *MockConfig) KeyLoc() string            { return m.Called().String(0) }
+func (m *MockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *MockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *MockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *MockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *MockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *MockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *MockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *MockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) TLSStoragePath() string           { return m.Called().String(0) }
+func (m *MockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *MockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *MockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *MockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *MockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *MockConfig) AllowedPortsStart() uint16        { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) AllowedPortsEnd() uint16          { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *MockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *MockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *MockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *MockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *MockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *MockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *MockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *MockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *MockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *MockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *MockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *MockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *MockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *MockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *MockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *MockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *MockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *MockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *MockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *MockConfig) PprofPort() string                    { return m.Called().String(0) }
+func (m *MockConfig) Mode() types.ServerMode               { return m.Called().Get(0).(types.ServerMode) }
+func (m *MockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *MockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *MockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *MockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *MockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *MockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *MockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *MockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *MockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *MockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *MockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *MockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *MockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *MockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *MockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) KeyLoc() string                       { return m.Called().String(0) }
+func (m *MockConfig) SSHHostKey() string                   { return m.Called().String(0) }
 
 type mockRegistry struct {
 	mock.Mock
@@ -803,6 +1337,14 @@ func (m *mockRegistry) GetAllSessionFromUser(user string) []registry.Session {
 	}
 	return args.Get(0).([]registry.Session)
 }
+
+func (m *mockRegistry) Sessions() map[registry.Key]registry.Session {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(map[registry.Key]registry.Session)
+}
 func (m *mockRegistry) Register(key registry.Key, session registry.Session) bool {
 	return m.Called(key, session).Bool(0)
 }
@@ -864,6 +1406,9 @@ func (m *mockInteraction) Mode() types.InteractiveMode {
 	return m.Called().Get(0).(types.InteractiveMode)
 }
 func (m *mockInteraction) Send(message string) error { return m.Called(message).Error(0) }
+func (m *mockInteraction) SendDiagnostic(message string) error {
+	return m.Called(message).Error(0)
+}
 
 type mockLifecycle struct {
 	mock.Mock
@@ -888,6 +1433,7 @@ func (m *mockLifecycle) User() string                         { return m.Called(
 func (m *mockLifecycle) SetChannel(channel ssh.Channel) error { return m.Called(channel).Error(0) }
 func (m *mockLifecycle) SetStatus(status types.SessionStatus) { m.Called(status) }
 func (m *mockLifecycle) IsActive() bool                       { return m.Called().Bool(0) }
+func (m *mockLifecycle) IsClosed() bool                       { return m.Called().Bool(0) }
 func (m *mockLifecycle) StartedAt() time.Time                 { return m.Called().Get(0).(time.Time) }
 func (m *mockLifecycle) PortRegistry() lifecycle.PortRegistry {
 	args := m.Called()
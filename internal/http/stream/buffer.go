@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"tunnel_pls/internal/http/header"
+)
+
+const flushDelay = 5 * time.Millisecond
+
+type bufferedWriter struct {
+	mu    sync.Mutex
+	buf   *bufio.Writer
+	timer *time.Timer
+}
+
+func newBufferedWriter(w io.Writer, size int) *bufferedWriter {
+	return &bufferedWriter{buf: bufio.NewWriterSize(w, size)}
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	n, err := bw.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if bw.buf.Buffered() > 0 && bw.timer == nil {
+		bw.timer = time.AfterFunc(flushDelay, func() {
+			_ = bw.Flush()
+		})
+	}
+	return n, nil
+}
+
+func (bw *bufferedWriter) Flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if bw.timer != nil {
+		bw.timer.Stop()
+		bw.timer = nil
+	}
+	return bw.buf.Flush()
+}
+
+func isStreamingResponse(resphf header.ResponseHeader) bool {
+	contentType := headerValue(resphf, "Content-Type")
+	encoding := headerValue(resphf, "Transfer-Encoding")
+	return strings.HasPrefix(strings.ToLower(contentType), "text/event-stream") || strings.EqualFold(encoding, "chunked")
+}
+
+func headerValue(resphf header.ResponseHeader, key string) string {
+	if v := resphf.Value(key); v != "" {
+		return v
+	}
+	return resphf.Value(strings.ToLower(key))
+}
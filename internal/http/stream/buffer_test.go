@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	calls int
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	return w.buf.Write(p)
+}
+
+func (w *recordingWriter) snapshot() (string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String(), w.calls
+}
+
+func TestNewBuffered(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    []string
+		buffered  bool
+		expect    string
+		coalesced bool
+	}{
+		{
+			name:   "unbuffered passes writes through",
+			writes: []string{"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\n", "bo", "dy"},
+			expect: "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nbody",
+		},
+		{
+			name:      "buffered coalesces small writes",
+			writes:    []string{"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\n", "bo", "dy"},
+			buffered:  true,
+			expect:    "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nbody",
+			coalesced: true,
+		},
+		{
+			name:     "buffered event stream is flushed per write",
+			writes:   []string{"HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\n\r\n", "data: 1\n\n", "data: 2\n\n"},
+			buffered: true,
+			expect:   "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\n\r\ndata: 1\n\ndata: 2\n\n",
+		},
+		{
+			name:     "buffered chunked response is flushed per write",
+			writes:   []string{"HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n", "2\r\nok\r\n", "0\r\n\r\n"},
+			buffered: true,
+			expect:   "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &recordingWriter{}
+			var hs HTTP
+			if tt.buffered {
+				hs = NewBuffered(w, nil, nil, 4096)
+			} else {
+				hs = New(w, nil, nil)
+			}
+
+			for _, p := range tt.writes {
+				n, err := hs.Write([]byte(p))
+				assert.NoError(t, err)
+				assert.Equal(t, len(p), n)
+			}
+
+			if !tt.coalesced {
+				written, _ := w.snapshot()
+				assert.Equal(t, tt.expect, written)
+			}
+
+			assert.NoError(t, hs.CloseWrite())
+			written, calls := w.snapshot()
+			assert.Equal(t, tt.expect, written)
+			if tt.coalesced {
+				assert.Less(t, calls, len(tt.writes))
+			}
+		})
+	}
+}
+
+func TestBufferedWriterFlushesAfterDelay(t *testing.T) {
+	w := &recordingWriter{}
+	bw := newBufferedWriter(w, 4096)
+
+	_, err := bw.Write([]byte("pending"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		written, _ := w.snapshot()
+		return written == "pending"
+	}, time.Second, flushDelay)
+}
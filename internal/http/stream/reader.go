@@ -6,23 +6,27 @@ import (
 )
 
 func (hs *http) Read(p []byte) (int, error) {
-	tmp := make([]byte, len(p))
-	read, err := hs.reader.Read(tmp)
+	if len(hs.pending) > 0 {
+		n := copy(p, hs.pending)
+		hs.pending = hs.pending[n:]
+		return n, nil
+	}
+
+	read, err := hs.reader.Read(p)
 	if read == 0 && err != nil {
 		return 0, err
 	}
 
-	tmp = tmp[:read]
+	data := p[:read]
 
-	headerEndIdx := bytes.Index(tmp, DELIMITER)
+	headerEndIdx := bytes.Index(data, DELIMITER)
 	if headerEndIdx == -1 {
-		return handleNoDelimiter(p, tmp, err)
+		return read, err
 	}
 
-	headerByte, bodyByte := splitHeaderAndBody(tmp, headerEndIdx)
+	headerByte, bodyByte := splitHeaderAndBody(data, headerEndIdx)
 
 	if !isHTTPHeader(headerByte) {
-		copy(p, tmp)
 		return read, nil
 	}
 
@@ -30,7 +34,7 @@ func (hs *http) Read(p []byte) (int, error) {
 }
 
 func (hs *http) processHTTPRequest(p, headerByte, bodyByte []byte) (int, error) {
-	reqhf, err := header.NewRequest(headerByte)
+	reqhf, err := header.NewRequest(bytes.Clone(headerByte))
 	if err != nil {
 		return 0, err
 	}
@@ -41,10 +45,7 @@ func (hs *http) processHTTPRequest(p, headerByte, bodyByte []byte) (int, error)
 
 	hs.reqHeader = reqhf
 	combined := append(reqhf.Finalize(), bodyByte...)
-	return copy(p, combined), nil
-}
-
-func handleNoDelimiter(p, tmp []byte, err error) (int, error) {
-	copy(p, tmp)
-	return len(tmp), err
+	n := copy(p, combined)
+	hs.pending = combined[n:]
+	return n, nil
 }
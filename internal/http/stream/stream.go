@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"errors"
 	"io"
 	"log"
 	"net"
@@ -13,6 +14,10 @@ var DELIMITER = []byte{0x0D, 0x0A, 0x0D, 0x0A}
 var requestLine = regexp.MustCompile(`^(GET|POST|PUT|DELETE|HEAD|OPTIONS|PATCH|TRACE|CONNECT) \S+ HTTP/\d\.\d$`)
 var responseLine = regexp.MustCompile(`^HTTP/\d\.\d \d{3} .+`)
 
+// ErrResponseHeaderTooLarge is returned by Write when the backend sends a
+// response header block larger than the configured limit.
+var ErrResponseHeaderTooLarge = errors.New("response header too large")
+
 type HTTP interface {
 	io.ReadWriteCloser
 	CloseWrite() error
@@ -20,6 +25,7 @@ type HTTP interface {
 	UseResponseMiddleware(mw middleware.ResponseMiddleware)
 	UseRequestMiddleware(mw middleware.RequestMiddleware)
 	SetRequestHeader(header header.RequestHeader)
+	SetMaxResponseHeaderSize(size int)
 	RequestMiddlewares() []middleware.RequestMiddleware
 	ResponseMiddlewares() []middleware.ResponseMiddleware
 	ApplyResponseMiddlewares(resphf header.ResponseHeader, body []byte) error
@@ -31,10 +37,14 @@ type http struct {
 	writer     io.Writer
 	reader     io.Reader
 	buf        []byte
+	pending    []byte
 	respHeader header.ResponseHeader
 	reqHeader  header.RequestHeader
 	respMW     []middleware.ResponseMiddleware
 	reqMW      []middleware.RequestMiddleware
+	buffered   *bufferedWriter
+	streaming  bool
+	maxRespHdr int
 }
 
 func New(writer io.Writer, reader io.Reader, remoteAddr net.Addr) HTTP {
@@ -46,6 +56,12 @@ func New(writer io.Writer, reader io.Reader, remoteAddr net.Addr) HTTP {
 	}
 }
 
+func NewBuffered(writer io.Writer, reader io.Reader, remoteAddr net.Addr, size int) HTTP {
+	hs := New(writer, reader, remoteAddr).(*http)
+	hs.buffered = newBufferedWriter(writer, size)
+	return hs
+}
+
 func (hs *http) RemoteAddr() net.Addr {
 	return hs.remoteAddr
 }
@@ -62,6 +78,12 @@ func (hs *http) SetRequestHeader(header header.RequestHeader) {
 	hs.reqHeader = header
 }
 
+// SetMaxResponseHeaderSize bounds how much of a response header block is
+// buffered while waiting for its end. Zero leaves it unbounded.
+func (hs *http) SetMaxResponseHeaderSize(size int) {
+	hs.maxRespHdr = size
+}
+
 func (hs *http) RequestMiddlewares() []middleware.RequestMiddleware {
 	return hs.reqMW
 }
@@ -71,6 +93,7 @@ func (hs *http) ResponseMiddlewares() []middleware.ResponseMiddleware {
 }
 
 func (hs *http) Close() error {
+	_ = hs.flush()
 	if closer, ok := hs.writer.(io.Closer); ok {
 		return closer.Close()
 	}
@@ -78,6 +101,9 @@ func (hs *http) Close() error {
 }
 
 func (hs *http) CloseWrite() error {
+	if err := hs.flush(); err != nil {
+		return err
+	}
 	if closer, ok := hs.writer.(interface{ CloseWrite() error }); ok {
 		return closer.CloseWrite()
 	}
@@ -540,6 +540,36 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadKeepsBytesBeyondBuffer(t *testing.T) {
+	addr := new(MockAddr)
+	addr.On("String").Return("1.2.3.4:1234").Maybe()
+
+	input := "POST /upload HTTP/1.1\r\nHost: test\r\nContent-Length: 10\r\n\r\n0123456789"
+	hs := New(nil, strings.NewReader(input), addr)
+
+	reqMW := new(MockRequestMiddleware)
+	reqMW.On("HandleRequest", mock.Anything).Run(func(args mock.Arguments) {
+		h := args.Get(0).(header.RequestHeader)
+		h.Set("X-Forwarded-For", "1.2.3.4")
+	}).Return(nil)
+	hs.UseRequestMiddleware(reqMW)
+
+	p := make([]byte, len(input))
+	var out []byte
+	for {
+		n, err := hs.Read(p)
+		out = append(out, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	assert.Greater(t, len(out), len(input))
+	assert.Contains(t, string(out), "X-Forwarded-For: 1.2.3.4\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\n0123456789"))
+}
+
 func TestWrite(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -720,6 +750,70 @@ func TestWriteErrors(t *testing.T) {
 	}
 }
 
+func TestWriteResponseHeaderLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		limit   int
+		wantErr bool
+		want    string
+	}{
+		{
+			name:   "header within the limit",
+			chunks: []string{"HTTP/1.1 200 OK\r\nX-A: 1\r\n\r\nbody"},
+			limit:  64,
+			want:   "HTTP/1.1 200 OK\r\nX-A: 1\r\n\r\nbody",
+		},
+		{
+			name:   "body does not count towards the limit",
+			chunks: []string{"HTTP/1.1 200 OK\r\n\r\n" + strings.Repeat("b", 128)},
+			limit:  32,
+			want:   "HTTP/1.1 200 OK\r\n\r\n" + strings.Repeat("b", 128),
+		},
+		{
+			name:    "oversized header in one write",
+			chunks:  []string{"HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 64) + "\r\n\r\n"},
+			limit:   32,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated header across writes",
+			chunks:  []string{"HTTP/1.1 200 OK\r\n", "X-Big: " + strings.Repeat("a", 16), strings.Repeat("a", 16)},
+			limit:   32,
+			wantErr: true,
+		},
+		{
+			name:   "no limit",
+			chunks: []string{"HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 64) + "\r\n\r\n"},
+			limit:  0,
+			want:   "HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 64) + "\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			hs := New(&out, nil, nil)
+			hs.SetMaxResponseHeaderSize(tt.limit)
+
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, err = hs.Write([]byte(chunk)); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrResponseHeaderTooLarge)
+				assert.Empty(t, out.String())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
 func TestReadEOF(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -8,15 +8,20 @@ import (
 func (hs *http) Write(p []byte) (int, error) {
 	if hs.shouldBypassBuffering(p) {
 		hs.respHeader = nil
+		hs.streaming = false
 	}
 
 	if hs.respHeader != nil {
-		return hs.writer.Write(p)
+		return hs.write(p)
 	}
 
 	hs.buf = append(hs.buf, p...)
 
 	headerEndIdx := bytes.Index(hs.buf, DELIMITER)
+	if hs.headerTooLarge(headerEndIdx) {
+		hs.buf = nil
+		return 0, ErrResponseHeaderTooLarge
+	}
 	if headerEndIdx == -1 {
 		return len(p), nil
 	}
@@ -24,6 +29,16 @@ func (hs *http) Write(p []byte) (int, error) {
 	return hs.processBufferedResponse(p, headerEndIdx)
 }
 
+func (hs *http) headerTooLarge(headerEndIdx int) bool {
+	if hs.maxRespHdr <= 0 {
+		return false
+	}
+	if headerEndIdx == -1 {
+		return len(hs.buf) > hs.maxRespHdr
+	}
+	return headerEndIdx+len(DELIMITER) > hs.maxRespHdr
+}
+
 func (hs *http) shouldBypassBuffering(p []byte) bool {
 	return hs.respHeader != nil && len(hs.buf) == 0 && len(p) >= 5 && string(p[0:5]) == "HTTP/"
 }
@@ -44,7 +59,7 @@ func (hs *http) processBufferedResponse(p []byte, delimiterIdx int) (int, error)
 }
 
 func (hs *http) writeRawBuffer() (int, error) {
-	_, err := hs.writer.Write(hs.buf)
+	_, err := hs.write(hs.buf)
 	length := len(hs.buf)
 	hs.buf = nil
 	if err != nil {
@@ -64,6 +79,7 @@ func (hs *http) processHTTPResponse(headerByte, bodyByte []byte) error {
 	}
 
 	hs.respHeader = resphf
+	hs.streaming = isStreamingResponse(resphf)
 	finalHeader := resphf.Finalize()
 
 	if err = hs.writeHeaderAndBody(finalHeader, bodyByte); err != nil {
@@ -74,15 +90,37 @@ func (hs *http) processHTTPResponse(headerByte, bodyByte []byte) error {
 }
 
 func (hs *http) writeHeaderAndBody(header, bodyByte []byte) error {
-	if _, err := hs.writer.Write(header); err != nil {
+	if _, err := hs.write(header); err != nil {
 		return err
 	}
 
 	if len(bodyByte) > 0 {
-		if _, err := hs.writer.Write(bodyByte); err != nil {
+		if _, err := hs.write(bodyByte); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+func (hs *http) write(p []byte) (int, error) {
+	if hs.buffered == nil {
+		return hs.writer.Write(p)
+	}
+
+	n, err := hs.buffered.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if hs.streaming {
+		return n, hs.buffered.Flush()
+	}
+	return n, nil
+}
+
+func (hs *http) flush() error {
+	if hs.buffered == nil {
+		return nil
+	}
+	return hs.buffered.Flush()
+}
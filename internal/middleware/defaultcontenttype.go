@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"tunnel_pls/internal/http/header"
+)
+
+type DefaultContentType struct {
+	contentType string
+}
+
+func NewDefaultContentType(contentType string) *DefaultContentType {
+	return &DefaultContentType{contentType: contentType}
+}
+
+func (d *DefaultContentType) HandleResponse(header header.ResponseHeader, body []byte) error {
+	if header.Value("Content-Type") != "" {
+		return nil
+	}
+	header.Set("Content-Type", d.contentType)
+	return nil
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDefaultContentTypeHandleResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		inject   bool
+	}{
+		{
+			name:   "Injects default when missing",
+			inject: true,
+		},
+		{
+			name:     "Preserves existing Content-Type",
+			existing: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHeader := new(mockResponseHeader)
+			mockHeader.On("Value", "Content-Type").Return(tt.existing)
+			if tt.inject {
+				mockHeader.On("Set", "Content-Type", "text/html; charset=utf-8").Return()
+			}
+
+			err := NewDefaultContentType("text/html; charset=utf-8").HandleResponse(mockHeader, nil)
+			assert.NoError(t, err)
+			mockHeader.AssertExpectations(t)
+			if !tt.inject {
+				mockHeader.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"tunnel_pls/internal/http/header"
+)
+
+type HostRewrite struct {
+	host string
+}
+
+func NewHostRewrite(host string) *HostRewrite {
+	return &HostRewrite{host: host}
+}
+
+func (hr *HostRewrite) HandleRequest(header header.RequestHeader) error {
+	header.Set("Host", hr.host)
+	return nil
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostRewrite_HandleRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+	}{
+		{name: "plain host", host: "backend.internal"},
+		{name: "host with port", host: "localhost:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHeader := new(mockRequestHeader)
+			mockHeader.On("Set", "Host", tt.host).Return()
+
+			hostRewrite := NewHostRewrite(tt.host)
+
+			err := hostRewrite.HandleRequest(mockHeader)
+			assert.NoError(t, err)
+			mockHeader.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNewHostRewrite(t *testing.T) {
+	instance := NewHostRewrite("backend.internal")
+	assert.NotNil(t, instance)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net"
+	"net/url"
+	"tunnel_pls/internal/http/header"
+)
+
+type LocationRewrite struct {
+	scheme string
+	host   string
+}
+
+func NewLocationRewrite(scheme, host string) *LocationRewrite {
+	return &LocationRewrite{scheme: scheme, host: host}
+}
+
+func (lr *LocationRewrite) HandleResponse(header header.ResponseHeader, body []byte) error {
+	location := header.Value("Location")
+	if location == "" {
+		return nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil || !u.IsAbs() || !isLoopbackHost(u.Hostname()) {
+		return nil
+	}
+
+	u.Scheme = lr.scheme
+	u.Host = lr.host
+	header.Set("Location", u.String())
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLocationRewriteHandleResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		expected string
+	}{
+		{
+			name:     "Rewrites localhost redirect",
+			location: "http://localhost:3000/x",
+			expected: "https://slug.domain/x",
+		},
+		{
+			name:     "Keeps query and fragment",
+			location: "http://127.0.0.1:8080/login?next=%2Fhome#top",
+			expected: "https://slug.domain/login?next=%2Fhome#top",
+		},
+		{
+			name:     "Rewrites IPv6 loopback",
+			location: "http://[::1]:3000/",
+			expected: "https://slug.domain/",
+		},
+		{
+			name:     "Leaves external redirect alone",
+			location: "https://accounts.example.com/oauth",
+		},
+		{
+			name:     "Leaves relative redirect alone",
+			location: "/dashboard",
+		},
+		{
+			name: "No Location header",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHeader := new(mockResponseHeader)
+			mockHeader.On("Value", "Location").Return(tt.location)
+			if tt.expected != "" {
+				mockHeader.On("Set", "Location", tt.expected).Return()
+			}
+
+			err := NewLocationRewrite("https", "slug.domain").HandleResponse(mockHeader, nil)
+			assert.NoError(t, err)
+			mockHeader.AssertExpectations(t)
+			if tt.expected == "" {
+				mockHeader.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"tunnel_pls/internal/http/header"
+)
+
+type ServedBy struct {
+	nodeID string
+}
+
+func NewServedBy(nodeID string) *ServedBy {
+	return &ServedBy{nodeID: nodeID}
+}
+
+func (h *ServedBy) HandleResponse(header header.ResponseHeader, body []byte) error {
+	header.Set("X-Served-By", h.nodeID)
+	return nil
+}
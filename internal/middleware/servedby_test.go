@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServedByHandleResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodeID string
+		body   []byte
+	}{
+		{
+			name:   "Sets X-Served-By Header",
+			nodeID: "node-1",
+			body:   []byte("Sample body"),
+		},
+		{
+			name:   "Sets X-Served-By Header Without Body",
+			nodeID: "edge-sg-02",
+			body:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHeader := new(mockResponseHeader)
+			mockHeader.On("Set", "X-Served-By", tt.nodeID).Return()
+
+			servedBy := NewServedBy(tt.nodeID)
+
+			err := servedBy.HandleResponse(mockHeader, tt.body)
+			assert.NoError(t, err)
+			mockHeader.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNewServedBy(t *testing.T) {
+	instance := NewServedBy("node-1")
+	assert.NotNil(t, instance)
+}
@@ -11,6 +11,7 @@ type Port interface {
 	Unassigned() (uint16, bool)
 	SetStatus(port uint16, assigned bool) error
 	Claim(port uint16) (claimed bool)
+	Assigned() []uint16
 }
 
 type port struct {
@@ -86,3 +87,16 @@ func (pm *port) Claim(port uint16) (claimed bool) {
 	pm.ports[port] = true
 	return true
 }
+
+func (pm *port) Assigned() []uint16 {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	var assigned []uint16
+	for _, index := range pm.sortedPorts {
+		if pm.ports[index] {
+			assigned = append(assigned, index)
+		}
+	}
+	return assigned
+}
@@ -161,3 +161,17 @@ func TestClaim(t *testing.T) {
 		})
 	}
 }
+
+func TestAssigned(t *testing.T) {
+	pm := New()
+	_ = pm.AddRange(1000, 1003)
+
+	assert.Empty(t, pm.Assigned())
+
+	assert.True(t, pm.Claim(1002))
+	assert.True(t, pm.Claim(1000))
+	assert.Equal(t, []uint16{1000, 1002}, pm.Assigned())
+
+	_ = pm.SetStatus(1000, false)
+	assert.Equal(t, []uint16{1002}, pm.Assigned())
+}
@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"log"
+	"time"
+)
+
+var (
+	slugReuseWindow = time.Hour
+	now             = time.Now
+)
+
+type slugLifetimes struct {
+	assigned map[Key]time.Time
+	released map[Key]time.Time
+}
+
+func (l *slugLifetimes) assign(key Key) {
+	at := now()
+	if l.assigned == nil {
+		l.assigned = make(map[Key]time.Time)
+	}
+	l.assigned[key] = at
+
+	if releasedAt, ok := l.released[key]; ok {
+		delete(l.released, key)
+		if idle := at.Sub(releasedAt); idle <= slugReuseWindow {
+			log.Printf("Slug %s reused %s after release", key.Id, idle.Round(time.Millisecond))
+		}
+	}
+}
+
+func (l *slugLifetimes) release(key Key) {
+	at := now()
+	assignedAt, ok := l.assigned[key]
+	if !ok {
+		return
+	}
+	delete(l.assigned, key)
+	log.Printf("Slug %s released after %s", key.Id, at.Sub(assignedAt).Round(time.Millisecond))
+
+	if l.released == nil {
+		l.released = make(map[Key]time.Time)
+	}
+	for k, releasedAt := range l.released {
+		if at.Sub(releasedAt) > slugReuseWindow {
+			delete(l.released, k)
+		}
+	}
+	l.released[key] = at
+}
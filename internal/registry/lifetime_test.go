@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &logs
+}
+
+func TestRegistry_SlugLifetimeLogged(t *testing.T) {
+	logs := captureLog(t)
+
+	r := NewRegistry(0, 20)
+	key := types.SessionKey{Id: "lifetime", Type: types.TunnelTypeHTTP}
+	require.True(t, r.Register(key, createMockSession()))
+	time.Sleep(20 * time.Millisecond)
+	r.Remove(key)
+
+	match := regexp.MustCompile(`Slug lifetime released after (\S+)`).FindStringSubmatch(logs.String())
+	require.Len(t, match, 2, "expected a lifetime log line, got %q", logs.String())
+	lifetime, err := time.ParseDuration(match[1])
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, lifetime, 20*time.Millisecond)
+	assert.Less(t, lifetime, 5*time.Second)
+}
+
+func TestRegistry_SlugReuseLogged(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldNow := now
+	now = func() time.Time { return current }
+	defer func() { now = oldNow }()
+
+	key := types.SessionKey{Id: "reused", Type: types.TunnelTypeHTTP}
+
+	t.Run("within window", func(t *testing.T) {
+		logs := captureLog(t)
+		r := NewRegistry(0, 20)
+		require.True(t, r.Register(key, createMockSession()))
+		current = current.Add(10 * time.Minute)
+		r.Remove(key)
+		current = current.Add(30 * time.Second)
+		require.True(t, r.Register(key, createMockSession()))
+
+		assert.Contains(t, logs.String(), "Slug reused released after 10m0s")
+		assert.Contains(t, logs.String(), "Slug reused reused 30s after release")
+	})
+
+	t.Run("outside window", func(t *testing.T) {
+		logs := captureLog(t)
+		r := NewRegistry(0, 20)
+		require.True(t, r.Register(key, createMockSession()))
+		r.Remove(key)
+		current = current.Add(slugReuseWindow + time.Minute)
+		require.True(t, r.Register(key, createMockSession()))
+
+		assert.NotContains(t, logs.String(), "after release")
+	})
+}
+
+func TestRegistry_SlugLifetimeOnUpdate(t *testing.T) {
+	logs := captureLog(t)
+
+	r := NewRegistry(0, 20)
+	oldKey := types.SessionKey{Id: "before", Type: types.TunnelTypeHTTP}
+	newKey := types.SessionKey{Id: "after", Type: types.TunnelTypeHTTP}
+	require.True(t, r.Register(oldKey, createMockSession()))
+	require.NoError(t, r.Update("user1", oldKey, newKey))
+
+	assert.Contains(t, logs.String(), "Slug before released after")
+	assert.NotContains(t, logs.String(), "Slug after released")
+
+	r.Remove(newKey)
+	assert.Contains(t, logs.String(), "Slug after released after")
+}
+
+func TestSlugLifetimes_PrunesReleased(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldNow := now
+	now = func() time.Time { return current }
+	defer func() { now = oldNow }()
+	captureLog(t)
+
+	var l slugLifetimes
+	stale := types.SessionKey{Id: "stale", Type: types.TunnelTypeHTTP}
+	fresh := types.SessionKey{Id: "fresh", Type: types.TunnelTypeHTTP}
+	l.assign(stale)
+	l.release(stale)
+	current = current.Add(slugReuseWindow + time.Second)
+	l.assign(fresh)
+	l.release(fresh)
+
+	assert.NotContains(t, l.released, stale)
+	assert.Contains(t, l.released, fresh)
+	assert.Empty(t, l.assigned)
+}
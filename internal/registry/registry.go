@@ -3,6 +3,7 @@ package registry
 import (
 	"fmt"
 	"sync"
+	"time"
 	"tunnel_pls/internal/session/forwarder"
 	"tunnel_pls/internal/session/interaction"
 	"tunnel_pls/internal/session/lifecycle"
@@ -27,11 +28,21 @@ type Registry interface {
 	Register(key Key, session Session) (success bool)
 	Remove(key Key)
 	GetAllSessionFromUser(user string) []Session
+	Sessions() map[Key]Session
 }
 type registry struct {
-	mu        sync.RWMutex
-	byUser    map[string]map[Key]Session
-	slugIndex map[Key]string
+	mu            sync.RWMutex
+	byUser        map[string]map[Key]Session
+	slugIndex     map[Key]string
+	lifetimes     slugLifetimes
+	reuseGrace    time.Duration
+	maxSlugLength int
+	reservations  map[Key]reservation
+}
+
+type reservation struct {
+	user  string
+	until time.Time
 }
 
 var (
@@ -43,10 +54,13 @@ var (
 	ErrSlugUnchanged        = fmt.Errorf("slug is unchanged")
 )
 
-func NewRegistry() Registry {
+func NewRegistry(slugReuseGrace time.Duration, maxSlugLength int) Registry {
 	return &registry{
-		byUser:    make(map[string]map[Key]Session),
-		slugIndex: make(map[Key]string),
+		byUser:        make(map[string]map[Key]Session),
+		slugIndex:     make(map[Key]string),
+		reuseGrace:    slugReuseGrace,
+		maxSlugLength: maxSlugLength,
+		reservations:  make(map[Key]reservation),
 	}
 }
 
@@ -90,14 +104,27 @@ func (r *registry) Update(user string, oldKey, newKey Key) error {
 		return ErrForbiddenSlug
 	}
 
-	if !isValidSlug(newKey.Id) {
+	if !isValidSlug(newKey.Id, r.maxSlugLength) {
 		return ErrInvalidSlug
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.slugIndex[newKey]; exists && newKey != oldKey {
+	// Keeping the current slug leaves the maps alone, so it never stops
+	// resolving mid-update.
+	if newKey == oldKey {
+		if _, ok := r.byUser[user][oldKey]; !ok {
+			return ErrSessionNotFound
+		}
+		return nil
+	}
+
+	if _, exists := r.slugIndex[newKey]; exists {
+		return ErrSlugInUse
+	}
+
+	if r.reservedForOther(newKey, user) {
 		return ErrSlugInUse
 	}
 
@@ -111,6 +138,8 @@ func (r *registry) Update(user string, oldKey, newKey Key) error {
 
 	client.Slug().Set(newKey.Id)
 	r.slugIndex[newKey] = user
+	r.lifetimes.release(oldKey)
+	r.lifetimes.assign(newKey)
 
 	r.byUser[user][newKey] = client
 	return nil
@@ -125,12 +154,16 @@ func (r *registry) Register(key Key, userSession Session) (success bool) {
 	}
 
 	userID := userSession.Lifecycle().User()
+	if r.reservedForOther(key, userID) {
+		return false
+	}
 	if r.byUser[userID] == nil {
 		r.byUser[userID] = make(map[Key]Session)
 	}
 
 	r.byUser[userID][key] = userSession
 	r.slugIndex[key] = userID
+	r.lifetimes.assign(key)
 	return true
 }
 
@@ -150,6 +183,19 @@ func (r *registry) GetAllSessionFromUser(user string) []Session {
 	return sessions
 }
 
+func (r *registry) Sessions() map[Key]Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make(map[Key]Session, len(r.slugIndex))
+	for key, userID := range r.slugIndex {
+		if s, ok := r.byUser[userID][key]; ok {
+			sessions[key] = s
+		}
+	}
+	return sessions
+}
+
 func (r *registry) Remove(key Key) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -164,10 +210,37 @@ func (r *registry) Remove(key Key) {
 		delete(r.byUser, userID)
 	}
 	delete(r.slugIndex, key)
+	r.lifetimes.release(key)
+	r.reserve(key, userID)
+}
+
+func (r *registry) reserve(key Key, user string) {
+	if r.reuseGrace <= 0 || key.Type != types.TunnelTypeHTTP {
+		return
+	}
+	at := now()
+	for k, res := range r.reservations {
+		if !at.Before(res.until) {
+			delete(r.reservations, k)
+		}
+	}
+	r.reservations[key] = reservation{user: user, until: at.Add(r.reuseGrace)}
 }
 
-func isValidSlug(slug string) bool {
-	if len(slug) < minSlugLength || len(slug) > maxSlugLength {
+func (r *registry) reservedForOther(key Key, user string) bool {
+	res, ok := r.reservations[key]
+	if !ok {
+		return false
+	}
+	if res.user != user && now().Before(res.until) {
+		return true
+	}
+	delete(r.reservations, key)
+	return false
+}
+
+func isValidSlug(slug string, maxLength int) bool {
+	if len(slug) < minSlugLength || len(slug) > maxLength {
 		return false
 	}
 
@@ -322,7 +395,4 @@ var forbiddenSlugs = map[string]struct{}{
 	"false":         {},
 }
 
-var (
-	minSlugLength = 3
-	maxSlugLength = 20
-)
+const minSlugLength = 3
@@ -88,6 +88,7 @@ func (ml *mockLifecycle) PortRegistry() lifecycle.PortRegistry {
 func (ml *mockLifecycle) SetChannel(channel ssh.Channel) error { return ml.Called(channel).Error(0) }
 func (ml *mockLifecycle) SetStatus(status types.SessionStatus) { ml.Called(status) }
 func (ml *mockLifecycle) IsActive() bool                       { return ml.Called().Bool(0) }
+func (ml *mockLifecycle) IsClosed() bool                       { return ml.Called().Bool(0) }
 func (ml *mockLifecycle) StartedAt() time.Time                 { return ml.Called().Get(0).(time.Time) }
 func (ml *mockLifecycle) Close() error                         { return ml.Called().Error(0) }
 func (ml *mockLifecycle) User() string                         { return ml.Called().String(0) }
@@ -118,7 +119,7 @@ func createMockSession(user ...string) *mockSession {
 }
 
 func TestNewRegistry(t *testing.T) {
-	r := NewRegistry()
+	r := NewRegistry(0, 20)
 	require.NotNil(t, r)
 }
 
@@ -333,6 +334,25 @@ func TestRegistry_Update(t *testing.T) {
 			},
 			wantErr: ErrInvalidSlug,
 		},
+		{
+			name: "change slug to one longer than the limit",
+			user: "user1",
+			setupFunc: func(r *registry) (types.SessionKey, types.SessionKey) {
+				oldKey := types.SessionKey{Id: "test1", Type: types.TunnelTypeHTTP}
+				newKey := types.SessionKey{Id: "twenty-one-characters", Type: types.TunnelTypeHTTP}
+				session := createMockSession()
+
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.byUser["user1"] = map[types.SessionKey]Session{
+					oldKey: session,
+				}
+				r.slugIndex[oldKey] = "user1"
+
+				return oldKey, newKey
+			},
+			wantErr: ErrInvalidSlug,
+		},
 		{
 			name: "change slug but session not found",
 			user: "user2",
@@ -417,9 +437,10 @@ func TestRegistry_Update(t *testing.T) {
 			t.Parallel()
 
 			r := &registry{
-				byUser:    make(map[string]map[types.SessionKey]Session),
-				slugIndex: make(map[types.SessionKey]string),
-				mu:        sync.RWMutex{},
+				byUser:        make(map[string]map[types.SessionKey]Session),
+				slugIndex:     make(map[types.SessionKey]string),
+				maxSlugLength: 20,
+				mu:            sync.RWMutex{},
 			}
 
 			oldKey, newKey := tt.setupFunc(r)
@@ -439,6 +460,37 @@ func TestRegistry_Update(t *testing.T) {
 	}
 }
 
+func TestRegistry_UpdateIdenticalKey(t *testing.T) {
+	key := types.SessionKey{Id: "same-slug", Type: types.TunnelTypeHTTP}
+
+	t.Run("is a no-op", func(t *testing.T) {
+		r := NewRegistry(0, 20).(*registry)
+		session := createMockSession("user1")
+		require.True(t, r.Register(key, session))
+		slug := session.Slug().(*mockSlug)
+		assignedAt := r.lifetimes.assigned[key]
+
+		require.NoError(t, r.Update("user1", key, key))
+
+		assert.Equal(t, map[types.SessionKey]string{key: "user1"}, r.slugIndex)
+		assert.Equal(t, map[types.SessionKey]Session{key: session}, r.byUser["user1"])
+		assert.Equal(t, assignedAt, r.lifetimes.assigned[key])
+		slug.AssertNotCalled(t, "Set", mock.Anything)
+
+		got, err := r.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, session, got)
+	})
+
+	t.Run("still requires ownership", func(t *testing.T) {
+		r := NewRegistry(0, 20).(*registry)
+		require.True(t, r.Register(key, createMockSession("user1")))
+
+		assert.ErrorIs(t, r.Update("user2", key, key), ErrSessionNotFound)
+		assert.Equal(t, map[types.SessionKey]string{key: "user1"}, r.slugIndex)
+	})
+}
+
 func TestRegistry_Register(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -560,6 +612,27 @@ func TestRegistry_GetAllSessionFromUser(t *testing.T) {
 	}
 }
 
+func TestRegistry_Sessions(t *testing.T) {
+	r := NewRegistry(0, 20)
+	assert.Empty(t, r.Sessions())
+
+	key1 := types.SessionKey{Id: "alpha", Type: types.TunnelTypeHTTP}
+	key2 := types.SessionKey{Id: "40000", Type: types.TunnelTypeTCP}
+	s1 := createMockSession("user1")
+	s2 := createMockSession("user2")
+	require.True(t, r.Register(key1, s1))
+	require.True(t, r.Register(key2, s2))
+
+	sessions := r.Sessions()
+	assert.Len(t, sessions, 2)
+	assert.Same(t, s1, sessions[key1])
+	assert.Same(t, s2, sessions[key2])
+
+	delete(sessions, key1)
+	_, err := r.Get(key1)
+	assert.NoError(t, err, "modifying the snapshot must not affect the registry")
+}
+
 func TestRegistry_Remove(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -615,6 +688,63 @@ func TestRegistry_Remove(t *testing.T) {
 	}
 }
 
+func TestRegistry_SlugReuseGrace(t *testing.T) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldNow := now
+	now = func() time.Time { return current }
+	defer func() { now = oldNow }()
+
+	key := types.SessionKey{Id: "held", Type: types.TunnelTypeHTTP}
+
+	t.Run("reserved for owner within grace", func(t *testing.T) {
+		r := NewRegistry(time.Minute, 20)
+		require.True(t, r.Register(key, createMockSession("owner")))
+		r.Remove(key)
+
+		current = current.Add(30 * time.Second)
+		assert.False(t, r.Register(key, createMockSession("other")))
+		_, err := r.Get(key)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		assert.True(t, r.Register(key, createMockSession("owner")))
+	})
+
+	t.Run("released after grace", func(t *testing.T) {
+		r := NewRegistry(time.Minute, 20)
+		require.True(t, r.Register(key, createMockSession("owner")))
+		r.Remove(key)
+
+		current = current.Add(time.Minute)
+		assert.True(t, r.Register(key, createMockSession("other")))
+	})
+
+	t.Run("update blocked within grace", func(t *testing.T) {
+		r := NewRegistry(time.Minute, 20)
+		other := types.SessionKey{Id: "other-slug", Type: types.TunnelTypeHTTP}
+		require.True(t, r.Register(key, createMockSession("owner")))
+		require.True(t, r.Register(other, createMockSession("other")))
+		r.Remove(key)
+
+		assert.ErrorIs(t, r.Update("other", other, key), ErrSlugInUse)
+		current = current.Add(2 * time.Minute)
+		assert.NoError(t, r.Update("other", other, key))
+	})
+
+	t.Run("tcp ports are not reserved", func(t *testing.T) {
+		r := NewRegistry(time.Minute, 20)
+		tcpKey := types.SessionKey{Id: "9000", Type: types.TunnelTypeTCP}
+		require.True(t, r.Register(tcpKey, createMockSession("owner")))
+		r.Remove(tcpKey)
+		assert.True(t, r.Register(tcpKey, createMockSession("other")))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		r := NewRegistry(0, 20)
+		require.True(t, r.Register(key, createMockSession("owner")))
+		r.Remove(key)
+		assert.True(t, r.Register(key, createMockSession("other")))
+	})
+}
+
 func TestIsValidSlug(t *testing.T) {
 	tests := []struct {
 		slug string
@@ -633,7 +763,7 @@ func TestIsValidSlug(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.slug, func(t *testing.T) {
-			got := isValidSlug(tt.slug)
+			got := isValidSlug(tt.slug, 20)
 			if got != tt.want {
 				t.Errorf("isValidSlug(%q) = %v; want %v", tt.slug, got, tt.want)
 			}
@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"tunnel_pls/internal/port"
+	"tunnel_pls/internal/types"
+)
+
+type Sweeper interface {
+	Run(ctx context.Context)
+	Sweep()
+}
+
+type sweeper struct {
+	mu       sync.Mutex
+	registry Registry
+	ports    port.Port
+	interval time.Duration
+	suspects map[uint16]struct{}
+}
+
+func NewSweeper(registry Registry, ports port.Port, interval time.Duration) Sweeper {
+	return &sweeper{
+		registry: registry,
+		ports:    ports,
+		interval: interval,
+		suspects: make(map[uint16]struct{}),
+	}
+}
+
+func (s *sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+func (s *sweeper) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	livePorts := make(map[uint16]struct{})
+	for key, session := range s.registry.Sessions() {
+		if session.Lifecycle().IsClosed() {
+			log.Printf("Removing closed session %s from registry", key.Id)
+			s.registry.Remove(key)
+			continue
+		}
+		if key.Type != types.TunnelTypeTCP && key.Type != types.TunnelTypeUDP {
+			continue
+		}
+		if p, err := strconv.ParseUint(key.Id, 10, 16); err == nil {
+			livePorts[uint16(p)] = struct{}{}
+		}
+	}
+
+	suspects := make(map[uint16]struct{})
+	for _, p := range s.ports.Assigned() {
+		if _, ok := livePorts[p]; ok {
+			continue
+		}
+		if _, ok := s.suspects[p]; !ok {
+			suspects[p] = struct{}{}
+			continue
+		}
+		log.Printf("Releasing orphaned port %d", p)
+		if err := s.ports.SetStatus(p, false); err != nil {
+			log.Printf("failed to release orphaned port %d: %v", p, err)
+		}
+	}
+	s.suspects = suspects
+}
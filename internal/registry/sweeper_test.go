@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tunnel_pls/internal/port"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSweepSession(user string, closed bool) *mockSession {
+	m := new(mockSession)
+	ml := new(mockLifecycle)
+	ml.On("User").Return(user).Maybe()
+	ml.On("IsClosed").Return(closed).Maybe()
+	m.On("Lifecycle").Return(ml).Maybe()
+	return m
+}
+
+func TestSweeperReleasesOrphanedPorts(t *testing.T) {
+	reg := NewRegistry(0, 20)
+	ports := port.New()
+	require.NoError(t, ports.AddRange(40000, 40002))
+
+	require.True(t, ports.Claim(40000))
+	require.True(t, reg.Register(types.SessionKey{Id: "40000", Type: types.TunnelTypeTCP}, createSweepSession("user1", false)))
+	require.True(t, ports.Claim(40001))
+
+	sweeper := NewSweeper(reg, ports, time.Minute)
+
+	sweeper.Sweep()
+	assert.Equal(t, []uint16{40000, 40001}, ports.Assigned(), "orphaned port is kept for one sweep in case its session is still being set up")
+
+	sweeper.Sweep()
+	assert.Equal(t, []uint16{40000}, ports.Assigned())
+}
+
+func TestSweeperKeepsUDPTunnelPorts(t *testing.T) {
+	reg := NewRegistry(0, 20)
+	ports := port.New()
+	require.NoError(t, ports.AddRange(40000, 40002))
+
+	require.True(t, ports.Claim(40000))
+	require.True(t, reg.Register(types.SessionKey{Id: "40000", Type: types.TunnelTypeUDP}, createSweepSession("user1", false)))
+
+	sweeper := NewSweeper(reg, ports, time.Minute)
+	sweeper.Sweep()
+	sweeper.Sweep()
+	assert.Equal(t, []uint16{40000}, ports.Assigned())
+}
+
+func TestSweeperKeepsPortThatGainedSession(t *testing.T) {
+	reg := NewRegistry(0, 20)
+	ports := port.New()
+	require.NoError(t, ports.AddRange(40000, 40000))
+	require.True(t, ports.Claim(40000))
+
+	sweeper := NewSweeper(reg, ports, time.Minute)
+	sweeper.Sweep()
+
+	require.True(t, reg.Register(types.SessionKey{Id: "40000", Type: types.TunnelTypeTCP}, createSweepSession("user1", false)))
+	sweeper.Sweep()
+	sweeper.Sweep()
+
+	assert.Equal(t, []uint16{40000}, ports.Assigned())
+}
+
+func TestSweeperRemovesClosedSessions(t *testing.T) {
+	reg := NewRegistry(0, 20)
+	ports := port.New()
+	require.NoError(t, ports.AddRange(40000, 40001))
+
+	liveKey := types.SessionKey{Id: "live-slug", Type: types.TunnelTypeHTTP}
+	deadKey := types.SessionKey{Id: "dead-slug", Type: types.TunnelTypeHTTP}
+	deadTCPKey := types.SessionKey{Id: "40001", Type: types.TunnelTypeTCP}
+	require.True(t, reg.Register(liveKey, createSweepSession("user1", false)))
+	require.True(t, reg.Register(deadKey, createSweepSession("user2", true)))
+	require.True(t, ports.Claim(40001))
+	require.True(t, reg.Register(deadTCPKey, createSweepSession("user2", true)))
+
+	sweeper := NewSweeper(reg, ports, time.Minute)
+	sweeper.Sweep()
+
+	_, err := reg.Get(liveKey)
+	assert.NoError(t, err)
+	_, err = reg.Get(deadKey)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	_, err = reg.Get(deadTCPKey)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	sweeper.Sweep()
+	assert.Empty(t, ports.Assigned())
+}
+
+func TestSweeperRun(t *testing.T) {
+	reg := NewRegistry(0, 20)
+	ports := port.New()
+	require.NoError(t, ports.AddRange(40000, 40000))
+	require.True(t, ports.Claim(40000))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewSweeper(reg, ports, 10*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(ports.Assigned()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after context cancellation")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"sync"
 	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/grpc/client"
@@ -14,6 +15,8 @@ import (
 	"tunnel_pls/internal/random"
 	"tunnel_pls/internal/registry"
 	"tunnel_pls/internal/session"
+	"tunnel_pls/internal/transport"
+	"tunnel_pls/internal/types"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -31,8 +34,12 @@ type server struct {
 	grpcClient      client.Client
 	sessionRegistry registry.Registry
 	portRegistry    port.Port
+	done            chan struct{}
+	closeOnce       sync.Once
 }
 
+var readinessRetryInterval = 2 * time.Second
+
 func New(randomizer random.Random, config config.Config, sshConfig *ssh.ServerConfig, sessionRegistry registry.Registry, grpcClient client.Client, portRegistry port.Port, sshPort string) (Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", sshPort))
 	if err != nil {
@@ -48,10 +55,16 @@ func New(randomizer random.Random, config config.Config, sshConfig *ssh.ServerCo
 		grpcClient:      grpcClient,
 		sessionRegistry: sessionRegistry,
 		portRegistry:    portRegistry,
+		done:            make(chan struct{}),
 	}, nil
 }
 
 func (s *server) Start() {
+	if !s.waitUntilReady() {
+		log.Println("server closed before becoming ready")
+		return
+	}
+
 	log.Printf("SSH server is starting on port %s", s.sshPort)
 	for {
 		conn, err := s.sshListener.Accept()
@@ -69,9 +82,49 @@ func (s *server) Start() {
 }
 
 func (s *server) Close() error {
+	if s.done != nil {
+		s.closeOnce.Do(func() {
+			close(s.done)
+		})
+	}
 	return s.sshListener.Close()
 }
 
+func (s *server) waitUntilReady() bool {
+	if s.grpcClient == nil || s.config.Mode() != types.ServerModeNODE {
+		return true
+	}
+
+	for {
+		err := s.checkReadiness()
+		if err == nil {
+			return true
+		}
+		log.Printf("SSH server not ready, retrying in %s: %v", readinessRetryInterval, err)
+
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(readinessRetryInterval):
+		}
+	}
+}
+
+func (s *server) checkReadiness() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := s.grpcClient.CheckServerHealth(ctx); err != nil {
+		return fmt.Errorf("gRPC health check failed: %w", err)
+	}
+
+	if s.config.TLSEnabled() {
+		if _, err := transport.NewTLSConfig(s.config); err != nil {
+			return fmt.Errorf("TLS not initialized: %w", err)
+		}
+	}
+	return nil
+}
+
 func (s *server) handleConnection(conn net.Conn) {
 	sshConn, chans, forwardingReqs, err := ssh.NewServerConn(conn, s.sshConfig)
 	if err != nil {
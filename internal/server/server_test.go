@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 	"tunnel_pls/internal/registry"
@@ -32,23 +33,75 @@ type MockConfig struct {
 	mock.Mock
 }
 
-func (m *MockConfig) Domain() string            { return m.Called().String(0) }
-func (m *MockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *MockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *MockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *MockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *MockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *MockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *MockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *MockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) AllowedPortsStart() uint16 { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) AllowedPortsEnd() uint16   { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *MockConfig) PprofPort() string         { return m.Called().String(0) }
+func (m *MockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *MockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *MockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *MockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *MockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *MockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *MockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *MockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) TLSStoragePath() string           { return m.Called().String(0) }
+func (m *MockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *MockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *MockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *MockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *MockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *MockConfig) AllowedPortsStart() uint16        { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) AllowedPortsEnd() uint16          { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *MockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *MockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *MockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *MockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *MockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *MockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *MockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *MockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *MockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *MockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *MockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *MockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *MockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *MockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *MockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *MockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *MockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *MockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *MockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *MockConfig) PprofPort() string                    { return m.Called().String(0) }
 func (m *MockConfig) Mode() types.ServerMode {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -63,10 +116,30 @@ func (m *MockConfig) Mode() types.ServerMode {
 		return types.ServerMode(args.Int(0))
 	}
 }
-func (m *MockConfig) GRPCAddress() string { return m.Called().String(0) }
-func (m *MockConfig) GRPCPort() string    { return m.Called().String(0) }
-func (m *MockConfig) NodeToken() string   { return m.Called().String(0) }
-func (m *MockConfig) KeyLoc() string      { return m.Called().String(0) }
+func (m *MockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *MockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *MockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *MockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *MockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *MockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *MockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *MockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *MockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *MockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *MockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *MockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *MockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *MockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *MockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) KeyLoc() string                       { return m.Called().String(0) }
+func (m *MockConfig) SSHHostKey() string                   { return m.Called().String(0) }
 
 type MockSessionRegistry struct {
 	mock.Mock
@@ -107,6 +180,11 @@ func (m *MockSessionRegistry) GetAllSessionFromUser(user string) []registry.Sess
 	return args.Get(0).([]registry.Session)
 }
 
+func (m *MockSessionRegistry) Sessions() map[registry.Key]registry.Session {
+	args := m.Called()
+	return args.Get(0).(map[registry.Key]registry.Session)
+}
+
 func (m *MockSessionRegistry) Slug() slug.Slug {
 	args := m.Called()
 	return args.Get(0).(slug.Slug)
@@ -131,6 +209,11 @@ func (m *MockGRPCClient) CheckServerHealth(ctx context.Context) error {
 	return args.Error(0)
 }
 
+func (m *MockGRPCClient) WaitForServerHealth(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func (m *MockGRPCClient) SubscribeEvents(ctx context.Context, domain, token string) error {
 	args := m.Called(ctx, domain, token)
 	return args.Error(0)
@@ -161,6 +244,13 @@ func (m *MockPort) SetStatus(port uint16, assigned bool) error {
 func (m *MockPort) Claim(port uint16) bool {
 	return m.Called(port).Bool(0)
 }
+func (m *MockPort) Assigned() []uint16 {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]uint16)
+}
 
 type MockListener struct {
 	mock.Mock
@@ -286,6 +376,7 @@ func TestClose(t *testing.T) {
 func TestStart(t *testing.T) {
 	mr := new(MockRandom)
 	mc := new(MockConfig)
+	mc.On("Mode").Return(types.ServerModeSTANDALONE)
 	mreg := new(MockSessionRegistry)
 	mg := new(MockGRPCClient)
 	mp := new(MockPort)
@@ -333,6 +424,7 @@ func TestStart(t *testing.T) {
 		mockSessionRegistry := &MockSessionRegistry{}
 		mockGrpcClient := &MockGRPCClient{}
 		mockPort := &MockPort{}
+		mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 
 		sshConfig, _ := getTestSSHConfig()
 
@@ -401,6 +493,115 @@ func TestStart(t *testing.T) {
 	})
 }
 
+func TestStartReadinessGate(t *testing.T) {
+	oldInterval := readinessRetryInterval
+	readinessRetryInterval = 10 * time.Millisecond
+	defer func() { readinessRetryInterval = oldInterval }()
+
+	t.Run("waits for healthy gRPC before accepting", func(t *testing.T) {
+		mockConfig := &MockConfig{}
+		mockConfig.On("Mode").Return(types.ServerModeNODE)
+		mockConfig.On("TLSEnabled").Return(false)
+
+		var healthChecks atomic.Int32
+		mockGrpcClient := &MockGRPCClient{}
+		mockGrpcClient.On("CheckServerHealth", mock.Anything).Run(func(args mock.Arguments) {
+			healthChecks.Add(1)
+		}).Return(errors.New("unhealthy")).Twice()
+		mockGrpcClient.On("CheckServerHealth", mock.Anything).Run(func(args mock.Arguments) {
+			healthChecks.Add(1)
+		}).Return(nil).Once()
+
+		var checksBeforeAccept int32
+		mockListener := &MockListener{}
+		mockListener.On("Accept").Run(func(args mock.Arguments) {
+			checksBeforeAccept = healthChecks.Load()
+		}).Return(nil, net.ErrClosed).Once()
+
+		s := &server{
+			config:      mockConfig,
+			sshPort:     "0",
+			sshListener: mockListener,
+			grpcClient:  mockGrpcClient,
+			done:        make(chan struct{}),
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			s.Start()
+			close(finished)
+		}()
+
+		select {
+		case <-finished:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Start did not return")
+		}
+
+		assert.Equal(t, int32(3), checksBeforeAccept)
+		mockGrpcClient.AssertExpectations(t)
+		mockListener.AssertExpectations(t)
+	})
+
+	t.Run("close while waiting stops start", func(t *testing.T) {
+		mockConfig := &MockConfig{}
+		mockConfig.On("Mode").Return(types.ServerModeNODE)
+
+		mockGrpcClient := &MockGRPCClient{}
+		mockGrpcClient.On("CheckServerHealth", mock.Anything).Return(errors.New("unhealthy"))
+
+		mockListener := &MockListener{}
+		mockListener.On("Close").Return(nil)
+
+		s := &server{
+			config:      mockConfig,
+			sshPort:     "0",
+			sshListener: mockListener,
+			grpcClient:  mockGrpcClient,
+			done:        make(chan struct{}),
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			s.Start()
+			close(finished)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, s.Close())
+
+		select {
+		case <-finished:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Start did not return after Close")
+		}
+
+		mockListener.AssertNotCalled(t, "Accept")
+	})
+
+	t.Run("standalone mode skips health check", func(t *testing.T) {
+		mockConfig := &MockConfig{}
+		mockConfig.On("Mode").Return(types.ServerModeSTANDALONE)
+
+		mockGrpcClient := &MockGRPCClient{}
+
+		mockListener := &MockListener{}
+		mockListener.On("Accept").Return(nil, net.ErrClosed).Once()
+
+		s := &server{
+			config:      mockConfig,
+			sshPort:     "0",
+			sshListener: mockListener,
+			grpcClient:  mockGrpcClient,
+		}
+
+		s.Start()
+
+		mockGrpcClient.AssertNotCalled(t, "CheckServerHealth", mock.Anything)
+		mockListener.AssertExpectations(t)
+	})
+}
+
 func TestHandleConnection(t *testing.T) {
 	t.Run("SSH handshake fails - connection closed", func(t *testing.T) {
 		mockRandom := &MockRandom{}
@@ -483,6 +684,12 @@ func TestHandleConnection(t *testing.T) {
 		mockConfig.On("Domain").Return("test.com")
 		mockConfig.On("Mode").Return(types.ServerModeNODE)
 		mockConfig.On("SSHPort").Return("2200")
+		mockConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mockConfig.On("TunnelURLBanner").Return(false).Maybe()
+		mockConfig.On("MaxSlugLength").Return(20).Maybe()
+		mockConfig.On("NodeRegion").Return("").Maybe()
+		mockConfig.On("TLSEnabled").Return(false).Maybe()
+		mockConfig.On("TunnelEventsWebhook").Return("").Maybe()
 		mockRandom.On("String", mock.Anything).Return("ilovefemboy", nil)
 		mockSessionRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
 		mockSessionRegistry.On("Remove", mock.Anything).Return(nil)
@@ -578,6 +785,12 @@ func TestHandleConnection(t *testing.T) {
 		mockConfig.On("Domain").Return("test.com")
 		mockConfig.On("Mode").Return(types.ServerModeNODE)
 		mockConfig.On("SSHPort").Return("2200")
+		mockConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mockConfig.On("TunnelURLBanner").Return(false).Maybe()
+		mockConfig.On("MaxSlugLength").Return(20).Maybe()
+		mockConfig.On("NodeRegion").Return("").Maybe()
+		mockConfig.On("TLSEnabled").Return(false).Maybe()
+		mockConfig.On("TunnelEventsWebhook").Return("").Maybe()
 		mockRandom.On("String", mock.Anything).Return("ilovefemboy", nil)
 		mockSessionRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
 		mockSessionRegistry.On("Remove", mock.Anything).Return(nil)
@@ -673,6 +886,12 @@ func TestHandleConnection(t *testing.T) {
 		mockConfig.On("Domain").Return("test.com")
 		mockConfig.On("Mode").Return(types.ServerModeNODE)
 		mockConfig.On("SSHPort").Return("2200")
+		mockConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mockConfig.On("TunnelURLBanner").Return(false).Maybe()
+		mockConfig.On("MaxSlugLength").Return(20).Maybe()
+		mockConfig.On("NodeRegion").Return("").Maybe()
+		mockConfig.On("TLSEnabled").Return(false).Maybe()
+		mockConfig.On("TunnelEventsWebhook").Return("").Maybe()
 		mockRandom.On("String", mock.Anything).Return("ilovefemboy", nil)
 		mockSessionRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
 		mockSessionRegistry.On("Remove", mock.Anything).Return(nil)
@@ -800,6 +1019,7 @@ func TestIntegration(t *testing.T) {
 		mg := new(MockGRPCClient)
 		mp := new(MockPort)
 		sc, _ := getTestSSHConfig()
+		mc.On("Mode").Return(types.ServerModeSTANDALONE)
 
 		s, err := New(mr, mc, sc, mreg, mg, mp, "0")
 		assert.NoError(t, err)
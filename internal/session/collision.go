@@ -0,0 +1,80 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"tunnel_pls/internal/config"
+	"tunnel_pls/internal/random"
+	"tunnel_pls/internal/registry"
+	"tunnel_pls/internal/types"
+)
+
+const (
+	slugSuffixLength     = 4
+	maxCollisionAttempts = 3
+)
+
+type collisionRegistry struct {
+	registry.Registry
+	config     config.Config
+	randomizer random.Random
+}
+
+func newCollisionRegistry(reg registry.Registry, conf config.Config, randomizer random.Random) *collisionRegistry {
+	return &collisionRegistry{
+		Registry:   reg,
+		config:     conf,
+		randomizer: randomizer,
+	}
+}
+
+func (c *collisionRegistry) Update(user string, oldKey, newKey types.SessionKey) error {
+	err := c.Registry.Update(user, oldKey, newKey)
+	if !errors.Is(err, registry.ErrSlugInUse) || c.config.SlugCollisionPolicy() != types.CollisionPolicySUFFIX {
+		return err
+	}
+
+	for attempt := 0; attempt < maxCollisionAttempts; attempt++ {
+		candidate, suffixErr := c.suffixed(newKey.Id)
+		if suffixErr != nil {
+			return suffixErr
+		}
+		err = c.Registry.Update(user, oldKey, types.SessionKey{Id: candidate, Type: newKey.Type})
+		if !errors.Is(err, registry.ErrSlugInUse) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *collisionRegistry) register(key types.SessionKey, session registry.Session) (types.SessionKey, bool) {
+	if c.Registry.Register(key, session) {
+		return key, true
+	}
+	if c.config.SlugCollisionPolicy() != types.CollisionPolicySUFFIX {
+		return key, false
+	}
+
+	for attempt := 0; attempt < maxCollisionAttempts; attempt++ {
+		candidate, err := c.suffixed(key.Id)
+		if err != nil {
+			return key, false
+		}
+		suffixedKey := types.SessionKey{Id: candidate, Type: key.Type}
+		if c.Registry.Register(suffixedKey, session) {
+			return suffixedKey, true
+		}
+	}
+	return key, false
+}
+
+func (c *collisionRegistry) suffixed(slug string) (string, error) {
+	suffix, err := c.randomizer.String(slugSuffixLength)
+	if err != nil {
+		return "", err
+	}
+	if keep := c.config.MaxSlugLength() - slugSuffixLength - 1; len(slug) > keep {
+		slug = strings.TrimRight(slug[:keep], "-")
+	}
+	return slug + "-" + suffix, nil
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var directDialTimeout = 5 * time.Second
+
+type directTCPIPPayload struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func (s *session) serveChannels() {
+	for channel := range s.sshChan {
+		if channel.ChannelType() == "direct-tcpip" {
+			go s.handleDirectTCPIP(channel)
+			continue
+		}
+		if err := channel.Reject(ssh.UnknownChannelType, "unsupported channel type"); err != nil {
+			log.Printf("failed to reject %s channel: %v", channel.ChannelType(), err)
+		}
+	}
+}
+
+func (s *session) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	if !s.config.DirectTCPIPEnabled() {
+		_ = newChannel.Reject(ssh.Prohibited, "direct-tcpip is disabled on this server")
+		return
+	}
+
+	var payload directTCPIPPayload
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil || payload.DestPort > 65535 {
+		_ = newChannel.Reject(ssh.ConnectionFailed, "invalid direct-tcpip payload")
+		return
+	}
+
+	target := net.JoinHostPort(payload.DestAddr, strconv.FormatUint(uint64(payload.DestPort), 10))
+	if !isDirectTargetAllowed(s.config.DirectTCPIPAllowlist(), payload.DestAddr, payload.DestPort) {
+		_ = newChannel.Reject(ssh.Prohibited, fmt.Sprintf("destination %s is not allowed", target))
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", target, directDialTimeout)
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, fmt.Sprintf("failed to connect to %s", target))
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("failed to close direct-tcpip connection: %v", err)
+		}
+	}()
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		log.Printf("failed to accept direct-tcpip channel: %v", err)
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	defer func() {
+		_ = channel.Close()
+	}()
+
+	s.forwarder.HandleConnection(conn, channel)
+}
+
+func isDirectTargetAllowed(allowlist []string, host string, port uint32) bool {
+	host = strings.ToLower(host)
+	portStr := strconv.FormatUint(uint64(port), 10)
+	return slices.Contains(allowlist, net.JoinHostPort(host, portStr)) ||
+		slices.Contains(allowlist, net.JoinHostPort(host, "*"))
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"tunnel_pls/internal/config"
+	"tunnel_pls/internal/session/interaction"
+	"tunnel_pls/internal/types"
+)
+
+var eventClient = &http.Client{Timeout: 5 * time.Second}
+
+type tunnelCreatedEvent struct {
+	Event     string    `json:"event"`
+	URL       string    `json:"url"`
+	User      string    `json:"user"`
+	Type      string    `json:"type"`
+	Port      uint16    `json:"port"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *session) tunnelURL() string {
+	domain := config.TunnelDomain(s.config)
+	if s.forwarder.TunnelType() == types.TunnelTypeHTTP {
+		protocol := "http"
+		if s.config.TLSEnabled() {
+			protocol = "https"
+		}
+		return interaction.BuildURL(protocol, s.slug.String(), domain)
+	}
+	if s.forwarder.TunnelType() == types.TunnelTypeUDP {
+		return fmt.Sprintf("udp://%s:%d", domain, s.forwarder.ForwardedPort())
+	}
+	return fmt.Sprintf("tcp://%s:%d", domain, s.forwarder.ForwardedPort())
+}
+
+// emitTunnelCreated logs a tunnel.created event and posts it to
+// TUNNEL_EVENTS_WEBHOOK when one is set. The event is not sent over gRPC:
+// the control-plane proto has no Node payload for it, so the webhook is how
+// the control plane learns about new tunnels until the proto gains one.
+func (s *session) emitTunnelCreated() {
+	body, err := json.Marshal(tunnelCreatedEvent{
+		Event:     "tunnel.created",
+		URL:       s.tunnelURL(),
+		User:      s.lifecycle.User(),
+		Type:      s.Detail().ForwardingType,
+		Port:      s.forwarder.ForwardedPort(),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("failed to encode tunnel created event: %v", err)
+		return
+	}
+
+	log.Printf("Tunnel created: %s", body)
+	if webhook := s.config.TunnelEventsWebhook(); webhook != "" {
+		go postEvent(webhook, body)
+	}
+}
+
+func postEvent(url string, body []byte) {
+	resp, err := eventClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("failed to deliver tunnel event: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Printf("tunnel event webhook responded with %s", resp.Status)
+	}
+}
@@ -0,0 +1,42 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+)
+
+// nodeBandwidth is shared by every forwarder so the node as a whole stays
+// within its configured egress rate.
+var nodeBandwidth bandwidthBucket
+
+type bandwidthBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait takes n bytes from the bucket and sleeps until the rate allows them.
+// The bucket holds at most one second of traffic; callers that overdraw it
+// sleep off the debt, so concurrent copies queue behind each other.
+func (b *bandwidthBucket) wait(n int, limit int64) {
+	if limit <= 0 || n <= 0 {
+		return
+	}
+	rate := float64(limit)
+
+	b.mu.Lock()
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else {
+		b.tokens = min(rate, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,108 @@
+package forwarder
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+	"tunnel_pls/internal/session/slug"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthBucket(t *testing.T) {
+	t.Run("unlimited does not wait", func(t *testing.T) {
+		var b bandwidthBucket
+		start := time.Now()
+		b.wait(1<<30, 0)
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("burst of one second is free", func(t *testing.T) {
+		var b bandwidthBucket
+		start := time.Now()
+		b.wait(1000, 1000)
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("overdraw sleeps off the debt", func(t *testing.T) {
+		var b bandwidthBucket
+		start := time.Now()
+		b.wait(1000, 1000)
+		b.wait(200, 1000)
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	})
+}
+
+func TestHandleConnectionNodeBandwidthLimit(t *testing.T) {
+	const (
+		limit     = 16 * 1024
+		perTunnel = 8 * 1024
+		tunnels   = 3
+	)
+	nodeBandwidth = bandwidthBucket{}
+	t.Cleanup(func() { nodeBandwidth = bandwidthBucket{} })
+
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(512).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(limit))
+
+	payload := bytes.Repeat([]byte("x"), perTunnel)
+	received := make([]int64, tunnels)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for idx := range tunnels {
+		fw := New(cfg, slug.New(), nil)
+		channel, channelPeer := newChannelPair()
+		dstEndpoint, dstPeer := newPipePair()
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			fw.HandleConnection(dstEndpoint, channel)
+		}()
+		go func() {
+			defer wg.Done()
+			received[idx], _ = io.Copy(io.Discard, dstPeer)
+		}()
+		go func() {
+			_, _ = io.Copy(io.Discard, channelPeer)
+		}()
+
+		_, err := channelPeer.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, channelPeer.CloseWrite())
+		require.NoError(t, dstPeer.CloseWrite())
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for _, n := range received {
+		assert.Equal(t, int64(perTunnel), n)
+	}
+	// The first second of traffic is free, the remainder must be paced.
+	overdraw := float64(tunnels*perTunnel - limit)
+	assert.GreaterOrEqual(t, elapsed.Seconds(), overdraw/limit*0.9)
+}
+
+func TestForwardDatagramNodeBandwidthLimit(t *testing.T) {
+	nodeBandwidth = bandwidthBucket{}
+	t.Cleanup(func() { nodeBandwidth = bandwidthBucket{} })
+
+	cfg := &mockConfig{}
+	cfg.On("NodeBandwidthLimit").Return(int64(1000))
+	fw := New(cfg, slug.New(), nil).(*forwarder)
+	channel, channelPeer := newChannelPair()
+	go func() {
+		_, _ = io.Copy(io.Discard, channelPeer)
+	}()
+
+	start := time.Now()
+	require.NoError(t, fw.ForwardDatagram(channel, bytes.Repeat([]byte("x"), 1000)))
+	require.NoError(t, fw.ForwardDatagram(channel, bytes.Repeat([]byte("x"), 200)))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
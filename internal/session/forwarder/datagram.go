@@ -0,0 +1,132 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// MaxDatagramSize is the largest UDP payload the 2-byte length prefix used
+// on forwarded-udpip channels can frame.
+const MaxDatagramSize = 65535
+
+var ErrDatagramTooLarge = errors.New("datagram exceeds maximum frame size")
+
+// writeDatagram frames p with its big-endian length and writes it in a single
+// call, so concurrent writers never interleave partial frames.
+func writeDatagram(w io.Writer, p []byte) error {
+	if len(p) > MaxDatagramSize {
+		return ErrDatagramTooLarge
+	}
+	frame := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(frame, uint16(len(p)))
+	copy(frame[2:], p)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readDatagram reads one length-prefixed frame into buf, which must hold at
+// least MaxDatagramSize bytes.
+func readDatagram(r io.Reader, buf []byte) (int, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+// startFlow sets up the UDP_BYTE_BUDGET for a forwarded-udpip channel. Both
+// directions of a flow draw from it, as both directions of a TCP connection
+// do from TCP_BYTE_BUDGET.
+func (f *forwarder) startFlow(channel ssh.Channel, peer net.Addr) {
+	limit := f.config.UDPByteBudget()
+	if limit <= 0 {
+		return
+	}
+	f.flowBudgets.Store(channel, &byteBudget{
+		limit: limit,
+		exceeded: func() {
+			log.Printf("Closing UDP flow from %s on port %d: %v", peer, f.ForwardedPort(), ErrByteBudgetExceeded)
+			_ = channel.Close()
+		},
+	})
+}
+
+// chargeDatagram applies the flow's byte budget and the node bandwidth limit
+// to a datagram of n bytes and counts it. A datagram over budget is dropped
+// whole rather than truncated.
+func (f *forwarder) chargeDatagram(channel ssh.Channel, n int, count *atomic.Uint64) error {
+	if budget, ok := f.flowBudgets.Load(channel); ok {
+		if _, err := budget.(*byteBudget).consume(n, nil); err != nil {
+			return err
+		}
+	}
+	count.Add(uint64(n))
+	nodeBandwidth.wait(n, f.config.NodeBandwidthLimit())
+	return nil
+}
+
+// ForwardDatagram sends one datagram received from a UDP peer to the SSH
+// client over that peer's channel.
+func (f *forwarder) ForwardDatagram(dst ssh.Channel, p []byte) error {
+	if len(p) > MaxDatagramSize {
+		f.recentErrors.record(fmt.Errorf("forward datagram: %w", ErrDatagramTooLarge))
+		return ErrDatagramTooLarge
+	}
+	if err := f.chargeDatagram(dst, len(p), &f.bytesIn); err != nil {
+		f.recentErrors.record(fmt.Errorf("forward datagram: %w", err))
+		return err
+	}
+	if err := writeDatagram(dst, p); err != nil {
+		f.recentErrors.record(fmt.Errorf("forward datagram: %w", err))
+		return err
+	}
+	return nil
+}
+
+// HandleDatagrams relays the SSH client's replies on src back to peer until
+// the channel is closed.
+func (f *forwarder) HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel) {
+	defer func() {
+		f.flowBudgets.Delete(src)
+		if tc, ok := src.(*trackedChannel); ok {
+			tc.release()
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, err := readDatagram(src, buf)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				f.recentErrors.record(fmt.Errorf("read datagram: %w", err))
+				log.Printf("Error reading datagram for %s: %v", peer, err)
+			}
+			return
+		}
+		if err = f.chargeDatagram(src, n, &f.bytesOut); err != nil {
+			f.recentErrors.record(fmt.Errorf("read datagram: %w", err))
+			return
+		}
+		if _, err = dst.WriteTo(buf[:n], peer); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			f.recentErrors.record(fmt.Errorf("write datagram: %w", err))
+			continue
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"tunnel_pls/internal/session/slug"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDatagramFraming(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		payloads := [][]byte{{}, []byte("ping"), bytes.Repeat([]byte{0xab}, MaxDatagramSize)}
+
+		var wire bytes.Buffer
+		for _, p := range payloads {
+			require.NoError(t, writeDatagram(&wire, p))
+		}
+
+		buf := make([]byte, MaxDatagramSize)
+		for _, want := range payloads {
+			n, err := readDatagram(&wire, buf)
+			require.NoError(t, err)
+			assert.Equal(t, want, buf[:n])
+		}
+		_, err := readDatagram(&wire, buf)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("oversized payload", func(t *testing.T) {
+		var wire bytes.Buffer
+		err := writeDatagram(&wire, make([]byte, MaxDatagramSize+1))
+		assert.ErrorIs(t, err, ErrDatagramTooLarge)
+		assert.Zero(t, wire.Len())
+	})
+
+	t.Run("truncated frame", func(t *testing.T) {
+		wire := bytes.NewReader([]byte{0x00, 0x05, 'p', 'i'})
+		_, err := readDatagram(wire, make([]byte, MaxDatagramSize))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestForwardDatagram(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("NodeBandwidthLimit").Return(int64(0))
+	f := New(cfg, slug.New(), &mockConn{}).(*forwarder)
+	channel, peer := newChannelPair()
+
+	require.NoError(t, f.ForwardDatagram(channel, []byte("hello")))
+
+	frame := make([]byte, 7)
+	_, err := io.ReadFull(peer, frame)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x05, 'h', 'e', 'l', 'l', 'o'}, frame)
+	assert.Equal(t, uint64(5), f.BytesIn())
+}
+
+func TestHandleDatagrams(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	cfg := &mockConfig{}
+	cfg.On("NodeBandwidthLimit").Return(int64(0))
+	f := New(cfg, slug.New(), &mockConn{}).(*forwarder)
+	channel, peer := newChannelPair()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.HandleDatagrams(server, client.LocalAddr(), channel)
+	}()
+
+	require.NoError(t, writeDatagram(peer, []byte("pong")))
+	require.NoError(t, writeDatagram(peer, []byte("again")))
+	require.NoError(t, peer.CloseWrite())
+
+	buf := make([]byte, 64)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+	for _, want := range []string{"pong", "again"} {
+		n, from, err := client.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(buf[:n]))
+		assert.Equal(t, server.LocalAddr().String(), from.String())
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleDatagrams did not return after the channel closed")
+	}
+	assert.Equal(t, uint64(9), f.BytesOut())
+	assert.Empty(t, f.RecentErrors())
+}
+
+func TestDatagramByteBudget(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("UDPByteBudget").Return(int64(8))
+	cfg.On("NodeBandwidthLimit").Return(int64(0))
+	f := New(cfg, slug.New(), &mockConn{}).(*forwarder)
+	f.SetType(types.TunnelTypeUDP)
+	f.SetForwardedPort(27015)
+	channel, peer := newChannelPair()
+	f.startFlow(channel, &net.UDPAddr{IP: net.ParseIP("203.0.113.9"), Port: 40000})
+
+	require.NoError(t, f.ForwardDatagram(channel, []byte("hello")))
+	err := f.ForwardDatagram(channel, []byte("world"))
+	assert.ErrorIs(t, err, ErrByteBudgetExceeded)
+
+	frame := make([]byte, 7)
+	_, err = io.ReadFull(peer, frame)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x05, 'h', 'e', 'l', 'l', 'o'}, frame)
+	assert.Equal(t, uint64(5), f.BytesIn())
+	channel.AssertCalled(t, "Close")
+
+	require.NoError(t, peer.CloseWrite())
+	f.HandleDatagrams(nil, nil, channel)
+	_, tracked := f.flowBudgets.Load(channel)
+	assert.False(t, tracked, "the budget should be dropped once the flow ends")
+}
+
+func TestOpenForwardedChannelType(t *testing.T) {
+	tests := []struct {
+		name        string
+		tunnelType  types.TunnelType
+		channelType string
+	}{
+		{name: "tcp tunnel", tunnelType: types.TunnelTypeTCP, channelType: "forwarded-tcpip"},
+		{name: "udp tunnel", tunnelType: types.TunnelTypeUDP, channelType: "forwarded-udpip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &mockConfig{}
+			cfg.On("TunnelLogDir").Return("")
+			cfg.On("LogConnections").Return(false)
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("UDPByteBudget").Return(int64(0)).Maybe()
+			channel, _ := newChannelPair()
+			conn := &mockConn{}
+			conn.On("OpenChannel", tt.channelType, mock.Anything).Return(channel, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil)
+
+			f := New(cfg, slug.New(), conn)
+			f.SetType(tt.tunnelType)
+			f.SetForwardedPort(27015)
+
+			_, _, err := f.OpenForwardedChannel(context.Background(), &net.UDPAddr{IP: net.ParseIP("203.0.113.9"), Port: 40000})
+			require.NoError(t, err)
+			conn.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package forwarder
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const recentErrorCapacity = 10
+
+type errorLog struct {
+	mu      sync.Mutex
+	entries [recentErrorCapacity]string
+	next    int
+	count   int
+}
+
+func (l *errorLog) record(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = time.Now().Format("15:04:05") + " " + strings.ReplaceAll(err.Error(), "\n", "; ")
+	l.next = (l.next + 1) % recentErrorCapacity
+	if l.count < recentErrorCapacity {
+		l.count++
+	}
+}
+
+func (l *errorLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]string, 0, l.count)
+	start := (l.next - l.count + recentErrorCapacity) % recentErrorCapacity
+	for i := 0; i < l.count; i++ {
+		out = append(out, l.entries[(start+i)%recentErrorCapacity])
+	}
+	return out
+}
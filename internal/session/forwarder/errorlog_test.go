@@ -0,0 +1,69 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLog(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		var l errorLog
+		assert.Empty(t, l.snapshot())
+	})
+
+	t.Run("keeps insertion order", func(t *testing.T) {
+		var l errorLog
+		l.record(errors.New("connection refused"))
+		l.record(errors.New("connection reset by peer"))
+
+		entries := l.snapshot()
+		require.Len(t, entries, 2)
+		assert.True(t, strings.HasSuffix(entries[0], " connection refused"))
+		assert.True(t, strings.HasSuffix(entries[1], " connection reset by peer"))
+	})
+
+	t.Run("drops oldest when full", func(t *testing.T) {
+		var l errorLog
+		for i := 0; i < recentErrorCapacity+3; i++ {
+			l.record(fmt.Errorf("error %d", i))
+		}
+
+		entries := l.snapshot()
+		require.Len(t, entries, recentErrorCapacity)
+		assert.True(t, strings.HasSuffix(entries[0], " error 3"))
+		assert.True(t, strings.HasSuffix(entries[recentErrorCapacity-1], fmt.Sprintf(" error %d", recentErrorCapacity+2)))
+	})
+
+	t.Run("flattens joined errors", func(t *testing.T) {
+		var l errorLog
+		l.record(errors.Join(errors.New("copy failed"), errors.New("close failed")))
+
+		entries := l.snapshot()
+		require.Len(t, entries, 1)
+		assert.NotContains(t, entries[0], "\n")
+		assert.Contains(t, entries[0], "copy failed; close failed")
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		var l errorLog
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					l.record(fmt.Errorf("worker %d", i))
+					_ = l.snapshot()
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.Len(t, l.snapshot(), recentErrorCapacity)
+	})
+}
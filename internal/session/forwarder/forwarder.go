@@ -2,39 +2,182 @@ package forwarder
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/session/slug"
 	"tunnel_pls/internal/types"
 
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh"
 )
 
+var (
+	ErrChannelLimit       = errors.New("forwarded channel limit reached")
+	ErrByteBudgetExceeded = errors.New("connection byte budget exceeded")
+	ErrOpenQueueTimeout   = errors.New("timed out waiting for a channel open slot")
+	ErrClientDisconnected = errors.New("ssh client disconnected")
+)
+
+var activeChannels atomic.Int64
+
+var sampleAccessLog = func(rate float64) bool {
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// MaxMirrorBodyLimit caps how much of each request body a tunnel may ask to
+// have mirrored, so debugging output cannot pin large buffers.
+const MaxMirrorBodyLimit = 64 * 1024
+
+const (
+	openRetryDelay           = 100 * time.Millisecond
+	maxConsecutiveEmptyReads = 100
+)
+
 type Forwarder interface {
 	SetType(tunnelType types.TunnelType)
 	SetForwardedPort(port uint16)
 	SetListener(listener net.Listener)
 	Listener() net.Listener
+	SetPacketConn(conn net.PacketConn)
 	TunnelType() types.TunnelType
 	ForwardedPort() uint16
+	SetAllowedMethods(methods []string)
+	AllowedMethods() []string
+	SetAllowedOrigins(origins []string)
+	AllowedOrigins() []string
+	SetHostHeader(host string)
+	HostHeader() string
+	SetRewriteLocation(enabled bool)
+	RewriteLocation() bool
+	SetDefaultContentType(contentType string)
+	DefaultContentType() string
+	SetMirrorBodyLimit(limit int)
+	MirrorBodyLimit() int
+	SetBasicAuth(username, password string) error
+	BasicAuthEnabled() bool
+	CheckBasicAuth(username, password string) bool
+	SetEnabled(enabled bool)
+	Enabled() bool
+	BytesIn() uint64
+	BytesOut() uint64
+	RecentErrors() []string
 	HandleConnection(dst io.ReadWriter, src ssh.Channel)
+	ForwardDatagram(dst ssh.Channel, p []byte) error
+	HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel)
 	OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error)
 	Close() error
 }
 type forwarder struct {
-	mu            sync.RWMutex
-	listener      net.Listener
-	tunnelType    types.TunnelType
-	forwardedPort uint16
-	slug          slug.Slug
-	conn          ssh.Conn
-	bufferPool    sync.Pool
+	mu              sync.RWMutex
+	listener        net.Listener
+	packetConn      net.PacketConn
+	tunnelType      types.TunnelType
+	forwardedPort   uint16
+	methods         []string
+	origins         []string
+	hostHeader      string
+	rewriteLocation bool
+	contentType     string
+	mirrorLimit     int
+	authUser        string
+	authHash        []byte
+	disabled        bool
+	slug            slug.Slug
+	conn            ssh.Conn
+	config          config.Config
+	bufferPool      sync.Pool
+	bytesIn         atomic.Uint64
+	bytesOut        atomic.Uint64
+	recentErrors    errorLog
+	openQueue       chan struct{}
+	openQueueOnce   sync.Once
+	closeOnce       sync.Once
+	tunnelLog       *tunnelLog
+	flowBudgets     sync.Map
+}
+
+type countingReader struct {
+	r         io.Reader
+	count     *atomic.Uint64
+	budget    *byteBudget
+	bandwidth int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 && cr.budget != nil {
+		n, err = cr.budget.consume(n, err)
+	}
+	if n > 0 {
+		cr.count.Add(uint64(n))
+		nodeBandwidth.wait(n, cr.bandwidth)
+	}
+	return n, err
+}
+
+type progressReader struct {
+	r     io.Reader
+	empty int
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 || err != nil || len(p) == 0 {
+		pr.empty = 0
+		return n, err
+	}
+	pr.empty++
+	if pr.empty >= maxConsecutiveEmptyReads {
+		return 0, io.ErrNoProgress
+	}
+	return 0, nil
+}
+
+type byteBudget struct {
+	limit    int64
+	used     atomic.Int64
+	once     sync.Once
+	exceeded func()
+}
+
+func (b *byteBudget) consume(n int, err error) (int, error) {
+	total := b.used.Add(int64(n))
+	if total <= b.limit {
+		return n, err
+	}
+	b.once.Do(b.exceeded)
+	allowed := int64(n) - (total - b.limit)
+	if allowed < 0 {
+		allowed = 0
+	}
+	return int(allowed), ErrByteBudgetExceeded
+}
+
+type trackedChannel struct {
+	ssh.Channel
+	once sync.Once
+}
+
+func (tc *trackedChannel) release() {
+	tc.once.Do(func() {
+		activeChannels.Add(-1)
+	})
+}
+
+func (tc *trackedChannel) Close() error {
+	tc.release()
+	return tc.Channel.Close()
 }
 
 func New(config config.Config, slug slug.Slug, conn ssh.Conn) Forwarder {
@@ -44,6 +187,7 @@ func New(config config.Config, slug slug.Slug, conn ssh.Conn) Forwarder {
 		forwardedPort: 0,
 		slug:          slug,
 		conn:          conn,
+		config:        config,
 		bufferPool: sync.Pool{
 			New: func() interface{} {
 				bufSize := config.BufferSize()
@@ -57,11 +201,91 @@ func New(config config.Config, slug slug.Slug, conn ssh.Conn) Forwarder {
 func (f *forwarder) copyWithBuffer(dst io.Writer, src io.Reader) (written int64, err error) {
 	buf := f.bufferPool.Get().(*[]byte)
 	defer f.bufferPool.Put(buf)
-	return io.CopyBuffer(dst, src, *buf)
+	return io.CopyBuffer(dst, &progressReader{r: src}, *buf)
+}
+
+func (f *forwarder) acquireOpenSlot(ctx context.Context) (func(), error) {
+	size := f.config.ChannelOpenQueue()
+	if size <= 0 {
+		return func() {}, nil
+	}
+	f.openQueueOnce.Do(func() {
+		f.openQueue = make(chan struct{}, size)
+	})
+
+	timer := time.NewTimer(f.config.ChannelOpenQueueTimeout())
+	defer timer.Stop()
+	select {
+	case f.openQueue <- struct{}{}:
+		return func() { <-f.openQueue }, nil
+	case <-timer.C:
+		return nil, ErrOpenQueueTimeout
+	case <-ctx.Done():
+		return nil, fmt.Errorf("context cancelled: %w", ctx.Err())
+	}
 }
 
 func (f *forwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error) {
+	release, err := f.acquireOpenSlot(ctx)
+	if err != nil {
+		f.recentErrors.record(err)
+		return nil, nil, err
+	}
+	defer release()
+
+	limit := f.config.MaxForwardedChannels()
+	if limit > 0 {
+		if activeChannels.Add(1) > int64(limit) {
+			activeChannels.Add(-1)
+			f.recentErrors.record(ErrChannelLimit)
+			return nil, nil, ErrChannelLimit
+		}
+	}
+
+	if dir := f.config.TunnelLogDir(); dir != "" {
+		f.writeTunnelLog(dir, f.connectionEntry(origin))
+	}
+	logConnections := f.config.LogConnections()
+	sampled := logConnections && sampleAccessLog(f.config.AccessLogSampleRate())
+	if sampled {
+		f.logConnection(origin)
+	}
 	payload := createForwardedTCPIPPayload(origin, f.ForwardedPort())
+	channel, reqs, err := f.openChannel(ctx, payload)
+	if isTransientOpenError(err) {
+		select {
+		case <-time.After(openRetryDelay):
+			channel, reqs, err = f.openChannel(ctx, payload)
+		case <-ctx.Done():
+			err = fmt.Errorf("context cancelled: %w", ctx.Err())
+		}
+	}
+	if err != nil {
+		f.recentErrors.record(fmt.Errorf("open channel: %w", err))
+		if logConnections {
+			log.Printf("Forwarding connection: open channel failed for %s slug=%s port=%d: %v",
+				origin, f.slug.String(), f.ForwardedPort(), err)
+		}
+		if limit > 0 {
+			activeChannels.Add(-1)
+		}
+		return nil, nil, err
+	}
+	if limit > 0 {
+		channel = &trackedChannel{Channel: channel}
+	}
+	if f.TunnelType() == types.TunnelTypeUDP {
+		f.startFlow(channel, origin)
+	}
+	return channel, reqs, nil
+}
+
+func isTransientOpenError(err error) bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(err, &openErr) && openErr.Reason == ssh.ResourceShortage
+}
+
+func (f *forwarder) openChannel(ctx context.Context, payload []byte) (ssh.Channel, <-chan *ssh.Request, error) {
 	type channelResult struct {
 		channel ssh.Channel
 		reqs    <-chan *ssh.Request
@@ -70,7 +294,13 @@ func (f *forwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (
 	resultChan := make(chan channelResult, 1)
 
 	go func() {
-		channel, reqs, err := f.conn.OpenChannel("forwarded-tcpip", payload)
+		channel, reqs, err := f.conn.OpenChannel(f.forwardedChannelType(), payload)
+		// Anything other than an explicit refusal means the connection went
+		// away under the open, which the SSH library reports opaquely.
+		var openErr *ssh.OpenChannelError
+		if err != nil && !errors.As(err, &openErr) {
+			err = fmt.Errorf("%w: %w", ErrClientDisconnected, err)
+		}
 		select {
 		case resultChan <- channelResult{channel, reqs, err}:
 		case <-ctx.Done():
@@ -89,6 +319,15 @@ func (f *forwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (
 	}
 }
 
+// forwardedChannelType is the channel type a client that asked for a UDP
+// forward expects; everything else uses the standard forwarded-tcpip.
+func (f *forwarder) forwardedChannelType() string {
+	if f.TunnelType() == types.TunnelTypeUDP {
+		return "forwarded-udpip"
+	}
+	return "forwarded-tcpip"
+}
+
 func closeWriter(w io.Writer) error {
 	if cw, ok := w.(interface{ CloseWrite() error }); ok {
 		return cw.CloseWrite()
@@ -115,15 +354,22 @@ func (f *forwarder) copyAndClose(dst io.Writer, src io.Reader, direction string)
 func (f *forwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 	defer func() {
 		_, _ = io.Copy(io.Discard, src)
+		if tc, ok := src.(*trackedChannel); ok {
+			tc.release()
+		}
 	}()
 
+	budget := f.connectionBudget(dst, src)
+	bandwidth := f.config.NodeBandwidthLimit()
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		err := f.copyAndClose(dst, src, "src to dst")
+		err := f.copyAndClose(dst, &countingReader{r: src, count: &f.bytesOut, budget: budget, bandwidth: bandwidth}, "src to dst")
 		if err != nil {
+			f.recentErrors.record(err)
 			log.Println("Error during copy: ", err)
 			return
 		}
@@ -131,8 +377,9 @@ func (f *forwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 
 	go func() {
 		defer wg.Done()
-		err := f.copyAndClose(src, dst, "dst to src")
+		err := f.copyAndClose(src, &countingReader{r: dst, count: &f.bytesIn, budget: budget, bandwidth: bandwidth}, "dst to src")
 		if err != nil {
+			f.recentErrors.record(err)
 			log.Println("Error during copy: ", err)
 			return
 		}
@@ -141,6 +388,23 @@ func (f *forwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 	wg.Wait()
 }
 
+func (f *forwarder) connectionBudget(dst io.ReadWriter, src ssh.Channel) *byteBudget {
+	limit := f.config.TCPByteBudget()
+	if limit <= 0 || f.TunnelType() != types.TunnelTypeTCP {
+		return nil
+	}
+	return &byteBudget{
+		limit: limit,
+		exceeded: func() {
+			log.Printf("Closing TCP connection on port %d: %v", f.ForwardedPort(), ErrByteBudgetExceeded)
+			if closer, ok := dst.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			_ = src.Close()
+		},
+	}
+}
+
 func (f *forwarder) SetType(tunnelType types.TunnelType) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -165,6 +429,163 @@ func (f *forwarder) SetForwardedPort(port uint16) {
 	f.forwardedPort = port
 }
 
+func (f *forwarder) SetAllowedMethods(methods []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods = append([]string(nil), methods...)
+}
+
+func (f *forwarder) AllowedMethods() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]string(nil), f.methods...)
+}
+
+// SetAllowedOrigins restricts which Origin values may open a WebSocket
+// through the tunnel; an empty list allows any origin.
+func (f *forwarder) SetAllowedOrigins(origins []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.origins = append([]string(nil), origins...)
+}
+
+func (f *forwarder) AllowedOrigins() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]string(nil), f.origins...)
+}
+
+func (f *forwarder) SetHostHeader(host string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hostHeader = host
+}
+
+func (f *forwarder) HostHeader() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.hostHeader
+}
+
+func (f *forwarder) SetRewriteLocation(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rewriteLocation = enabled
+}
+
+func (f *forwarder) RewriteLocation() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rewriteLocation
+}
+
+func (f *forwarder) SetDefaultContentType(contentType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.contentType = contentType
+}
+
+func (f *forwarder) DefaultContentType() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.contentType
+}
+
+// SetMirrorBodyLimit turns request mirroring on with up to limit body bytes
+// captured per request; zero turns it off.
+func (f *forwarder) SetMirrorBodyLimit(limit int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mirrorLimit = limit
+}
+
+func (f *forwarder) MirrorBodyLimit() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.mirrorLimit
+}
+
+// ParseBasicAuth splits "username:password" credentials. An empty value
+// yields empty credentials, which disable basic auth.
+func ParseBasicAuth(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", nil
+	}
+	username, password, ok := strings.Cut(value, ":")
+	if !ok || username == "" || password == "" {
+		return "", "", errors.New("credentials must be in username:password form")
+	}
+	for _, c := range username {
+		if c <= ' ' || c == 0x7f {
+			return "", "", fmt.Errorf("invalid character %q in username", c)
+		}
+	}
+	if len(password) > 72 {
+		return "", "", errors.New("password must be at most 72 bytes")
+	}
+	return username, password, nil
+}
+
+// SetBasicAuth replaces the tunnel's credentials; an empty username turns
+// basic auth off. Only the bcrypt hash of the password is kept.
+func (f *forwarder) SetBasicAuth(username, password string) error {
+	var hash []byte
+	if username != "" {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hash basic auth password: %w", err)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.authUser = username
+	f.authHash = hash
+	return nil
+}
+
+func (f *forwarder) BasicAuthEnabled() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.authUser != ""
+}
+
+func (f *forwarder) CheckBasicAuth(username, password string) bool {
+	f.mu.RLock()
+	user, hash := f.authUser, f.authHash
+	f.mu.RUnlock()
+	if user == "" {
+		return true
+	}
+	userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(user)) == 1
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && userMatch
+}
+
+func (f *forwarder) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disabled = !enabled
+}
+
+func (f *forwarder) Enabled() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !f.disabled
+}
+
+func (f *forwarder) BytesIn() uint64 {
+	return f.bytesIn.Load()
+}
+
+func (f *forwarder) BytesOut() uint64 {
+	return f.bytesOut.Load()
+}
+
+func (f *forwarder) RecentErrors() []string {
+	return f.recentErrors.snapshot()
+}
+
 func (f *forwarder) SetListener(listener net.Listener) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -177,16 +598,71 @@ func (f *forwarder) Listener() net.Listener {
 	return f.listener
 }
 
+func (f *forwarder) SetPacketConn(conn net.PacketConn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.packetConn = conn
+}
+
+// Close closes the listener or UDP socket once. Teardown can reach it from
+// more than one path at the same time, so later calls are no-ops that return
+// nil.
 func (f *forwarder) Close() error {
-	if listener := f.Listener(); listener != nil {
-		return listener.Close()
+	var err error
+	f.closeOnce.Do(func() {
+		if listener := f.Listener(); listener != nil {
+			err = listener.Close()
+		}
+		f.mu.Lock()
+		if f.packetConn != nil {
+			err = errors.Join(err, f.packetConn.Close())
+		}
+		if f.tunnelLog != nil {
+			_ = f.tunnelLog.Close()
+		}
+		f.mu.Unlock()
+	})
+	return err
+}
+
+func (f *forwarder) logConnection(origin net.Addr) {
+	host, port := splitOrigin(origin)
+	if f.config.LogTunnelType() {
+		log.Printf("Forwarding connection: origin_ip=%s origin_port=%d slug=%s port=%d type=%s",
+			host, port, f.slug.String(), f.ForwardedPort(), tunnelTypeName(f.TunnelType()))
+		return
 	}
-	return nil
+	log.Printf("Forwarding connection: origin_ip=%s origin_port=%d slug=%s port=%d",
+		host, port, f.slug.String(), f.ForwardedPort())
 }
 
-func createForwardedTCPIPPayload(origin net.Addr, destPort uint16) []byte {
+func (f *forwarder) connectionEntry(origin net.Addr) string {
+	host, port := splitOrigin(origin)
+	return fmt.Sprintf("origin_ip=%s origin_port=%d slug=%s port=%d type=%s",
+		host, port, f.slug.String(), f.ForwardedPort(), tunnelTypeName(f.TunnelType()))
+}
+
+func tunnelTypeName(tunnelType types.TunnelType) string {
+	switch tunnelType {
+	case types.TunnelTypeHTTP:
+		return "HTTP"
+	case types.TunnelTypeTCP:
+		return "TCP"
+	case types.TunnelTypeUDP:
+		return "UDP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func splitOrigin(origin net.Addr) (string, uint32) {
 	host, portStr, _ := net.SplitHostPort(origin.String())
-	port, _ := strconv.Atoi(portStr)
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return host, uint32(port)
+}
+
+func createForwardedTCPIPPayload(origin net.Addr, destPort uint16) []byte {
+	host, port := splitOrigin(origin)
 
 	forwardPayload := struct {
 		DestAddr   string
@@ -197,7 +673,7 @@ func createForwardedTCPIPPayload(origin net.Addr, destPort uint16) []byte {
 		DestAddr:   "localhost",
 		DestPort:   uint32(destPort),
 		OriginAddr: host,
-		OriginPort: uint32(port),
+		OriginPort: port,
 	}
 
 	return ssh.Marshal(forwardPayload)
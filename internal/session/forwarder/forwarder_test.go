@@ -3,13 +3,21 @@ package forwarder
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"log"
 	"net"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"tunnel_pls/internal/http/stream"
 	"tunnel_pls/internal/session/slug"
 	"tunnel_pls/internal/types"
 
@@ -23,28 +31,100 @@ type mockConfig struct {
 	mock.Mock
 }
 
-func (m *mockConfig) Domain() string            { return m.Called().String(0) }
-func (m *mockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *mockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *mockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *mockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *mockConfig) KeyLoc() string            { return m.Called().String(0) }
-func (m *mockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *mockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *mockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *mockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *mockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *mockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *mockConfig) AllowedPortsStart() uint16 { return m.Called().Get(0).(uint16) }
-func (m *mockConfig) AllowedPortsEnd() uint16   { return m.Called().Get(0).(uint16) }
-func (m *mockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *mockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *mockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *mockConfig) PprofPort() string         { return m.Called().String(0) }
-func (m *mockConfig) Mode() types.ServerMode    { return m.Called().Get(0).(types.ServerMode) }
-func (m *mockConfig) GRPCAddress() string       { return m.Called().String(0) }
-func (m *mockConfig) GRPCPort() string          { return m.Called().String(0) }
-func (m *mockConfig) NodeToken() string         { return m.Called().String(0) }
+func (m *mockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *mockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *mockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *mockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *mockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *mockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *mockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *mockConfig) KeyLoc() string                   { return m.Called().String(0) }
+func (m *mockConfig) SSHHostKey() string               { return m.Called().String(0) }
+func (m *mockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *mockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *mockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *mockConfig) TLSStoragePath() string           { return m.Called().String(0) }
+func (m *mockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *mockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *mockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *mockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *mockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *mockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *mockConfig) AllowedPortsStart() uint16        { return m.Called().Get(0).(uint16) }
+func (m *mockConfig) AllowedPortsEnd() uint16          { return m.Called().Get(0).(uint16) }
+func (m *mockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *mockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *mockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *mockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *mockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *mockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *mockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *mockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *mockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *mockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *mockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *mockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *mockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *mockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *mockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *mockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *mockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *mockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *mockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *mockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *mockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *mockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *mockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *mockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *mockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *mockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *mockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *mockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *mockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *mockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *mockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *mockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *mockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *mockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *mockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *mockConfig) PprofPort() string                    { return m.Called().String(0) }
+func (m *mockConfig) Mode() types.ServerMode               { return m.Called().Get(0).(types.ServerMode) }
+func (m *mockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *mockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *mockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *mockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *mockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *mockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *mockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *mockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *mockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *mockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *mockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *mockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *mockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *mockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *mockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *mockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *mockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *mockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *mockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *mockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *mockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
 
 type mockConn struct {
 	mock.Mock
@@ -269,6 +349,12 @@ func TestNew(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(tt.bufferSize).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			s := slug.New()
 			conn := &mockConn{}
 
@@ -318,6 +404,12 @@ func TestHandleConnection(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(tt.bufferSize).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			channel, channelPeer := newChannelPair()
@@ -383,6 +475,189 @@ func TestHandleConnection(t *testing.T) {
 	}
 }
 
+type patternReader struct {
+	offset int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte('a' + (r.offset+i)%26)
+	}
+	r.offset += len(p)
+	return len(p), nil
+}
+
+type uploadSink struct {
+	ssh.Channel
+	header  []byte
+	body    hash.Hash
+	bodyLen int64
+}
+
+func (s *uploadSink) Read([]byte) (int, error) { return 0, io.EOF }
+func (s *uploadSink) CloseWrite() error        { return nil }
+func (s *uploadSink) Close() error             { return nil }
+
+func (s *uploadSink) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.header == nil {
+		idx := bytes.Index(p, []byte("\r\n\r\n"))
+		if idx == -1 {
+			return 0, errors.New("request header split across writes")
+		}
+		s.header = append([]byte(nil), p[:idx+4]...)
+		p = p[idx+4:]
+	}
+	s.bodyLen += int64(len(p))
+	s.body.Write(p)
+	return n, nil
+}
+
+func TestHandleConnectionStreamsLargeBody(t *testing.T) {
+	const bodySize = 16 << 20
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(32 * 1024).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	expected := sha256.New()
+	_, err := io.Copy(expected, io.LimitReader(&patternReader{}, bodySize))
+	require.NoError(t, err)
+
+	request := io.MultiReader(
+		strings.NewReader(fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n", bodySize)),
+		io.LimitReader(&patternReader{}, bodySize),
+	)
+	dst := stream.New(io.Discard, request, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+	sink := &uploadSink{body: sha256.New()}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	forwarder.HandleConnection(dst, sink)
+	runtime.ReadMemStats(&after)
+
+	assert.Contains(t, string(sink.header), "POST /upload HTTP/1.1\r\n")
+	assert.Equal(t, int64(bodySize), sink.bodyLen)
+	assert.Equal(t, expected.Sum(nil), sink.body.Sum(nil))
+	assert.Equal(t, uint64(bodySize), forwarder.BytesIn()-uint64(len(sink.header)))
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(bodySize/8), "body should be streamed through reused buffers")
+}
+
+func TestHandleConnectionCountsBytes(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(4).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.Zero(t, forwarder.BytesIn())
+	assert.Zero(t, forwarder.BytesOut())
+
+	channel, channelPeer := newChannelPair()
+	dstEndpoint, dstPeer := newPipePair()
+
+	done := make(chan struct{})
+	go func() {
+		forwarder.HandleConnection(dstEndpoint, channel)
+		close(done)
+	}()
+
+	response := []byte("hello from client")
+	request := []byte("GET / HTTP/1.1")
+
+	go func() {
+		_, _ = io.Copy(io.Discard, dstPeer)
+	}()
+	go func() {
+		_, _ = io.Copy(io.Discard, channelPeer)
+	}()
+
+	_, err := channelPeer.Write(response)
+	require.NoError(t, err)
+	_, err = dstPeer.Write(request)
+	require.NoError(t, err)
+
+	require.NoError(t, channelPeer.CloseWrite())
+	require.NoError(t, dstPeer.CloseWrite())
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleConnection did not complete")
+	}
+
+	assert.Equal(t, uint64(len(request)), forwarder.BytesIn())
+	assert.Equal(t, uint64(len(response)), forwarder.BytesOut())
+}
+
+func TestHandleConnectionByteBudget(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(4).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(8))
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+	forwarder.SetType(types.TunnelTypeTCP)
+	forwarder.SetForwardedPort(9000)
+
+	peerToCh := newSyncBuffer()
+	channel := &testChannel{readBuf: peerToCh, writeBuf: newSyncBuffer()}
+	channel.On("Close").Run(func(args mock.Arguments) {
+		_ = peerToCh.Close()
+	}).Return(nil)
+	dstEndpoint, dstPeer := newPipePair()
+
+	done := make(chan struct{})
+	go func() {
+		forwarder.HandleConnection(dstEndpoint, channel)
+		close(done)
+	}()
+
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(dstPeer)
+		received <- data
+	}()
+
+	_, err := peerToCh.Write([]byte("0123456789abcdefghijklmnopqrstuv"))
+	require.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleConnection did not close the connection after the budget was exceeded")
+	}
+
+	assert.Equal(t, "01234567", string(<-received))
+	assert.Equal(t, uint64(8), forwarder.BytesOut())
+	channel.AssertCalled(t, "Close")
+
+	assert.Contains(t, strings.Join(forwarder.RecentErrors(), "\n"), ErrByteBudgetExceeded.Error())
+}
+
+func TestConnectionBudgetOnlyAppliesToTCP(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(4).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(8))
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	forwarder.SetType(types.TunnelTypeHTTP)
+	assert.Nil(t, forwarder.connectionBudget(&bytes.Buffer{}, &testChannel{}))
+
+	forwarder.SetType(types.TunnelTypeTCP)
+	assert.NotNil(t, forwarder.connectionBudget(&bytes.Buffer{}, &testChannel{}))
+}
+
 func TestHandleConnection_Error(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -414,6 +689,12 @@ func TestHandleConnection_Error(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(tt.bufferSize).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			channel, _ := newChannelPair()
@@ -477,6 +758,12 @@ func TestOpenForwardedChannel(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(8).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			channel := &testChannel{
 				readBuf:  newSyncBuffer(),
 				writeBuf: newSyncBuffer(),
@@ -519,6 +806,408 @@ func TestOpenForwardedChannel(t *testing.T) {
 	}
 }
 
+func TestOpenForwardedChannelLogsOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		origin  *net.TCPAddr
+	}{
+		{name: "ipv4 origin", enabled: true, origin: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}},
+		{name: "ipv6 origin", enabled: true, origin: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}},
+		{name: "disabled", enabled: false, origin: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			cfg := &mockConfig{}
+			cfg.On("LogConnections").Return(tt.enabled)
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("LogTunnelType").Return(false).Maybe()
+			cfg.On("AccessLogSampleRate").Return(1.0).Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+			channel := &testChannel{
+				readBuf:  newSyncBuffer(),
+				writeBuf: newSyncBuffer(),
+			}
+			requests := make(chan *ssh.Request)
+
+			var capturedData []byte
+			conn := &mockConn{}
+			conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Run(func(args mock.Arguments) {
+				capturedData = append([]byte(nil), args.Get(1).([]byte)...)
+			}).Return(channel, (<-chan *ssh.Request)(requests), nil)
+
+			s := slug.New()
+			s.Set("audit-me")
+			forwarder := New(cfg, s, conn).(*forwarder)
+			forwarder.SetForwardedPort(80)
+
+			_, _, err := forwarder.OpenForwardedChannel(context.Background(), tt.origin)
+			require.NoError(t, err)
+
+			var payload struct {
+				DestAddr   string
+				DestPort   uint32
+				OriginAddr string
+				OriginPort uint32
+			}
+			require.NoError(t, ssh.Unmarshal(capturedData, &payload))
+			assert.Equal(t, uint32(tt.origin.Port), payload.OriginPort)
+
+			if !tt.enabled {
+				assert.Empty(t, logs.String())
+				return
+			}
+			assert.Contains(t, logs.String(), fmt.Sprintf("origin_ip=%s origin_port=%d", payload.OriginAddr, payload.OriginPort))
+			assert.Contains(t, logs.String(), "slug=audit-me port=80")
+		})
+	}
+}
+
+func TestOpenForwardedChannelGlobalLimit(t *testing.T) {
+	newLimited := func(channel ssh.Channel) (*forwarder, *mockConn) {
+		cfg := &mockConfig{}
+		cfg.On("BufferSize").Return(8).Maybe()
+		cfg.On("LogConnections").Return(false).Maybe()
+		cfg.On("TunnelLogDir").Return("").Maybe()
+		cfg.On("MaxForwardedChannels").Return(2)
+		cfg.On("ChannelOpenQueue").Return(0).Maybe()
+		cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+		cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+		conn := &mockConn{}
+		conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return(channel, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil)
+		f := New(cfg, slug.New(), conn).(*forwarder)
+		f.SetForwardedPort(80)
+		return f, conn
+	}
+	newChannel := func() *testChannel {
+		ch := &testChannel{readBuf: newSyncBuffer(), writeBuf: newSyncBuffer()}
+		ch.On("Close").Return(nil)
+		return ch
+	}
+	origin := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7000}
+
+	first, second, third := newChannel(), newChannel(), newChannel()
+	tunnelA, _ := newLimited(first)
+	tunnelB, _ := newLimited(second)
+	tunnelC, connC := newLimited(third)
+
+	chA, _, err := tunnelA.OpenForwardedChannel(context.Background(), origin)
+	require.NoError(t, err)
+	chB, _, err := tunnelB.OpenForwardedChannel(context.Background(), origin)
+	require.NoError(t, err)
+
+	_, _, err = tunnelC.OpenForwardedChannel(context.Background(), origin)
+	assert.ErrorIs(t, err, ErrChannelLimit)
+	connC.AssertNotCalled(t, "OpenChannel", mock.Anything, mock.Anything)
+
+	_, err = chA.Write([]byte("still flowing"))
+	require.NoError(t, err)
+	buf := make([]byte, 13)
+	_, err = io.ReadFull(first.writeBuf, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "still flowing", string(buf))
+
+	require.NoError(t, chA.Close())
+	require.NoError(t, chA.Close())
+
+	chC, _, err := tunnelC.OpenForwardedChannel(context.Background(), origin)
+	require.NoError(t, err)
+
+	_, _, err = tunnelA.OpenForwardedChannel(context.Background(), origin)
+	assert.ErrorIs(t, err, ErrChannelLimit)
+
+	dstB, peerB := newPipePair()
+	require.NoError(t, peerB.Close())
+	second.readBuf.Close()
+	tunnelB.HandleConnection(dstB, chB)
+	require.NoError(t, chB.Close())
+
+	chA, _, err = tunnelA.OpenForwardedChannel(context.Background(), origin)
+	require.NoError(t, err)
+
+	require.NoError(t, chA.Close())
+	require.NoError(t, chC.Close())
+	assert.Equal(t, int64(0), activeChannels.Load())
+}
+
+func TestOpenForwardedChannelLogsTunnelType(t *testing.T) {
+	tests := []struct {
+		name       string
+		tunnelType types.TunnelType
+		enabled    bool
+		expect     string
+	}{
+		{name: "http tunnel", tunnelType: types.TunnelTypeHTTP, enabled: true, expect: "type=HTTP"},
+		{name: "tcp tunnel", tunnelType: types.TunnelTypeTCP, enabled: true, expect: "type=TCP"},
+		{name: "disabled", tunnelType: types.TunnelTypeTCP, enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			cfg := &mockConfig{}
+			cfg.On("LogConnections").Return(true)
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("LogTunnelType").Return(tt.enabled)
+			cfg.On("AccessLogSampleRate").Return(1.0)
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+			channel := &testChannel{
+				readBuf:  newSyncBuffer(),
+				writeBuf: newSyncBuffer(),
+			}
+			conn := &mockConn{}
+			conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return(channel, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil)
+
+			s := slug.New()
+			s.Set("tagged")
+			forwarder := New(cfg, s, conn).(*forwarder)
+			forwarder.SetType(tt.tunnelType)
+			forwarder.SetForwardedPort(8080)
+
+			_, _, err := forwarder.OpenForwardedChannel(context.Background(), &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234})
+			require.NoError(t, err)
+
+			assert.Contains(t, logs.String(), "slug=tagged port=8080")
+			if tt.expect == "" {
+				assert.NotContains(t, logs.String(), "type=")
+				return
+			}
+			assert.Contains(t, logs.String(), tt.expect)
+		})
+	}
+}
+
+func TestOpenForwardedChannelSamplesLogs(t *testing.T) {
+	oldSample := sampleAccessLog
+	defer func() { sampleAccessLog = oldSample }()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := &mockConfig{}
+	cfg.On("LogConnections").Return(true)
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("LogTunnelType").Return(false)
+	cfg.On("AccessLogSampleRate").Return(0.1)
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+
+	var calls int
+	sampleAccessLog = func(rate float64) bool {
+		assert.Equal(t, 0.1, rate)
+		calls++
+		return calls%10 == 0
+	}
+
+	conn := &mockConn{}
+	conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return(&testChannel{
+		readBuf:  newSyncBuffer(),
+		writeBuf: newSyncBuffer(),
+	}, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil).Times(100)
+	conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return((*testChannel)(nil), (<-chan *ssh.Request)(nil), errors.New("connect failed"))
+
+	s := slug.New()
+	s.Set("sampled")
+	forwarder := New(cfg, s, conn).(*forwarder)
+	forwarder.SetForwardedPort(80)
+	origin := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+
+	for i := 0; i < 100; i++ {
+		_, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, strings.Count(logs.String(), "Forwarding connection:"))
+
+	logs.Reset()
+	for i := 0; i < 5; i++ {
+		_, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+		require.Error(t, err)
+	}
+	assert.Equal(t, 5, strings.Count(logs.String(), "Forwarding connection: open channel failed for 203.0.113.7:51234 slug=sampled port=80:"))
+	assert.Contains(t, logs.String(), "connect failed")
+	assert.NotContains(t, logs.String(), "origin_ip=")
+}
+
+func TestOpenForwardedChannelQueue(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(8).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(1)
+	cfg.On("ChannelOpenQueueTimeout").Return(50 * time.Millisecond)
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+
+	hold := make(chan struct{})
+	started := make(chan struct{}, 1)
+	channel := &testChannel{readBuf: newSyncBuffer(), writeBuf: newSyncBuffer()}
+	conn := &mockConn{}
+	conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Run(func(args mock.Arguments) {
+		started <- struct{}{}
+		<-hold
+	}).Return(channel, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil)
+
+	forwarder := New(cfg, slug.New(), conn).(*forwarder)
+	forwarder.SetForwardedPort(80)
+	origin := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7000}
+
+	slow := make(chan error, 1)
+	go func() {
+		_, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+		slow <- err
+	}()
+	<-started
+
+	begin := time.Now()
+	_, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+	assert.ErrorIs(t, err, ErrOpenQueueTimeout)
+	assert.GreaterOrEqual(t, time.Since(begin), 50*time.Millisecond)
+	conn.AssertNumberOfCalls(t, "OpenChannel", 1)
+	assert.Contains(t, forwarder.RecentErrors()[0], ErrOpenQueueTimeout.Error())
+
+	close(hold)
+	require.NoError(t, <-slow)
+
+	ch, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+	require.NoError(t, err)
+	assert.Same(t, channel, ch)
+	<-started
+}
+
+func TestOpenForwardedChannelRecordsErrors(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(8).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	conn := &mockConn{}
+	conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return((*testChannel)(nil), (<-chan *ssh.Request)(nil), &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "connection refused"})
+
+	forwarder := New(cfg, slug.New(), conn).(*forwarder)
+	forwarder.SetForwardedPort(3000)
+	assert.Empty(t, forwarder.RecentErrors())
+
+	_, _, err := forwarder.OpenForwardedChannel(context.Background(), &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7000})
+	require.Error(t, err)
+
+	entries := forwarder.RecentErrors()
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0], "open channel: ssh: rejected: connect failed (connection refused)")
+}
+
+func TestOpenForwardedChannelRetriesUnderBackpressure(t *testing.T) {
+	shortage := &ssh.OpenChannelError{Reason: ssh.ResourceShortage, Message: "window exhausted"}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "transient failure then success",
+			errs:      []error{shortage, nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "transient failure twice",
+			errs:      []error{shortage, shortage},
+			wantErr:   shortage,
+			wantCalls: 2,
+		},
+		{
+			name:      "dead connection is not retried",
+			errs:      []error{io.EOF},
+			wantErr:   io.EOF,
+			wantCalls: 1,
+		},
+		{
+			name:      "dead connection is reported as a disconnect",
+			errs:      []error{io.EOF},
+			wantErr:   ErrClientDisconnected,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &mockConfig{}
+			cfg.On("BufferSize").Return(8).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+			channel := &testChannel{readBuf: newSyncBuffer(), writeBuf: newSyncBuffer()}
+			requests := make(chan *ssh.Request)
+
+			conn := &mockConn{}
+			for _, err := range tt.errs {
+				if err != nil {
+					conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return((*testChannel)(nil), (<-chan *ssh.Request)(nil), err).Once()
+				} else {
+					conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return(channel, (<-chan *ssh.Request)(requests), nil).Once()
+				}
+			}
+
+			forwarder := New(cfg, slug.New(), conn).(*forwarder)
+			forwarder.SetForwardedPort(8080)
+
+			origin := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7000}
+			ch, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Same(t, channel, ch)
+			}
+			conn.AssertNumberOfCalls(t, "OpenChannel", tt.wantCalls)
+		})
+	}
+}
+
+func TestOpenForwardedChannelRetryHonoursContext(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(8).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	conn := &mockConn{}
+	conn.On("OpenChannel", "forwarded-tcpip", mock.Anything).Return((*testChannel)(nil), (<-chan *ssh.Request)(nil), &ssh.OpenChannelError{Reason: ssh.ResourceShortage}).Once()
+
+	forwarder := New(cfg, slug.New(), conn).(*forwarder)
+	ctx, cancel := context.WithTimeout(context.Background(), openRetryDelay/4)
+	defer cancel()
+
+	_, _, err := forwarder.OpenForwardedChannel(ctx, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7000})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	conn.AssertNumberOfCalls(t, "OpenChannel", 1)
+}
+
 func TestOpenForwardedChannelContextCancellation(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -547,6 +1236,12 @@ func TestOpenForwardedChannelContextCancellation(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(8).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			channel := &testChannel{
 				readBuf:  newSyncBuffer(),
 				writeBuf: newSyncBuffer(),
@@ -885,6 +1580,12 @@ func TestCopyAndClose(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(32).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			src := tt.setupSrc()
@@ -916,6 +1617,12 @@ func TestCopyAndClose(t *testing.T) {
 func TestCopyAndCloseJoinedErrors(t *testing.T) {
 	cfg := &mockConfig{}
 	cfg.On("BufferSize").Return(32).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 	forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 	src := &mockReader{}
@@ -1049,6 +1756,12 @@ func TestCopyWithBuffer(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(tt.bufferSize).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			src := tt.setupSrc()
@@ -1081,6 +1794,12 @@ func TestCopyWithBuffer(t *testing.T) {
 func TestCopyWithBufferReusesBuffer(t *testing.T) {
 	cfg := &mockConfig{}
 	cfg.On("BufferSize").Return(16).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 	forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 	buf1 := forwarder.bufferPool.Get().(*[]byte)
@@ -1109,6 +1828,55 @@ func TestCopyWithBufferReusesBuffer(t *testing.T) {
 	cfg.AssertExpectations(t)
 }
 
+type emptyReadsReader struct {
+	empty int
+	reads int
+	r     io.Reader
+}
+
+func (e *emptyReadsReader) Read(p []byte) (int, error) {
+	e.reads++
+	if e.empty != 0 {
+		if e.empty > 0 {
+			e.empty--
+		}
+		return 0, nil
+	}
+	return e.r.Read(p)
+}
+
+func TestCopyWithBufferZeroLengthReads(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	t.Run("transient empty reads", func(t *testing.T) {
+		src := &emptyReadsReader{empty: 3, r: bytes.NewReader([]byte("test data"))}
+		dst := &bytes.Buffer{}
+
+		n, err := forwarder.copyWithBuffer(dst, src)
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), n)
+		assert.Equal(t, "test data", dst.String())
+	})
+
+	t.Run("no progress", func(t *testing.T) {
+		src := &emptyReadsReader{empty: -1}
+		dst := &bytes.Buffer{}
+
+		n, err := forwarder.copyWithBuffer(dst, src)
+		require.ErrorIs(t, err, io.ErrNoProgress)
+		assert.Equal(t, int64(0), n)
+		assert.Equal(t, maxConsecutiveEmptyReads, src.reads)
+	})
+}
+
 func TestSetType(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1132,6 +1900,12 @@ func TestSetType(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			assert.Equal(t, types.TunnelTypeUNKNOWN, forwarder.TunnelType())
@@ -1167,6 +1941,12 @@ func TestTunnelType(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			forwarder.SetType(tt.tunnelType)
@@ -1209,6 +1989,12 @@ func TestSetForwardedPort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			assert.Equal(t, uint16(0), forwarder.ForwardedPort())
@@ -1244,6 +2030,12 @@ func TestForwardedPort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			if tt.port != 0 {
@@ -1257,6 +2049,186 @@ func TestForwardedPort(t *testing.T) {
 	}
 }
 
+func TestSetAllowedMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []string
+	}{
+		{
+			name:    "default allows everything",
+			methods: nil,
+		},
+		{
+			name:    "get only",
+			methods: []string{"GET"},
+		},
+		{
+			name:    "multiple methods",
+			methods: []string{"GET", "HEAD", "OPTIONS"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &mockConfig{}
+			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+			forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+			assert.Empty(t, forwarder.AllowedMethods())
+
+			forwarder.SetAllowedMethods(tt.methods)
+			got := forwarder.AllowedMethods()
+			assert.ElementsMatch(t, tt.methods, got)
+
+			if len(got) > 0 {
+				got[0] = "DELETE"
+				assert.Equal(t, tt.methods[0], forwarder.AllowedMethods()[0])
+			}
+			cfg.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetHostHeader(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.Empty(t, forwarder.HostHeader())
+
+	forwarder.SetHostHeader("backend.local:3000")
+	assert.Equal(t, "backend.local:3000", forwarder.HostHeader())
+
+	forwarder.SetHostHeader("")
+	assert.Empty(t, forwarder.HostHeader())
+	cfg.AssertExpectations(t)
+}
+
+func TestSetAllowedOrigins(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.Empty(t, forwarder.AllowedOrigins())
+
+	origins := []string{"https://app.example.com", "http://localhost:3000"}
+	forwarder.SetAllowedOrigins(origins)
+	got := forwarder.AllowedOrigins()
+	assert.Equal(t, origins, got)
+
+	got[0] = "https://evil.example"
+	assert.Equal(t, "https://app.example.com", forwarder.AllowedOrigins()[0])
+	cfg.AssertExpectations(t)
+}
+
+func TestSetDefaultContentType(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.Empty(t, forwarder.DefaultContentType())
+
+	forwarder.SetDefaultContentType("text/plain")
+	assert.Equal(t, "text/plain", forwarder.DefaultContentType())
+	cfg.AssertExpectations(t)
+}
+
+func TestSetMirrorBodyLimit(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.Zero(t, forwarder.MirrorBodyLimit())
+
+	forwarder.SetMirrorBodyLimit(512)
+	assert.Equal(t, 512, forwarder.MirrorBodyLimit())
+
+	forwarder.SetMirrorBodyLimit(0)
+	assert.Zero(t, forwarder.MirrorBodyLimit())
+	cfg.AssertExpectations(t)
+}
+
+func TestSetBasicAuth(t *testing.T) {
+	cfg := &mockConfig{}
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.False(t, forwarder.BasicAuthEnabled())
+	assert.True(t, forwarder.CheckBasicAuth("", ""))
+
+	require.NoError(t, forwarder.SetBasicAuth("alice", "first-secret"))
+	assert.True(t, forwarder.BasicAuthEnabled())
+	assert.NotContains(t, string(forwarder.authHash), "first-secret")
+	assert.True(t, forwarder.CheckBasicAuth("alice", "first-secret"))
+	assert.False(t, forwarder.CheckBasicAuth("alice", "wrong"))
+	assert.False(t, forwarder.CheckBasicAuth("mallory", "first-secret"))
+
+	require.NoError(t, forwarder.SetBasicAuth("bob", "second-secret"))
+	assert.False(t, forwarder.CheckBasicAuth("alice", "first-secret"))
+	assert.True(t, forwarder.CheckBasicAuth("bob", "second-secret"))
+
+	require.NoError(t, forwarder.SetBasicAuth("", ""))
+	assert.False(t, forwarder.BasicAuthEnabled())
+	cfg.AssertExpectations(t)
+}
+
+func TestParseBasicAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		wantUser     string
+		wantPassword string
+		wantErr      bool
+	}{
+		{name: "valid", value: " alice:s3cret:x ", wantUser: "alice", wantPassword: "s3cret:x"},
+		{name: "empty disables", value: ""},
+		{name: "missing separator", value: "alice", wantErr: true},
+		{name: "missing password", value: "alice:", wantErr: true},
+		{name: "missing username", value: ":secret", wantErr: true},
+		{name: "control character", value: "ali\x00ce:secret", wantErr: true},
+		{name: "password too long", value: "alice:" + strings.Repeat("a", 73), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, password, err := ParseBasicAuth(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantUser, user)
+			assert.Equal(t, tt.wantPassword, password)
+		})
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	assert.True(t, forwarder.Enabled())
+
+	forwarder.SetEnabled(false)
+	assert.False(t, forwarder.Enabled())
+
+	forwarder.SetEnabled(true)
+	assert.True(t, forwarder.Enabled())
+	cfg.AssertExpectations(t)
+}
+
 func TestSetListener(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -1282,6 +2254,12 @@ func TestSetListener(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			listener := tt.setupListener()
@@ -1327,6 +2305,12 @@ func TestListener(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			listener := tt.setupListener()
@@ -1384,6 +2368,12 @@ func TestClose(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(16).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			listener := tt.setupListener()
@@ -1403,6 +2393,37 @@ func TestClose(t *testing.T) {
 	}
 }
 
+func TestCloseConcurrent(t *testing.T) {
+	cfg := &mockConfig{}
+	cfg.On("BufferSize").Return(16).Maybe()
+	forwarder := New(cfg, slug.New(), nil).(*forwarder)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	forwarder.SetListener(listener)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- forwarder.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, forwarder.Close())
+
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+	cfg.AssertExpectations(t)
+}
+
 func TestCloseWriter(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1526,6 +2547,12 @@ func TestHandleConnectionWithErrors(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(tt.bufferSize).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 			channel, channelPeer := tt.setupChannel()
@@ -1553,6 +2580,12 @@ func TestHandleConnectionWithErrors(t *testing.T) {
 func TestHandleConnectionDiscardOnExit(t *testing.T) {
 	cfg := &mockConfig{}
 	cfg.On("BufferSize").Return(16).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 	forwarder := New(cfg, slug.New(), nil).(*forwarder)
 
 	channel, channelPeer := newChannelPair()
@@ -1603,6 +2636,12 @@ func TestOpenForwardedChannelSuccess(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(8).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 			channel := &testChannel{
 				readBuf:  newSyncBuffer(),
 				writeBuf: newSyncBuffer(),
@@ -1663,6 +2702,12 @@ func TestOpenForwardedChannelError(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &mockConfig{}
 			cfg.On("BufferSize").Return(8).Maybe()
+			cfg.On("LogConnections").Return(false).Maybe()
+			cfg.On("TunnelLogDir").Return("").Maybe()
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 
 			conn := tt.setupConn()
 			forwarder := New(cfg, slug.New(), conn).(*forwarder)
@@ -1687,6 +2732,12 @@ func TestOpenForwardedChannelError(t *testing.T) {
 func TestOpenForwardedChannelContextCancelledDuringOpen(t *testing.T) {
 	cfg := &mockConfig{}
 	cfg.On("BufferSize").Return(8).Maybe()
+	cfg.On("LogConnections").Return(false).Maybe()
+	cfg.On("TunnelLogDir").Return("").Maybe()
+	cfg.On("MaxForwardedChannels").Return(0).Maybe()
+	cfg.On("ChannelOpenQueue").Return(0).Maybe()
+	cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+	cfg.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
 
 	channel := &testChannel{
 		readBuf:  newSyncBuffer(),
@@ -0,0 +1,123 @@
+package forwarder
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"tunnel_pls/internal/types"
+)
+
+// tunnelLog appends a tunnel's connection log to its own file, moving the
+// file aside to path.1 once it would grow past maxSize. Writes after Close
+// fail with os.ErrClosed rather than reopening the file.
+type tunnelLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	closed  bool
+}
+
+func newTunnelLog(path string, maxSize int64) *tunnelLog {
+	return &tunnelLog{path: path, maxSize: maxSize}
+}
+
+func (l *tunnelLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, os.ErrClosed
+	}
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *tunnelLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+func (l *tunnelLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *tunnelLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// tunnelLogName names the file after the tunnel's public address and the
+// SSH session that owns it. Slugs and ports are reused once a tunnel closes,
+// so the session ID keeps a later owner's connections out of an earlier
+// owner's file; an HTTP tunnel that changes its slug starts a new file.
+func (f *forwarder) tunnelLogName() string {
+	id := f.conn.SessionID()
+	session := hex.EncodeToString(id[:min(len(id), 8)])
+	switch f.TunnelType() {
+	case types.TunnelTypeHTTP:
+		return fmt.Sprintf("%s-%s.log", filepath.Base(f.slug.String()), session)
+	case types.TunnelTypeUDP:
+		return fmt.Sprintf("udp-%d-%s.log", f.ForwardedPort(), session)
+	default:
+		return fmt.Sprintf("tcp-%d-%s.log", f.ForwardedPort(), session)
+	}
+}
+
+func (f *forwarder) writeTunnelLog(dir, entry string) {
+	path := filepath.Join(dir, f.tunnelLogName())
+
+	f.mu.Lock()
+	if f.tunnelLog == nil || f.tunnelLog.path != path {
+		if f.tunnelLog != nil {
+			_ = f.tunnelLog.Close()
+		}
+		f.tunnelLog = newTunnelLog(path, f.config.TunnelLogMaxSize())
+	}
+	tl := f.tunnelLog
+	f.mu.Unlock()
+
+	if _, err := fmt.Fprintf(tl, "%s %s\n", time.Now().UTC().Format(time.RFC3339), entry); err != nil {
+		f.recentErrors.record(fmt.Errorf("tunnel log: %w", err))
+	}
+}
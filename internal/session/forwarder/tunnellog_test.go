@@ -0,0 +1,165 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tunnel_pls/internal/session/slug"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestTunnelLogRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := newTunnelLog(path, 64)
+
+	var entries []string
+	for i := range 8 {
+		entry := fmt.Sprintf("entry %02d %s\n", i, strings.Repeat("x", 10))
+		entries = append(entries, entry)
+		_, err := l.Write([]byte(entry))
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+
+	// Each entry is 20 bytes, so a file holds three before it rotates and
+	// only the last rotation survives as audit.log.1.
+	assert.Equal(t, strings.Join(entries[3:6], ""), string(rotated))
+	assert.Equal(t, strings.Join(entries[6:], ""), string(current))
+}
+
+func TestTunnelLogAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("earlier\n"), 0600))
+
+	l := newTunnelLog(path, 1024)
+	_, err := l.Write([]byte("later\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "earlier\nlater\n", string(data))
+}
+
+func TestTunnelLogWriteAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := newTunnelLog(path, 1024)
+	_, err := l.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	_, err = l.Write([]byte("after\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "before\n", string(data))
+}
+
+func TestOpenForwardedChannelWritesTunnelLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		tunnelType types.TunnelType
+		slug       string
+		port       uint16
+		channel    string
+		file       string
+	}{
+		{name: "http tunnel", tunnelType: types.TunnelTypeHTTP, slug: "audit-me", port: 80, channel: "forwarded-tcpip", file: "audit-me-0102030405060708.log"},
+		{name: "tcp tunnel", tunnelType: types.TunnelTypeTCP, port: 4242, channel: "forwarded-tcpip", file: "tcp-4242-0102030405060708.log"},
+		{name: "udp tunnel", tunnelType: types.TunnelTypeUDP, port: 27015, channel: "forwarded-udpip", file: "udp-27015-0102030405060708.log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &mockConfig{}
+			cfg.On("TunnelLogDir").Return(dir)
+			cfg.On("TunnelLogMaxSize").Return(int64(1 << 20))
+			cfg.On("LogConnections").Return(false)
+			cfg.On("MaxForwardedChannels").Return(0).Maybe()
+			cfg.On("ChannelOpenQueue").Return(0).Maybe()
+			cfg.On("TCPByteBudget").Return(int64(0)).Maybe()
+			cfg.On("UDPByteBudget").Return(int64(0)).Maybe()
+			channel := &testChannel{
+				readBuf:  newSyncBuffer(),
+				writeBuf: newSyncBuffer(),
+			}
+			requests := make(chan *ssh.Request)
+			conn := &mockConn{}
+			conn.On("OpenChannel", tt.channel, mock.Anything).Return(channel, (<-chan *ssh.Request)(requests), nil)
+			conn.On("SessionID").Return([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+
+			s := slug.New()
+			s.Set(tt.slug)
+			forwarder := New(cfg, s, conn).(*forwarder)
+			forwarder.SetType(tt.tunnelType)
+			forwarder.SetForwardedPort(tt.port)
+
+			origins := []*net.TCPAddr{
+				{IP: net.ParseIP("203.0.113.7"), Port: 51234},
+				{IP: net.ParseIP("198.51.100.2"), Port: 40000},
+			}
+			for _, origin := range origins {
+				_, _, err := forwarder.OpenForwardedChannel(context.Background(), origin)
+				require.NoError(t, err)
+			}
+			require.NoError(t, forwarder.Close())
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.file))
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			require.Len(t, lines, 2)
+			assert.Contains(t, lines[0], "origin_ip=203.0.113.7 origin_port=51234")
+			assert.Contains(t, lines[1], "origin_ip=198.51.100.2 origin_port=40000")
+			assert.Contains(t, lines[1], fmt.Sprintf("port=%d type=%s", tt.port, tunnelTypeName(tt.tunnelType)))
+			cfg.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTunnelLogSeparatesReusedSlug(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &mockConfig{}
+	cfg.On("TunnelLogMaxSize").Return(int64(1 << 20))
+
+	owners := []struct {
+		session []byte
+		entry   string
+	}{
+		{session: []byte{0xaa, 1, 2, 3, 4, 5, 6, 7}, entry: "first owner"},
+		{session: []byte{0xbb, 1, 2, 3, 4, 5, 6, 7}, entry: "second owner"},
+	}
+	for _, owner := range owners {
+		conn := &mockConn{}
+		conn.On("SessionID").Return(owner.session)
+		s := slug.New()
+		s.Set("shared")
+		forwarder := New(cfg, s, conn).(*forwarder)
+		forwarder.SetType(types.TunnelTypeHTTP)
+		forwarder.writeTunnelLog(dir, owner.entry)
+		require.NoError(t, forwarder.Close())
+	}
+
+	first, err := os.ReadFile(filepath.Join(dir, "shared-aa01020304050607.log"))
+	require.NoError(t, err)
+	second, err := os.ReadFile(filepath.Join(dir, "shared-bb01020304050607.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(first), "first owner")
+	assert.NotContains(t, string(first), "second owner")
+	assert.Contains(t, string(second), "second owner")
+}
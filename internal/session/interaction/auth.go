@@ -0,0 +1,101 @@
+package interaction
+
+import (
+	"strings"
+	"tunnel_pls/internal/session/forwarder"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func (m *model) authUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.editingAuth = false
+		m.authError = ""
+		m.authInput.SetValue("")
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case "enter":
+		if err := m.checkSecureTransport(); err != nil {
+			m.authError = err.Error()
+			return m, nil
+		}
+		username, password, err := forwarder.ParseBasicAuth(m.authInput.Value())
+		if err != nil {
+			m.authError = err.Error()
+			return m, nil
+		}
+		if err = m.interaction.forwarder.SetBasicAuth(username, password); err != nil {
+			m.authError = err.Error()
+			return m, nil
+		}
+		m.editingAuth = false
+		m.authError = ""
+		m.authInput.SetValue("")
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	default:
+		m.authError = ""
+		m.authInput, cmd = m.authInput.Update(msg)
+		return m, cmd
+	}
+}
+
+func (m *model) authView() string {
+	isCompact := shouldUseCompactLayout(m.width, BreakpointMedium)
+	isVeryCompact := shouldUseCompactLayout(m.width, BreakpointTiny)
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(ColorPrimary)).
+		PaddingTop(1).
+		PaddingBottom(1)
+
+	instructionStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorWhite))
+
+	helpStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorDarkGray)).
+		Italic(true).
+		MarginTop(1)
+
+	title := "🔒 Rotate Basic Auth"
+	instruction := "Enter new credentials as username:password (leave empty to disable):"
+	helpText := "Press Enter to save • Esc to cancel"
+	if isVeryCompact {
+		title = "Rotate Basic Auth"
+		instruction = "username:password"
+		helpText = "Enter: save • Esc: cancel"
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n\n")
+	b.WriteString(instructionStyle.Render(instruction))
+	b.WriteString("\n")
+
+	boxPadding := getPaddingValue(isVeryCompact, isCompact)
+	inputBoxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(ColorPrimary)).
+		Padding(1, boxPadding).
+		MarginTop(1)
+	if m.authError != "" {
+		inputBoxStyle = inputBoxStyle.BorderForeground(lipgloss.Color(ColorError))
+	}
+	b.WriteString(inputBoxStyle.Render(m.authInput.View()))
+	b.WriteString("\n")
+
+	if m.authError != "" {
+		errorStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(ColorError)).
+			Bold(true)
+		b.WriteString(errorStyle.Render("❌ " + m.authError))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(helpStyle.Render(helpText))
+	return b.String()
+}
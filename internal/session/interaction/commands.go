@@ -18,8 +18,26 @@ func (m *model) handleCommandSelection(item commandItem) (tea.Model, tea.Cmd) {
 		m.slugInput.SetValue(m.interaction.slug.String())
 		m.slugInput.Focus()
 		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case "toggle":
+		m.showingCommands = false
+		m.interaction.forwarder.SetEnabled(!m.interaction.forwarder.Enabled())
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case "errors":
+		m.showingCommands = false
+		m.showingErrors = true
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case "auth":
+		m.showingCommands = false
+		m.editingAuth = true
+		m.authError = ""
+		m.authInput.SetValue("")
+		m.authInput.Focus()
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
 	case "tunnel-type":
 		m.showingCommands = false
+		if m.interaction.config.ComingSoonDisabled() {
+			return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+		}
 		m.showingComingSoon = true
 		return m, tea.Batch(tickCmd(5*time.Second), tea.ClearScreen, textinput.Blink)
 	default:
@@ -3,6 +3,7 @@ package interaction
 import (
 	"fmt"
 	"strings"
+	"tunnel_pls/internal/types"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -18,6 +19,10 @@ func (m *model) dashboardUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case key.Matches(msg, m.keymap.command):
 		m.showingCommands = true
 		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case key.Matches(msg, m.keymap.random) && m.tunnelType == types.TunnelTypeHTTP:
+		m.confirmingRegenerate = true
+		m.regenerateError = ""
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
 	}
 	return m, nil
 }
@@ -130,13 +135,25 @@ func (m *model) getUserInfoContent(isCompact bool) string {
 		return fmt.Sprintf("👤 %s\n\n%s\n%s",
 			userInfoStyle.Render(authenticatedUser),
 			sectionHeaderStyle.Render("🌐 FORWARDING ADDRESS:"),
-			addressStyle.Render(fmt.Sprintf("   %s", tunnelURL)))
+			addressStyle.Render(fmt.Sprintf("   %s", tunnelURL))) + m.renderDisabledNotice()
 	}
 
 	return fmt.Sprintf("👤  Authenticated as: %s\n\n%s\n     %s",
 		userInfoStyle.Render(authenticatedUser),
 		sectionHeaderStyle.Render("🌐  FORWARDING ADDRESS:"),
-		addressStyle.Render(tunnelURL))
+		addressStyle.Render(tunnelURL)) + m.renderDisabledNotice()
+}
+
+func (m *model) renderDisabledNotice() string {
+	if m.interaction.forwarder.Enabled() {
+		return ""
+	}
+
+	noticeStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorWarning)).
+		Bold(true)
+
+	return "\n\n" + noticeStyle.Render("⏸  Tunnel disabled, new connections are rejected")
 }
 
 func (m *model) renderQuickActions(isCompact bool) string {
@@ -162,6 +179,10 @@ func (m *model) renderQuickActions(isCompact bool) string {
 	commands := m.getActionCommands(keyHintStyle)
 	b.WriteString(featureStyle.Render(commands.commandsText))
 	b.WriteString("\n")
+	if m.tunnelType == types.TunnelTypeHTTP && m.keymap.random.Enabled() {
+		b.WriteString(featureStyle.Render(commands.regenerateText))
+		b.WriteString("\n")
+	}
 	b.WriteString(featureStyle.Render(commands.quitText))
 
 	return b.String()
@@ -178,21 +199,24 @@ func (m *model) getQuickActionsTitle() string {
 }
 
 type actionCommands struct {
-	commandsText string
-	quitText     string
+	commandsText   string
+	regenerateText string
+	quitText       string
 }
 
 func (m *model) getActionCommands(keyHintStyle lipgloss.Style) actionCommands {
 	if shouldUseCompactLayout(m.width, BreakpointSmall) {
 		return actionCommands{
-			commandsText: fmt.Sprintf("  %s  Commands", keyHintStyle.Render("[C]")),
-			quitText:     fmt.Sprintf("  %s  Quit", keyHintStyle.Render("[Q]")),
+			commandsText:   fmt.Sprintf("  %s  Commands", keyHintStyle.Render("[C]")),
+			regenerateText: fmt.Sprintf("  %s  New slug", keyHintStyle.Render("[^R]")),
+			quitText:       fmt.Sprintf("  %s  Quit", keyHintStyle.Render("[Q]")),
 		}
 	}
 
 	return actionCommands{
-		commandsText: fmt.Sprintf("  %s  Open commands menu", keyHintStyle.Render("[C]")),
-		quitText:     fmt.Sprintf("  %s  Quit application", keyHintStyle.Render("[Q]")),
+		commandsText:   fmt.Sprintf("  %s  Open commands menu", keyHintStyle.Render("[C]")),
+		regenerateText: fmt.Sprintf("  %s  Regenerate random slug", keyHintStyle.Render("[Ctrl+R]")),
+		quitText:       fmt.Sprintf("  %s  Quit application", keyHintStyle.Render("[Q]")),
 	}
 }
 
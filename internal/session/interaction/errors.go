@@ -0,0 +1,61 @@
+package interaction
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func (m *model) errorsUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.showingErrors = false
+	return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+}
+
+func (m *model) errorsView() string {
+	isVeryCompact := shouldUseCompactLayout(m.width, BreakpointTiny)
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(ColorPrimary)).
+		PaddingTop(1).
+		PaddingBottom(1)
+
+	errorStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorError))
+
+	emptyStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorGray))
+
+	helpStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorDarkGray)).
+		Italic(true).
+		MarginTop(1)
+
+	title := "⚠️  Recent Errors"
+	helpText := "Press any key to return to the dashboard..."
+	if isVeryCompact {
+		title = "Recent Errors"
+		helpText = "Press any key..."
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n\n")
+
+	entries := m.interaction.forwarder.RecentErrors()
+	if len(entries) == 0 {
+		b.WriteString(emptyStyle.Render("No forwarding errors recorded."))
+		b.WriteString("\n")
+	}
+
+	maxWidth := getResponsiveWidth(m.width, 4, 20, 120)
+	for i := len(entries) - 1; i >= 0; i-- {
+		b.WriteString(errorStyle.Render(truncateString(entries[i], maxWidth)))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(helpStyle.Render(helpText))
+	return b.String()
+}
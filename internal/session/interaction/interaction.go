@@ -2,8 +2,11 @@ package interaction
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/random"
 	"tunnel_pls/internal/session/slug"
@@ -27,6 +30,7 @@ type Interaction interface {
 	Start()
 	Redraw()
 	Send(message string) error
+	SendDiagnostic(message string) error
 }
 
 type SessionRegistry interface {
@@ -37,6 +41,10 @@ type Forwarder interface {
 	Close() error
 	TunnelType() types.TunnelType
 	ForwardedPort() uint16
+	SetEnabled(enabled bool)
+	Enabled() bool
+	RecentErrors() []string
+	SetBasicAuth(username, password string) error
 }
 
 type CloseFunc func() error
@@ -44,6 +52,7 @@ type interaction struct {
 	randomizer      random.Random
 	config          config.Config
 	channel         ssh.Channel
+	channelMu       sync.RWMutex
 	slug            slug.Slug
 	forwarder       Forwarder
 	closeFunc       CloseFunc
@@ -54,6 +63,7 @@ type interaction struct {
 	cancel          context.CancelFunc
 	mode            types.InteractiveMode
 	programMu       sync.Mutex
+	lastSlugChange  time.Time
 }
 
 func (i *interaction) SetMode(m types.InteractiveMode) {
@@ -65,12 +75,68 @@ func (i *interaction) Mode() types.InteractiveMode {
 }
 
 func (i *interaction) Send(message string) error {
-	if i.channel != nil {
-		_, err := i.channel.Write([]byte(message))
+	if channel := i.currentChannel(); channel != nil {
+		_, err := channel.Write([]byte(message))
 		return err
 	}
 	return nil
 }
+
+// SendDiagnostic writes to the channel's stderr stream so error output does
+// not corrupt the TUI being drawn on stdout.
+func (i *interaction) SendDiagnostic(message string) error {
+	channel := i.currentChannel()
+	if channel == nil {
+		return nil
+	}
+	stderr := channel.Stderr()
+	if stderr == nil {
+		return nil
+	}
+	_, err := stderr.Write([]byte(message))
+	return err
+}
+
+func (i *interaction) sendExitStatus(status uint32) {
+	channel := i.currentChannel()
+	if channel == nil {
+		return
+	}
+	payload := ssh.Marshal(struct{ Status uint32 }{status})
+	if _, err := channel.SendRequest("exit-status", false, payload); err != nil {
+		log.Printf("Failed to send exit-status: %v", err)
+	}
+}
+
+func (i *interaction) keepalive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := i.currentChannel().SendRequest("keepalive@openssh.com", false, nil); err != nil {
+				log.Printf("Failed to send interactive keepalive: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// runProgram runs the dashboard, turning a panic that escapes Bubble Tea into
+// an error so a broken dashboard only ends its own session.
+func (i *interaction) runProgram() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", tea.ErrProgramPanic, r)
+		}
+	}()
+	_, err = i.program.Run()
+	return err
+}
+
 func (i *interaction) SetWH(w, h int) {
 	if i.program != nil {
 		i.program.Send(tea.WindowSizeMsg{
@@ -98,9 +164,17 @@ func New(randomizer random.Random, config config.Config, slug slug.Slug, forward
 }
 
 func (i *interaction) SetChannel(channel ssh.Channel) {
+	i.channelMu.Lock()
+	defer i.channelMu.Unlock()
 	i.channel = channel
 }
 
+func (i *interaction) currentChannel() ssh.Channel {
+	i.channelMu.RLock()
+	defer i.channelMu.RUnlock()
+	return i.channel
+}
+
 func (i *interaction) Stop() {
 	if i.cancel != nil {
 		i.cancel()
@@ -130,8 +204,10 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		if msg.Width < 80 {
 			m.slugInput.Width = msg.Width - 10
+			m.authInput.Width = msg.Width - 10
 		} else {
 			m.slugInput.Width = 50
+			m.authInput.Width = 50
 		}
 		return m, nil
 
@@ -148,6 +224,18 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.slugUpdate(msg)
 		}
 
+		if m.editingAuth {
+			return m.authUpdate(msg)
+		}
+
+		if m.confirmingRegenerate {
+			return m.regenerateUpdate(msg)
+		}
+
+		if m.showingErrors {
+			return m.errorsUpdate(msg)
+		}
+
 		if m.showingCommands {
 			return m.commandsUpdate(msg)
 		}
@@ -177,6 +265,18 @@ func (m *model) View() string {
 		return m.slugView()
 	}
 
+	if m.editingAuth {
+		return m.authView()
+	}
+
+	if m.confirmingRegenerate {
+		return m.regenerateView()
+	}
+
+	if m.showingErrors {
+		return m.errorsView()
+	}
+
 	if m.showingCommands {
 		return m.commandsView()
 	}
@@ -198,9 +298,17 @@ func (i *interaction) Start() {
 	tunnelType := i.forwarder.TunnelType()
 	port := i.forwarder.ForwardedPort()
 
+	tunnelTypeDesc := "Change tunnel type (Coming Soon)"
+	if i.config.ComingSoonDisabled() {
+		tunnelTypeDesc = "Change tunnel type (Not Available)"
+	}
+
 	items := []list.Item{
 		commandItem{name: "slug", desc: "Set custom subdomain"},
-		commandItem{name: "tunnel-type", desc: "Change tunnel type (Coming Soon)"},
+		commandItem{name: "toggle", desc: "Disable or re-enable the tunnel without disconnecting"},
+		commandItem{name: "errors", desc: "Show recent forwarding errors"},
+		commandItem{name: "auth", desc: "Rotate basic-auth credentials"},
+		commandItem{name: "tunnel-type", desc: tunnelTypeDesc},
 	}
 
 	delegate := list.NewDefaultDelegate()
@@ -215,17 +323,23 @@ func (i *interaction) Start() {
 
 	ti := textinput.New()
 	ti.Placeholder = "my-custom-slug"
-	ti.CharLimit = 20
+	ti.CharLimit = i.config.MaxSlugLength()
 	ti.Width = 50
 
+	ai := textinput.New()
+	ai.Placeholder = "username:password"
+	ai.CharLimit = 128
+	ai.Width = 50
+
 	m := &model{
 		randomizer:  i.randomizer,
-		domain:      i.config.Domain(),
+		domain:      config.TunnelDomain(i.config),
 		protocol:    protocol,
 		tunnelType:  tunnelType,
 		port:        port,
 		commandList: commandList,
 		slugInput:   ti,
+		authInput:   ai,
 		interaction: i,
 		keymap: keymap{
 			quit: key.NewBinding(
@@ -243,12 +357,14 @@ func (i *interaction) Start() {
 		},
 		help: help.New(),
 	}
+	m.keymap.random.SetEnabled(!i.config.RandomKeybindingDisabled())
 
+	channel := i.currentChannel()
 	i.programMu.Lock()
 	i.program = tea.NewProgram(
 		m,
-		tea.WithInput(i.channel),
-		tea.WithOutput(i.channel),
+		tea.WithInput(channel),
+		tea.WithOutput(channel),
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(),
 		tea.WithoutSignals(),
@@ -257,9 +373,23 @@ func (i *interaction) Start() {
 	)
 	i.programMu.Unlock()
 
-	_, err := i.program.Run()
+	keepaliveCtx, stopKeepalive := context.WithCancel(i.ctx)
+	if interval := i.config.InteractiveKeepalive(); interval > 0 {
+		go i.keepalive(keepaliveCtx, interval)
+	}
+
+	err := i.runProgram()
+	stopKeepalive()
+	if errors.Is(err, tea.ErrProgramPanic) {
+		log.Printf("Interactive dashboard for %s panicked, closing session: %v", i.user, err)
+	}
 	if err != nil {
 		log.Printf("Cannot close tea: %s \n", err)
+		if diagErr := i.SendDiagnostic(fmt.Sprintf("Dashboard stopped unexpectedly: %v\r\n", err)); diagErr != nil {
+			log.Printf("Failed to write diagnostic to stderr: %v", diagErr)
+		}
+	} else {
+		i.sendExitStatus(0)
 	}
 
 	i.programMu.Lock()
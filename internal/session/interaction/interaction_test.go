@@ -1,20 +1,28 @@
 package interaction
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"tunnel_pls/internal/session/forwarder"
 	"tunnel_pls/internal/types"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -31,28 +39,100 @@ type MockConfig struct {
 	mock.Mock
 }
 
-func (m *MockConfig) Domain() string            { return m.Called().String(0) }
-func (m *MockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *MockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *MockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *MockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *MockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *MockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *MockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) AllowedPortsStart() uint16 { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) AllowedPortsEnd() uint16   { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *MockConfig) PprofPort() string         { return m.Called().String(0) }
-func (m *MockConfig) Mode() types.ServerMode    { return m.Called().Get(0).(types.ServerMode) }
-func (m *MockConfig) GRPCAddress() string       { return m.Called().String(0) }
-func (m *MockConfig) GRPCPort() string          { return m.Called().String(0) }
-func (m *MockConfig) NodeToken() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *MockConfig) KeyLoc() string            { return m.Called().String(0) }
+func (m *MockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *MockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *MockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *MockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *MockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *MockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *MockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *MockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *MockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *MockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *MockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *MockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *MockConfig) AllowedPortsStart() uint16        { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) AllowedPortsEnd() uint16          { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *MockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *MockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *MockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *MockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *MockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *MockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *MockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *MockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *MockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *MockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *MockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *MockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *MockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *MockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *MockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *MockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *MockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *MockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *MockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *MockConfig) PprofPort() string                    { return m.Called().String(0) }
+func (m *MockConfig) Mode() types.ServerMode               { return m.Called().Get(0).(types.ServerMode) }
+func (m *MockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *MockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *MockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *MockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *MockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *MockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *MockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *MockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *MockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *MockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *MockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *MockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *MockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *MockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *MockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TLSStoragePath() string               { return m.Called().String(0) }
+func (m *MockConfig) KeyLoc() string                       { return m.Called().String(0) }
+func (m *MockConfig) SSHHostKey() string                   { return m.Called().String(0) }
 
 type MockSlug struct {
 	mock.Mock
@@ -74,6 +154,15 @@ func (m *MockForwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 	m.Called(dst, src)
 }
 
+func (m *MockForwarder) ForwardDatagram(dst ssh.Channel, p []byte) error {
+	args := m.Called(dst, p)
+	return args.Error(0)
+}
+
+func (m *MockForwarder) HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel) {
+	m.Called(dst, peer, src)
+}
+
 func (m *MockForwarder) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -97,6 +186,98 @@ func (m *MockForwarder) SetForwardedPort(port uint16) {
 	m.Called(port)
 }
 
+func (m *MockForwarder) SetAllowedMethods(methods []string) {
+	m.Called(methods)
+}
+
+func (m *MockForwarder) AllowedMethods() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetAllowedOrigins(origins []string) {
+	m.Called(origins)
+}
+
+func (m *MockForwarder) AllowedOrigins() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetHostHeader(host string) {
+	m.Called(host)
+}
+
+func (m *MockForwarder) HostHeader() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetRewriteLocation(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) RewriteLocation() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) SetDefaultContentType(contentType string) {
+	m.Called(contentType)
+}
+
+func (m *MockForwarder) DefaultContentType() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetMirrorBodyLimit(limit int) {
+	m.Called(limit)
+}
+
+func (m *MockForwarder) MirrorBodyLimit() int {
+	return m.Called().Int(0)
+}
+
+func (m *MockForwarder) SetBasicAuth(username, password string) error {
+	return m.Called(username, password).Error(0)
+}
+
+func (m *MockForwarder) BasicAuthEnabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) CheckBasicAuth(username, password string) bool {
+	return m.Called(username, password).Bool(0)
+}
+
+func (m *MockForwarder) SetEnabled(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) Enabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) RecentErrors() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) BytesIn() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
+func (m *MockForwarder) BytesOut() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
 func (m *MockForwarder) SetListener(listener net.Listener) {
 	m.Called(listener)
 }
@@ -106,6 +287,10 @@ func (m *MockForwarder) Listener() net.Listener {
 	return args.Get(0).(net.Listener)
 }
 
+func (m *MockForwarder) SetPacketConn(conn net.PacketConn) {
+	m.Called(conn)
+}
+
 func (m *MockForwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error) {
 	args := m.Called(ctx, origin)
 	if args.Get(0) == nil {
@@ -339,6 +524,40 @@ func TestInteraction_Send(t *testing.T) {
 	}
 }
 
+func TestInteraction_SendDiagnostic(t *testing.T) {
+	tests := []struct {
+		name         string
+		setupChannel bool
+		stderr       io.ReadWriter
+	}{
+		{name: "writes to stderr", setupChannel: true, stderr: &bytes.Buffer{}},
+		{name: "channel without stderr", setupChannel: true},
+		{name: "without channel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSlug := &MockSlug{}
+			mockCloser := &MockCloser{}
+			mockInteraction := New(&MockRandom{}, &MockConfig{}, mockSlug, &MockForwarder{}, &MockSessionRegistry{}, "user", mockCloser.Close)
+
+			mockChannel := &MockChannel{}
+			if tt.setupChannel {
+				mockChannel.On("Stderr").Return(tt.stderr)
+				mockInteraction.SetChannel(mockChannel)
+			}
+
+			err := mockInteraction.SendDiagnostic("something went wrong\r\n")
+			assert.NoError(t, err)
+			if buf, ok := tt.stderr.(*bytes.Buffer); ok {
+				assert.Equal(t, "something went wrong\r\n", buf.String())
+			}
+			mockChannel.AssertNotCalled(t, "Write", mock.Anything)
+			assert.Empty(t, mockChannel.data)
+		})
+	}
+}
+
 func TestInteraction_SetWH(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -398,6 +617,43 @@ func TestInteraction_SetChannel(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestInteraction_SetChannelConcurrentSend(t *testing.T) {
+	mockSlug := &MockSlug{}
+	mockSlug.On("String").Return("test-slug")
+	mockInteraction := New(&MockRandom{}, &MockConfig{}, mockSlug, &MockForwarder{}, &MockSessionRegistry{}, "user", (&MockCloser{}).Close)
+
+	channels := make([]*MockChannel, 50)
+	for idx := range channels {
+		channels[idx] = &MockChannel{}
+		channels[idx].On("Write", mock.Anything).Return(4, nil)
+	}
+	mockInteraction.SetChannel(channels[0])
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for _, ch := range channels[1:] {
+			mockInteraction.SetChannel(ch)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range channels {
+			assert.NoError(t, mockInteraction.Send("ping"))
+		}
+	}()
+	wg.Wait()
+
+	latest := channels[len(channels)-1]
+	before := len(latest.data)
+	require.NoError(t, mockInteraction.Send("last"))
+	assert.Equal(t, "last", string(latest.data[before:]))
+	for _, ch := range channels[:len(channels)-1] {
+		assert.NotContains(t, string(ch.data), "last")
+	}
+}
+
 func TestInteraction_Redraw(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -461,8 +717,14 @@ func TestInteraction_Start(t *testing.T) {
 			mockInteraction.SetMode(tt.mode)
 
 			mockConfig.On("Domain").Return("tunnl.live")
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("TLSEnabled").Return(tt.tlsEnabled)
+			mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+			mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+			mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockForwarder.On("TunnelType").Return(tt.tunnelType)
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockForwarder.On("ForwardedPort").Return(tt.port)
 
 			mockInteraction.Start()
@@ -613,6 +875,7 @@ func TestModel_View(t *testing.T) {
 			mockConfig := &MockConfig{}
 			mockSlug := &MockSlug{}
 			mockForwarder := &MockForwarder{}
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockSessionRegistry := &MockSessionRegistry{}
 			mockCloser := &MockCloser{}
 			mockSlug.On("String").Return("test-slug")
@@ -730,6 +993,10 @@ func TestModel_Update_KeyMessages(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRandom := &MockRandom{}
 			mockConfig := &MockConfig{}
+			mockConfig.On("SlugChangeCooldown").Return(time.Duration(0)).Maybe()
+			mockConfig.On("RequireTLSForAdmin").Return(false).Maybe()
+			mockConfig.On("RequireStrongSlugs").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockSlug := &MockSlug{}
 			mockForwarder := &MockForwarder{}
 			mockSessionRegistry := &MockSessionRegistry{}
@@ -868,6 +1135,10 @@ func TestModel_SlugUpdate(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRandom := &MockRandom{}
 			mockConfig := &MockConfig{}
+			mockConfig.On("SlugChangeCooldown").Return(time.Duration(0)).Maybe()
+			mockConfig.On("RequireTLSForAdmin").Return(false).Maybe()
+			mockConfig.On("RequireStrongSlugs").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockSlug := &MockSlug{}
 			mockForwarder := &MockForwarder{}
 			mockSessionRegistry := &MockSessionRegistry{}
@@ -923,6 +1194,350 @@ func TestModel_SlugUpdate(t *testing.T) {
 	}
 }
 
+func TestModel_SlugChangeCooldown(t *testing.T) {
+	mockRandom := &MockRandom{}
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockSessionRegistry := &MockSessionRegistry{}
+	mockCloser := &MockCloser{}
+	mockConfig.On("SlugChangeCooldown").Return(time.Minute)
+	mockConfig.On("RequireTLSForAdmin").Return(false).Maybe()
+	mockConfig.On("RequireStrongSlugs").Return(false).Maybe()
+	mockSlug.On("String").Return("old-slug")
+	mockSessionRegistry.On("Update", "testuser",
+		types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+		types.SessionKey{Id: "first-change", Type: types.TunnelTypeHTTP},
+	).Return(nil).Once()
+
+	mockInteraction := New(mockRandom, mockConfig, mockSlug, &MockForwarder{}, mockSessionRegistry, "testuser", mockCloser.Close)
+
+	ti := textinput.New()
+	ti.SetValue("first-change")
+	m := &model{
+		randomizer:  mockRandom,
+		tunnelType:  types.TunnelTypeHTTP,
+		slugInput:   ti,
+		editingSlug: true,
+		interaction: mockInteraction.(*interaction),
+	}
+
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.False(t, m.editingSlug)
+	assert.Empty(t, m.slugError)
+
+	m.editingSlug = true
+	m.slugInput.SetValue("second-change")
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, m.editingSlug)
+	assert.Contains(t, m.slugError, "please wait")
+
+	m.confirmingRegenerate = true
+	_, _ = m.regenerateUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, m.confirmingRegenerate)
+	assert.Contains(t, m.regenerateError, "please wait")
+
+	mockSessionRegistry.AssertNumberOfCalls(t, "Update", 1)
+	mockRandom.AssertNotCalled(t, "String", mock.Anything)
+
+	m.interaction.lastSlugChange = time.Now().Add(-2 * time.Minute)
+	mockSessionRegistry.On("Update", "testuser",
+		types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+		types.SessionKey{Id: "second-change", Type: types.TunnelTypeHTTP},
+	).Return(nil).Once()
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.False(t, m.editingSlug)
+	assert.Empty(t, m.slugError)
+}
+
+func TestModel_RequireStrongSlugs(t *testing.T) {
+	tests := []struct {
+		name        string
+		require     bool
+		slug        string
+		expectError bool
+	}{
+		{name: "short slug rejected", require: true, slug: "my-app", expectError: true},
+		{name: "repetitive slug rejected", require: true, slug: "abababababab", expectError: true},
+		{name: "strong slug accepted", require: true, slug: "k7x-qm2p-zr9w"},
+		{name: "weak slug accepted without flag", require: false, slug: "my-app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockSlug := &MockSlug{}
+			mockSessionRegistry := &MockSessionRegistry{}
+			mockCloser := &MockCloser{}
+			mockConfig.On("SlugChangeCooldown").Return(time.Duration(0))
+			mockConfig.On("RequireTLSForAdmin").Return(false).Maybe()
+			mockConfig.On("RequireStrongSlugs").Return(tt.require)
+			mockSlug.On("String").Return("old-slug")
+			mockSessionRegistry.On("Update", "testuser",
+				types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+				types.SessionKey{Id: tt.slug, Type: types.TunnelTypeHTTP},
+			).Return(nil).Maybe()
+
+			mockInteraction := New(&MockRandom{}, mockConfig, mockSlug, &MockForwarder{}, mockSessionRegistry, "testuser", mockCloser.Close)
+
+			ti := textinput.New()
+			ti.SetValue(tt.slug)
+			m := &model{
+				tunnelType:  types.TunnelTypeHTTP,
+				slugInput:   ti,
+				editingSlug: true,
+				interaction: mockInteraction.(*interaction),
+			}
+
+			_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+			if tt.expectError {
+				assert.True(t, m.editingSlug)
+				assert.Contains(t, m.slugError, "too easy to guess")
+				mockSessionRegistry.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.False(t, m.editingSlug)
+			assert.Empty(t, m.slugError)
+			mockSessionRegistry.AssertNumberOfCalls(t, "Update", 1)
+		})
+	}
+}
+
+func TestModel_RequireTLSForAdmin(t *testing.T) {
+	tests := []struct {
+		name        string
+		require     bool
+		protocol    string
+		expectError bool
+	}{
+		{name: "blocked on plain session", require: true, protocol: "http", expectError: true},
+		{name: "allowed on TLS session", require: true, protocol: "https"},
+		{name: "allowed without policy", require: false, protocol: "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
+			mockSlug := &MockSlug{}
+			mockRandom := &MockRandom{}
+			mockSessionRegistry := &MockSessionRegistry{}
+			mockCloser := &MockCloser{}
+			mockConfig.On("RequireTLSForAdmin").Return(tt.require)
+			mockConfig.On("SlugChangeCooldown").Return(time.Duration(0)).Maybe()
+			mockConfig.On("RequireStrongSlugs").Return(false).Maybe()
+			mockSlug.On("String").Return("old-slug")
+			mockRandom.On("String", 20).Return("random-slug", nil).Maybe()
+			mockSessionRegistry.On("Update", "testuser", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			mockInteraction := New(mockRandom, mockConfig, mockSlug, &MockForwarder{}, mockSessionRegistry, "testuser", mockCloser.Close)
+
+			ti := textinput.New()
+			ti.SetValue("new-slug")
+			m := &model{
+				randomizer:  mockRandom,
+				protocol:    tt.protocol,
+				tunnelType:  types.TunnelTypeHTTP,
+				slugInput:   ti,
+				editingSlug: true,
+				interaction: mockInteraction.(*interaction),
+			}
+
+			_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+			m.confirmingRegenerate = true
+			_, _ = m.regenerateUpdate(tea.KeyMsg{Type: tea.KeyEnter})
+
+			if tt.expectError {
+				assert.True(t, m.editingSlug)
+				assert.Contains(t, m.slugError, "requires a TLS-enabled server")
+				assert.True(t, m.confirmingRegenerate)
+				assert.Contains(t, m.regenerateError, "requires a TLS-enabled server")
+				mockSessionRegistry.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.False(t, m.editingSlug)
+			assert.Empty(t, m.slugError)
+			assert.False(t, m.confirmingRegenerate)
+			assert.Empty(t, m.regenerateError)
+			mockSessionRegistry.AssertNumberOfCalls(t, "Update", 2)
+		})
+	}
+}
+
+func TestModel_RegenerateSlug(t *testing.T) {
+	tests := []struct {
+		name            string
+		tunnelType      types.TunnelType
+		confirmKey      tea.KeyMsg
+		setupMocks      func(*MockSessionRegistry, *MockSlug, *MockRandom)
+		expectPrompt    bool
+		expectConfirmed bool
+		expectedError   string
+	}{
+		{
+			name:       "y confirms and updates registry to a new random slug",
+			tunnelType: types.TunnelTypeHTTP,
+			confirmKey: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}},
+			setupMocks: func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {
+				ms.On("String").Return("old-slug")
+				mr.On("String", 20).Return("fresh-random-slug", nil)
+				msr.On("Update", "testuser",
+					types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+					types.SessionKey{Id: "fresh-random-slug", Type: types.TunnelTypeHTTP},
+				).Return(nil)
+			},
+			expectPrompt:    true,
+			expectConfirmed: true,
+		},
+		{
+			name:       "enter confirms",
+			tunnelType: types.TunnelTypeHTTP,
+			confirmKey: tea.KeyMsg{Type: tea.KeyEnter},
+			setupMocks: func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {
+				ms.On("String").Return("old-slug")
+				mr.On("String", 20).Return("another-random-slug", nil)
+				msr.On("Update", "testuser",
+					types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+					types.SessionKey{Id: "another-random-slug", Type: types.TunnelTypeHTTP},
+				).Return(nil)
+			},
+			expectPrompt:    true,
+			expectConfirmed: true,
+		},
+		{
+			name:         "n cancels without touching the registry",
+			tunnelType:   types.TunnelTypeHTTP,
+			confirmKey:   tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}},
+			setupMocks:   func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {},
+			expectPrompt: true,
+		},
+		{
+			name:         "esc cancels without touching the registry",
+			tunnelType:   types.TunnelTypeHTTP,
+			confirmKey:   tea.KeyMsg{Type: tea.KeyEsc},
+			setupMocks:   func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {},
+			expectPrompt: true,
+		},
+		{
+			name:       "registry error keeps the prompt open",
+			tunnelType: types.TunnelTypeHTTP,
+			confirmKey: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}},
+			setupMocks: func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {
+				ms.On("String").Return("old-slug")
+				mr.On("String", 20).Return("taken-slug", nil)
+				msr.On("Update", "testuser",
+					types.SessionKey{Id: "old-slug", Type: types.TunnelTypeHTTP},
+					types.SessionKey{Id: "taken-slug", Type: types.TunnelTypeHTTP},
+				).Return(assert.AnError)
+			},
+			expectPrompt:  true,
+			expectedError: assert.AnError.Error(),
+		},
+		{
+			name:       "random error keeps the prompt open",
+			tunnelType: types.TunnelTypeHTTP,
+			confirmKey: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}},
+			setupMocks: func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {
+				mr.On("String", 20).Return("", assert.AnError)
+			},
+			expectPrompt:  true,
+			expectedError: assert.AnError.Error(),
+		},
+		{
+			name:       "tcp tunnel has no slug to regenerate",
+			tunnelType: types.TunnelTypeTCP,
+			setupMocks: func(msr *MockSessionRegistry, ms *MockSlug, mr *MockRandom) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRandom := &MockRandom{}
+			mockConfig := &MockConfig{}
+			mockConfig.On("SlugChangeCooldown").Return(time.Duration(0)).Maybe()
+			mockConfig.On("RequireTLSForAdmin").Return(false).Maybe()
+			mockConfig.On("RequireStrongSlugs").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
+			mockSlug := &MockSlug{}
+			mockForwarder := &MockForwarder{}
+			mockSessionRegistry := &MockSessionRegistry{}
+			mockCloser := &MockCloser{}
+
+			mockInteraction := New(mockRandom, mockConfig, mockSlug, mockForwarder, mockSessionRegistry, "testuser", mockCloser.Close)
+
+			m := &model{
+				randomizer:  mockRandom,
+				domain:      "tunnl.live",
+				protocol:    "http",
+				tunnelType:  tt.tunnelType,
+				interaction: mockInteraction.(*interaction),
+				keymap: keymap{
+					quit: key.NewBinding(
+						key.WithKeys("q", "ctrl+c"),
+						key.WithHelp("q", "quit"),
+					),
+					command: key.NewBinding(
+						key.WithKeys("c"),
+						key.WithHelp("c", "commands"),
+					),
+					random: key.NewBinding(
+						key.WithKeys("ctrl+r"),
+						key.WithHelp("ctrl+r", "random"),
+					),
+				},
+			}
+
+			tt.setupMocks(mockSessionRegistry, mockSlug, mockRandom)
+
+			result, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+			resultModel := result.(*model)
+			assert.Equal(t, tt.expectPrompt, resultModel.confirmingRegenerate)
+			if !tt.expectPrompt {
+				mockSessionRegistry.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			result, _ = resultModel.Update(tt.confirmKey)
+			resultModel = result.(*model)
+
+			if tt.expectedError != "" {
+				assert.True(t, resultModel.confirmingRegenerate)
+				assert.Equal(t, tt.expectedError, resultModel.regenerateError)
+			} else {
+				assert.False(t, resultModel.confirmingRegenerate)
+				assert.Equal(t, "", resultModel.regenerateError)
+			}
+			if !tt.expectConfirmed && tt.expectedError == "" {
+				mockSessionRegistry.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			}
+
+			mockSessionRegistry.AssertExpectations(t)
+			mockSlug.AssertExpectations(t)
+			mockRandom.AssertExpectations(t)
+		})
+	}
+}
+
+func TestModel_RegenerateView(t *testing.T) {
+	mockSlug := &MockSlug{}
+	mockSlug.On("String").Return("old-slug")
+	mockInteraction := New(&MockRandom{}, &MockConfig{}, mockSlug, &MockForwarder{}, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+
+	m := &model{
+		domain:               "tunnl.live",
+		protocol:             "https",
+		tunnelType:           types.TunnelTypeHTTP,
+		width:                100,
+		confirmingRegenerate: true,
+		regenerateError:      "slug already in use",
+		interaction:          mockInteraction.(*interaction),
+	}
+
+	view := m.View()
+	assert.Contains(t, view, "Regenerate Subdomain")
+	assert.Contains(t, view, "https://old-slug.tunnl.live")
+	assert.Contains(t, view, "slug already in use")
+}
+
 func TestModel_SlugView(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1097,12 +1712,13 @@ func TestModel_ComingSoonView(t *testing.T) {
 
 func TestModel_CommandsUpdate(t *testing.T) {
 	tests := []struct {
-		name             string
-		keyMsg           tea.KeyMsg
-		selectedItem     list.Item
-		expectCommands   bool
-		expectEditSlug   bool
-		expectComingSoon bool
+		name               string
+		keyMsg             tea.KeyMsg
+		selectedItem       list.Item
+		comingSoonDisabled bool
+		expectCommands     bool
+		expectEditSlug     bool
+		expectComingSoon   bool
 	}{
 		{
 			name:           "escape key closes commands",
@@ -1128,6 +1744,14 @@ func TestModel_CommandsUpdate(t *testing.T) {
 			expectCommands:   false,
 			expectComingSoon: true,
 		},
+		{
+			name:               "enter on tunnel-type with coming soon disabled does nothing",
+			keyMsg:             tea.KeyMsg{Type: tea.KeyEnter},
+			selectedItem:       commandItem{name: "tunnel-type", desc: "Change tunnel type"},
+			comingSoonDisabled: true,
+			expectCommands:     false,
+			expectComingSoon:   false,
+		},
 		{
 			name:           "arrow key navigates list",
 			keyMsg:         tea.KeyMsg{Type: tea.KeyDown},
@@ -1144,6 +1768,7 @@ func TestModel_CommandsUpdate(t *testing.T) {
 			mockSessionRegistry := &MockSessionRegistry{}
 			mockCloser := &MockCloser{}
 			mockSlug.On("String").Return("test-slug")
+			mockConfig.On("ComingSoonDisabled").Return(tt.comingSoonDisabled).Maybe()
 
 			mockInteraction := New(mockRandom, mockConfig, mockSlug, mockForwarder, mockSessionRegistry, "testuser", mockCloser.Close)
 
@@ -1196,9 +1821,184 @@ func TestModel_CommandsUpdate(t *testing.T) {
 			if tt.expectEditSlug {
 				assert.True(t, resultModel.editingSlug)
 			}
-			if tt.expectComingSoon {
-				assert.True(t, resultModel.showingComingSoon)
+			assert.Equal(t, tt.expectComingSoon, resultModel.showingComingSoon)
+		})
+	}
+}
+
+func TestModel_ToggleCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		expectSet  bool
+		expectNote bool
+	}{
+		{name: "disables an enabled tunnel", enabled: true, expectSet: false, expectNote: true},
+		{name: "re-enables a disabled tunnel", enabled: false, expectSet: true, expectNote: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSlug := &MockSlug{}
+			mockForwarder := &MockForwarder{}
+			mockSlug.On("String").Return("test-slug").Maybe()
+			mockForwarder.On("Enabled").Return(tt.enabled).Once()
+			mockForwarder.On("SetEnabled", tt.expectSet).Once()
+			mockForwarder.On("Enabled").Return(tt.expectSet)
+
+			mockInteraction := New(&MockRandom{}, &MockConfig{}, mockSlug, mockForwarder, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+
+			m := &model{
+				domain:          "tunnl.live",
+				protocol:        "http",
+				tunnelType:      types.TunnelTypeHTTP,
+				width:           100,
+				showingCommands: true,
+				interaction:     mockInteraction.(*interaction),
+			}
+
+			result, _ := m.handleCommandSelection(commandItem{name: "toggle"})
+			resultModel := result.(*model)
+
+			assert.False(t, resultModel.showingCommands)
+			mockForwarder.AssertCalled(t, "SetEnabled", tt.expectSet)
+
+			view := resultModel.dashboardView()
+			if tt.expectNote {
+				assert.Contains(t, view, "Tunnel disabled")
+			} else {
+				assert.NotContains(t, view, "Tunnel disabled")
+			}
+		})
+	}
+}
+
+func TestModel_AuthRotate(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockConfig.On("RequireTLSForAdmin").Return(false)
+	fw := forwarder.New(mockConfig, &MockSlug{}, nil)
+	require.NoError(t, fw.SetBasicAuth("alice", "old-secret"))
+
+	mockInteraction := New(&MockRandom{}, mockConfig, &MockSlug{}, fw, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+	m := &model{
+		protocol:    "https",
+		authInput:   textinput.New(),
+		interaction: mockInteraction.(*interaction),
+	}
+
+	_, _ = m.handleCommandSelection(commandItem{name: "auth"})
+	assert.True(t, m.editingAuth)
+	assert.Contains(t, m.View(), "Rotate Basic Auth")
+
+	m.authInput.SetValue("bob:new-secret")
+	_, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	assert.False(t, m.editingAuth)
+	assert.Empty(t, m.authError)
+	assert.Empty(t, m.authInput.Value())
+	assert.False(t, fw.CheckBasicAuth("alice", "old-secret"))
+	assert.True(t, fw.CheckBasicAuth("bob", "new-secret"))
+}
+
+func TestModel_AuthRotateErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		protocol   string
+		value      string
+		requireTLS bool
+		setErr     error
+		wantErr    string
+	}{
+		{name: "malformed credentials", protocol: "https", value: "bob", wantErr: "username:password"},
+		{name: "requires tls", protocol: "http", value: "bob:secret", requireTLS: true, wantErr: "TLS-enabled"},
+		{name: "forwarder error", protocol: "https", value: "bob:secret", setErr: errors.New("hash failed"), wantErr: "hash failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockConfig.On("RequireTLSForAdmin").Return(tt.requireTLS)
+			mockForwarder := &MockForwarder{}
+			mockForwarder.On("SetBasicAuth", "bob", "secret").Return(tt.setErr).Maybe()
+
+			mockInteraction := New(&MockRandom{}, mockConfig, &MockSlug{}, mockForwarder, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+			m := &model{
+				protocol:    tt.protocol,
+				editingAuth: true,
+				authInput:   textinput.New(),
+				interaction: mockInteraction.(*interaction),
+			}
+			m.authInput.SetValue(tt.value)
+
+			_, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+			assert.True(t, m.editingAuth)
+			assert.Contains(t, m.authError, tt.wantErr)
+			assert.Contains(t, m.View(), tt.wantErr)
+
+			_, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+			assert.False(t, m.editingAuth)
+			assert.Empty(t, m.authError)
+		})
+	}
+}
+
+func TestModel_ErrorsView(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		width       int
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "no errors",
+			width:    100,
+			contains: []string{"Recent Errors", "No forwarding errors recorded."},
+		},
+		{
+			name: "latest errors first",
+			entries: []string{
+				"10:00:00 open channel: connect failed: connection refused",
+				"10:00:05 copy error (src to dst): connection reset by peer",
+			},
+			width:       100,
+			contains:    []string{"connection refused", "connection reset by peer"},
+			notContains: []string{"No forwarding errors recorded."},
+		},
+		{
+			name:     "compact layout",
+			entries:  []string{"10:00:00 boom"},
+			width:    40,
+			contains: []string{"Recent Errors", "Press any key..."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockForwarder := &MockForwarder{}
+			mockForwarder.On("RecentErrors").Return(tt.entries)
+
+			mockInteraction := New(&MockRandom{}, &MockConfig{}, &MockSlug{}, mockForwarder, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+
+			m := &model{
+				width:         tt.width,
+				showingErrors: true,
+				interaction:   mockInteraction.(*interaction),
+			}
+
+			view := m.View()
+			for _, s := range tt.contains {
+				assert.Contains(t, view, s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, view, s)
 			}
+			if len(tt.entries) == 2 {
+				assert.Less(t, strings.Index(view, "connection reset by peer"), strings.Index(view, "connection refused"))
+			}
+
+			result, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+			assert.False(t, result.(*model).showingErrors)
 		})
 	}
 }
@@ -1389,6 +2189,7 @@ func TestModel_DashboardView(t *testing.T) {
 			mockConfig := &MockConfig{}
 			mockSlug := &MockSlug{}
 			mockForwarder := &MockForwarder{}
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockSessionRegistry := &MockSessionRegistry{}
 			mockCloser := &MockCloser{}
 			mockSlug.On("String").Return("test-slug")
@@ -1414,6 +2215,75 @@ func TestModel_DashboardView(t *testing.T) {
 	}
 }
 
+func TestModel_RandomKeybindingDisabled(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockSlug.On("String").Return("test-slug")
+	mockForwarder := &MockForwarder{}
+	mockForwarder.On("Enabled").Return(true).Maybe()
+
+	mockInteraction := New(&MockRandom{}, mockConfig, mockSlug, mockForwarder, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+
+	random := key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "random"),
+	)
+	random.SetEnabled(false)
+
+	m := &model{
+		domain:      "tunnl.live",
+		protocol:    "http",
+		tunnelType:  types.TunnelTypeHTTP,
+		slugInput:   textinput.New(),
+		interaction: mockInteraction.(*interaction),
+		width:       100,
+		keymap:      keymap{random: random},
+	}
+
+	_, cmd := m.dashboardUpdate(tea.KeyMsg{Type: tea.KeyCtrlR})
+	assert.Nil(t, cmd)
+	assert.False(t, m.confirmingRegenerate)
+	assert.NotContains(t, m.dashboardView(), "Ctrl+R")
+
+	m.editingSlug = true
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyCtrlR})
+	assert.Empty(t, m.slugInput.Value())
+	assert.NotContains(t, m.slugView(), "CTRL+R")
+}
+
+func TestModel_SlugInputLimit(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockSlug.On("String").Return("test-slug")
+	mockForwarder := &MockForwarder{}
+
+	mockInteraction := New(&MockRandom{}, mockConfig, mockSlug, mockForwarder, &MockSessionRegistry{}, "testuser", (&MockCloser{}).Close)
+
+	slugInput := textinput.New()
+	slugInput.CharLimit = 12
+	slugInput.Focus()
+	m := &model{
+		domain:      "tunnl.live",
+		protocol:    "http",
+		tunnelType:  types.TunnelTypeHTTP,
+		slugInput:   slugInput,
+		interaction: mockInteraction.(*interaction),
+		width:       100,
+		editingSlug: true,
+	}
+
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("short")})
+	assert.NotContains(t, m.slugView(), "/12")
+
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("er-than-")})
+	assert.Equal(t, "shorter-than", m.slugInput.Value())
+	assert.Contains(t, m.slugView(), "12/12")
+	assert.Contains(t, m.slugView(), "3-12 chars")
+
+	_, _ = m.slugUpdate(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("limit")})
+	assert.Equal(t, "shorter-than", m.slugInput.Value())
+}
+
 func TestGetResponsiveWidth(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1529,12 +2399,50 @@ func TestTruncateString(t *testing.T) {
 			maxLength: 2,
 			expected:  "he",
 		},
+		{
+			name:      "multibyte string longer than max",
+			input:     "héllo wörld ünïcode",
+			maxLength: 10,
+			expected:  "héllo w...",
+		},
+		{
+			name:      "multibyte string within max",
+			input:     "héllo",
+			maxLength: 5,
+			expected:  "héllo",
+		},
+		{
+			name:      "wide runes longer than max",
+			input:     "日本語のテキスト",
+			maxLength: 10,
+			expected:  "日本語...",
+		},
+		{
+			name:      "wide rune not split at boundary",
+			input:     "日本語のテキスト",
+			maxLength: 8,
+			expected:  "日本...",
+		},
+		{
+			name:      "wide runes with very short max length",
+			input:     "日本語",
+			maxLength: 3,
+			expected:  "日",
+		},
+		{
+			name:      "wide runes within max",
+			input:     "日本語",
+			maxLength: 6,
+			expected:  "日本語",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := truncateString(tt.input, tt.maxLength)
 			assert.Equal(t, tt.expected, result)
+			assert.True(t, utf8.ValidString(result))
+			assert.LessOrEqual(t, runewidth.StringWidth(result), tt.maxLength)
 		})
 	}
 }
@@ -1572,7 +2480,7 @@ func TestBuildURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildURL(tt.protocol, tt.subdomain, tt.domain)
+			result := BuildURL(tt.protocol, tt.subdomain, tt.domain)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -1738,6 +2646,13 @@ func TestModel_GetTunnelURL(t *testing.T) {
 			port:       3306,
 			expected:   "tcp://tunnl.live:3306",
 		},
+		{
+			name:       "udp tunnel",
+			tunnelType: types.TunnelTypeUDP,
+			domain:     "tunnl.live",
+			port:       27015,
+			expected:   "udp://tunnl.live:27015",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1837,8 +2752,14 @@ func TestInteraction_Start_Interactive(t *testing.T) {
 			}
 
 			mockConfig.On("Domain").Return(tt.domain)
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("TLSEnabled").Return(tt.tlsEnabled)
+			mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+			mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+			mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockForwarder.On("TunnelType").Return(tt.tunnelType)
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockForwarder.On("ForwardedPort").Return(tt.port)
 			mockSlug.On("String").Return("test-slug")
 
@@ -1848,6 +2769,7 @@ func TestInteraction_Start_Interactive(t *testing.T) {
 			mockChannel := &MockChannel{}
 			mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 			mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockChannel.On("Stderr").Return(nil).Maybe()
 			mockInteraction.SetChannel(mockChannel)
 
 			done := make(chan bool, 1)
@@ -1875,6 +2797,56 @@ func TestInteraction_Start_Interactive(t *testing.T) {
 	}
 }
 
+func TestInteraction_Start_Keepalive(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockForwarder := &MockForwarder{}
+	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(10 * time.Millisecond)
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
+	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("ForwardedPort").Return(uint16(80))
+	mockSlug.On("String").Return("test-slug")
+
+	mockInteraction := New(&MockRandom{}, mockConfig, mockSlug, mockForwarder, &MockSessionRegistry{}, "testuser", nil)
+	mockInteraction.SetMode(types.InteractiveModeINTERACTIVE)
+
+	blockRead := make(chan struct{})
+	mockChannel := &MockChannel{}
+	mockChannel.On("Read", mock.Anything).Run(func(mock.Arguments) { <-blockRead }).Return(0, io.EOF).Maybe()
+	mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+	mockChannel.On("Stderr").Return(nil).Maybe()
+	var keepalives atomic.Int32
+	mockChannel.On("SendRequest", "keepalive@openssh.com", false, []byte(nil)).Run(func(mock.Arguments) {
+		keepalives.Add(1)
+	}).Return(false, nil)
+	mockChannel.On("SendRequest", "exit-status", false, mock.Anything).Return(false, nil).Maybe()
+	mockInteraction.SetChannel(mockChannel)
+
+	done := make(chan struct{})
+	go func() {
+		mockInteraction.Start()
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return keepalives.Load() >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mockInteraction.(*interaction).Stop()
+	close(blockRead)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start() did not complete in time")
+	}
+}
+
 func TestInteraction_Start_ProtocolSelection(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -1903,8 +2875,14 @@ func TestInteraction_Start_ProtocolSelection(t *testing.T) {
 			closeFunc := func() error { return nil }
 
 			mockConfig.On("Domain").Return("tunnl.live")
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("TLSEnabled").Return(tt.tlsEnabled)
+			mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+			mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+			mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockForwarder.On("ForwardedPort").Return(uint16(8080))
 			mockSlug.On("String").Return("test-slug")
 
@@ -1914,6 +2892,7 @@ func TestInteraction_Start_ProtocolSelection(t *testing.T) {
 			mockChannel := &MockChannel{}
 			mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 			mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockChannel.On("Stderr").Return(nil).Maybe()
 			mockInteraction.SetChannel(mockChannel)
 
 			go func() {
@@ -1964,14 +2943,21 @@ func TestInteraction_Stop(t *testing.T) {
 
 			if tt.setupProgram {
 				mockConfig.On("Domain").Return("tunnl.live")
+				mockConfig.On("NodeRegion").Return("").Maybe()
 				mockConfig.On("TLSEnabled").Return(false)
+				mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+				mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+				mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+				mockConfig.On("MaxSlugLength").Return(20).Maybe()
 				mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+				mockForwarder.On("Enabled").Return(true).Maybe()
 				mockForwarder.On("ForwardedPort").Return(uint16(8080))
 
 				mockInteraction.SetMode(types.InteractiveModeINTERACTIVE)
 				mockChannel := &MockChannel{}
 				mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 				mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+				mockChannel.On("Stderr").Return(nil).Maybe()
 				mockInteraction.SetChannel(mockChannel)
 
 				go func() {
@@ -2005,8 +2991,14 @@ func TestInteraction_Start_CommandListSetup(t *testing.T) {
 	closeFunc := func() error { return nil }
 
 	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
 	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
 	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("Enabled").Return(true).Maybe()
 	mockForwarder.On("ForwardedPort").Return(uint16(8080))
 
 	mockSlug.On("String").Return("test-slug")
@@ -2017,6 +3009,7 @@ func TestInteraction_Start_CommandListSetup(t *testing.T) {
 	mockChannel := &MockChannel{}
 	mockChannel.On("Read", mock.Anything).Return(0, nil)
 	mockChannel.On("Write", mock.Anything).Return(0, nil)
+	mockChannel.On("Stderr").Return(nil).Maybe()
 	mockInteraction.SetChannel(mockChannel)
 
 	go func() {
@@ -2041,8 +3034,14 @@ func TestInteraction_Start_TextInputSetup(t *testing.T) {
 	closeFunc := func() error { return nil }
 
 	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
 	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
 	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("Enabled").Return(true).Maybe()
 	mockForwarder.On("ForwardedPort").Return(uint16(8080))
 	mockSlug.On("String").Return("test-slug")
 
@@ -2052,6 +3051,7 @@ func TestInteraction_Start_TextInputSetup(t *testing.T) {
 	mockChannel := &MockChannel{}
 	mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 	mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+	mockChannel.On("Stderr").Return(nil).Maybe()
 	mockInteraction.SetChannel(mockChannel)
 
 	go func() {
@@ -2105,8 +3105,14 @@ func TestInteraction_Start_CleanupOnExit(t *testing.T) {
 			}
 
 			mockConfig.On("Domain").Return("tunnl.live")
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("TLSEnabled").Return(false)
+			mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+			mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+			mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockForwarder.On("ForwardedPort").Return(uint16(8080))
 			mockSlug.On("String").Return("test-slug")
 
@@ -2116,6 +3122,7 @@ func TestInteraction_Start_CleanupOnExit(t *testing.T) {
 			mockChannel := &MockChannel{}
 			mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 			mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockChannel.On("Stderr").Return(nil).Maybe()
 			mockInteraction.SetChannel(mockChannel)
 
 			done := make(chan bool, 1)
@@ -2144,6 +3151,180 @@ func TestInteraction_Start_CleanupOnExit(t *testing.T) {
 	}
 }
 
+type panickingModel struct{}
+
+func (panickingModel) Init() tea.Cmd                       { return nil }
+func (panickingModel) Update(tea.Msg) (tea.Model, tea.Cmd) { panic("update exploded") }
+func (panickingModel) View() string                        { return "" }
+
+func TestInteraction_RunProgramRecoversPanic(t *testing.T) {
+	i := New(&MockRandom{}, &MockConfig{}, &MockSlug{}, &MockForwarder{}, &MockSessionRegistry{}, "testuser", nil).(*interaction)
+	i.program = tea.NewProgram(
+		panickingModel{},
+		tea.WithInput(nil),
+		tea.WithOutput(io.Discard),
+		tea.WithoutSignalHandler(),
+		tea.WithoutCatchPanics(),
+	)
+
+	go i.program.Send(tea.KeyMsg{Type: tea.KeyEnter})
+
+	var err error
+	assert.NotPanics(t, func() { err = i.runProgram() })
+	assert.ErrorIs(t, err, tea.ErrProgramPanic)
+	assert.ErrorContains(t, err, "update exploded")
+}
+
+func TestInteraction_Start_PanicClosesSession(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockForwarder := &MockForwarder{}
+
+	var closeCalls atomic.Int32
+	closeFunc := func() error {
+		closeCalls.Add(1)
+		return nil
+	}
+
+	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
+	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("ForwardedPort").Return(uint16(8080))
+	mockForwarder.On("Enabled").Run(func(mock.Arguments) {
+		panic("dashboard exploded")
+	}).Return(true)
+	mockSlug.On("String").Return("test-slug")
+
+	mockInteraction := New(&MockRandom{}, mockConfig, mockSlug, mockForwarder, &MockSessionRegistry{}, "testuser", closeFunc)
+	mockInteraction.SetMode(types.InteractiveModeINTERACTIVE)
+
+	mockChannel := &MockChannel{}
+	blockRead := make(chan struct{})
+	defer close(blockRead)
+	mockChannel.On("Read", mock.Anything).Run(func(mock.Arguments) { <-blockRead }).Return(0, io.EOF).Maybe()
+	mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+	mockChannel.On("Stderr").Return(nil).Maybe()
+	mockInteraction.SetChannel(mockChannel)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mockInteraction.Start()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start() did not return after the dashboard panicked")
+	}
+
+	assert.Equal(t, int32(1), closeCalls.Load())
+	mockChannel.AssertNotCalled(t, "SendRequest", "exit-status", mock.Anything, mock.Anything)
+}
+
+func TestInteraction_Start_SendsExitStatus(t *testing.T) {
+	mockRandom := &MockRandom{}
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockForwarder := &MockForwarder{}
+	mockSessionRegistry := &MockSessionRegistry{}
+
+	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
+	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("ForwardedPort").Return(uint16(8080))
+	mockSlug.On("String").Return("test-slug")
+
+	closed := make(chan struct{})
+	mockInteraction := New(mockRandom, mockConfig, mockSlug, mockForwarder, mockSessionRegistry, "testuser", func() error {
+		close(closed)
+		return nil
+	})
+	mockInteraction.SetMode(types.InteractiveModeINTERACTIVE)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	mockChannel := &MockChannel{}
+	mockChannel.On("Read", mock.Anything).Run(func(args mock.Arguments) {
+		copy(args.Get(0).([]byte), "q")
+	}).Return(1, nil).Once()
+	mockChannel.On("Read", mock.Anything).Run(func(args mock.Arguments) {
+		<-release
+	}).Return(0, io.EOF).Maybe()
+	mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+	mockChannel.On("Stderr").Return(nil).Maybe()
+	mockChannel.On("SendRequest", "exit-status", false, ssh.Marshal(struct{ Status uint32 }{0})).Return(true, nil).Once()
+	mockInteraction.SetChannel(mockChannel)
+
+	go mockInteraction.Start()
+
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Start() did not exit after quit key")
+	}
+
+	mockChannel.AssertCalled(t, "SendRequest", "exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+}
+
+func TestInteraction_Start_NoExitStatusWhenKilled(t *testing.T) {
+	mockRandom := &MockRandom{}
+	mockConfig := &MockConfig{}
+	mockSlug := &MockSlug{}
+	mockForwarder := &MockForwarder{}
+	mockSessionRegistry := &MockSessionRegistry{}
+
+	mockConfig.On("Domain").Return("tunnl.live")
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("TLSEnabled").Return(false)
+	mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+	mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+	mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+	mockConfig.On("MaxSlugLength").Return(20).Maybe()
+	mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("ForwardedPort").Return(uint16(8080))
+	mockSlug.On("String").Return("test-slug")
+
+	mockInteraction := New(mockRandom, mockConfig, mockSlug, mockForwarder, mockSessionRegistry, "testuser", nil)
+	mockInteraction.SetMode(types.InteractiveModeINTERACTIVE)
+
+	mockChannel := &MockChannel{}
+	mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
+	mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+	mockChannel.On("Stderr").Return(nil).Maybe()
+	mockInteraction.SetChannel(mockChannel)
+
+	done := make(chan struct{})
+	go func() {
+		mockInteraction.Start()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	mockInteraction.(*interaction).Stop()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start() did not complete")
+	}
+
+	mockChannel.AssertNotCalled(t, "SendRequest", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestInteraction_Start_WithDifferentChannels(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -2169,8 +3350,14 @@ func TestInteraction_Start_WithDifferentChannels(t *testing.T) {
 			closeFunc := func() error { return nil }
 
 			mockConfig.On("Domain").Return("tunnl.live")
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("TLSEnabled").Return(false)
+			mockConfig.On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+			mockConfig.On("ComingSoonDisabled").Return(false).Maybe()
+			mockConfig.On("RandomKeybindingDisabled").Return(false).Maybe()
+			mockConfig.On("MaxSlugLength").Return(20).Maybe()
 			mockForwarder.On("TunnelType").Return(types.TunnelTypeHTTP)
+			mockForwarder.On("Enabled").Return(true).Maybe()
 			mockForwarder.On("ForwardedPort").Return(uint16(8080))
 			mockSlug.On("String").Return("test-slug")
 
@@ -2181,6 +3368,7 @@ func TestInteraction_Start_WithDifferentChannels(t *testing.T) {
 				mockChannel := &MockChannel{}
 				mockChannel.On("Read", mock.Anything).Return(0, assert.AnError).Maybe()
 				mockChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+				mockChannel.On("Stderr").Return(nil).Maybe()
 				mockInteraction.SetChannel(mockChannel)
 			}
 
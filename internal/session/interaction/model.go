@@ -11,6 +11,7 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
 )
 
 type commandItem struct {
@@ -23,23 +24,29 @@ func (i commandItem) Title() string       { return i.name }
 func (i commandItem) Description() string { return i.desc }
 
 type model struct {
-	randomizer        random.Random
-	domain            string
-	protocol          string
-	tunnelType        types.TunnelType
-	port              uint16
-	keymap            keymap
-	help              help.Model
-	quitting          bool
-	showingCommands   bool
-	editingSlug       bool
-	showingComingSoon bool
-	commandList       list.Model
-	slugInput         textinput.Model
-	slugError         string
-	interaction       *interaction
-	width             int
-	height            int
+	randomizer           random.Random
+	domain               string
+	protocol             string
+	tunnelType           types.TunnelType
+	port                 uint16
+	keymap               keymap
+	help                 help.Model
+	quitting             bool
+	showingCommands      bool
+	editingSlug          bool
+	showingComingSoon    bool
+	confirmingRegenerate bool
+	showingErrors        bool
+	editingAuth          bool
+	commandList          list.Model
+	slugInput            textinput.Model
+	slugError            string
+	authInput            textinput.Model
+	authError            string
+	regenerateError      string
+	interaction          *interaction
+	width                int
+	height               int
 }
 
 const (
@@ -63,7 +70,10 @@ const (
 
 func (m *model) getTunnelURL() string {
 	if m.tunnelType == types.TunnelTypeHTTP {
-		return buildURL(m.protocol, m.interaction.slug.String(), m.domain)
+		return BuildURL(m.protocol, m.interaction.slug.String(), m.domain)
+	}
+	if m.tunnelType == types.TunnelTypeUDP {
+		return fmt.Sprintf("udp://%s:%d", m.domain, m.port)
 	}
 	return fmt.Sprintf("tcp://%s:%d", m.domain, m.port)
 }
@@ -96,13 +106,13 @@ func shouldUseCompactLayout(width int, threshold int) bool {
 }
 
 func truncateString(s string, maxLength int) string {
-	if len(s) <= maxLength {
+	if runewidth.StringWidth(s) <= maxLength {
 		return s
 	}
 	if maxLength < 4 {
-		return s[:maxLength]
+		return runewidth.Truncate(s, maxLength, "")
 	}
-	return s[:maxLength-3] + "..."
+	return runewidth.Truncate(s, maxLength, "...")
 }
 
 func tickCmd(d time.Duration) tea.Cmd {
@@ -111,6 +121,7 @@ func tickCmd(d time.Duration) tea.Cmd {
 	})
 }
 
-func buildURL(protocol, subdomain, domain string) string {
+// BuildURL returns the public URL of an HTTP tunnel served under subdomain.
+func BuildURL(protocol, subdomain, domain string) string {
 	return fmt.Sprintf("%s://%s.%s", protocol, subdomain, domain)
 }
@@ -0,0 +1,108 @@
+package interaction
+
+import (
+	"strings"
+	"time"
+	"tunnel_pls/internal/config"
+	"tunnel_pls/internal/types"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func (m *model) regenerateUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y", "enter":
+		if err := m.regenerateSlug(); err != nil {
+			m.regenerateError = err.Error()
+			return m, nil
+		}
+		m.confirmingRegenerate = false
+		m.regenerateError = ""
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	case "n", "N", "esc", "ctrl+c":
+		m.confirmingRegenerate = false
+		m.regenerateError = ""
+		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
+	}
+	return m, nil
+}
+
+func (m *model) regenerateSlug() error {
+	if err := m.checkSecureTransport(); err != nil {
+		return err
+	}
+	if err := m.checkSlugCooldown(); err != nil {
+		return err
+	}
+	newSlug, err := m.randomizer.String(config.RandomSlugLength(m.interaction.config))
+	if err != nil {
+		return err
+	}
+	err = m.interaction.sessionRegistry.Update(m.interaction.user, types.SessionKey{
+		Id:   m.interaction.slug.String(),
+		Type: types.TunnelTypeHTTP,
+	}, types.SessionKey{
+		Id:   newSlug,
+		Type: types.TunnelTypeHTTP,
+	})
+	if err != nil {
+		return err
+	}
+	m.interaction.lastSlugChange = time.Now()
+	return nil
+}
+
+func (m *model) regenerateView() string {
+	isCompact := shouldUseCompactLayout(m.width, BreakpointMedium)
+	isVeryCompact := shouldUseCompactLayout(m.width, BreakpointTiny)
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(ColorPrimary)).
+		PaddingTop(1).
+		PaddingBottom(1)
+
+	warningBoxStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorWarning)).
+		Background(lipgloss.Color(ColorWarningBg)).
+		Bold(true).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(ColorWarning)).
+		Padding(1, getPaddingValue(isVeryCompact, isCompact)).
+		MarginTop(getMarginValue(isCompact, 1, 2)).
+		MarginBottom(getMarginValue(isCompact, 1, 2)).
+		Width(getResponsiveWidth(m.width, 10, 30, 60))
+
+	helpStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(ColorDarkGray)).
+		Italic(true).
+		MarginTop(1)
+
+	title := "🎲 Regenerate Subdomain"
+	warning := "⚠️  A new random subdomain will replace\n" + m.getTunnelURL() + "\n\nExisting links will stop working."
+	helpText := "Press Y or Enter to confirm • N or Esc to cancel"
+	if isVeryCompact {
+		title = "Regenerate Subdomain"
+		warning = "Existing links will stop working."
+		helpText = "Y confirm • N cancel"
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n\n")
+	b.WriteString(warningBoxStyle.Render(warning))
+	b.WriteString("\n")
+
+	if m.regenerateError != "" {
+		errorStyle := lipgloss.NewStyle().
+			Foreground(lipgloss.Color(ColorError)).
+			Bold(true)
+		b.WriteString(errorStyle.Render("❌ " + m.regenerateError))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(helpStyle.Render(helpText))
+	return b.String()
+}
@@ -1,8 +1,12 @@
 package interaction
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
+	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/types"
 
 	"github.com/charmbracelet/bubbles/key"
@@ -11,6 +15,12 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+const (
+	strongSlugMinLength  = 12
+	strongSlugMinEntropy = 3.0
+	slugLimitWarnWithin  = 5
+)
+
 func (m *model) slugUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
@@ -26,7 +36,19 @@ func (m *model) slugUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.slugError = ""
 		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
 	case "enter":
+		if err := m.checkSecureTransport(); err != nil {
+			m.slugError = err.Error()
+			return m, nil
+		}
+		if err := m.checkSlugCooldown(); err != nil {
+			m.slugError = err.Error()
+			return m, nil
+		}
 		inputValue := m.slugInput.Value()
+		if err := m.checkSlugStrength(inputValue); err != nil {
+			m.slugError = err.Error()
+			return m, nil
+		}
 		if err := m.interaction.sessionRegistry.Update(m.interaction.user, types.SessionKey{
 			Id:   m.interaction.slug.String(),
 			Type: types.TunnelTypeHTTP,
@@ -37,12 +59,13 @@ func (m *model) slugUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.slugError = err.Error()
 			return m, nil
 		}
+		m.interaction.lastSlugChange = time.Now()
 		m.editingSlug = false
 		m.slugError = ""
 		return m, tea.Batch(tea.ClearScreen, textinput.Blink)
 	default:
 		if key.Matches(msg, m.keymap.random) {
-			newSubdomain, err := m.randomizer.String(20)
+			newSubdomain, err := m.randomizer.String(config.RandomSlugLength(m.interaction.config))
 			if err != nil {
 				return m, cmd
 			}
@@ -54,6 +77,48 @@ func (m *model) slugUpdate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 }
 
+func (m *model) checkSecureTransport() error {
+	if !m.interaction.config.RequireTLSForAdmin() || m.protocol == "https" {
+		return nil
+	}
+	return errors.New("this action requires a TLS-enabled server")
+}
+
+func (m *model) checkSlugCooldown() error {
+	cooldown := m.interaction.config.SlugChangeCooldown()
+	if cooldown <= 0 || m.interaction.lastSlugChange.IsZero() {
+		return nil
+	}
+	remaining := cooldown - time.Since(m.interaction.lastSlugChange)
+	if remaining <= 0 {
+		return nil
+	}
+	return fmt.Errorf("please wait %s before changing the slug again", remaining.Truncate(time.Second)+time.Second)
+}
+
+func (m *model) checkSlugStrength(slug string) error {
+	if !m.interaction.config.RequireStrongSlugs() {
+		return nil
+	}
+	if len(slug) < strongSlugMinLength || slugEntropy(slug) < strongSlugMinEntropy {
+		return fmt.Errorf("slug is too easy to guess, use at least %d varied characters", strongSlugMinLength)
+	}
+	return nil
+}
+
+func slugEntropy(slug string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range slug {
+		counts[r]++
+	}
+	var entropy float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(slug))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
 func (m *model) slugView() string {
 	isCompact := shouldUseCompactLayout(m.width, BreakpointMedium)
 	isVeryCompact := shouldUseCompactLayout(m.width, BreakpointTiny)
@@ -69,6 +134,7 @@ func (m *model) slugView() string {
 	b.WriteString(m.renderSlugRules(isVeryCompact, isCompact))
 	b.WriteString(m.renderSlugInstruction(isVeryCompact))
 	b.WriteString(m.renderSlugInput(isVeryCompact, isCompact))
+	b.WriteString(m.renderSlugLimit())
 	b.WriteString(m.renderSlugPreview(isVeryCompact))
 	b.WriteString(m.renderSlugHelp(isVeryCompact))
 
@@ -154,15 +220,16 @@ func (m *model) renderSlugRules(isVeryCompact, isCompact bool) string {
 }
 
 func (m *model) getRulesContent(isVeryCompact, isCompact bool) string {
+	length := fmt.Sprintf("3-%d chars", m.slugInput.CharLimit)
 	if isVeryCompact {
-		return "Rules:\n3-20 chars\na-z, 0-9, -\nNo leading/trailing -"
+		return "Rules:\n" + length + "\na-z, 0-9, -\nNo leading/trailing -"
 	}
 
 	if isCompact {
-		return "📋 Rules:\n  • 3-20 chars\n  • a-z, 0-9, -\n  • No leading/trailing -"
+		return "📋 Rules:\n  • " + length + "\n  • a-z, 0-9, -\n  • No leading/trailing -"
 	}
 
-	return "📋 Rules: \n\t• 3-20 chars \n\t• a-z, 0-9, - \n\t• No leading/trailing -"
+	return "📋 Rules: \n\t• " + length + " \n\t• a-z, 0-9, - \n\t• No leading/trailing -"
 }
 
 func (m *model) renderSlugInstruction(isVeryCompact bool) string {
@@ -227,8 +294,28 @@ func (m *model) renderNormalInput(boxPadding, boxMargin int) string {
 	return inputBoxStyle.Render(m.slugInput.View()) + "\n"
 }
 
+// renderSlugLimit shows a character count once the input gets close to its
+// limit, so users notice before further keystrokes are dropped.
+func (m *model) renderSlugLimit() string {
+	limit := m.slugInput.CharLimit
+	length := len([]rune(m.slugInput.Value()))
+	if limit <= 0 || length < limit-slugLimitWarnWithin {
+		return ""
+	}
+
+	color := ColorDarkGray
+	if length >= limit {
+		color = ColorWarning
+	}
+	counterStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(color)).
+		Italic(true)
+
+	return counterStyle.Render(fmt.Sprintf("%d/%d", length, limit)) + "\n"
+}
+
 func (m *model) renderSlugPreview(isVeryCompact bool) string {
-	previewURL := buildURL(m.protocol, m.slugInput.Value(), m.domain)
+	previewURL := BuildURL(m.protocol, m.slugInput.Value(), m.domain)
 	previewWidth := getResponsiveWidth(m.width, 10, 30, 80)
 
 	if isVeryCompact {
@@ -253,6 +340,12 @@ func (m *model) renderSlugHelp(isVeryCompact bool) string {
 	if isVeryCompact {
 		helpText = "Enter: save • CTRL+R: random • Esc: cancel"
 	}
+	if !m.keymap.random.Enabled() {
+		helpText = "Press Enter to save • Esc to cancel"
+		if isVeryCompact {
+			helpText = "Enter: save • Esc: cancel"
+		}
+	}
 
 	return helpStyle.Render(helpText)
 }
@@ -65,6 +65,7 @@ type Lifecycle interface {
 	SetChannel(channel ssh.Channel) error
 	SetStatus(status types.SessionStatus)
 	IsActive() bool
+	IsClosed() bool
 	StartedAt() time.Time
 	Close() error
 }
@@ -121,6 +122,12 @@ func (l *lifecycle) IsActive() bool {
 	return l.status == types.SessionStatusRUNNING
 }
 
+func (l *lifecycle) IsClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status == types.SessionStatusCLOSED
+}
+
 func (l *lifecycle) Close() error {
 	l.mu.Lock()
 	if l.status == types.SessionStatusCLOSED {
@@ -135,6 +142,13 @@ func (l *lifecycle) Close() error {
 	l.mu.Unlock()
 
 	var errs []error
+	if err := l.closeListener(); err != nil {
+		errs = append(errs, err)
+	}
+	l.cleanupRegistry()
+	if err := l.releasePort(); err != nil {
+		errs = append(errs, err)
+	}
 	if channel != nil {
 		if err := channel.Close(); err != nil && !isClosedError(err) {
 			errs = append(errs, err)
@@ -146,11 +160,6 @@ func (l *lifecycle) Close() error {
 		}
 	}
 
-	l.cleanupRegistry()
-	if err := l.cleanupForwarder(); err != nil {
-		errs = append(errs, err)
-	}
-
 	closeErr := errors.Join(errs...)
 
 	l.mu.Lock()
@@ -172,14 +181,25 @@ func (l *lifecycle) cleanupRegistry() {
 	l.sessionRegistry.Remove(key)
 }
 
-func (l *lifecycle) cleanupForwarder() error {
-	if l.forwarder.TunnelType() != types.TunnelTypeTCP {
+// bindsPort reports whether the tunnel owns a port from the port registry,
+// which TCP and UDP tunnels do and HTTP tunnels do not.
+func (l *lifecycle) bindsPort() bool {
+	tunnelType := l.forwarder.TunnelType()
+	return tunnelType == types.TunnelTypeTCP || tunnelType == types.TunnelTypeUDP
+}
+
+func (l *lifecycle) closeListener() error {
+	if !l.bindsPort() {
 		return nil
 	}
-	var errs []error
-	errs = append(errs, l.portRegistry.SetStatus(l.forwarder.ForwardedPort(), false))
-	errs = append(errs, l.forwarder.Close())
-	return errors.Join(errs...)
+	return l.forwarder.Close()
+}
+
+func (l *lifecycle) releasePort() error {
+	if !l.bindsPort() {
+		return nil
+	}
+	return l.portRegistry.SetStatus(l.forwarder.ForwardedPort(), false)
 }
 
 func isClosedError(err error) bool {
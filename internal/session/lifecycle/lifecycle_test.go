@@ -35,6 +35,15 @@ func (m *MockForwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 	m.Called(dst, src)
 }
 
+func (m *MockForwarder) ForwardDatagram(dst ssh.Channel, p []byte) error {
+	args := m.Called(dst, p)
+	return args.Error(0)
+}
+
+func (m *MockForwarder) HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel) {
+	m.Called(dst, peer, src)
+}
+
 func (m *MockForwarder) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -58,6 +67,98 @@ func (m *MockForwarder) SetForwardedPort(port uint16) {
 	m.Called(port)
 }
 
+func (m *MockForwarder) SetAllowedMethods(methods []string) {
+	m.Called(methods)
+}
+
+func (m *MockForwarder) AllowedMethods() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetAllowedOrigins(origins []string) {
+	m.Called(origins)
+}
+
+func (m *MockForwarder) AllowedOrigins() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetHostHeader(host string) {
+	m.Called(host)
+}
+
+func (m *MockForwarder) HostHeader() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetRewriteLocation(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) RewriteLocation() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) SetDefaultContentType(contentType string) {
+	m.Called(contentType)
+}
+
+func (m *MockForwarder) DefaultContentType() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetMirrorBodyLimit(limit int) {
+	m.Called(limit)
+}
+
+func (m *MockForwarder) MirrorBodyLimit() int {
+	return m.Called().Int(0)
+}
+
+func (m *MockForwarder) SetBasicAuth(username, password string) error {
+	return m.Called(username, password).Error(0)
+}
+
+func (m *MockForwarder) BasicAuthEnabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) CheckBasicAuth(username, password string) bool {
+	return m.Called(username, password).Bool(0)
+}
+
+func (m *MockForwarder) SetEnabled(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) Enabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) RecentErrors() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) BytesIn() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
+func (m *MockForwarder) BytesOut() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
 func (m *MockForwarder) SetListener(listener net.Listener) {
 	m.Called(listener)
 }
@@ -67,6 +168,10 @@ func (m *MockForwarder) Listener() net.Listener {
 	return args.Get(0).(net.Listener)
 }
 
+func (m *MockForwarder) SetPacketConn(conn net.PacketConn) {
+	m.Called(conn)
+}
+
 func (m *MockForwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error) {
 	args := m.Called(ctx, origin)
 	if args.Get(0) == nil {
@@ -198,8 +303,10 @@ func TestLifecycle_SetStatus(t *testing.T) {
 
 	mockLifecycle := New(mockSSHConn, mockForwarder, mockSlug, mockPort, mockSessionRegistry, "mas-fuad")
 
+	assert.False(t, mockLifecycle.IsClosed())
 	mockLifecycle.SetStatus(types.SessionStatusRUNNING)
 	assert.True(t, mockLifecycle.IsActive())
+	assert.False(t, mockLifecycle.IsClosed())
 }
 
 func TestLifecycle_IsActive(t *testing.T) {
@@ -234,6 +341,11 @@ func TestLifecycle_Close(t *testing.T) {
 			tunnelType: types.TunnelTypeTCP,
 			expectErr:  false,
 		},
+		{
+			name:       "Close UDP forwarding success",
+			tunnelType: types.TunnelTypeUDP,
+			expectErr:  false,
+		},
 		{
 			name:         "Close with conn close error",
 			tunnelType:   types.TunnelTypeHTTP,
@@ -261,7 +373,7 @@ func TestLifecycle_Close(t *testing.T) {
 
 			mockForwarder := &MockForwarder{}
 			mockForwarder.On("TunnelType").Return(tt.tunnelType)
-			if tt.tunnelType == types.TunnelTypeTCP {
+			if tt.tunnelType == types.TunnelTypeTCP || tt.tunnelType == types.TunnelTypeUDP {
 				mockForwarder.On("ForwardedPort").Return(uint16(8080))
 				mockForwarder.On("Close").Return(nil)
 			}
@@ -270,7 +382,7 @@ func TestLifecycle_Close(t *testing.T) {
 			mockSlug.On("String").Return("test-slug")
 
 			mockPort := &MockPort{}
-			if tt.tunnelType == types.TunnelTypeTCP {
+			if tt.tunnelType == types.TunnelTypeTCP || tt.tunnelType == types.TunnelTypeUDP {
 				mockPort.On("SetStatus", uint16(8080), false).Return(nil)
 			}
 
@@ -310,6 +422,40 @@ func TestLifecycle_Close(t *testing.T) {
 	}
 }
 
+func TestLifecycle_CloseOrder(t *testing.T) {
+	var order []string
+	record := func(step string) func(mock.Arguments) {
+		return func(mock.Arguments) { order = append(order, step) }
+	}
+
+	mockSSHConn := &MockSSHConn{}
+	mockSSHConn.On("Close").Run(record("conn")).Return(nil)
+
+	mockForwarder := &MockForwarder{}
+	mockForwarder.On("TunnelType").Return(types.TunnelTypeTCP)
+	mockForwarder.On("ForwardedPort").Return(uint16(8080))
+	mockForwarder.On("Close").Run(record("listener")).Return(nil)
+
+	mockSlug := &MockSlug{}
+	mockSlug.On("String").Return("8080")
+
+	mockPort := &MockPort{}
+	mockPort.On("SetStatus", uint16(8080), false).Run(record("port")).Return(nil)
+
+	mockSessionRegistry := &MockSessionRegistry{}
+	mockSessionRegistry.On("Remove", types.SessionKey{Id: "8080", Type: types.TunnelTypeTCP}).Run(record("registry")).Return()
+
+	mockSSHChannel := &MockSSHChannel{}
+	mockSSHChannel.On("Close").Run(record("channel")).Return(nil)
+
+	lc := New(mockSSHConn, mockForwarder, mockSlug, mockPort, mockSessionRegistry, "mas-fuad")
+	lc.SetStatus(types.SessionStatusRUNNING)
+	assert.NoError(t, lc.SetChannel(mockSSHChannel))
+
+	assert.NoError(t, lc.Close())
+	assert.Equal(t, []string{"listener", "registry", "port", "channel", "conn"}, order)
+}
+
 func TestLifecycle_ConcurrentClose(t *testing.T) {
 	mockSSHConn := &MockSSHConn{}
 	mockSSHConn.On("Close").Return(nil)
@@ -421,4 +567,5 @@ func TestLifecycle_SetStatus_AfterClose(t *testing.T) {
 
 	mockLifecycle.SetStatus(types.SessionStatusRUNNING)
 	assert.False(t, mockLifecycle.IsActive(), "SetStatus should be ignored after Close")
+	assert.True(t, mockLifecycle.IsClosed())
 }
@@ -6,7 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"tunnel_pls/internal/config"
 	portUtil "tunnel_pls/internal/port"
@@ -18,6 +25,7 @@ import (
 	"tunnel_pls/internal/session/slug"
 	"tunnel_pls/internal/transport"
 	"tunnel_pls/internal/types"
+	"unicode"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -27,6 +35,7 @@ type Session interface {
 	HandleTCPIPForward(req *ssh.Request) error
 	HandleHTTPForward(req *ssh.Request, port uint16) error
 	HandleTCPForward(req *ssh.Request, addr string, port uint16, reserved bool) error
+	HandleUDPForward(req *ssh.Request, port uint16, reserved bool) error
 	Lifecycle() lifecycle.Lifecycle
 	Interaction() interaction.Interaction
 	Forwarder() forwarder.Forwarder
@@ -45,6 +54,11 @@ type session struct {
 	forwarder   forwarder.Forwarder
 	slug        slug.Slug
 	registry    registry.Registry
+	ptyReq      chan struct{}
+	ptyOnce     sync.Once
+
+	descriptionMu sync.RWMutex
+	description   string
 }
 
 type Config struct {
@@ -58,13 +72,32 @@ type Config struct {
 	User            string
 }
 
+var ptyWaitTimeout = 500 * time.Millisecond
+
+const noPTYMessage = "Interactive mode requires a PTY, continuing in headless mode. Reconnect with ssh -t to use the dashboard.\r\n"
+
+const interactiveLimitMessage = "This server has reached its limit of interactive dashboards, continuing in headless mode.\r\n"
+
+var activeInteractiveSessions atomic.Int64
+
+// maxDescriptionLength bounds the free-text note users attach to a tunnel
+// so it stays readable in session listings.
+const maxDescriptionLength = 80
+
+// udpForwardRequest is the global request a client sends instead of
+// tcpip-forward to expose a UDP service. Its payload is identical; datagrams
+// then arrive on forwarded-udpip channels, each framed with a 2-byte
+// big-endian length.
+const udpForwardRequest = "udpip-forward"
+
 var blockedReservedPorts = []uint16{1080, 1433, 1521, 1900, 2049, 3306, 3389, 5432, 5900, 6379, 8080, 8443, 9000, 9200, 27017}
 
 func New(conf *Config) Session {
 	slugManager := slug.New()
 	forwarderManager := forwarder.New(conf.Config, slugManager, conf.Conn)
 	lifecycleManager := lifecycle.New(conf.Conn, forwarderManager, slugManager, conf.PortRegistry, conf.SessionRegistry, conf.User)
-	interactionManager := interaction.New(conf.Randomizer, conf.Config, slugManager, forwarderManager, conf.SessionRegistry, conf.User, lifecycleManager.Close)
+	slugRegistry := newCollisionRegistry(conf.SessionRegistry, conf.Config, conf.Randomizer)
+	interactionManager := interaction.New(conf.Randomizer, conf.Config, slugManager, forwarderManager, slugRegistry, conf.User, lifecycleManager.Close)
 
 	return &session{
 		randomizer:  conf.Randomizer,
@@ -76,6 +109,7 @@ func New(conf *Config) Session {
 		forwarder:   forwarderManager,
 		slug:        slugManager,
 		registry:    conf.SessionRegistry,
+		ptyReq:      make(chan struct{}),
 	}
 }
 
@@ -99,25 +133,38 @@ func (s *session) Detail() *types.Detail {
 	tunnelTypeMap := map[types.TunnelType]string{
 		types.TunnelTypeHTTP: "HTTP",
 		types.TunnelTypeTCP:  "TCP",
+		types.TunnelTypeUDP:  "UDP",
 	}
 	tunnelType, ok := tunnelTypeMap[s.forwarder.TunnelType()]
 	if !ok {
 		tunnelType = "UNKNOWN"
 	}
 
+	s.descriptionMu.RLock()
+	description := s.description
+	s.descriptionMu.RUnlock()
+
 	return &types.Detail{
 		ForwardingType: tunnelType,
 		Slug:           s.slug.String(),
 		UserID:         s.lifecycle.User(),
 		Active:         s.lifecycle.IsActive(),
 		StartedAt:      s.lifecycle.StartedAt(),
+		Description:    description,
 	}
 }
 
+func (s *session) setDescription(description string) {
+	s.descriptionMu.Lock()
+	defer s.descriptionMu.Unlock()
+	s.description = description
+}
+
 func (s *session) Start() error {
 	if err := s.setupSessionMode(); err != nil {
 		return err
 	}
+	go s.serveChannels()
 
 	tcpipReq := s.waitForTCPIPForward()
 	if tcpipReq == nil {
@@ -131,6 +178,12 @@ func (s *session) Start() error {
 	if err := s.HandleTCPIPForward(tcpipReq); err != nil {
 		return err
 	}
+	go s.handleForwardRequests(tcpipReq)
+	s.fallbackToHeadlessWithoutPTY()
+	if s.acquireInteractiveSlot() {
+		defer activeInteractiveSessions.Add(-1)
+	}
+	s.sendURLBanner()
 	s.interaction.Start()
 
 	return s.waitForSessionEnd()
@@ -143,6 +196,11 @@ func (s *session) setupSessionMode() error {
 			log.Println("Forwarding request channel closed")
 			return nil
 		}
+		if channel.ChannelType() == "direct-tcpip" {
+			go s.handleDirectTCPIP(channel)
+			s.interaction.SetMode(types.InteractiveModeHEADLESS)
+			return nil
+		}
 		return s.setupInteractiveMode(channel)
 	case <-time.After(500 * time.Millisecond):
 		s.interaction.SetMode(types.InteractiveModeHEADLESS)
@@ -173,6 +231,55 @@ func (s *session) setupInteractiveMode(channel ssh.NewChannel) error {
 	return nil
 }
 
+func (s *session) fallbackToHeadlessWithoutPTY() {
+	if s.interaction.Mode() != types.InteractiveModeINTERACTIVE {
+		return
+	}
+
+	select {
+	case <-s.ptyReq:
+		return
+	case <-time.After(ptyWaitTimeout):
+	}
+
+	log.Println("No pty-req received, falling back to headless mode")
+	s.interaction.SetMode(types.InteractiveModeHEADLESS)
+	if err := s.interaction.Send(noPTYMessage); err != nil {
+		log.Printf("failed to send headless notice: %v", err)
+	}
+}
+
+func (s *session) acquireInteractiveSlot() bool {
+	if s.interaction.Mode() != types.InteractiveModeINTERACTIVE {
+		return false
+	}
+
+	limit := s.config.MaxInteractiveSessions()
+	if n := activeInteractiveSessions.Add(1); limit <= 0 || n <= int64(limit) {
+		return true
+	}
+	activeInteractiveSessions.Add(-1)
+
+	log.Println("Interactive session limit reached, falling back to headless mode")
+	s.interaction.SetMode(types.InteractiveModeHEADLESS)
+	if err := s.interaction.Send(interactiveLimitMessage); err != nil {
+		log.Printf("failed to send headless notice: %v", err)
+	}
+	return false
+}
+
+// sendURLBanner tells headless clients where their tunnel lives, since they
+// never see the dashboard. Clients started with ssh -N open no session
+// channel and have nothing to write to, so they still rely on the log.
+func (s *session) sendURLBanner() {
+	if s.interaction.Mode() != types.InteractiveModeHEADLESS || !s.config.TunnelURLBanner() {
+		return
+	}
+	if err := s.interaction.Send(fmt.Sprintf("Forwarding %s\r\n", s.tunnelURL())); err != nil {
+		log.Printf("failed to send tunnel URL banner: %v", err)
+	}
+}
+
 func (s *session) handleMissingForwardRequest() error {
 	err := s.interaction.Send(fmt.Sprintf("Port forwarding request not received. Ensure you ran the correct command with -R flag. Example: ssh %s -p %s -R 80:localhost:3000", s.config.Domain(), s.config.SSHPort()))
 	if err != nil {
@@ -207,7 +314,7 @@ func (s *session) waitForTCPIPForward() *ssh.Request {
 				log.Println("Forwarding request channel closed")
 				return nil
 			}
-			if req.Type == "tcpip-forward" {
+			if req.Type == "tcpip-forward" || req.Type == udpForwardRequest {
 				return req
 			}
 			log.Printf("Ignoring unexpected global request: %s", req.Type)
@@ -219,6 +326,37 @@ func (s *session) waitForTCPIPForward() *ssh.Request {
 	}
 }
 
+func (s *session) handleForwardRequests(active *ssh.Request) {
+	activeBind, _ := forwardBind(active.Payload)
+	for req := range s.initialReq {
+		switch req.Type {
+		case "tcpip-forward", udpForwardRequest:
+			bind, err := forwardBind(req.Payload)
+			if err == nil && bind == activeBind {
+				log.Printf("Rejecting duplicate %s for %s: already forwarded by this session", req.Type, bind)
+			} else {
+				log.Printf("Rejecting additional %s for %s: only one forward per session is supported", req.Type, bind)
+			}
+		default:
+			log.Printf("Ignoring unexpected global request: %s", req.Type)
+		}
+		if err := req.Reply(false, nil); err != nil {
+			log.Printf("Failed to reply to %s request: %v", req.Type, err)
+		}
+	}
+}
+
+func forwardBind(payload []byte) (string, error) {
+	var forwardPayload struct {
+		BindAddr string
+		BindPort uint32
+	}
+	if err := ssh.Unmarshal(payload, &forwardPayload); err != nil {
+		return "", fmt.Errorf("failed to unmarshal forward payload: %w", err)
+	}
+	return net.JoinHostPort(forwardPayload.BindAddr, strconv.FormatUint(uint64(forwardPayload.BindPort), 10)), nil
+}
+
 func (s *session) handleWindowChange(req *ssh.Request) error {
 	p := req.Payload
 	if len(p) < 16 {
@@ -233,10 +371,218 @@ func (s *session) handleWindowChange(req *ssh.Request) error {
 	return req.Reply(true, nil)
 }
 
+func (s *session) handleEnv(req *ssh.Request) error {
+	var env struct {
+		Name  string
+		Value string
+	}
+	if err := ssh.Unmarshal(req.Payload, &env); err != nil {
+		log.Println("invalid env payload")
+		return req.Reply(false, nil)
+	}
+
+	switch env.Name {
+	case "TUNNEL_ALLOWED_METHODS":
+		methods, err := parseAllowedMethods(env.Value)
+		if err != nil {
+			log.Printf("invalid allowed methods %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetAllowedMethods(methods)
+	case "TUNNEL_WS_ALLOWED_ORIGINS":
+		origins, err := parseAllowedOrigins(env.Value)
+		if err != nil {
+			log.Printf("invalid allowed origins %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetAllowedOrigins(origins)
+	case "TUNNEL_HOST_HEADER":
+		host, err := parseHostHeader(env.Value)
+		if err != nil {
+			log.Printf("invalid host header %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetHostHeader(host)
+	case "TUNNEL_REWRITE_LOCATION":
+		enabled, err := strconv.ParseBool(strings.TrimSpace(env.Value))
+		if err != nil {
+			log.Printf("invalid rewrite location flag %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetRewriteLocation(enabled)
+	case "TUNNEL_DEFAULT_CONTENT_TYPE":
+		contentType, err := parseContentType(env.Value)
+		if err != nil {
+			log.Printf("invalid default content type %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetDefaultContentType(contentType)
+	case "TUNNEL_MIRROR":
+		limit, err := parseMirrorBodyLimit(env.Value)
+		if err != nil {
+			log.Printf("invalid mirror body limit %q: %v", env.Value, err)
+			return req.Reply(false, nil)
+		}
+		s.forwarder.SetMirrorBodyLimit(limit)
+	case "TUNNEL_DESCRIPTION":
+		description, err := parseDescription(env.Value)
+		if err != nil {
+			log.Printf("invalid tunnel description: %v", err)
+			return req.Reply(false, nil)
+		}
+		s.setDescription(description)
+	case "TUNNEL_BASIC_AUTH":
+		username, password, err := forwarder.ParseBasicAuth(env.Value)
+		if err != nil {
+			log.Printf("invalid basic auth credentials: %v", err)
+			return req.Reply(false, nil)
+		}
+		if err = s.forwarder.SetBasicAuth(username, password); err != nil {
+			log.Printf("failed to set basic auth credentials: %v", err)
+			return req.Reply(false, nil)
+		}
+	default:
+		return req.Reply(false, nil)
+	}
+
+	return req.Reply(true, nil)
+}
+
+// terminationSignals are the signal names, as sent without the "SIG" prefix,
+// that end the session when a client delivers them on the session channel.
+var terminationSignals = []string{"INT", "TERM", "HUP", "QUIT", "KILL"}
+
+func (s *session) handleSignal(req *ssh.Request) error {
+	var signal struct {
+		Name string
+	}
+	if err := ssh.Unmarshal(req.Payload, &signal); err != nil {
+		log.Println("invalid signal payload")
+		return req.Reply(false, nil)
+	}
+
+	if !slices.Contains(terminationSignals, signal.Name) {
+		log.Printf("Ignoring unsupported signal: %s", signal.Name)
+		return req.Reply(false, nil)
+	}
+
+	log.Printf("Received SIG%s, closing session", signal.Name)
+	if err := req.Reply(true, nil); err != nil {
+		return err
+	}
+	if err := s.lifecycle.Close(); err != nil {
+		log.Printf("failed to close session on signal: %v", err)
+	}
+	return nil
+}
+
+func parseAllowedMethods(value string) ([]string, error) {
+	var methods []string
+	for _, m := range strings.Split(value, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+		for _, c := range m {
+			if c < 'A' || c > 'Z' {
+				return nil, fmt.Errorf("invalid method: %s", m)
+			}
+		}
+		if !slices.Contains(methods, m) {
+			methods = append(methods, m)
+		}
+	}
+	return methods, nil
+}
+
+// parseAllowedOrigins reads a comma-separated list of scheme://host[:port]
+// origins, lowercased so they compare the way browsers serialise them.
+func parseAllowedOrigins(value string) ([]string, error) {
+	var origins []string
+	for _, o := range strings.Split(value, ",") {
+		o = strings.ToLower(strings.TrimSpace(o))
+		if o == "" {
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid origin: %s", o)
+		}
+		o = u.Scheme + "://" + u.Host
+		if !slices.Contains(origins, o) {
+			origins = append(origins, o)
+		}
+	}
+	return origins, nil
+}
+
+func parseHostHeader(value string) (string, error) {
+	host := strings.TrimSpace(value)
+	if host == "" {
+		return "", nil
+	}
+	for _, c := range host {
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("/?#@\\", c) {
+			return "", fmt.Errorf("invalid character %q", c)
+		}
+	}
+	return host, nil
+}
+
+func parseContentType(value string) (string, error) {
+	contentType := strings.TrimSpace(value)
+	if contentType == "" {
+		return "", nil
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+func parseDescription(value string) (string, error) {
+	description := strings.TrimSpace(value)
+	if n := len([]rune(description)); n > maxDescriptionLength {
+		return "", fmt.Errorf("description is %d characters, the limit is %d", n, maxDescriptionLength)
+	}
+	if strings.ContainsFunc(description, unicode.IsControl) {
+		return "", errors.New("description must not contain control characters")
+	}
+	return description, nil
+}
+
+// parseMirrorBodyLimit reads how many body bytes to mirror per request.
+// Zero disables mirroring; headers are always included when it is on.
+func parseMirrorBodyLimit(value string) (int, error) {
+	limit, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if limit < 0 || limit > forwarder.MaxMirrorBodyLimit {
+		return 0, fmt.Errorf("must be between 0 and %d", forwarder.MaxMirrorBodyLimit)
+	}
+	return limit, nil
+}
+
 func (s *session) HandleGlobalRequest(GlobalRequest <-chan *ssh.Request) error {
 	for req := range GlobalRequest {
+		if s.lifecycle.IsClosed() {
+			log.Printf("Rejecting %s request on closing session", req.Type)
+			if err := req.Reply(false, nil); err != nil {
+				return err
+			}
+			continue
+		}
 		switch req.Type {
-		case "shell", "pty-req":
+		case "shell":
+			if err := req.Reply(true, nil); err != nil {
+				return err
+			}
+		case "pty-req":
+			s.ptyOnce.Do(func() {
+				close(s.ptyReq)
+			})
 			if err := req.Reply(true, nil); err != nil {
 				return err
 			}
@@ -244,6 +590,14 @@ func (s *session) HandleGlobalRequest(GlobalRequest <-chan *ssh.Request) error {
 			if err := s.handleWindowChange(req); err != nil {
 				return err
 			}
+		case "env":
+			if err := s.handleEnv(req); err != nil {
+				return err
+			}
+		case "signal":
+			if err := s.handleSignal(req); err != nil {
+				return err
+			}
 		default:
 			log.Println("Unknown request type:", req.Type)
 			if err := req.Reply(false, nil); err != nil {
@@ -254,7 +608,7 @@ func (s *session) HandleGlobalRequest(GlobalRequest <-chan *ssh.Request) error {
 	return nil
 }
 
-func (s *session) parseForwardPayload(payload []byte) (address string, port uint16, reserved bool, err error) {
+func (s *session) parseForwardPayload(requestType string, payload []byte) (address string, port uint16, reserved bool, err error) {
 	var forwardPayload struct {
 		BindAddr string
 		BindPort uint32
@@ -274,6 +628,18 @@ func (s *session) parseForwardPayload(payload []byte) (address string, port uint
 		return "", 0, false, fmt.Errorf("port is blocked")
 	}
 
+	if requestType != udpForwardRequest && s.tunnelTypeForPort(port) == types.TunnelTypeHTTP {
+		return forwardPayload.BindAddr, port, false, nil
+	}
+
+	if requestType == udpForwardRequest {
+		if !s.config.UDPEnabled() {
+			return "", 0, false, fmt.Errorf("udp forwarding is disabled")
+		}
+	} else if !s.config.TCPEnabled() {
+		return "", 0, false, fmt.Errorf("tcp forwarding is disabled")
+	}
+
 	if port == 0 {
 		unassigned, ok := s.lifecycle.PortRegistry().Unassigned()
 		if !ok {
@@ -285,6 +651,19 @@ func (s *session) parseForwardPayload(payload []byte) (address string, port uint
 	return forwardPayload.BindAddr, port, false, nil
 }
 
+// tunnelTypeForPort picks the tunnel type for a requested port. Port 0 asks
+// the server to allocate a port, which only a TCP tunnel can do, so it is
+// TCP whatever DEFAULT_TUNNEL_TYPE says.
+func (s *session) tunnelTypeForPort(port uint16) types.TunnelType {
+	if port == 0 {
+		return types.TunnelTypeTCP
+	}
+	if slices.Contains(s.config.HTTPForwardPorts(), port) {
+		return types.TunnelTypeHTTP
+	}
+	return s.config.DefaultTunnelType()
+}
+
 func (s *session) denyForwardingRequest(req *ssh.Request, key *types.SessionKey, listener io.Closer, msg string) error {
 	var errs []error
 	if key != nil {
@@ -322,30 +701,43 @@ func (s *session) finalizeForwarding(req *ssh.Request, portToBind uint16, listen
 		s.forwarder.SetListener(listener)
 	}
 
+	if !s.lifecycle.IsActive() {
+		return fmt.Errorf("session closed while forwarding was being set up")
+	}
+
+	s.emitTunnelCreated()
 	return nil
 }
 
 func (s *session) HandleTCPIPForward(req *ssh.Request) error {
-	address, port, reserved, err := s.parseForwardPayload(req.Payload)
+	if s.lifecycle.IsClosed() {
+		if err := req.Reply(false, nil); err != nil {
+			return err
+		}
+		return fmt.Errorf("rejected %s request: session is closing", req.Type)
+	}
+
+	address, port, reserved, err := s.parseForwardPayload(req.Type, req.Payload)
 	if err != nil {
 		return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("cannot parse forwarded payload: %s", err.Error()))
 	}
 
-	switch port {
-	case 80, 443:
-		return s.HandleHTTPForward(req, port)
-	default:
+	if req.Type == udpForwardRequest {
+		return s.HandleUDPForward(req, port, reserved)
+	}
+	if reserved || s.tunnelTypeForPort(port) == types.TunnelTypeTCP {
 		return s.HandleTCPForward(req, address, port, reserved)
 	}
+	return s.HandleHTTPForward(req, port)
 }
 
 func (s *session) HandleHTTPForward(req *ssh.Request, portToBind uint16) error {
-	randomString, err := s.randomizer.String(20)
+	randomString, err := s.randomizer.String(config.RandomSlugLength(s.config))
 	if err != nil {
 		return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("Failed to create slug: %s", err))
 	}
-	key := types.SessionKey{Id: randomString, Type: types.TunnelTypeHTTP}
-	if !s.registry.Register(key, s) {
+	key, registered := newCollisionRegistry(s.registry, s.config, s.randomizer).register(types.SessionKey{Id: randomString, Type: types.TunnelTypeHTTP}, s)
+	if !registered {
 		return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("Failed to register client with slug: %s", randomString))
 	}
 
@@ -356,35 +748,48 @@ func (s *session) HandleHTTPForward(req *ssh.Request, portToBind uint16) error {
 	return nil
 }
 
-func (s *session) HandleTCPForward(req *ssh.Request, addr string, portToBind uint16, reserved bool) error {
+func (s *session) tcpKeepAlive() net.KeepAliveConfig {
+	interval := s.config.TCPKeepAliveInterval()
+	if interval <= 0 {
+		return net.KeepAliveConfig{}
+	}
+	return net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     interval,
+		Interval: interval,
+		Count:    s.config.TCPKeepAliveCount(),
+	}
+}
+
+func (s *session) HandleTCPForward(req *ssh.Request, addr string, portToBind uint16, reserved bool) (err error) {
 	if !reserved {
 		if claimed := s.lifecycle.PortRegistry().Claim(portToBind); !claimed {
 			return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("Port %d is already in use or restricted", portToBind))
 		}
 	}
 
-	releasePort := func() {
-		if err := s.lifecycle.PortRegistry().SetStatus(portToBind, false); err != nil {
-			log.Printf("failed to release port %d: %v", portToBind, err)
+	defer func() {
+		if err == nil {
+			return
 		}
-	}
+		if releaseErr := s.lifecycle.PortRegistry().SetStatus(portToBind, false); releaseErr != nil {
+			log.Printf("failed to release port %d: %v", portToBind, releaseErr)
+		}
+	}()
 
-	tcpServer := transport.NewTCPServer(portToBind, s.forwarder)
+	tcpServer := transport.NewTCPServer(portToBind, s.forwarder, s.config.TCPInitialReadTimeout(), s.config.MaxConcurrentAccepts(), s.tcpKeepAlive())
 	listener, err := tcpServer.Listen()
 	if err != nil {
-		releasePort()
 		return s.denyForwardingRequest(req, nil, listener, fmt.Sprintf("Port %d is already in use or restricted", portToBind))
 	}
 
 	key := types.SessionKey{Id: fmt.Sprintf("%d", portToBind), Type: types.TunnelTypeTCP}
 	if !s.registry.Register(key, s) {
-		releasePort()
 		return s.denyForwardingRequest(req, nil, listener, fmt.Sprintf("Failed to register TunnelTypeTCP client with id: %s", key.Id))
 	}
 
 	err = s.finalizeForwarding(req, portToBind, listener, types.TunnelTypeTCP, key.Id)
 	if err != nil {
-		releasePort()
 		return s.denyForwardingRequest(req, &key, listener, fmt.Sprintf("Failed to finalize forwarding: %s", err))
 	}
 
@@ -397,6 +802,48 @@ func (s *session) HandleTCPForward(req *ssh.Request, addr string, portToBind uin
 	return nil
 }
 
+func (s *session) HandleUDPForward(req *ssh.Request, portToBind uint16, reserved bool) (err error) {
+	if !reserved {
+		if claimed := s.lifecycle.PortRegistry().Claim(portToBind); !claimed {
+			return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("Port %d is already in use or restricted", portToBind))
+		}
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if releaseErr := s.lifecycle.PortRegistry().SetStatus(portToBind, false); releaseErr != nil {
+			log.Printf("failed to release port %d: %v", portToBind, releaseErr)
+		}
+	}()
+
+	udpServer := transport.NewUDPServer(portToBind, s.forwarder)
+	packetConn, err := udpServer.Listen()
+	if err != nil {
+		return s.denyForwardingRequest(req, nil, nil, fmt.Sprintf("Port %d is already in use or restricted", portToBind))
+	}
+
+	key := types.SessionKey{Id: fmt.Sprintf("%d", portToBind), Type: types.TunnelTypeUDP}
+	if !s.registry.Register(key, s) {
+		return s.denyForwardingRequest(req, nil, packetConn, fmt.Sprintf("Failed to register TunnelTypeUDP client with id: %s", key.Id))
+	}
+
+	s.forwarder.SetPacketConn(packetConn)
+	err = s.finalizeForwarding(req, portToBind, nil, types.TunnelTypeUDP, key.Id)
+	if err != nil {
+		return s.denyForwardingRequest(req, &key, packetConn, fmt.Sprintf("Failed to finalize forwarding: %s", err))
+	}
+
+	go func() {
+		if err := udpServer.Serve(packetConn); err != nil {
+			log.Printf("Failed serving udp server: %s\n", err)
+		}
+	}()
+
+	return nil
+}
+
 func isBlockedPort(port uint16) bool {
 	if port == 80 || port == 443 {
 		return false
@@ -5,15 +5,20 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/binary"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 	"tunnel_pls/internal/config"
+	portUtil "tunnel_pls/internal/port"
 	"tunnel_pls/internal/registry"
 	"tunnel_pls/internal/session/lifecycle"
 	"tunnel_pls/internal/types"
@@ -38,9 +43,10 @@ type mockConfig struct {
 	config.Config
 }
 
-func (m *mockConfig) Domain() string            { return m.Called().String(0) }
-func (m *mockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *mockConfig) SSHPort() string           { return m.Called().String(0) }
+func (m *mockConfig) Domain() string      { return m.Called().String(0) }
+func (m *mockConfig) NodeRegion() string  { return m.Called().String(0) }
+func (m *mockConfig) FrontendURL() string { return m.Called().String(0) }
+func (m *mockConfig) SSHPort() string     { return m.Called().String(0) }
 func (m *mockConfig) Mode() types.ServerMode {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -56,6 +62,62 @@ func (m *mockConfig) Mode() types.ServerMode {
 	}
 }
 func (m *mockConfig) TLSEnabled() bool { return m.Called().Bool(0) }
+func (m *mockConfig) TunnelEventsWebhook() string {
+	return m.Called().String(0)
+}
+func (m *mockConfig) TunnelURLBanner() bool {
+	return m.Called().Bool(0)
+}
+func (m *mockConfig) TCPEnabled() bool { return m.Called().Bool(0) }
+func (m *mockConfig) UDPEnabled() bool { return m.Called().Bool(0) }
+func (m *mockConfig) MaxInteractiveSessions() int {
+	return m.Called().Int(0)
+}
+func (m *mockConfig) HTTPForwardPorts() []uint16 {
+	return m.Called().Get(0).([]uint16)
+}
+func (m *mockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+
+func (m *mockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+
+func (m *mockConfig) BufferSize() int           { return m.Called().Int(0) }
+func (m *mockConfig) TCPByteBudget() int64      { return m.Called().Get(0).(int64) }
+func (m *mockConfig) UDPByteBudget() int64      { return m.Called().Get(0).(int64) }
+func (m *mockConfig) NodeBandwidthLimit() int64 { return m.Called().Get(0).(int64) }
+func (m *mockConfig) ComingSoonDisabled() bool {
+	return m.Called().Bool(0)
+}
+func (m *mockConfig) RandomKeybindingDisabled() bool {
+	return m.Called().Bool(0)
+}
+func (m *mockConfig) MaxSlugLength() int {
+	return m.Called().Int(0)
+}
+func (m *mockConfig) InteractiveKeepalive() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *mockConfig) TCPInitialReadTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *mockConfig) TCPKeepAliveInterval() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *mockConfig) TCPKeepAliveCount() int {
+	return m.Called().Int(0)
+}
+func (m *mockConfig) MaxConcurrentAccepts() int {
+	return m.Called().Int(0)
+}
+func (m *mockConfig) DirectTCPIPEnabled() bool {
+	return m.Called().Bool(0)
+}
+func (m *mockConfig) DirectTCPIPAllowlist() []string {
+	return m.Called().Get(0).([]string)
+}
 
 type mockRegistry struct {
 	mock.Mock
@@ -67,6 +129,10 @@ func (m *mockRegistry) Register(key types.SessionKey, session registry.Session)
 	return m.Called(key, session).Bool(0)
 }
 
+func (m *mockRegistry) Update(user string, oldKey, newKey types.SessionKey) error {
+	return m.Called(user, oldKey, newKey).Error(0)
+}
+
 func (m *mockRegistry) Remove(key types.SessionKey) {
 	m.removedKey = key
 }
@@ -105,6 +171,9 @@ func (m *mockPort) SetStatus(port uint16, assigned bool) error {
 func (m *mockPort) Claim(port uint16) bool {
 	return m.Called(port).Bool(0)
 }
+func (m *mockPort) Assigned() []uint16 {
+	return m.Called().Get(0).([]uint16)
+}
 
 type mockSSHConn struct {
 	ssh.Conn
@@ -237,6 +306,11 @@ func TestDetail(t *testing.T) {
 	assert.Equal(t, "testuser", detail.UserID)
 	assert.True(t, detail.Active)
 
+	assert.Empty(t, detail.Description)
+
+	s.setDescription("billing webhooks")
+	assert.Equal(t, "billing webhooks", s.Detail().Description)
+
 	s.forwarder.SetType(types.TunnelTypeTCP)
 	detail = s.Detail()
 	assert.Equal(t, "TCP", detail.ForwardingType)
@@ -269,6 +343,276 @@ func TestIsBlockedPort(t *testing.T) {
 	}
 }
 
+func TestTunnelTypeForPort(t *testing.T) {
+	tests := []struct {
+		name        string
+		httpPorts   []uint16
+		defaultType types.TunnelType
+		port        uint16
+		expected    types.TunnelType
+	}{
+		{"default mapping port 80", []uint16{80, 443}, types.TunnelTypeTCP, 80, types.TunnelTypeHTTP},
+		{"default mapping port 443", []uint16{80, 443}, types.TunnelTypeTCP, 443, types.TunnelTypeHTTP},
+		{"default mapping random port", []uint16{80, 443}, types.TunnelTypeTCP, 0, types.TunnelTypeTCP},
+		{"default mapping high port", []uint16{80, 443}, types.TunnelTypeTCP, 3000, types.TunnelTypeTCP},
+		{"custom mapping extra http port", []uint16{80, 443, 3000}, types.TunnelTypeTCP, 3000, types.TunnelTypeHTTP},
+		{"custom mapping port 80 removed", []uint16{443}, types.TunnelTypeTCP, 80, types.TunnelTypeTCP},
+		{"http default for unmapped port", []uint16{80, 443}, types.TunnelTypeHTTP, 5000, types.TunnelTypeHTTP},
+		{"http default allocates tcp for port 0", []uint16{80, 443}, types.TunnelTypeHTTP, 0, types.TunnelTypeTCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mConfig := &mockConfig{}
+			mConfig.On("HTTPForwardPorts").Return(tt.httpPorts)
+			mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+			mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+			mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+			mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+			mConfig.On("DefaultTunnelType").Return(tt.defaultType).Maybe()
+			mConfig.On("Domain").Return("tunnl.live").Maybe()
+			mConfig.On("NodeRegion").Return("").Maybe()
+			mConfig.On("TLSEnabled").Return(false).Maybe()
+			mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+			mConfig.On("TunnelURLBanner").Return(false).Maybe()
+			s := &session{config: mConfig}
+			assert.Equal(t, tt.expected, s.tunnelTypeForPort(tt.port))
+		})
+	}
+}
+
+func TestHandleTCPIPForward_CustomHTTPPort(t *testing.T) {
+	sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+	mRegistry := &mockRegistry{}
+	mPort := &mockPort{}
+	mRandom := &mockRandom{}
+	mConfig := &mockConfig{}
+	mConfig.On("MaxSlugLength").Return(20).Maybe()
+	mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443, 3000})
+	mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+	mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+	mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+	mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+	mConfig.On("Domain").Return("tunnl.live").Maybe()
+	mConfig.On("NodeRegion").Return("").Maybe()
+	mConfig.On("TLSEnabled").Return(false).Maybe()
+	mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+	mConfig.On("TunnelURLBanner").Return(false).Maybe()
+	s := New(&Config{
+		Randomizer:      mRandom,
+		Config:          mConfig,
+		Conn:            sConn,
+		InitialReq:      make(chan *ssh.Request),
+		SshChan:         make(chan ssh.NewChannel),
+		SessionRegistry: mRegistry,
+		PortRegistry:    mPort,
+		User:            "testuser",
+	}).(*session)
+	mRandom.On("String", 20).Return("custom-slug-12345678", nil)
+	mRegistry.On("Register", types.SessionKey{Id: "custom-slug-12345678", Type: types.TunnelTypeHTTP}, mock.Anything).Return(true)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], 3000)
+
+	go func() {
+		_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+	}()
+
+	var req *ssh.Request
+	select {
+	case req = <-sReqs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for tcpip-forward request")
+	}
+
+	err := s.HandleTCPIPForward(req)
+	assert.NoError(t, err)
+	assert.Equal(t, types.TunnelTypeHTTP, s.forwarder.TunnelType())
+	assert.Equal(t, uint16(3000), s.forwarder.ForwardedPort())
+	mConfig.AssertNotCalled(t, "TCPEnabled")
+	mPort.AssertNotCalled(t, "Claim", mock.Anything)
+	mRegistry.AssertExpectations(t)
+}
+
+func TestHandleTCPIPForward_PortZeroWithHTTPDefault(t *testing.T) {
+	sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+	mRegistry := &mockRegistry{}
+	mPort := &mockPort{}
+	mConfig := &mockConfig{}
+	mConfig.On("MaxSlugLength").Return(20).Maybe()
+	mConfig.On("TCPEnabled").Return(true)
+	mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443}).Maybe()
+	mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+	mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+	mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+	mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mConfig.On("DefaultTunnelType").Return(types.TunnelTypeHTTP).Maybe()
+	mConfig.On("Domain").Return("tunnl.live").Maybe()
+	mConfig.On("NodeRegion").Return("").Maybe()
+	mConfig.On("TLSEnabled").Return(false).Maybe()
+	mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+	mConfig.On("TunnelURLBanner").Return(false).Maybe()
+	s := New(&Config{
+		Randomizer:      &mockRandom{},
+		Config:          mConfig,
+		Conn:            sConn,
+		InitialReq:      make(chan *ssh.Request),
+		SshChan:         make(chan ssh.NewChannel),
+		SessionRegistry: mRegistry,
+		PortRegistry:    mPort,
+		User:            "testuser",
+	}).(*session)
+	mPort.On("Unassigned").Return(uint16(12346), true)
+	mPort.On("Claim", uint16(12346)).Return(true)
+	mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], 0)
+
+	go func() {
+		_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+	}()
+
+	var req *ssh.Request
+	select {
+	case req = <-sReqs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for tcpip-forward request")
+	}
+
+	err := s.HandleTCPIPForward(req)
+	assert.NoError(t, err)
+	defer func() {
+		if l := s.forwarder.Listener(); l != nil {
+			_ = l.Close()
+		}
+	}()
+	assert.Equal(t, types.TunnelTypeTCP, s.forwarder.TunnelType())
+	assert.Equal(t, uint16(12346), s.forwarder.ForwardedPort())
+}
+
+func TestHandleTCPIPForward_UDP(t *testing.T) {
+	sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+	mRegistry := &mockRegistry{}
+	mPort := &mockPort{}
+	mConfig := &mockConfig{}
+	mConfig.On("UDPEnabled").Return(true)
+	mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443}).Maybe()
+	mConfig.On("DefaultTunnelType").Return(types.TunnelTypeHTTP).Maybe()
+	mConfig.On("Domain").Return("tunnl.live").Maybe()
+	mConfig.On("NodeRegion").Return("").Maybe()
+	mConfig.On("TLSEnabled").Return(false).Maybe()
+	mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+	mConfig.On("TunnelURLBanner").Return(false).Maybe()
+	s := New(&Config{
+		Randomizer:      &mockRandom{},
+		Config:          mConfig,
+		Conn:            sConn,
+		InitialReq:      make(chan *ssh.Request),
+		SshChan:         make(chan ssh.NewChannel),
+		SessionRegistry: mRegistry,
+		PortRegistry:    mPort,
+		User:            "testuser",
+	}).(*session)
+
+	probe, err := net.ListenPacket("udp", "0.0.0.0:0")
+	require.NoError(t, err)
+	port := uint16(probe.LocalAddr().(*net.UDPAddr).Port)
+	require.NoError(t, probe.Close())
+
+	mPort.On("Claim", port).Return(true)
+	mRegistry.On("Register", types.SessionKey{Id: strconv.Itoa(int(port)), Type: types.TunnelTypeUDP}, mock.Anything).Return(true)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], uint32(port))
+
+	replied := make(chan []byte, 1)
+	go func() {
+		_, reply, _ := cConn.SendRequest(udpForwardRequest, true, payload)
+		replied <- reply
+	}()
+
+	var req *ssh.Request
+	select {
+	case req = <-sReqs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for udpip-forward request")
+	}
+
+	err = s.HandleTCPIPForward(req)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, s.forwarder.Close())
+	}()
+
+	assert.Equal(t, types.TunnelTypeUDP, s.forwarder.TunnelType())
+	assert.Equal(t, port, s.forwarder.ForwardedPort())
+	assert.Equal(t, "UDP", s.Detail().ForwardingType)
+	assert.Equal(t, uint32(port), binary.BigEndian.Uint32(<-replied))
+
+	_, err = net.ListenPacket("udp", fmt.Sprintf("0.0.0.0:%d", port))
+	assert.Error(t, err, "the tunnel should hold the UDP port")
+	mPort.AssertExpectations(t)
+	mRegistry.AssertExpectations(t)
+}
+
+func TestAcquireInteractiveSlot(t *testing.T) {
+	defer activeInteractiveSessions.Store(0)
+
+	newInteractive := func(limit int) *session {
+		mConfig := &mockConfig{}
+		mConfig.On("MaxInteractiveSessions").Return(limit)
+		s := New(&Config{
+			Randomizer:      &mockRandom{},
+			Config:          mConfig,
+			SessionRegistry: &mockRegistry{},
+			PortRegistry:    &mockPort{},
+			User:            "testuser",
+		}).(*session)
+		s.interaction.SetMode(types.InteractiveModeINTERACTIVE)
+		return s
+	}
+
+	t.Run("sessions past the cap become headless", func(t *testing.T) {
+		activeInteractiveSessions.Store(0)
+		sessions := []*session{newInteractive(2), newInteractive(2), newInteractive(2)}
+
+		assert.True(t, sessions[0].acquireInteractiveSlot())
+		assert.True(t, sessions[1].acquireInteractiveSlot())
+		assert.False(t, sessions[2].acquireInteractiveSlot())
+
+		assert.Equal(t, types.InteractiveModeINTERACTIVE, sessions[0].interaction.Mode())
+		assert.Equal(t, types.InteractiveModeINTERACTIVE, sessions[1].interaction.Mode())
+		assert.Equal(t, types.InteractiveModeHEADLESS, sessions[2].interaction.Mode())
+		assert.Equal(t, int64(2), activeInteractiveSessions.Load())
+	})
+
+	t.Run("zero means unlimited", func(t *testing.T) {
+		activeInteractiveSessions.Store(1000)
+		s := newInteractive(0)
+		assert.True(t, s.acquireInteractiveSlot())
+		assert.Equal(t, types.InteractiveModeINTERACTIVE, s.interaction.Mode())
+	})
+
+	t.Run("headless sessions do not take a slot", func(t *testing.T) {
+		activeInteractiveSessions.Store(0)
+		s := newInteractive(1)
+		s.interaction.SetMode(types.InteractiveModeHEADLESS)
+		assert.False(t, s.acquireInteractiveSlot())
+		assert.Equal(t, int64(0), activeInteractiveSessions.Load())
+	})
+}
+
 func TestHandleGlobalRequest(t *testing.T) {
 	_, sReqs, _, cConn, cleanup := setupSSH(t)
 	defer cleanup()
@@ -302,6 +646,27 @@ func TestHandleGlobalRequest(t *testing.T) {
 		{"pty-req", "pty-req", nil, true, true},
 		{"window-change valid", "window-change", make([]byte, 16), true, true},
 		{"window-change invalid", "window-change", make([]byte, 4), true, false},
+		{"env allowed methods", "env", envPayload("TUNNEL_ALLOWED_METHODS", "get, head"), true, true},
+		{"env invalid methods", "env", envPayload("TUNNEL_ALLOWED_METHODS", "GET;DELETE"), true, false},
+		{"env allowed origins", "env", envPayload("TUNNEL_WS_ALLOWED_ORIGINS", "https://App.example.com, http://localhost:3000/"), true, true},
+		{"env invalid origins", "env", envPayload("TUNNEL_WS_ALLOWED_ORIGINS", "https://app.example.com/path"), true, false},
+		{"env host header", "env", envPayload("TUNNEL_HOST_HEADER", " backend.local:3000 "), true, true},
+		{"env invalid host header", "env", envPayload("TUNNEL_HOST_HEADER", "evil\r\nX-Injected: 1"), true, false},
+		{"env rewrite location", "env", envPayload("TUNNEL_REWRITE_LOCATION", "true"), true, true},
+		{"env invalid rewrite location", "env", envPayload("TUNNEL_REWRITE_LOCATION", "sometimes"), true, false},
+		{"env default content type", "env", envPayload("TUNNEL_DEFAULT_CONTENT_TYPE", " text/plain; charset=utf-8 "), true, true},
+		{"env invalid default content type", "env", envPayload("TUNNEL_DEFAULT_CONTENT_TYPE", "text/html\r\nX-Injected: 1"), true, false},
+		{"env mirror", "env", envPayload("TUNNEL_MIRROR", " 256 "), true, true},
+		{"env invalid mirror", "env", envPayload("TUNNEL_MIRROR", "lots"), true, false},
+		{"env mirror over cap", "env", envPayload("TUNNEL_MIRROR", "1048576"), true, false},
+		{"env description", "env", envPayload("TUNNEL_DESCRIPTION", "  staging API for the mobile team "), true, true},
+		{"env description too long", "env", envPayload("TUNNEL_DESCRIPTION", strings.Repeat("x", maxDescriptionLength+1)), true, false},
+		{"env basic auth", "env", envPayload("TUNNEL_BASIC_AUTH", "alice:secret"), true, true},
+		{"env invalid basic auth", "env", envPayload("TUNNEL_BASIC_AUTH", "alice"), true, false},
+		{"env unsupported variable", "env", envPayload("LANG", "C"), true, false},
+		{"env invalid payload", "env", []byte{1}, true, false},
+		{"signal unsupported", "signal", signalPayload("USR1"), true, false},
+		{"signal invalid payload", "signal", []byte{1}, true, false},
 		{"unknown", "unknown", nil, true, false},
 	}
 
@@ -312,6 +677,16 @@ func TestHandleGlobalRequest(t *testing.T) {
 			assert.Equal(t, tt.expected, ok)
 		})
 	}
+	assert.False(t, s.lifecycle.IsClosed())
+	assert.Equal(t, []string{"GET", "HEAD"}, s.forwarder.AllowedMethods())
+	assert.Equal(t, []string{"https://app.example.com", "http://localhost:3000"}, s.forwarder.AllowedOrigins())
+	assert.Equal(t, "staging API for the mobile team", s.Detail().Description)
+	assert.Equal(t, "backend.local:3000", s.forwarder.HostHeader())
+	assert.True(t, s.forwarder.RewriteLocation())
+	assert.Equal(t, "text/plain; charset=utf-8", s.forwarder.DefaultContentType())
+	assert.Equal(t, 256, s.forwarder.MirrorBodyLimit())
+	assert.True(t, s.forwarder.CheckBasicAuth("alice", "secret"))
+	assert.False(t, s.forwarder.CheckBasicAuth("alice", "guess"))
 
 	err := cConn.Close()
 	assert.NoError(t, err)
@@ -323,15 +698,241 @@ func TestHandleGlobalRequest(t *testing.T) {
 	}
 }
 
+func TestHandleGlobalRequest_Closing(t *testing.T) {
+	sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+
+	mPort := &mockPort{}
+	mRegistry := &mockRegistry{}
+	s := New(&Config{
+		Randomizer:      &mockRandom{},
+		Config:          &mockConfig{},
+		Conn:            sConn,
+		InitialReq:      make(chan *ssh.Request),
+		SshChan:         make(chan ssh.NewChannel),
+		SessionRegistry: mRegistry,
+		PortRegistry:    mPort,
+		User:            "testuser",
+	}).(*session)
+	s.lifecycle.SetStatus(types.SessionStatusCLOSED)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], 80)
+
+	t.Run("tcpip-forward", func(t *testing.T) {
+		replies := make(chan bool, 1)
+		go func() {
+			ok, _, _ := cConn.SendRequest("tcpip-forward", true, payload)
+			replies <- ok
+		}()
+
+		err := s.HandleTCPIPForward(<-sReqs)
+		assert.ErrorContains(t, err, "session is closing")
+		assert.False(t, <-replies)
+		assert.True(t, s.lifecycle.IsClosed())
+		assert.Equal(t, types.TunnelTypeUNKNOWN, s.forwarder.TunnelType())
+		assert.Zero(t, s.forwarder.ForwardedPort())
+		mPort.AssertNotCalled(t, "Unassigned")
+		mPort.AssertNotCalled(t, "Claim", mock.Anything)
+		mRegistry.AssertNotCalled(t, "Register", mock.Anything, mock.Anything)
+	})
+
+	t.Run("session requests", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			_ = s.HandleGlobalRequest(sReqs)
+			close(done)
+		}()
+
+		for _, req := range []struct {
+			reqType string
+			payload []byte
+		}{
+			{"tcpip-forward", payload},
+			{"env", envPayload("TUNNEL_HOST_HEADER", "backend.local")},
+			{"pty-req", nil},
+		} {
+			ok, _, err := cConn.SendRequest(req.reqType, true, req.payload)
+			assert.NoError(t, err)
+			assert.False(t, ok, req.reqType)
+		}
+		assert.Empty(t, s.forwarder.HostHeader())
+		select {
+		case <-s.ptyReq:
+			t.Fatal("pty-req should not be acknowledged on a closing session")
+		default:
+		}
+
+		assert.NoError(t, cConn.Close())
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("HandleGlobalRequest timed out after cConn.Close()")
+		}
+	})
+}
+
+func TestHandleGlobalRequest_Signal(t *testing.T) {
+	for _, name := range terminationSignals {
+		t.Run(name, func(t *testing.T) {
+			sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+			defer cleanup()
+
+			s := New(&Config{
+				Randomizer:      &mockRandom{},
+				Config:          &mockConfig{},
+				Conn:            sConn,
+				InitialReq:      make(chan *ssh.Request),
+				SshChan:         make(chan ssh.NewChannel),
+				SessionRegistry: &mockRegistry{},
+				PortRegistry:    &mockPort{},
+				User:            "testuser",
+			}).(*session)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- s.HandleGlobalRequest(sReqs)
+			}()
+
+			ok, _, err := cConn.SendRequest("signal", true, signalPayload(name))
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			select {
+			case err = <-done:
+				assert.NoError(t, err)
+			case <-time.After(2 * time.Second):
+				t.Fatal("HandleGlobalRequest did not return after signal")
+			}
+			assert.True(t, s.lifecycle.IsClosed())
+			assert.Error(t, cConn.Wait())
+		})
+	}
+}
+
+func signalPayload(name string) []byte {
+	return ssh.Marshal(struct{ Name string }{name})
+}
+
+func envPayload(name, value string) []byte {
+	return ssh.Marshal(struct {
+		Name  string
+		Value string
+	}{name, value})
+}
+
+func TestParseAllowedMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+		wantErr  bool
+	}{
+		{"single", "GET", []string{"GET"}, false},
+		{"normalized", " get ,Head ", []string{"GET", "HEAD"}, false},
+		{"duplicates", "GET,get,POST", []string{"GET", "POST"}, false},
+		{"empty", "", nil, false},
+		{"empty entries", ",GET,,", []string{"GET"}, false},
+		{"invalid characters", "GET,PO ST", nil, true},
+		{"invalid separator", "GET;POST", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			methods, err := parseAllowedMethods(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, methods)
+		})
+	}
+}
+
+func TestParseAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+		wantErr  bool
+	}{
+		{"single", "https://app.example.com", []string{"https://app.example.com"}, false},
+		{"normalized", " HTTPS://App.Example.com/ ,http://localhost:3000 ", []string{"https://app.example.com", "http://localhost:3000"}, false},
+		{"duplicates", "https://a.example,https://A.example/", []string{"https://a.example"}, false},
+		{"empty", "", nil, false},
+		{"missing scheme", "app.example.com", nil, true},
+		{"unsupported scheme", "ftp://app.example.com", nil, true},
+		{"path", "https://app.example.com/login", nil, true},
+		{"userinfo", "https://user@app.example.com", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origins, err := parseAllowedOrigins(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, origins)
+		})
+	}
+}
+
+func TestParseDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{"plain", "billing webhooks", "billing webhooks", false},
+		{"trimmed", "  billing webhooks \t", "billing webhooks", false},
+		{"empty clears", "", "", false},
+		{"at limit", strings.Repeat("é", maxDescriptionLength), strings.Repeat("é", maxDescriptionLength), false},
+		{"over limit", strings.Repeat("é", maxDescriptionLength+1), "", true},
+		{"control characters", "billing\r\nwebhooks", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description, err := parseDescription(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, description)
+		})
+	}
+}
+
 func TestHandleTCPIPForward_Table(t *testing.T) {
 	setup := func(t *testing.T) (*session, *mockRegistry, *mockPort, *mockRandom, *ssh.ServerConn, <-chan *ssh.Request, ssh.Conn, func()) {
 		sConn, sReqs, _, cConn, cleanup := setupSSH(t)
 		mRegistry := &mockRegistry{}
 		mPort := &mockPort{}
 		mRandom := &mockRandom{}
+		mConfig := &mockConfig{}
+		mConfig.On("MaxSlugLength").Return(20).Maybe()
+		mConfig.On("TCPEnabled").Return(true)
+		mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+		mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+		mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+		mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+		mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+		mConfig.On("Domain").Return("tunnl.live").Maybe()
+		mConfig.On("NodeRegion").Return("").Maybe()
+		mConfig.On("TLSEnabled").Return(false).Maybe()
+		mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+		mConfig.On("TunnelURLBanner").Return(false).Maybe()
 		conf := &Config{
 			Randomizer:      mRandom,
-			Config:          &mockConfig{},
+			Config:          mConfig,
 			Conn:            sConn,
 			InitialReq:      make(chan *ssh.Request),
 			SshChan:         make(chan ssh.NewChannel),
@@ -449,6 +1050,198 @@ func TestHandleTCPIPForward_Table(t *testing.T) {
 	})
 }
 
+func TestTunnelCreatedEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		port       uint32
+		tlsEnabled bool
+		expected   tunnelCreatedEvent
+	}{
+		{
+			name:       "http tunnel",
+			port:       80,
+			tlsEnabled: true,
+			expected:   tunnelCreatedEvent{Event: "tunnel.created", URL: "https://event-slug-1234567890.eu.tunnl.live", User: "testuser", Type: "HTTP", Port: 80},
+		},
+		{
+			name:     "tcp tunnel",
+			port:     0,
+			expected: tunnelCreatedEvent{Event: "tunnel.created", URL: "tcp://eu.tunnl.live:23456", User: "testuser", Type: "TCP", Port: 23456},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan tunnelCreatedEvent, 1)
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var evt tunnelCreatedEvent
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&evt))
+				events <- evt
+			}))
+			defer webhook.Close()
+
+			sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+			defer cleanup()
+			mRegistry := &mockRegistry{}
+			mPort := &mockPort{}
+			mRandom := &mockRandom{}
+			mConfig := &mockConfig{}
+			mConfig.On("MaxSlugLength").Return(20).Maybe()
+			mConfig.On("TCPEnabled").Return(true).Maybe()
+			mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+			mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+			mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+			mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+			mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+			mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+			mConfig.On("Domain").Return("tunnl.live")
+			mConfig.On("NodeRegion").Return("eu")
+			mConfig.On("TLSEnabled").Return(tt.tlsEnabled).Maybe()
+			mConfig.On("TunnelEventsWebhook").Return(webhook.URL)
+			mRandom.On("String", 20).Return("event-slug-1234567890", nil).Maybe()
+			mPort.On("Unassigned").Return(uint16(23456), true).Maybe()
+			mPort.On("Claim", mock.Anything).Return(true).Maybe()
+			mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+			s := New(&Config{
+				Randomizer:      mRandom,
+				Config:          mConfig,
+				Conn:            sConn,
+				InitialReq:      make(chan *ssh.Request),
+				SshChan:         make(chan ssh.NewChannel),
+				SessionRegistry: mRegistry,
+				PortRegistry:    mPort,
+				User:            "testuser",
+			}).(*session)
+
+			payload := make([]byte, 4+9+4)
+			binary.BigEndian.PutUint32(payload[0:4], 9)
+			copy(payload[4:13], "localhost")
+			binary.BigEndian.PutUint32(payload[13:17], tt.port)
+
+			go func() {
+				_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+			}()
+
+			require.NoError(t, s.HandleTCPIPForward(<-sReqs))
+			defer func() {
+				if l := s.forwarder.Listener(); l != nil {
+					_ = l.Close()
+				}
+			}()
+
+			select {
+			case evt := <-events:
+				assert.WithinDuration(t, time.Now(), evt.CreatedAt, 5*time.Second)
+				evt.CreatedAt = time.Time{}
+				assert.Equal(t, tt.expected, evt)
+			case <-time.After(2 * time.Second):
+				t.Fatal("tunnel created event was not delivered")
+			}
+		})
+	}
+}
+
+func TestTunnelURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		tunnelType types.TunnelType
+		expected   string
+	}{
+		{name: "tcp tunnel", tunnelType: types.TunnelTypeTCP, expected: "tcp://eu.tunnl.live:27015"},
+		{name: "udp tunnel", tunnelType: types.TunnelTypeUDP, expected: "udp://eu.tunnl.live:27015"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mConfig := &mockConfig{}
+			mConfig.On("Domain").Return("tunnl.live")
+			mConfig.On("NodeRegion").Return("eu")
+			s := New(&Config{
+				Randomizer:      &mockRandom{},
+				Config:          mConfig,
+				SessionRegistry: &mockRegistry{},
+				PortRegistry:    &mockPort{},
+				User:            "testuser",
+			}).(*session)
+			s.forwarder.SetType(tt.tunnelType)
+			s.forwarder.SetForwardedPort(27015)
+
+			assert.Equal(t, tt.expected, s.tunnelURL())
+		})
+	}
+}
+
+func TestStart_URLBanner(t *testing.T) {
+	sConn, sReqs, sChans, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+
+	mRegistry := &mockRegistry{}
+	mRandom := &mockRandom{}
+	mConfig := &mockConfig{}
+	mConfig.On("MaxSlugLength").Return(20).Maybe()
+	mConfig.On("Mode").Return(types.ServerModeSTANDALONE)
+	mConfig.On("Domain").Return("example.com")
+	mConfig.On("NodeRegion").Return("").Maybe()
+	mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+	mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+	mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+	mConfig.On("TLSEnabled").Return(false).Maybe()
+	mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+	mConfig.On("TunnelURLBanner").Return(true)
+	mRandom.On("String", 20).Return("banner-slug", nil)
+	mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+
+	s := New(&Config{
+		Randomizer:      mRandom,
+		Config:          mConfig,
+		Conn:            sConn,
+		InitialReq:      sReqs,
+		SshChan:         sChans,
+		SessionRegistry: mRegistry,
+		PortRegistry:    &mockPort{},
+		User:            "testuser",
+	}).(*session)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], 80)
+
+	expected := noPTYMessage + "Forwarding http://banner-slug.example.com\r\n"
+	received := make(chan string, 1)
+	go func() {
+		ch, reqs, err := cConn.OpenChannel("session", nil)
+		if err != nil {
+			received <- ""
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		_, _ = ch.SendRequest("shell", true, nil)
+		_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+
+		buf := make([]byte, len(expected))
+		_, err = io.ReadFull(ch, buf)
+		if err != nil {
+			received <- ""
+		} else {
+			received <- string(buf)
+		}
+		_ = cConn.Close()
+	}()
+
+	err := s.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, types.InteractiveModeHEADLESS, s.interaction.Mode())
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, expected, msg)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for tunnel URL banner")
+	}
+}
+
 func TestStart_Table(t *testing.T) {
 	setup := func(t *testing.T) (*session, *Config, ssh.Conn, func()) {
 		sConn, sReqs, sChans, cConn, cleanup := setupSSH(t)
@@ -456,9 +1249,24 @@ func TestStart_Table(t *testing.T) {
 		mPort := &mockPort{}
 		mRandom := &mockRandom{}
 		mConfig := &mockConfig{}
+		mConfig.On("MaxSlugLength").Return(20).Maybe()
 		mConfig.On("Mode").Return(types.ServerModeSTANDALONE)
 		mConfig.On("Domain").Return("example.com")
+		mConfig.On("NodeRegion").Return("").Maybe()
 		mConfig.On("SSHPort").Return("2222")
+		mConfig.On("TCPEnabled").Return(true)
+		mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+		mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+		mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+		mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+		mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+		mConfig.On("Domain").Return("tunnl.live").Maybe()
+		mConfig.On("NodeRegion").Return("").Maybe()
+		mConfig.On("TLSEnabled").Return(false).Maybe()
+		mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+		mConfig.On("TunnelURLBanner").Return(false).Maybe()
+		mConfig.On("MaxInteractiveSessions").Return(1)
 
 		conf := &Config{
 			Randomizer:      mRandom,
@@ -488,11 +1296,16 @@ func TestStart_Table(t *testing.T) {
 		conf.PortRegistry.(*mockPort).On("SetStatus", mock.AnythingOfType("uint16"), mock.Anything).Return(nil)
 		conf.SessionRegistry.(*mockRegistry).On("Register", mock.Anything, mock.Anything).Return(true)
 		conf.Config.(*mockConfig).On("TLSEnabled").Return(false)
+		conf.Config.(*mockConfig).On("InteractiveKeepalive").Return(time.Duration(0)).Maybe()
+		conf.Config.(*mockConfig).On("ComingSoonDisabled").Return(false).Maybe()
+		conf.Config.(*mockConfig).On("RandomKeybindingDisabled").Return(false).Maybe()
+		conf.Config.(*mockConfig).On("MaxSlugLength").Return(20).Maybe()
 		go func() {
 			time.Sleep(200 * time.Millisecond)
 			ch, reqs, err := cConn.OpenChannel("session", nil)
 			if err == nil {
 				go ssh.DiscardRequests(reqs)
+				_, _ = ch.SendRequest("pty-req", true, nil)
 				time.Sleep(200 * time.Millisecond)
 				_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
 				time.Sleep(200 * time.Millisecond)
@@ -509,6 +1322,99 @@ func TestStart_Table(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("Interactive without PTY falls back to headless", func(t *testing.T) {
+		s, conf, cConn, cleanup := setup(t)
+		defer cleanup()
+
+		payload := make([]byte, 4+9+4)
+		binary.BigEndian.PutUint32(payload[0:4], 9)
+		copy(payload[4:13], "localhost")
+		binary.BigEndian.PutUint32(payload[13:17], 80)
+
+		conf.Randomizer.(*mockRandom).On("String", 20).Return("nopty-slug", nil)
+		conf.SessionRegistry.(*mockRegistry).On("Register", mock.Anything, mock.Anything).Return(true)
+
+		received := make(chan string, 1)
+		go func() {
+			ch, reqs, err := cConn.OpenChannel("session", nil)
+			if err != nil {
+				received <- ""
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			_, _ = ch.SendRequest("shell", true, nil)
+			_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+
+			buf := make([]byte, len(noPTYMessage))
+			_, err = io.ReadFull(ch, buf)
+			if err != nil {
+				received <- ""
+			} else {
+				received <- string(buf)
+			}
+			_ = cConn.Close()
+		}()
+
+		err := s.Start()
+		assert.NoError(t, err)
+		assert.Equal(t, types.InteractiveModeHEADLESS, s.interaction.Mode())
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, noPTYMessage, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for headless notice")
+		}
+	})
+
+	t.Run("Interactive over the session cap falls back to headless", func(t *testing.T) {
+		s, conf, cConn, cleanup := setup(t)
+		defer cleanup()
+		activeInteractiveSessions.Store(1)
+		defer activeInteractiveSessions.Store(0)
+
+		payload := make([]byte, 4+9+4)
+		binary.BigEndian.PutUint32(payload[0:4], 9)
+		copy(payload[4:13], "localhost")
+		binary.BigEndian.PutUint32(payload[13:17], 80)
+
+		conf.Randomizer.(*mockRandom).On("String", 20).Return("overcap-slug", nil)
+		conf.SessionRegistry.(*mockRegistry).On("Register", mock.Anything, mock.Anything).Return(true)
+
+		received := make(chan string, 1)
+		go func() {
+			ch, reqs, err := cConn.OpenChannel("session", nil)
+			if err != nil {
+				received <- ""
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			_, _ = ch.SendRequest("pty-req", true, nil)
+			_, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+
+			buf := make([]byte, len(interactiveLimitMessage))
+			_, err = io.ReadFull(ch, buf)
+			if err != nil {
+				received <- ""
+			} else {
+				received <- string(buf)
+			}
+			_ = cConn.Close()
+		}()
+
+		err := s.Start()
+		assert.NoError(t, err)
+		assert.Equal(t, types.InteractiveModeHEADLESS, s.interaction.Mode())
+		assert.Equal(t, int64(1), activeInteractiveSessions.Load())
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, interactiveLimitMessage, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for headless notice")
+		}
+	})
+
 	t.Run("Headless mode success", func(t *testing.T) {
 		s, conf, cConn, cleanup := setup(t)
 		defer cleanup()
@@ -572,15 +1478,98 @@ func TestStart_Table(t *testing.T) {
 	})
 }
 
+func TestStart_DuplicateTCPIPForward(t *testing.T) {
+	sConn, sReqs, sChans, cConn, cleanup := setupSSH(t)
+	defer cleanup()
+
+	mRegistry := &mockRegistry{}
+	mRandom := &mockRandom{}
+	mConfig := &mockConfig{}
+	mConfig.On("MaxSlugLength").Return(20).Maybe()
+	mConfig.On("Mode").Return(types.ServerModeSTANDALONE)
+	mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+	mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP).Maybe()
+	mConfig.On("Domain").Return("tunnl.live").Maybe()
+	mConfig.On("NodeRegion").Return("").Maybe()
+	mConfig.On("TLSEnabled").Return(false).Maybe()
+	mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+	mConfig.On("TunnelURLBanner").Return(false).Maybe()
+	mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+	mRandom.On("String", 20).Return("first-slug", nil).Once()
+	mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+	mRegistry.On("Remove", mock.Anything).Return().Maybe()
+
+	s := New(&Config{
+		Randomizer:      mRandom,
+		Config:          mConfig,
+		Conn:            sConn,
+		InitialReq:      sReqs,
+		SshChan:         sChans,
+		SessionRegistry: mRegistry,
+		PortRegistry:    &mockPort{},
+		User:            "testuser",
+	}).(*session)
+
+	payload := make([]byte, 4+9+4)
+	binary.BigEndian.PutUint32(payload[0:4], 9)
+	copy(payload[4:13], "localhost")
+	binary.BigEndian.PutUint32(payload[13:17], 80)
+
+	type result struct {
+		first, duplicate bool
+		active           bool
+		slug             string
+	}
+	results := make(chan result, 1)
+	go func() {
+		var r result
+		r.first, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+		r.duplicate, _, _ = cConn.SendRequest("tcpip-forward", true, payload)
+		r.active = s.lifecycle.IsActive()
+		r.slug = s.slug.String()
+		results <- r
+		_ = cConn.Close()
+	}()
+
+	err := s.Start()
+	assert.NoError(t, err)
+
+	select {
+	case r := <-results:
+		assert.True(t, r.first)
+		assert.False(t, r.duplicate)
+		assert.True(t, r.active)
+		assert.Equal(t, "first-slug", r.slug)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for forward replies")
+	}
+	mRegistry.AssertNumberOfCalls(t, "Register", 1)
+	mRandom.AssertNumberOfCalls(t, "String", 1)
+}
+
 func TestForwardingFailures(t *testing.T) {
 	setup := func(t *testing.T) (*session, *mockRegistry, *mockPort, *mockRandom, *ssh.ServerConn, <-chan *ssh.Request, ssh.Conn, func()) {
 		sConn, sReqs, _, cConn, cleanup := setupSSH(t)
 		mRegistry := &mockRegistry{}
 		mPort := &mockPort{}
 		mRandom := &mockRandom{}
+		mConfig := &mockConfig{}
+		mConfig.On("MaxSlugLength").Return(20).Maybe()
+		mConfig.On("TCPEnabled").Return(true)
+		mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+		mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+		mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+		mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+		mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+		mConfig.On("Domain").Return("tunnl.live").Maybe()
+		mConfig.On("NodeRegion").Return("").Maybe()
+		mConfig.On("TLSEnabled").Return(false).Maybe()
+		mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+		mConfig.On("TunnelURLBanner").Return(false).Maybe()
 		conf := &Config{
 			Randomizer:      mRandom,
-			Config:          &mockConfig{},
+			Config:          mConfig,
 			Conn:            sConn,
 			InitialReq:      make(chan *ssh.Request),
 			SshChan:         make(chan ssh.NewChannel),
@@ -784,6 +1773,69 @@ func TestForwardingFailures(t *testing.T) {
 	})
 }
 
+func TestHandleTCPIPForward_TCPDisabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestType string
+		port        uint32
+		tcpEnabled  bool
+		expected    string
+	}{
+		{name: "auto assigned port", requestType: "tcpip-forward", port: 0, expected: "tcp forwarding is disabled"},
+		{name: "explicit port", requestType: "tcpip-forward", port: 1234, expected: "tcp forwarding is disabled"},
+		{name: "udp forward", requestType: udpForwardRequest, port: 1234, expected: "udp forwarding is disabled"},
+		{name: "udp forward with tcp enabled", requestType: udpForwardRequest, port: 1234, tcpEnabled: true, expected: "udp forwarding is disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sConn, sReqs, _, cConn, cleanup := setupSSH(t)
+			defer cleanup()
+			mPort := &mockPort{}
+			mConfig := &mockConfig{}
+			mConfig.On("TCPEnabled").Return(tt.tcpEnabled).Maybe()
+			mConfig.On("UDPEnabled").Return(false).Maybe()
+			mConfig.On("HTTPForwardPorts").Return([]uint16{80, 443})
+			mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT).Maybe()
+			mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+			mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+			mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+			mConfig.On("DefaultTunnelType").Return(types.TunnelTypeTCP)
+			mConfig.On("Domain").Return("tunnl.live").Maybe()
+			mConfig.On("NodeRegion").Return("").Maybe()
+			mConfig.On("TLSEnabled").Return(false).Maybe()
+			mConfig.On("TunnelEventsWebhook").Return("").Maybe()
+			mConfig.On("TunnelURLBanner").Return(false).Maybe()
+			s := New(&Config{
+				Randomizer:      &mockRandom{},
+				Config:          mConfig,
+				Conn:            sConn,
+				InitialReq:      make(chan *ssh.Request),
+				SshChan:         make(chan ssh.NewChannel),
+				SessionRegistry: &mockRegistry{},
+				PortRegistry:    mPort,
+				User:            "testuser",
+			}).(*session)
+
+			payload := make([]byte, 4+9+4)
+			binary.BigEndian.PutUint32(payload[0:4], 9)
+			copy(payload[4:13], "localhost")
+			binary.BigEndian.PutUint32(payload[13:17], tt.port)
+
+			go func() {
+				_, _, _ = cConn.SendRequest(tt.requestType, true, payload)
+			}()
+
+			req := <-sReqs
+			err := s.HandleTCPIPForward(req)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+			mPort.AssertNotCalled(t, "Unassigned")
+			mPort.AssertNotCalled(t, "Claim", mock.Anything)
+		})
+	}
+}
+
 func TestSetupInteractiveMode_Error(t *testing.T) {
 	sConn, _, sChans, _, cleanup := setupSSH(t)
 	defer cleanup()
@@ -815,6 +1867,10 @@ func (m *mockNewChanFail) Accept() (ssh.Channel, <-chan *ssh.Request, error) {
 	return nil, nil, fmt.Errorf("accept failed")
 }
 
+func (m *mockNewChanFail) ChannelType() string {
+	return "session"
+}
+
 func TestWaitForTCPIPForward_EdgeCases(t *testing.T) {
 	t.Run("Wrong Request Type Then Timeout", func(t *testing.T) {
 		_, sReqs, _, cConn, cleanup := setupSSH(t)
@@ -1020,6 +2076,7 @@ func TestHandleMissingForwardRequest(t *testing.T) {
 	mConn := &mockSSHConn{}
 	mConfig := &mockConfig{}
 	mConfig.On("Domain").Return("example.com")
+	mConfig.On("NodeRegion").Return("").Maybe()
 	mConfig.On("SSHPort").Return("2222")
 	mConn.On("Close").Return(nil)
 
@@ -1046,7 +2103,7 @@ func TestParseForwardPayload_Errors(t *testing.T) {
 	s := &session{}
 
 	t.Run("Short Address", func(t *testing.T) {
-		_, _, _, err := s.parseForwardPayload([]byte{0, 0, 0, 4})
+		_, _, _, err := s.parseForwardPayload("tcpip-forward", []byte{0, 0, 0, 4})
 		if err == nil {
 			t.Error("expected error, got nil")
 		}
@@ -1054,7 +2111,7 @@ func TestParseForwardPayload_Errors(t *testing.T) {
 
 	t.Run("Short Port", func(t *testing.T) {
 		payload := append([]byte{0, 0, 0, 4}, []byte("addr")...)
-		_, _, _, err := s.parseForwardPayload(payload)
+		_, _, _, err := s.parseForwardPayload("tcpip-forward", payload)
 		if err == nil {
 			t.Error("expected error, got nil")
 		}
@@ -1065,7 +2122,7 @@ func TestParseForwardPayload_Errors(t *testing.T) {
 		portBuf := make([]byte, 4)
 		binary.BigEndian.PutUint32(portBuf, 22)
 		payload = append(payload, portBuf...)
-		_, _, _, err := s.parseForwardPayload(payload)
+		_, _, _, err := s.parseForwardPayload("tcpip-forward", payload)
 		if err == nil {
 			t.Error("expected error, got nil")
 		} else if !strings.Contains(err.Error(), "port is block") {
@@ -1195,9 +2252,13 @@ func TestHandleTCPForward_Failures(t *testing.T) {
 		sConn, sReqs, _, cConn, cleanup := setupSSH(t)
 		mRegistry := &mockRegistry{}
 		mPort := &mockPort{}
+		mConfig := &mockConfig{}
+		mConfig.On("TCPInitialReadTimeout").Return(time.Duration(0)).Maybe()
+		mConfig.On("TCPKeepAliveInterval").Return(time.Duration(0)).Maybe()
+		mConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 		conf := &Config{
 			Randomizer:      &mockRandom{},
-			Config:          &mockConfig{},
+			Config:          mConfig,
 			Conn:            sConn,
 			InitialReq:      sReqs,
 			SshChan:         make(chan ssh.NewChannel),
@@ -1295,6 +2356,57 @@ func TestHandleTCPForward_Failures(t *testing.T) {
 		}
 		mPort.AssertExpectations(t)
 	})
+
+	freePort := func(t *testing.T) uint16 {
+		l, err := net.Listen("tcp", "0.0.0.0:0")
+		require.NoError(t, err)
+		port := uint16(l.Addr().(*net.TCPAddr).Port)
+		require.NoError(t, l.Close())
+		return port
+	}
+
+	t.Run("Finalize fail releases claimed port", func(t *testing.T) {
+		s, mRegistry, _, sConn, sReqs, cConn, cleanup := setup(t)
+		defer cleanup()
+		port := freePort(t)
+		ports := portUtil.New()
+		require.NoError(t, ports.AddRange(port, port))
+		s.lifecycle = lifecycle.New(sConn, s.forwarder, s.slug, ports, mRegistry, "testuser")
+		mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+
+		req := getReq(t, cConn, sReqs)
+		require.NoError(t, cConn.Close())
+		_ = sConn.Wait()
+
+		err := s.HandleTCPForward(req, "localhost", port, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to finalize forwarding")
+
+		unassigned, ok := ports.Unassigned()
+		assert.True(t, ok)
+		assert.Equal(t, port, unassigned)
+	})
+
+	t.Run("Session closed during finalize releases claimed port", func(t *testing.T) {
+		s, mRegistry, _, _, sReqs, cConn, cleanup := setup(t)
+		defer cleanup()
+		port := freePort(t)
+		ports := portUtil.New()
+		require.NoError(t, ports.AddRange(port, port))
+		mConn := &mockSSHConn{}
+		mConn.On("Close").Return(nil)
+		s.lifecycle = lifecycle.New(mConn, s.forwarder, s.slug, ports, mRegistry, "testuser")
+		require.NoError(t, s.lifecycle.Close())
+		mRegistry.On("Register", mock.Anything, mock.Anything).Return(true)
+
+		err := s.HandleTCPForward(getReq(t, cConn, sReqs), "localhost", port, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "session closed")
+		assert.Equal(t, types.SessionKey{Id: strconv.Itoa(int(port)), Type: types.TunnelTypeTCP}, mRegistry.removedKey)
+
+		claimed := ports.Claim(port)
+		assert.True(t, claimed)
+	})
 }
 
 func TestHandleHTTPForward_Failures(t *testing.T) {
@@ -1302,9 +2414,11 @@ func TestHandleHTTPForward_Failures(t *testing.T) {
 		sConn, sReqs, _, cConn, cleanup := setupSSH(t)
 		mRegistry := &mockRegistry{}
 		mRandom := &mockRandom{}
+		mConfig := &mockConfig{}
+		mConfig.On("MaxSlugLength").Return(20).Maybe()
 		s := New(&Config{
 			Randomizer:      mRandom,
-			Config:          &mockConfig{},
+			Config:          mConfig,
 			Conn:            sConn,
 			InitialReq:      sReqs,
 			SshChan:         make(chan ssh.NewChannel),
@@ -1335,6 +2449,7 @@ func TestHandleHTTPForward_Failures(t *testing.T) {
 	t.Run("Register fail", func(t *testing.T) {
 		s, mRegistry, mRandom, _, sReqs, cConn, cleanup := setup(t)
 		defer cleanup()
+		s.config.(*mockConfig).On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT)
 		mRandom.On("String", 20).Return("slug", nil)
 		mRegistry.On("Register", mock.Anything, mock.Anything).Return(false)
 		err := s.HandleHTTPForward(getReq(t, cConn, sReqs), 80)
@@ -1343,7 +2458,222 @@ func TestHandleHTTPForward_Failures(t *testing.T) {
 		} else if !strings.Contains(err.Error(), "Failed to register") {
 			t.Errorf("expected error to contain %q, got %q", "Failed to register", err.Error())
 		}
+		mRegistry.AssertNumberOfCalls(t, "Register", 1)
+		mRandom.AssertNotCalled(t, "String", slugSuffixLength)
+	})
+
+	t.Run("Register collision with suffix policy", func(t *testing.T) {
+		s, mRegistry, mRandom, _, sReqs, cConn, cleanup := setup(t)
+		defer cleanup()
+		s.config.(*mockConfig).On("SlugCollisionPolicy").Return(types.CollisionPolicySUFFIX)
+		s.config.(*mockConfig).On("Domain").Return("tunnl.live").Maybe()
+		s.config.(*mockConfig).On("NodeRegion").Return("").Maybe()
+		s.config.(*mockConfig).On("TLSEnabled").Return(false).Maybe()
+		s.config.(*mockConfig).On("TunnelEventsWebhook").Return("").Maybe()
+		s.config.(*mockConfig).On("TunnelURLBanner").Return(false).Maybe()
+		mRandom.On("String", 20).Return("aaaaaaaaaaaaaaaaaaaa", nil)
+		mRandom.On("String", slugSuffixLength).Return("x7k2", nil)
+		mRegistry.On("Register", types.SessionKey{Id: "aaaaaaaaaaaaaaaaaaaa", Type: types.TunnelTypeHTTP}, mock.Anything).Return(false)
+		mRegistry.On("Register", types.SessionKey{Id: "aaaaaaaaaaaaaaa-x7k2", Type: types.TunnelTypeHTTP}, mock.Anything).Return(true)
+
+		replied := make(chan bool, 1)
+		go func() {
+			ok, _, _ := cConn.SendRequest("tcpip-forward", true, nil)
+			replied <- ok
+		}()
+		err := s.HandleHTTPForward(<-sReqs, 80)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !<-replied {
+			t.Error("expected forwarding request to be accepted")
+		}
+		if got := s.slug.String(); got != "aaaaaaaaaaaaaaa-x7k2" {
+			t.Errorf("expected suffixed slug, got %q", got)
+		}
+		mRegistry.AssertNumberOfCalls(t, "Register", 2)
+	})
+}
+
+func TestCollisionRegistryUpdate(t *testing.T) {
+	oldKey := types.SessionKey{Id: "mine", Type: types.TunnelTypeHTTP}
+	taken := types.SessionKey{Id: "taken", Type: types.TunnelTypeHTTP}
+
+	t.Run("reject returns the collision", func(t *testing.T) {
+		mRegistry := &mockRegistry{}
+		mConfig := &mockConfig{}
+		mRandom := &mockRandom{}
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicyREJECT)
+		mRegistry.On("Update", "user", oldKey, taken).Return(registry.ErrSlugInUse)
+
+		err := newCollisionRegistry(mRegistry, mConfig, mRandom).Update("user", oldKey, taken)
+		if !errors.Is(err, registry.ErrSlugInUse) {
+			t.Errorf("expected ErrSlugInUse, got %v", err)
+		}
+		mRandom.AssertNotCalled(t, "String", mock.Anything)
+	})
+
+	t.Run("suffix retries with a random suffix", func(t *testing.T) {
+		mRegistry := &mockRegistry{}
+		mConfig := &mockConfig{}
+		mRandom := &mockRandom{}
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicySUFFIX)
+		mConfig.On("MaxSlugLength").Return(20)
+		mRandom.On("String", slugSuffixLength).Return("ab12", nil)
+		mRegistry.On("Update", "user", oldKey, taken).Return(registry.ErrSlugInUse)
+		mRegistry.On("Update", "user", oldKey, types.SessionKey{Id: "taken-ab12", Type: types.TunnelTypeHTTP}).Return(nil)
+
+		err := newCollisionRegistry(mRegistry, mConfig, mRandom).Update("user", oldKey, taken)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		mRegistry.AssertExpectations(t)
 	})
+
+	t.Run("suffix keeps within the configured slug length", func(t *testing.T) {
+		long := types.SessionKey{Id: "twelve-chars", Type: types.TunnelTypeHTTP}
+		mRegistry := &mockRegistry{}
+		mConfig := &mockConfig{}
+		mRandom := &mockRandom{}
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicySUFFIX)
+		mConfig.On("MaxSlugLength").Return(12)
+		mRandom.On("String", slugSuffixLength).Return("ab12", nil)
+		mRegistry.On("Update", "user", oldKey, long).Return(registry.ErrSlugInUse)
+		mRegistry.On("Update", "user", oldKey, types.SessionKey{Id: "twelve-ab12", Type: types.TunnelTypeHTTP}).Return(nil)
+
+		err := newCollisionRegistry(mRegistry, mConfig, mRandom).Update("user", oldKey, long)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		mRegistry.AssertExpectations(t)
+	})
+
+	t.Run("suffix gives up after repeated collisions", func(t *testing.T) {
+		mRegistry := &mockRegistry{}
+		mConfig := &mockConfig{}
+		mRandom := &mockRandom{}
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicySUFFIX)
+		mConfig.On("MaxSlugLength").Return(20)
+		mRandom.On("String", slugSuffixLength).Return("ab12", nil)
+		mRegistry.On("Update", "user", oldKey, mock.Anything).Return(registry.ErrSlugInUse)
+
+		err := newCollisionRegistry(mRegistry, mConfig, mRandom).Update("user", oldKey, taken)
+		if !errors.Is(err, registry.ErrSlugInUse) {
+			t.Errorf("expected ErrSlugInUse, got %v", err)
+		}
+		mRegistry.AssertNumberOfCalls(t, "Update", maxCollisionAttempts+1)
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		mRegistry := &mockRegistry{}
+		mConfig := &mockConfig{}
+		mConfig.On("SlugCollisionPolicy").Return(types.CollisionPolicySUFFIX).Maybe()
+		mRegistry.On("Update", "user", oldKey, taken).Return(registry.ErrForbiddenSlug)
+
+		err := newCollisionRegistry(mRegistry, mConfig, &mockRandom{}).Update("user", oldKey, taken)
+		if !errors.Is(err, registry.ErrForbiddenSlug) {
+			t.Errorf("expected ErrForbiddenSlug, got %v", err)
+		}
+		mRegistry.AssertNumberOfCalls(t, "Update", 1)
+	})
+}
+
+func TestHandleDirectTCPIP(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = backend.Close() }()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	backendPort := uint32(backend.Addr().(*net.TCPAddr).Port)
+
+	openDirect := func(t *testing.T, mConfig *mockConfig, port uint32) (ssh.Channel, error) {
+		sConn, _, sChans, cConn, cleanup := setupSSH(t)
+		t.Cleanup(cleanup)
+
+		s := New(&Config{
+			Randomizer:      &mockRandom{},
+			Config:          mConfig,
+			Conn:            sConn,
+			InitialReq:      make(chan *ssh.Request),
+			SshChan:         sChans,
+			SessionRegistry: &mockRegistry{},
+			PortRegistry:    &mockPort{},
+			User:            "testuser",
+		}).(*session)
+		go s.serveChannels()
+
+		payload := ssh.Marshal(directTCPIPPayload{DestAddr: "127.0.0.1", DestPort: port, OriginAddr: "127.0.0.1", OriginPort: 5000})
+		ch, reqs, err := cConn.OpenChannel("direct-tcpip", payload)
+		if err != nil {
+			return nil, err
+		}
+		go ssh.DiscardRequests(reqs)
+		return ch, nil
+	}
+
+	t.Run("allowed destination is forwarded", func(t *testing.T) {
+		mConfig := &mockConfig{}
+		mConfig.On("DirectTCPIPEnabled").Return(true)
+		mConfig.On("DirectTCPIPAllowlist").Return([]string{"127.0.0.1:*"})
+		mConfig.On("BufferSize").Return(1024).Maybe()
+		mConfig.On("TCPByteBudget").Return(int64(0)).Maybe()
+		mConfig.On("NodeBandwidthLimit").Return(int64(0)).Maybe()
+
+		ch, err := openDirect(t, mConfig, backendPort)
+		require.NoError(t, err)
+		defer func() { _ = ch.Close() }()
+
+		_, err = ch.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(ch, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+	})
+
+	t.Run("destination outside the allowlist is rejected", func(t *testing.T) {
+		mConfig := &mockConfig{}
+		mConfig.On("DirectTCPIPEnabled").Return(true)
+		mConfig.On("DirectTCPIPAllowlist").Return([]string{"127.0.0.1:1"})
+
+		_, err := openDirect(t, mConfig, backendPort)
+		var openErr *ssh.OpenChannelError
+		require.ErrorAs(t, err, &openErr)
+		assert.Equal(t, ssh.Prohibited, openErr.Reason)
+	})
+
+	t.Run("disabled rejects every destination", func(t *testing.T) {
+		mConfig := &mockConfig{}
+		mConfig.On("DirectTCPIPEnabled").Return(false)
+
+		_, err := openDirect(t, mConfig, backendPort)
+		var openErr *ssh.OpenChannelError
+		require.ErrorAs(t, err, &openErr)
+		assert.Equal(t, ssh.Prohibited, openErr.Reason)
+		mConfig.AssertNotCalled(t, "DirectTCPIPAllowlist")
+	})
+}
+
+func TestIsDirectTargetAllowed(t *testing.T) {
+	allowlist := []string{"db.internal:5432", "cache.internal:*", "[::1]:22"}
+
+	assert.True(t, isDirectTargetAllowed(allowlist, "db.internal", 5432))
+	assert.True(t, isDirectTargetAllowed(allowlist, "DB.Internal", 5432))
+	assert.False(t, isDirectTargetAllowed(allowlist, "db.internal", 5433))
+	assert.True(t, isDirectTargetAllowed(allowlist, "cache.internal", 6379))
+	assert.True(t, isDirectTargetAllowed(allowlist, "::1", 22))
+	assert.False(t, isDirectTargetAllowed(allowlist, "other.internal", 22))
+	assert.False(t, isDirectTargetAllowed(nil, "db.internal", 5432))
 }
 
 func TestHandleGlobalRequest_Failures(t *testing.T) {
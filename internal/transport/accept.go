@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const shedWriteTimeout = time.Second
+
+type acceptLimiter struct {
+	slots chan struct{}
+}
+
+func newAcceptLimiter(limit int) *acceptLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &acceptLimiter{slots: make(chan struct{}, limit)}
+}
+
+func (l *acceptLimiter) admit(conn net.Conn) (net.Conn, bool) {
+	if l == nil {
+		return conn, true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return &pendingConn{Conn: conn, release: func() { <-l.slots }}, true
+	default:
+		return conn, false
+	}
+}
+
+type pendingConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *pendingConn) forwarded() {
+	c.once.Do(c.release)
+}
+
+func (c *pendingConn) Close() error {
+	c.forwarded()
+	return c.Conn.Close()
+}
+
+func markForwarded(conn net.Conn) {
+	if pc, ok := conn.(*pendingConn); ok {
+		pc.forwarded()
+	}
+}
+
+func shed(conn net.Conn, response []byte) {
+	log.Printf("Shedding connection from %s: too many pending connections", conn.RemoteAddr())
+	if len(response) > 0 {
+		_ = conn.SetDeadline(time.Now().Add(shedWriteTimeout))
+		_ = writeFull(conn, response)
+	}
+	if err := conn.Close(); err != nil {
+		log.Printf("Failed to close shed connection: %v", err)
+	}
+}
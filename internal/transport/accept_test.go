@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAcceptLimiter(t *testing.T) {
+	t.Run("unlimited", func(t *testing.T) {
+		l := newAcceptLimiter(0)
+		assert.Nil(t, l)
+
+		serverConn, clientConn := net.Pipe()
+		defer func() {
+			_ = serverConn.Close()
+			_ = clientConn.Close()
+		}()
+		conn, ok := l.admit(serverConn)
+		assert.True(t, ok)
+		assert.Equal(t, serverConn, conn)
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		l := newAcceptLimiter(2)
+
+		var admitted []net.Conn
+		for i := 0; i < 2; i++ {
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+			conn, ok := l.admit(serverConn)
+			require.True(t, ok)
+			admitted = append(admitted, conn)
+		}
+
+		serverConn, clientConn := net.Pipe()
+		defer func() {
+			_ = serverConn.Close()
+			_ = clientConn.Close()
+		}()
+		_, ok := l.admit(serverConn)
+		assert.False(t, ok)
+
+		markForwarded(admitted[0])
+		markForwarded(admitted[0])
+		assert.Len(t, l.slots, 1)
+
+		assert.NoError(t, admitted[1].Close())
+		assert.Len(t, l.slots, 0)
+
+		conn, ok := l.admit(serverConn)
+		assert.True(t, ok)
+		assert.NoError(t, conn.Close())
+		assert.Len(t, l.slots, 0)
+	})
+}
+
+func TestHTTPServer_Serve_ShedsExcessConnections(t *testing.T) {
+	msr := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("Domain").Return("example.com")
+	mockConfig.On("HTTPPort").Return("0")
+	mockConfig.On("MaxConcurrentAccepts").Return(2)
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	srv := NewHTTPServer(mockConfig, msr)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	var pending []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		pending = append(pending, conn)
+	}
+	require.Eventually(t, func() bool {
+		return len(srv.(*httpServer).limiter.slots) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		response, err := io.ReadAll(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, string(serviceUnavailableResponse), string(response))
+		_ = conn.Close()
+	}
+
+	for _, conn := range pending {
+		_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err := conn.Read(make([]byte, 1))
+		assert.True(t, isTimeout(err), "pending connection should not be shed")
+	}
+	assert.Len(t, srv.(*httpServer).limiter.slots, 2)
+}
+
+func TestTCPServer_Serve_ShedsExcessConnections(t *testing.T) {
+	mf := new(MockForwarder)
+	hold := make(chan struct{})
+	mf.On("Enabled").Return(true)
+	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		<-hold
+	}).Return(nil, (<-chan *ssh.Request)(nil), errors.New("open error"))
+	srv := NewTCPServer(0, mf, 0, 2, net.KeepAliveConfig{}).(*tcp)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return len(srv.limiter.slots) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(make([]byte, 1))
+		assert.Equal(t, 0, n)
+		assert.False(t, isTimeout(err), "excess connection should be closed")
+		_ = conn.Close()
+	}
+	assert.Len(t, srv.limiter.slots, 2)
+
+	close(hold)
+	require.Eventually(t, func() bool {
+		return len(srv.limiter.slots) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -11,12 +11,14 @@ import (
 type httpServer struct {
 	handler *httpHandler
 	config  config.Config
+	limiter *acceptLimiter
 }
 
 func NewHTTPServer(config config.Config, sessionRegistry registry.Registry) Transport {
 	return &httpServer{
 		handler: newHTTPHandler(config, sessionRegistry),
 		config:  config,
+		limiter: newAcceptLimiter(config.MaxConcurrentAccepts()),
 	}
 }
 
@@ -36,6 +38,11 @@ func (ht *httpServer) Serve(listener net.Listener) error {
 			continue
 		}
 
+		conn, ok := ht.limiter.admit(conn)
+		if !ok {
+			go shed(conn, serviceUnavailableResponse)
+			continue
+		}
 		go ht.handler.Handler(conn, false)
 	}
 }
@@ -17,6 +17,7 @@ func TestNewHTTPServer(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return("example.com")
 	mockConfig.On("HTTPPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 
 	srv := NewHTTPServer(mockConfig, msr)
 	assert.NotNil(t, srv)
@@ -33,6 +34,7 @@ func TestHTTPServer_Listen(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return("example.com")
 	mockConfig.On("HTTPPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 	srv := NewHTTPServer(mockConfig, msr)
 
 	listener, err := srv.Listen()
@@ -48,6 +50,7 @@ func TestHTTPServer_Serve(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return("example.com")
 	mockConfig.On("HTTPPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 	srv := NewHTTPServer(mockConfig, msr)
 
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -68,6 +71,7 @@ func TestHTTPServer_Serve_AcceptError(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return("example.com")
 	mockConfig.On("HTTPPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 	srv := NewHTTPServer(mockConfig, msr)
 
 	ml := new(mockListener)
@@ -85,7 +89,19 @@ func TestHTTPServer_Serve_Success(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return("example.com")
 	mockConfig.On("HTTPPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
 	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
 	mockConfig.On("TLSRedirect").Return(false)
 	srv := NewHTTPServer(mockConfig, msr)
 
@@ -4,27 +4,75 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/http/header"
 	"tunnel_pls/internal/http/stream"
 	"tunnel_pls/internal/middleware"
 	"tunnel_pls/internal/registry"
+	"tunnel_pls/internal/session/forwarder"
 	"tunnel_pls/internal/types"
 
 	"golang.org/x/crypto/ssh"
 )
 
+var errRequestLineTooLong = errors.New("request line too long")
+
+const (
+	whoamiPath   = "/__tunnel/whoami"
+	metadataPath = "/__tunnel/metadata"
+)
+
+const defaultBadGatewayPage = `<!DOCTYPE html>
+<html>
+<head><title>502 Bad Gateway</title></head>
+<body>
+<h1>502 Bad Gateway</h1>
+<p>The tunnel is connected, but the service behind it is not responding.</p>
+<p>If you own this tunnel, make sure your local application is running.</p>
+</body>
+</html>
+`
+
+const defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>503 Down for Maintenance</title></head>
+<body>
+<h1>503 Down for Maintenance</h1>
+<p>This server is undergoing planned maintenance. Tunnels stay connected and will be back shortly.</p>
+</body>
+</html>
+`
+
+const notFoundPage = `<!DOCTYPE html>
+<html>
+<head><title>404 Tunnel Not Found</title></head>
+<body>
+<h1>404 Tunnel Not Found</h1>
+<p>There is no active tunnel at %s.</p>
+<p><a href="%s">Learn how to start one</a></p>
+</body>
+</html>
+`
+
 type httpHandler struct {
 	config          config.Config
 	sessionRegistry registry.Registry
+	inflight        clientInflight
 }
 
 func newHTTPHandler(config config.Config, sessionRegistry registry.Registry) *httpHandler {
@@ -35,29 +83,132 @@ func newHTTPHandler(config config.Config, sessionRegistry registry.Registry) *ht
 }
 
 func (hh *httpHandler) redirect(conn net.Conn, status int, location string) error {
-	_, err := conn.Write([]byte(fmt.Sprintf("HTTP/1.1 %d Moved Permanently\r\n", status) +
+	response := []byte(fmt.Sprintf("HTTP/1.1 %d Moved Permanently\r\n", status) +
 		fmt.Sprintf("Location: %s", location) +
 		"Content-Length: 0\r\n" +
 		"Connection: close\r\n" +
+		"\r\n")
+	return writeFull(conn, response)
+}
+
+func (hh *httpHandler) badRequest(conn net.Conn) error {
+	return writeFull(conn, []byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+}
+
+func (hh *httpHandler) methodNotAllowed(w io.Writer, allowed []string) error {
+	response := []byte("HTTP/1.1 405 Method Not Allowed\r\n" +
+		fmt.Sprintf("Allow: %s\r\n", strings.Join(allowed, ", ")) +
+		"Content-Length: 0\r\n" +
+		"Connection: close\r\n" +
+		"\r\n")
+	return writeFull(w, response)
+}
+
+var serviceUnavailableResponse = []byte("HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+
+func (hh *httpHandler) forbidden(w io.Writer) error {
+	return writeFull(w, []byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+}
+
+func (hh *httpHandler) serviceUnavailable(w io.Writer) error {
+	return writeFull(w, serviceUnavailableResponse)
+}
+
+func (hh *httpHandler) unauthorized(w io.Writer) error {
+	return writeFull(w, []byte("HTTP/1.1 401 Unauthorized\r\n"+
+		"WWW-Authenticate: Basic realm=\"tunnel\", charset=\"UTF-8\"\r\n"+
+		"Content-Length: 0\r\n"+
+		"Connection: close\r\n"+
 		"\r\n"))
-	if err != nil {
-		return err
+}
+
+func (hh *httpHandler) tooManyRequests(w io.Writer) error {
+	return writeFull(w, []byte("HTTP/1.1 429 Too Many Requests\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+}
+
+func (hh *httpHandler) uriTooLong(w io.Writer) error {
+	return writeFull(w, []byte("HTTP/1.1 414 URI Too Long\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+}
+
+func (hh *httpHandler) requestTimeout(conn net.Conn) error {
+	return writeFull(conn, []byte("HTTP/1.1 408 Request Timeout\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+}
+
+func (hh *httpHandler) badGateway(w io.Writer) error {
+	page := hh.config.BadGatewayPage()
+	if page == "" {
+		page = defaultBadGatewayPage
 	}
-	return nil
+	response := []byte("HTTP/1.1 502 Bad Gateway\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n", len(page)) +
+		"Connection: close\r\n" +
+		"\r\n" +
+		page)
+	return writeFull(w, response)
 }
 
-func (hh *httpHandler) badRequest(conn net.Conn) error {
-	if _, err := conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n")); err != nil {
-		return err
+func (hh *httpHandler) maintenance(w io.Writer) error {
+	page := hh.config.MaintenancePage()
+	if page == "" {
+		page = defaultMaintenancePage
+	}
+	response := []byte("HTTP/1.1 503 Service Unavailable\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n", len(page)) +
+		"Retry-After: 300\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" +
+		page)
+	return writeFull(w, response)
+}
+
+func (hh *httpHandler) tunnelNotFound(conn net.Conn, slug string) error {
+	welcomeURL := hh.config.WelcomeURL()
+	if welcomeURL == "" {
+		return hh.redirect(conn, http.StatusMovedPermanently, fmt.Sprintf("%s/tunnel-not-found?slug=%s\r\n", hh.config.FrontendURL(), slug))
+	}
+	page := fmt.Sprintf(notFoundPage, html.EscapeString(slug), html.EscapeString(welcomeURL))
+	response := []byte("HTTP/1.1 404 Not Found\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n", len(page)) +
+		"Connection: close\r\n" +
+		"\r\n" +
+		page)
+	return writeFull(conn, response)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func writeFull(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return io.ErrShortWrite
+		}
+		b = b[min(n, len(b)):]
 	}
 	return nil
 }
 
-func readHTTPHeader(br *bufio.Reader, limit int) ([]byte, error) {
+func readHTTPHeader(br *bufio.Reader, limit, lineLimit int) ([]byte, error) {
 	var headerBuf []byte
+	requestLineRead := false
 	for {
 		line, err := br.ReadSlice('\n')
 		headerBuf = append(headerBuf, line...)
+		if !requestLineRead {
+			if len(bytes.TrimRight(headerBuf, "\r\n")) > lineLimit {
+				return nil, errRequestLineTooLong
+			}
+			requestLineRead = err == nil
+		}
 		if errors.Is(err, bufio.ErrBufferFull) {
 			if len(headerBuf) > limit {
 				return nil, fmt.Errorf("headers too large")
@@ -79,9 +230,17 @@ func readHTTPHeader(br *bufio.Reader, limit int) ([]byte, error) {
 func (hh *httpHandler) Handler(conn net.Conn, isTLS bool) {
 	defer hh.closeConnection(conn)
 
-	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_ = conn.SetReadDeadline(time.Now().Add(hh.config.HeaderReadTimeout()))
 	br := bufio.NewReaderSize(conn, hh.config.HeaderSize())
-	headerBuf, err := readHTTPHeader(br, hh.config.HeaderSize())
+	headerBuf, err := readHTTPHeader(br, hh.config.HeaderSize(), hh.config.MaxRequestLineSize())
+	if errors.Is(err, errRequestLineTooLong) {
+		_ = hh.uriTooLong(conn)
+		return
+	}
+	if isTimeout(err) {
+		_ = hh.requestTimeout(conn)
+		return
+	}
 	if err != nil {
 		_ = hh.badRequest(conn)
 		return
@@ -96,14 +255,23 @@ func (hh *httpHandler) Handler(conn net.Conn, isTLS bool) {
 		return
 	}
 
+	if limit := hh.config.MaxURILength(); limit > 0 && len(reqhf.Path()) > limit {
+		_ = hh.uriTooLong(conn)
+		return
+	}
+
+	if hh.handleMetadataRequest(reqhf, conn) {
+		return
+	}
+
 	slug, err := hh.extractSlug(reqhf)
 	if err != nil {
-		_ = hh.badRequest(conn)
+		hh.invalidHost(conn, reqhf)
 		return
 	}
 
-	if hh.shouldRedirectToTLS(isTLS) {
-		_ = hh.redirect(conn, http.StatusMovedPermanently, fmt.Sprintf("https://%s.%s/\r\n", slug, hh.config.Domain()))
+	if hh.shouldRedirectToTLS(isTLS, reqhf) {
+		_ = hh.redirect(conn, http.StatusMovedPermanently, fmt.Sprintf("https://%s.%s/\r\n", slug, config.TunnelDomain(hh.config)))
 		return
 	}
 
@@ -111,23 +279,62 @@ func (hh *httpHandler) Handler(conn net.Conn, isTLS bool) {
 		return
 	}
 
+	if hh.config.MaintenanceMode() {
+		_ = hh.maintenance(conn)
+		return
+	}
+
 	sshSession, err := hh.sessionRegistry.Get(types.SessionKey{
 		Id:   slug,
 		Type: types.TunnelTypeHTTP,
 	})
 	if err != nil {
-		_ = hh.redirect(conn, http.StatusMovedPermanently, fmt.Sprintf("%s/tunnel-not-found?slug=%s\r\n", hh.config.FrontendURL(), slug))
+		_ = hh.tunnelNotFound(conn, slug)
+		return
+	}
+
+	if hh.handleWhoamiRequest(reqhf, slug, conn) {
+		return
+	}
+
+	if respond := hh.rejectRequest(reqhf, sshSession.Forwarder()); respond != nil {
+		_ = respond(conn)
+		return
+	}
+
+	slots := &requestSlots{
+		inflight: &hh.inflight,
+		tunnel:   sshSession,
+		addr:     conn.RemoteAddr(),
+		limit:    hh.config.MaxRequestsPerIP(),
+		reject:   hh.tooManyRequests,
+	}
+	if !slots.acquire() {
+		_ = hh.tooManyRequests(conn)
 		return
 	}
+	defer slots.releaseAll()
 
-	hw := stream.New(conn, br, conn.RemoteAddr())
+	markForwarded(conn)
+	hw := hh.newStream(conn, br)
 	defer func(hw stream.HTTP) {
 		err = hw.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			log.Printf("Error closing HTTP stream: %v", err)
 		}
 	}(hw)
-	hh.forwardRequest(hw, reqhf, sshSession)
+	hh.forwardRequest(hw, reqhf, sshSession, slots, isTLS)
+}
+
+func (hh *httpHandler) newStream(conn net.Conn, br *bufio.Reader) stream.HTTP {
+	var hw stream.HTTP
+	if size := hh.config.ResponseWriteBuffer(); size > 0 {
+		hw = stream.NewBuffered(conn, br, conn.RemoteAddr(), size)
+	} else {
+		hw = stream.New(conn, br, conn.RemoteAddr())
+	}
+	hw.SetMaxResponseHeaderSize(hh.config.MaxResponseHeaderSize())
+	return hw
 }
 
 func (hh *httpHandler) closeConnection(conn net.Conn) {
@@ -138,6 +345,15 @@ func (hh *httpHandler) closeConnection(conn net.Conn) {
 }
 
 func (hh *httpHandler) extractSlug(reqhf header.RequestHeader) (string, error) {
+	if host, ok := hh.customDomainHost(reqhf); ok {
+		return hh.config.CustomDomains()[host], nil
+	}
+	if slug, ok := hh.baseDomainSlug(reqhf); ok {
+		return slug, nil
+	}
+	if hh.outsideRegion(reqhf) {
+		return "", errors.New("host is outside this node's region")
+	}
 	host := strings.Split(reqhf.Value("Host"), ".")
 	if len(host) <= 1 {
 		return "", errors.New("invalid host")
@@ -145,8 +361,117 @@ func (hh *httpHandler) extractSlug(reqhf header.RequestHeader) (string, error) {
 	return host[0], nil
 }
 
-func (hh *httpHandler) shouldRedirectToTLS(isTLS bool) bool {
-	return !isTLS && hh.config.TLSRedirect()
+func (hh *httpHandler) invalidHost(conn net.Conn, reqhf header.RequestHeader) {
+	switch hh.config.InvalidHostAction() {
+	case types.HostActionDROP:
+		return
+	case types.HostActionLOG:
+		log.Printf("Invalid Host header %q from %s", reqhf.Value("Host"), conn.RemoteAddr())
+	}
+	_ = hh.badRequest(conn)
+}
+
+// requestHost returns the Host header lowercased and without a port.
+func requestHost(reqhf header.RequestHeader) string {
+	host := strings.ToLower(reqhf.Value("Host"))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+func (hh *httpHandler) customDomainHost(reqhf header.RequestHeader) (string, bool) {
+	host := requestHost(reqhf)
+	_, ok := hh.config.CustomDomains()[host]
+	return host, ok
+}
+
+// baseDomainSlug takes the slug from a host under one of the node's
+// domains. With NODE_REGION set, tunnels on the primary domain live under
+// <region>.<domain>, so the region label is stripped along with the domain.
+// Registrations stay keyed by slug alone: the registry is per node and every
+// tunnel on a node shares its single region.
+func (hh *httpHandler) baseDomainSlug(reqhf header.RequestHeader) (string, bool) {
+	host := requestHost(reqhf)
+	for _, domain := range hh.config.Domains() {
+		if domain == hh.config.Domain() {
+			domain = config.TunnelDomain(hh.config)
+		}
+		prefix, ok := strings.CutSuffix(host, "."+domain)
+		if !ok || prefix == "" {
+			continue
+		}
+		slug, _, _ := strings.Cut(prefix, ".")
+		return slug, true
+	}
+	return "", false
+}
+
+// outsideRegion reports whether a host sits under the primary domain but not
+// under this node's region, such as another region's tunnel.
+func (hh *httpHandler) outsideRegion(reqhf header.RequestHeader) bool {
+	if hh.config.NodeRegion() == "" {
+		return false
+	}
+	return strings.HasSuffix(requestHost(reqhf), "."+hh.config.Domain())
+}
+
+func (hh *httpHandler) authorized(reqhf header.RequestHeader, fw forwarder.Forwarder) bool {
+	if !fw.BasicAuthEnabled() {
+		return true
+	}
+	encoded, ok := strings.CutPrefix(reqhf.Value("Authorization"), "Basic ")
+	if !ok {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	return ok && fw.CheckBasicAuth(username, password)
+}
+
+func isMethodAllowed(method string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, m := range allowed {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebSocketUpgrade(reqhf header.RequestHeader) bool {
+	return strings.EqualFold(strings.TrimSpace(reqhf.Value("Upgrade")), "websocket")
+}
+
+// isOriginAllowed reports whether a WebSocket handshake from origin may
+// reach the backend. The tunnel owner's list is stored lowercased.
+func isOriginAllowed(origin string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	for _, o := range allowed {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRedirectToTLS reports whether a plain HTTP request must be sent to
+// https. Custom domains are exempt: the node only holds certificates for its
+// own domains, so an https redirect would land on a certificate error.
+func (hh *httpHandler) shouldRedirectToTLS(isTLS bool, reqhf header.RequestHeader) bool {
+	if isTLS || !hh.config.TLSRedirect() {
+		return false
+	}
+	_, custom := hh.customDomainHost(reqhf)
+	return !custom
 }
 
 func (hh *httpHandler) handlePingRequest(slug string, conn net.Conn) bool {
@@ -154,7 +479,7 @@ func (hh *httpHandler) handlePingRequest(slug string, conn net.Conn) bool {
 		return false
 	}
 
-	_, err := conn.Write([]byte(
+	response := []byte(
 		"HTTP/1.1 200 OK\r\n" +
 			"Content-Length: 0\r\n" +
 			"Connection: close\r\n" +
@@ -162,7 +487,8 @@ func (hh *httpHandler) handlePingRequest(slug string, conn net.Conn) bool {
 			"Access-Control-Allow-Methods: GET, HEAD, OPTIONS\r\n" +
 			"Access-Control-Allow-Headers: *\r\n" +
 			"\r\n",
-	))
+	)
+	err := writeFull(conn, response)
 	if err != nil {
 		log.Println("Failed to write 200 OK:", err)
 		return true
@@ -170,12 +496,112 @@ func (hh *httpHandler) handlePingRequest(slug string, conn net.Conn) bool {
 	return true
 }
 
-func (hh *httpHandler) forwardRequest(hw stream.HTTP, initialRequest header.RequestHeader, sshSession registry.Session) {
+func (hh *httpHandler) handleWhoamiRequest(reqhf header.RequestHeader, slug string, conn net.Conn) bool {
+	if !hh.config.WhoamiEnabled() {
+		return false
+	}
+	if path, _, _ := strings.Cut(reqhf.Path(), "?"); path != whoamiPath {
+		return false
+	}
+
+	ip := clientIP(conn.RemoteAddr())
+	body, err := json.Marshal(struct {
+		IP   string `json:"ip"`
+		Slug string `json:"slug"`
+	}{IP: ip, Slug: slug})
+	if err != nil {
+		log.Println("Failed to encode whoami response:", err)
+		return true
+	}
+
+	response := []byte(fmt.Sprintf(
+		"HTTP/1.1 200 OK\r\n"+
+			"Content-Type: application/json\r\n"+
+			"Content-Length: %d\r\n"+
+			"Cache-Control: no-store\r\n"+
+			"Connection: close\r\n"+
+			"\r\n", len(body)))
+	if err = writeFull(conn, append(response, body...)); err != nil {
+		log.Println("Failed to write whoami response:", err)
+	}
+	return true
+}
+
+// isNodeHost reports whether a request is addressed to the node itself, by
+// DOMAIN or the FrontendURL host, rather than to one of its tunnels.
+func (hh *httpHandler) isNodeHost(reqhf header.RequestHeader) bool {
+	host := requestHost(reqhf)
+	if host == strings.ToLower(hh.config.Domain()) {
+		return true
+	}
+	frontend, err := url.Parse(hh.config.FrontendURL())
+	return err == nil && frontend.Hostname() != "" && strings.EqualFold(frontend.Hostname(), host)
+}
+
+func (hh *httpHandler) handleMetadataRequest(reqhf header.RequestHeader, conn net.Conn) bool {
+	token := hh.config.MetadataToken()
+	if token == "" {
+		return false
+	}
+	path, query, _ := strings.Cut(reqhf.Path(), "?")
+	if path != metadataPath || !hh.isNodeHost(reqhf) {
+		return false
+	}
+
+	provided, ok := strings.CutPrefix(reqhf.Value("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		_ = writeFull(conn, []byte("HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Bearer\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+		return true
+	}
+
+	values, _ := url.ParseQuery(query)
+	sshSession, err := hh.sessionRegistry.Get(types.SessionKey{
+		Id:   values.Get("slug"),
+		Type: types.TunnelTypeHTTP,
+	})
+	if err != nil {
+		_ = writeFull(conn, []byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+		return true
+	}
+
+	body, err := json.Marshal(struct {
+		*types.Detail
+		BytesIn  uint64 `json:"bytes_in"`
+		BytesOut uint64 `json:"bytes_out"`
+	}{
+		Detail:   sshSession.Detail(),
+		BytesIn:  sshSession.Forwarder().BytesIn(),
+		BytesOut: sshSession.Forwarder().BytesOut(),
+	})
+	if err != nil {
+		log.Println("Failed to encode metadata response:", err)
+		return true
+	}
+
+	response := []byte(fmt.Sprintf(
+		"HTTP/1.1 200 OK\r\n"+
+			"Content-Type: application/json\r\n"+
+			"Content-Length: %d\r\n"+
+			"Cache-Control: no-store\r\n"+
+			"Connection: close\r\n"+
+			"\r\n", len(body)))
+	if err = writeFull(conn, append(response, body...)); err != nil {
+		log.Println("Failed to write metadata response:", err)
+	}
+	return true
+}
+
+func (hh *httpHandler) forwardRequest(hw stream.HTTP, initialRequest header.RequestHeader, sshSession registry.Session, slots *requestSlots, isTLS bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	channel, reqs, err := sshSession.Forwarder().OpenForwardedChannel(ctx, hw.RemoteAddr())
 	if err != nil {
 		log.Printf("Failed to open forwarded-tcpip channel: %v", err)
+		if errors.Is(err, forwarder.ErrChannelLimit) || errors.Is(err, forwarder.ErrOpenQueueTimeout) {
+			_ = hh.serviceUnavailable(hw)
+			return
+		}
+		_ = hh.badGateway(hw)
 		return
 	}
 
@@ -188,21 +614,120 @@ func (hh *httpHandler) forwardRequest(hw stream.HTTP, initialRequest header.Requ
 		}
 	}()
 
-	hh.setupMiddlewares(hw)
+	hh.setupMiddlewares(hw, sshSession.Forwarder().HostHeader())
+	if sshSession.Forwarder().RewriteLocation() {
+		hw.UseResponseMiddleware(middleware.NewLocationRewrite(requestScheme(isTLS), initialRequest.Value("Host")))
+	}
+	if contentType := sshSession.Forwarder().DefaultContentType(); contentType != "" {
+		hw.UseResponseMiddleware(middleware.NewDefaultContentType(contentType))
+	}
 
 	if err = hh.sendInitialRequest(hw, initialRequest, channel); err != nil {
 		log.Printf("Failed to forward initial request: %v", err)
 		return
 	}
-	sshSession.Forwarder().HandleConnection(hw, channel)
+	// Handler already vetted the first request; later ones on this
+	// connection go through the same checks as they are parsed.
+	hw.UseRequestMiddleware(&requestPolicy{handler: hh, forwarder: sshSession.Forwarder()})
+	hw.UseRequestMiddleware(slots)
+	hw.UseResponseMiddleware(slots)
+
+	guard := &gatewayGuard{HTTP: hw, handler: hh}
+	if limit := sshSession.Forwarder().MirrorBodyLimit(); limit > 0 {
+		guard.mirror = newRequestMirror(limit, hw.RemoteAddr(), sshSession.Interaction().SendDiagnostic)
+		guard.mirror.begin(initialRequest, 0)
+		hw.UseRequestMiddleware(guard.mirror)
+		defer guard.mirror.flush()
+	}
+	sshSession.Forwarder().HandleConnection(guard, channel)
+}
+
+// gatewayGuard answers the client itself when the backend fails or a
+// later request on the connection is refused. Responses reach the stream
+// from both copy directions, so writes to it are serialised.
+type gatewayGuard struct {
+	stream.HTTP
+	handler *httpHandler
+	mu      sync.Mutex
+	wrote   atomic.Bool
+	mirror  *requestMirror
+}
+
+func (g *gatewayGuard) Read(p []byte) (int, error) {
+	n, err := g.HTTP.Read(p)
+	if g.refuse(err) {
+		// The refusal closes the connection, so end the request stream
+		// cleanly rather than reporting a copy error.
+		return 0, io.EOF
+	}
+	if g.mirror != nil && n > 0 {
+		g.mirror.capture(p[:n])
+	}
+	return n, err
+}
+
+func (g *gatewayGuard) refuse(err error) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !respondToRejection(g.HTTP, err) {
+		return false
+	}
+	g.wrote.Store(true)
+	_ = g.HTTP.Close()
+	return true
+}
+
+func (g *gatewayGuard) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(p) > 0 {
+		g.wrote.Store(true)
+	}
+	n, err := g.HTTP.Write(p)
+	if errors.Is(err, stream.ErrResponseHeaderTooLarge) {
+		log.Printf("Backend response header exceeds %d bytes", g.handler.config.MaxResponseHeaderSize())
+		if gwErr := g.handler.badGateway(g.HTTP); gwErr != nil {
+			log.Printf("Failed to write bad gateway response: %v", gwErr)
+		}
+	}
+	return n, err
+}
+
+func (g *gatewayGuard) CloseWrite() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.wrote.Load() {
+		if err := g.handler.badGateway(g.HTTP); err != nil {
+			log.Printf("Failed to write bad gateway response: %v", err)
+		}
+	}
+	// The backend has hung up, so nothing else can be answered on this
+	// connection. Closing it outright ends close-delimited bodies and stops
+	// the request copy from waiting on a client that never closes.
+	return g.HTTP.Close()
 }
 
-func (hh *httpHandler) setupMiddlewares(hw stream.HTTP) {
+func (hh *httpHandler) setupMiddlewares(hw stream.HTTP, hostHeader string) {
 	fingerprintMiddleware := middleware.NewTunnelFingerprint()
 	forwardedForMiddleware := middleware.NewForwardedFor(hw.RemoteAddr())
 
 	hw.UseResponseMiddleware(fingerprintMiddleware)
 	hw.UseRequestMiddleware(forwardedForMiddleware)
+
+	if hostHeader != "" {
+		hw.UseRequestMiddleware(middleware.NewHostRewrite(hostHeader))
+	}
+
+	if hh.config.ServedByHeader() {
+		hw.UseResponseMiddleware(middleware.NewServedBy(hh.config.NodeID()))
+	}
+}
+
+func requestScheme(isTLS bool) string {
+	if isTLS {
+		return "https"
+	}
+	return "http"
 }
 
 func (hh *httpHandler) sendInitialRequest(hw stream.HTTP, initialRequest header.RequestHeader, channel ssh.Channel) error {
@@ -1,15 +1,25 @@
 package transport
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
+	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+	"tunnel_pls/internal/http/header"
 	"tunnel_pls/internal/registry"
 	"tunnel_pls/internal/session/forwarder"
 	"tunnel_pls/internal/session/interaction"
@@ -21,6 +31,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockSessionRegistry struct {
@@ -62,6 +73,11 @@ func (m *MockSessionRegistry) GetAllSessionFromUser(user string) []registry.Sess
 	return args.Get(0).([]registry.Session)
 }
 
+func (m *MockSessionRegistry) Sessions() map[registry.Key]registry.Session {
+	args := m.Called()
+	return args.Get(0).(map[registry.Key]registry.Session)
+}
+
 func (m *MockSessionRegistry) Slug() slug.Slug {
 	args := m.Called()
 	return args.Get(0).(slug.Slug)
@@ -119,6 +135,15 @@ func (m *MockForwarder) HandleConnection(dst io.ReadWriter, src ssh.Channel) {
 	m.Called(dst, src)
 }
 
+func (m *MockForwarder) ForwardDatagram(dst ssh.Channel, p []byte) error {
+	args := m.Called(dst, p)
+	return args.Error(0)
+}
+
+func (m *MockForwarder) HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel) {
+	m.Called(dst, peer, src)
+}
+
 func (m *MockForwarder) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -142,6 +167,98 @@ func (m *MockForwarder) SetForwardedPort(port uint16) {
 	m.Called(port)
 }
 
+func (m *MockForwarder) SetAllowedMethods(methods []string) {
+	m.Called(methods)
+}
+
+func (m *MockForwarder) AllowedMethods() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetAllowedOrigins(origins []string) {
+	m.Called(origins)
+}
+
+func (m *MockForwarder) AllowedOrigins() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) SetHostHeader(host string) {
+	m.Called(host)
+}
+
+func (m *MockForwarder) HostHeader() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetRewriteLocation(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) RewriteLocation() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) SetDefaultContentType(contentType string) {
+	m.Called(contentType)
+}
+
+func (m *MockForwarder) DefaultContentType() string {
+	return m.Called().String(0)
+}
+
+func (m *MockForwarder) SetMirrorBodyLimit(limit int) {
+	m.Called(limit)
+}
+
+func (m *MockForwarder) MirrorBodyLimit() int {
+	return m.Called().Int(0)
+}
+
+func (m *MockForwarder) SetBasicAuth(username, password string) error {
+	return m.Called(username, password).Error(0)
+}
+
+func (m *MockForwarder) BasicAuthEnabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) CheckBasicAuth(username, password string) bool {
+	return m.Called(username, password).Bool(0)
+}
+
+func (m *MockForwarder) SetEnabled(enabled bool) {
+	m.Called(enabled)
+}
+
+func (m *MockForwarder) Enabled() bool {
+	return m.Called().Bool(0)
+}
+
+func (m *MockForwarder) RecentErrors() []string {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]string)
+}
+
+func (m *MockForwarder) BytesIn() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
+func (m *MockForwarder) BytesOut() uint64 {
+	return m.Called().Get(0).(uint64)
+}
+
 func (m *MockForwarder) SetListener(listener net.Listener) {
 	m.Called(listener)
 }
@@ -151,6 +268,10 @@ func (m *MockForwarder) Listener() net.Listener {
 	return args.Get(0).(net.Listener)
 }
 
+func (m *MockForwarder) SetPacketConn(conn net.PacketConn) {
+	m.Called(conn)
+}
+
 func (m *MockForwarder) OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error) {
 	args := m.Called(ctx, origin)
 	if args.Get(0) == nil {
@@ -223,6 +344,7 @@ func TestNewHTTPHandler(t *testing.T) {
 	msr := new(MockSessionRegistry)
 	mockConfig := &MockConfig{}
 	mockConfig.On("Domain").Return("domain")
+	mockConfig.On("NodeRegion").Return("").Maybe()
 	mockConfig.On("FrontendURL").Return("https://domain")
 	mockConfig.On("TLSRedirect").Return(false)
 	hh := newHTTPHandler(mockConfig, msr)
@@ -250,6 +372,15 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 			},
 		},
+		{
+			name:        "uri too long",
+			isTLS:       false,
+			redirectTLS: false,
+			request:     []byte("GET /" + strings.Repeat("a", 3000) + " HTTP/1.1\r\nHost: test.domain\r\n\r\n"),
+			expected:    []byte("HTTP/1.1 414 URI Too Long\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"),
+			setupMocks: func(msr *MockSessionRegistry) {
+			},
+		},
 		{
 			name:        "bad request - missing host",
 			isTLS:       false,
@@ -337,10 +468,17 @@ func TestHandler(t *testing.T) {
 			isTLS:       true,
 			redirectTLS: false,
 			request:     []byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"),
-			expected:    []byte(""),
+			expected:    []byte("HTTP/1.1 502 Bad Gateway\r\n"),
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 
 				msr.On("Get", types.SessionKey{
 					Id:   "test",
@@ -362,6 +500,13 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 				mockSSHChannel := new(MockSSHChannel)
 
 				msr.On("Get", types.SessionKey{
@@ -394,6 +539,13 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 				mockSSHChannel := new(MockSSHChannel)
 
 				msr.On("Get", types.SessionKey{
@@ -506,6 +658,13 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 				mockSSHChannel := new(MockSSHChannel)
 
 				msr.On("Get", mock.Anything).Return(mockSession, nil)
@@ -540,6 +699,13 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 				mockSSHChannel := new(MockSSHChannel)
 
 				msr.On("Get", mock.MatchedBy(func(k types.SessionKey) bool {
@@ -570,6 +736,13 @@ func TestHandler(t *testing.T) {
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 				mockSSHChannel := new(MockSSHChannel)
 
 				msr.On("Get", mock.Anything).Return(mockSession, nil)
@@ -593,10 +766,17 @@ func TestHandler(t *testing.T) {
 			isTLS:       true,
 			redirectTLS: false,
 			request:     []byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"),
-			expected:    []byte(""),
+			expected:    []byte("HTTP/1.1 502 Bad Gateway\r\n"),
 			setupMocks: func(msr *MockSessionRegistry) {
 				mockSession := new(MockSession)
 				mockForwarder := new(MockForwarder)
+				mockForwarder.On("AllowedMethods").Return(nil)
+				mockForwarder.On("Enabled").Return(true).Maybe()
+				mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+				mockForwarder.On("HostHeader").Return("").Maybe()
+				mockForwarder.On("RewriteLocation").Return(false).Maybe()
+				mockForwarder.On("DefaultContentType").Return("").Maybe()
+				mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 
 				msr.On("Get", mock.Anything).Return(mockSession, nil)
 				mockSession.On("Forwarder").Return(mockForwarder)
@@ -617,9 +797,25 @@ func TestHandler(t *testing.T) {
 			mockConfig := &MockConfig{}
 			port := "0"
 			mockConfig.On("Domain").Return("example.com")
+			mockConfig.On("NodeRegion").Return("").Maybe()
 			mockConfig.On("FrontendURL").Return("https://example.com")
 			mockConfig.On("HTTPPort").Return(port)
 			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("InvalidHostAction").Return(types.HostActionREJECT).Maybe()
+			mockConfig.On("WelcomeURL").Return("").Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
 			mockConfig.On("TLSRedirect").Return(true)
 			hh := &httpHandler{
 				sessionRegistry: mockSessionRegistry,
@@ -669,7 +865,7 @@ func TestHandler(t *testing.T) {
 							break
 						}
 						res = append(res, buf[:n]...)
-						if len(tt.expected) > 0 && len(res) >= len(tt.expected) {
+						if len(tt.expected) > 0 && len(res) >= len(tt.expected) && !bytes.HasPrefix(tt.expected, []byte("HTTP/1.1 502")) {
 							break
 						}
 					}
@@ -702,6 +898,11 @@ func TestHandler(t *testing.T) {
 					assert.Contains(t, resStr, "Content-Length: 5\r\n")
 					assert.Contains(t, resStr, "Server: Tunnel Please\r\n")
 					assert.True(t, strings.HasSuffix(resStr, "\r\n\r\nhello"))
+				} else if strings.HasPrefix(string(tt.expected), "HTTP/1.1 502") {
+					resStr := string(response)
+					assert.True(t, strings.HasPrefix(resStr, string(tt.expected)))
+					assert.Contains(t, resStr, "Content-Type: text/html; charset=utf-8\r\n")
+					assert.Contains(t, resStr, "<h1>502 Bad Gateway</h1>")
 				} else {
 					assert.Equal(t, string(tt.expected), string(response))
 				}
@@ -728,9 +929,23 @@ func TestHandlerForwardsPostBody(t *testing.T) {
 	mockSessionRegistry := new(MockSessionRegistry)
 	mockConfig := &MockConfig{}
 	mockConfig.On("Domain").Return("example.com")
+	mockConfig.On("NodeRegion").Return("").Maybe()
 	mockConfig.On("FrontendURL").Return("https://example.com")
 	mockConfig.On("HTTPPort").Return("0")
 	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
 	mockConfig.On("TLSRedirect").Return(true)
 	hh := &httpHandler{
 		sessionRegistry: mockSessionRegistry,
@@ -739,6 +954,13 @@ func TestHandlerForwardsPostBody(t *testing.T) {
 
 	mockSession := new(MockSession)
 	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
 	mockSSHChannel := new(MockSSHChannel)
 
 	mockSessionRegistry.On("Get", types.SessionKey{
@@ -834,3 +1056,2845 @@ func TestHandlerForwardsPostBody(t *testing.T) {
 
 	mockSessionRegistry.AssertExpectations(t)
 }
+
+func TestHandlerMethodAllowlist(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       string
+		wantForwarded bool
+		wantResponse  string
+	}{
+		{
+			name:          "disallowed method is rejected",
+			request:       "POST / HTTP/1.1\r\nHost: test.domain\r\nContent-Length: 0\r\n\r\n",
+			wantForwarded: false,
+			wantResponse:  "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:          "allowed method is forwarded",
+			request:       "GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			wantForwarded: true,
+			wantResponse:  "HTTP/1.1 200 OK\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return([]string{"GET", "HEAD"})
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil).Maybe()
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			}).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte(tt.request))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			if tt.wantForwarded {
+				assert.True(t, strings.HasPrefix(string(response), tt.wantResponse))
+				mockForwarder.AssertCalled(t, "HandleConnection", mock.Anything, mockSSHChannel)
+			} else {
+				assert.Equal(t, tt.wantResponse, string(response))
+				mockForwarder.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandlerWebSocketOriginAllowlist(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       string
+		wantForwarded bool
+		wantResponse  string
+	}{
+		{
+			name:          "disallowed origin upgrade is rejected",
+			request:       "GET /ws HTTP/1.1\r\nHost: test.domain\r\nUpgrade: websocket\r\nOrigin: https://evil.example\r\n\r\n",
+			wantForwarded: false,
+			wantResponse:  "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:          "upgrade without origin is rejected",
+			request:       "GET /ws HTTP/1.1\r\nHost: test.domain\r\nUpgrade: websocket\r\n\r\n",
+			wantForwarded: false,
+			wantResponse:  "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:          "allowed origin upgrade is forwarded",
+			request:       "GET /ws HTTP/1.1\r\nHost: test.domain\r\nUpgrade: WebSocket\r\nOrigin: https://App.Example.com\r\n\r\n",
+			wantForwarded: true,
+			wantResponse:  "HTTP/1.1 200 OK\r\n",
+		},
+		{
+			name:          "plain request ignores the origin list",
+			request:       "GET / HTTP/1.1\r\nHost: test.domain\r\nOrigin: https://evil.example\r\n\r\n",
+			wantForwarded: true,
+			wantResponse:  "HTTP/1.1 200 OK\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("AllowedOrigins").Return([]string{"https://app.example.com"}).Maybe()
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil).Maybe()
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			}).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte(tt.request))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			if tt.wantForwarded {
+				assert.True(t, strings.HasPrefix(string(response), tt.wantResponse))
+				mockForwarder.AssertCalled(t, "HandleConnection", mock.Anything, mockSSHChannel)
+			} else {
+				assert.Equal(t, tt.wantResponse, string(response))
+				mockForwarder.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandlerCustomDomain(t *testing.T) {
+	tests := []struct {
+		name         string
+		isTLS        bool
+		request      string
+		wantResponse string
+		wantPrefix   bool
+	}{
+		{
+			name:         "custom host is routed to mapped slug",
+			isTLS:        true,
+			request:      "GET / HTTP/1.1\r\nHost: App.Customer.com:443\r\n\r\n",
+			wantResponse: "HTTP/1.1 200 OK\r\n",
+			wantPrefix:   true,
+		},
+		{
+			name:         "custom host is served over http despite redirect",
+			isTLS:        false,
+			request:      "GET / HTTP/1.1\r\nHost: app.customer.com\r\n\r\n",
+			wantResponse: "HTTP/1.1 200 OK\r\n",
+			wantPrefix:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("Domain").Return("example.com")
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{"app.customer.com": "myslug"})
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(true)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "myslug",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil).Maybe()
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil).Maybe()
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			}).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, tt.isTLS)
+
+			go func() {
+				_, _ = clientConn.Write([]byte(tt.request))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			if tt.wantPrefix {
+				assert.True(t, strings.HasPrefix(string(response), tt.wantResponse))
+				mockSessionRegistry.AssertExpectations(t)
+				mockForwarder.AssertCalled(t, "HandleConnection", mock.Anything, mockSSHChannel)
+			} else {
+				assert.Equal(t, tt.wantResponse, string(response))
+				mockSessionRegistry.AssertNotCalled(t, "Get", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandlerMultipleDomains(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+	}{
+		{name: "primary domain", host: "myslug.a.com"},
+		{name: "secondary domain", host: "MySlug.B.net:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("Domain").Return("a.com")
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("Domains").Return([]string{"a.com", "b.net"})
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(true)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "myslug",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: " + tt.host + "\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			assert.True(t, strings.HasPrefix(string(response), "HTTP/1.1 200 OK\r\n"))
+			mockSessionRegistry.AssertExpectations(t)
+			mockForwarder.AssertCalled(t, "HandleConnection", mock.Anything, mockSSHChannel)
+		})
+	}
+}
+
+func TestHandlerRegionRedirect(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("Domain").Return("example.com")
+	mockConfig.On("NodeRegion").Return("us-east")
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("Domains").Return([]string{"example.com"})
+	mockConfig.On("TLSRedirect").Return(true)
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, false)
+
+	go func() {
+		_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: myapp.us-east.example.com\r\n\r\n"))
+	}()
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, _ := io.ReadAll(clientConn)
+
+	assert.Equal(t, "HTTP/1.1 301 Moved Permanently\r\nLocation: https://myapp.us-east.example.com/\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", string(response))
+	mockSessionRegistry.AssertNotCalled(t, "Get", mock.Anything)
+	mockConfig.AssertExpectations(t)
+}
+
+func TestExtractSlugRegion(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		expected  string
+		expectErr bool
+	}{
+		{name: "region host", host: "myapp.us-east.example.com", expected: "myapp"},
+		{name: "region host with port and case", host: "MyApp.US-East.example.com:443", expected: "myapp"},
+		{name: "secondary domain has no region", host: "myapp.b.net", expected: "myapp"},
+		{name: "other region", host: "myapp.eu-west.example.com", expectErr: true},
+		{name: "primary domain without region", host: "myapp.example.com", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConfig := &MockConfig{}
+			mockConfig.On("Domain").Return("example.com")
+			mockConfig.On("NodeRegion").Return("us-east")
+			mockConfig.On("Domains").Return([]string{"example.com", "b.net"})
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			hh := &httpHandler{config: mockConfig}
+
+			reqhf, err := header.NewRequest([]byte("GET / HTTP/1.1\r\nHost: " + tt.host + "\r\n\r\n"))
+			require.NoError(t, err)
+
+			slug, err := hh.extractSlug(reqhf)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, slug)
+		})
+	}
+}
+
+func TestHandlerRegionLooksUpSlugKey(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("Domain").Return("example.com")
+	mockConfig.On("NodeRegion").Return("us-east")
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("Domains").Return([]string{"example.com"})
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("WelcomeURL").Return("").Maybe()
+	mockConfig.On("FrontendURL").Return("https://example.com").Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "myapp",
+		Type: types.TunnelTypeHTTP,
+	}).Return(nil, errors.New("not found"))
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+	go func() {
+		_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: myapp.us-east.example.com\r\n\r\n"))
+	}()
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.ReadAll(clientConn)
+
+	mockSessionRegistry.AssertExpectations(t)
+}
+
+func TestHandlerServedByHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled adds node id", enabled: true},
+		{name: "disabled omits header", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(tt.enabled)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("NodeID").Return("node-1")
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+			mockSSHChannel.On("Close").Return(nil)
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, "HTTP/1.1 200 OK\r\n"))
+			if tt.enabled {
+				assert.Contains(t, resStr, "X-Served-By: node-1\r\n")
+			} else {
+				assert.NotContains(t, resStr, "X-Served-By")
+			}
+		})
+	}
+}
+
+func TestHandlerWhoami(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		path        string
+		wantWhoami  bool
+		wantForward bool
+	}{
+		{name: "enabled returns client ip and slug", enabled: true, path: "/__tunnel/whoami", wantWhoami: true},
+		{name: "enabled ignores query string", enabled: true, path: "/__tunnel/whoami?verbose=1", wantWhoami: true},
+		{name: "enabled forwards other paths", enabled: true, path: "/whoami", wantForward: true},
+		{name: "disabled forwards reserved path", enabled: false, path: "/__tunnel/whoami", wantForward: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false).Maybe()
+			mockConfig.On("WhoamiEnabled").Return(tt.enabled)
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil).Maybe()
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "myslug",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil).Maybe()
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			}).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "203.0.113.7:40000")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET " + tt.path + " HTTP/1.1\r\nHost: myslug.example.com\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, "HTTP/1.1 200 OK\r\n"))
+			if tt.wantWhoami {
+				assert.Contains(t, resStr, "Content-Type: application/json\r\n")
+				_, body, ok := strings.Cut(resStr, "\r\n\r\n")
+				assert.True(t, ok)
+				var got map[string]string
+				assert.NoError(t, json.Unmarshal([]byte(body), &got))
+				assert.Equal(t, map[string]string{"ip": "203.0.113.7", "slug": "myslug"}, got)
+				mockForwarder.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+			}
+			if tt.wantForward {
+				assert.True(t, strings.HasSuffix(resStr, "ok"))
+				mockForwarder.AssertCalled(t, "HandleConnection", mock.Anything, mockSSHChannel)
+			}
+		})
+	}
+}
+
+func TestHandlerMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       string
+		query      string
+		wantStatus string
+		wantBody   bool
+	}{
+		{name: "registered slug", auth: "Bearer secret", query: "?slug=myslug", wantStatus: "HTTP/1.1 200 OK\r\n", wantBody: true},
+		{name: "unknown slug", auth: "Bearer secret", query: "?slug=missing", wantStatus: "HTTP/1.1 404 Not Found\r\n"},
+		{name: "wrong token", auth: "Bearer nope", query: "?slug=myslug", wantStatus: "HTTP/1.1 401 Unauthorized\r\n"},
+		{name: "missing token", query: "?slug=myslug", wantStatus: "HTTP/1.1 401 Unauthorized\r\n"},
+	}
+
+	startedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("secret")
+			mockConfig.On("Domain").Return("example.com")
+			mockConfig.On("FrontendURL").Return("https://node.example.com")
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("CustomDomains").Return(map[string]string{}).Maybe()
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("TLSRedirect").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("BytesIn").Return(uint64(120)).Maybe()
+			mockForwarder.On("BytesOut").Return(uint64(4096)).Maybe()
+			mockSession.On("Forwarder").Return(mockForwarder).Maybe()
+			mockSession.On("Detail").Return(&types.Detail{
+				ForwardingType: "HTTP",
+				Slug:           "myslug",
+				UserID:         "alice",
+				Active:         true,
+				StartedAt:      startedAt,
+			}).Maybe()
+			mockSessionRegistry.On("Get", types.SessionKey{Id: "myslug", Type: types.TunnelTypeHTTP}).Return(mockSession, nil).Maybe()
+			mockSessionRegistry.On("Get", types.SessionKey{Id: "missing", Type: types.TunnelTypeHTTP}).Return((registry.Session)(nil), registry.ErrSessionNotFound).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "203.0.113.7:40000")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			request := "GET /__tunnel/metadata" + tt.query + " HTTP/1.1\r\nHost: node.example.com\r\n"
+			if tt.auth != "" {
+				request += "Authorization: " + tt.auth + "\r\n"
+			}
+			go func() {
+				_, _ = clientConn.Write([]byte(request + "\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, tt.wantStatus), resStr)
+			if !tt.wantBody {
+				return
+			}
+			assert.Contains(t, resStr, "Content-Type: application/json\r\n")
+			_, body, ok := strings.Cut(resStr, "\r\n\r\n")
+			assert.True(t, ok)
+			var got map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(body), &got))
+			assert.Equal(t, "HTTP", got["forwarding_type"])
+			assert.Equal(t, "myslug", got["slug"])
+			assert.Equal(t, startedAt.Format(time.RFC3339), got["started_at"])
+			assert.Equal(t, float64(120), got["bytes_in"])
+			assert.Equal(t, float64(4096), got["bytes_out"])
+		})
+	}
+}
+
+func TestHandlerMetadataTunnelHost(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("secret")
+	mockConfig.On("Domain").Return("example.com")
+	mockConfig.On("FrontendURL").Return("https://node.example.com")
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{"example.com"}).Maybe()
+	mockConfig.On("TLSRedirect").Return(false).Maybe()
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("WelcomeURL").Return("").Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "myslug",
+		Type: types.TunnelTypeHTTP,
+	}).Return(nil, errors.New("not found"))
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+	go func() {
+		_, _ = clientConn.Write([]byte("GET /__tunnel/metadata?slug=myslug HTTP/1.1\r\nHost: myslug.example.com\r\nAuthorization: Bearer secret\r\n\r\n"))
+	}()
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, _ := io.ReadAll(clientConn)
+
+	assert.NotContains(t, string(response), "application/json")
+	mockSessionRegistry.AssertExpectations(t)
+}
+
+func TestHandlerMaxRequestsPerIP(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(2)
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false).Maybe()
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true)
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("")
+	mockForwarder.On("RewriteLocation").Return(false)
+	mockForwarder.On("DefaultContentType").Return("")
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockSSHChannel := new(MockSSHChannel)
+
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+	mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+	mockSSHChannel.On("Close").Return(nil)
+	mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+		started <- struct{}{}
+		<-release
+		w := args.Get(0).(io.ReadWriter)
+		_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	})
+
+	send := func(ip string) net.Conn {
+		serverConn, clientConn := net.Pipe()
+		remoteAddr, _ := net.ResolveTCPAddr("tcp", ip+":40000")
+		go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+		go func() {
+			_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+		}()
+		return clientConn
+	}
+	read := func(conn net.Conn) string {
+		defer func() {
+			_ = conn.Close()
+		}()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		response, _ := io.ReadAll(conn)
+		return string(response)
+	}
+
+	held := []net.Conn{send("203.0.113.7"), send("203.0.113.7")}
+	for range held {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("forwarded request did not start")
+		}
+	}
+
+	assert.True(t, strings.HasPrefix(read(send("203.0.113.7")), "HTTP/1.1 429 Too Many Requests\r\n"))
+
+	other := send("198.51.100.9")
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request from another IP was not forwarded")
+	}
+
+	close(release)
+	for _, conn := range append(held, other) {
+		assert.True(t, strings.HasPrefix(read(conn), "HTTP/1.1 200 OK\r\n"))
+	}
+
+	assert.True(t, strings.HasPrefix(read(send("203.0.113.7")), "HTTP/1.1 200 OK\r\n"))
+}
+
+func TestHandlerMaxRequestsPerIPIdleKeepAlive(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(1)
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("TLSRedirect").Return(false).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false).Maybe()
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true)
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("")
+	mockForwarder.On("RewriteLocation").Return(false)
+	mockForwarder.On("DefaultContentType").Return("")
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockSSHChannel := new(MockSSHChannel)
+
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	release := make(chan struct{})
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+	mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+	mockSSHChannel.On("Close").Return(nil)
+	mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+		w := args.Get(0).(io.ReadWriter)
+		_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+		// Keep the connection open and idle after the response.
+		<-release
+	})
+	defer close(release)
+
+	send := func() *http.Response {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() {
+			_ = clientConn.Close()
+		})
+		remoteAddr, _ := net.ResolveTCPAddr("tcp", "203.0.113.7:40000")
+		go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+		go func() {
+			_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+		}()
+		_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(clientConn), nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, send().StatusCode)
+	assert.Equal(t, http.StatusOK, send().StatusCode, "an idle keep-alive connection must not hold a request slot")
+}
+
+func TestHandlerBasicAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       string
+		wantStatus string
+	}{
+		{name: "missing credentials", wantStatus: "HTTP/1.1 401 Unauthorized\r\n"},
+		{name: "wrong credentials", auth: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:guess")), wantStatus: "HTTP/1.1 401 Unauthorized\r\n"},
+		{name: "malformed header", auth: "Basic !!!", wantStatus: "HTTP/1.1 401 Unauthorized\r\n"},
+		{name: "valid credentials", auth: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")), wantStatus: "HTTP/1.1 200 OK\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false).Maybe()
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("Enabled").Return(true)
+			mockForwarder.On("BasicAuthEnabled").Return(true)
+			mockForwarder.On("CheckBasicAuth", "alice", "secret").Return(true).Maybe()
+			mockForwarder.On("CheckBasicAuth", mock.Anything, mock.Anything).Return(false).Maybe()
+			mockForwarder.On("AllowedMethods").Return(nil).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil).Maybe()
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil).Maybe()
+			mockSSHChannel.On("Close").Return(nil).Maybe()
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			}).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			request := "GET / HTTP/1.1\r\nHost: test.domain\r\n"
+			if tt.auth != "" {
+				request += "Authorization: " + tt.auth + "\r\n"
+			}
+			go func() {
+				_, _ = clientConn.Write([]byte(request + "\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, tt.wantStatus), resStr)
+			if strings.Contains(tt.wantStatus, "401") {
+				assert.Contains(t, resStr, "WWW-Authenticate: Basic realm=\"tunnel\"")
+				mockForwarder.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandlerHeaderReadTimeout(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(200 * time.Millisecond)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	handlerDone := make(chan struct{})
+	go func() {
+		defer close(handlerDone)
+		hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, false)
+	}()
+
+	stopTrickle := make(chan struct{})
+	defer close(stopTrickle)
+	go func() {
+		request := []byte("GET / HTTP/1.1\r\nHost: test.domain\r\nX-Slow: " + strings.Repeat("a", 1000))
+		for _, b := range request {
+			select {
+			case <-stopTrickle:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			if _, err := clientConn.Write([]byte{b}); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, _ := io.ReadAll(clientConn)
+
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", string(response))
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	select {
+	case <-handlerDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not close the connection")
+	}
+	mockSessionRegistry.AssertNotCalled(t, "Get", mock.Anything)
+}
+
+func TestHandlerHostHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		hostHeader string
+		wantHost   string
+	}{
+		{name: "preserves public host by default", hostHeader: "", wantHost: "Host: test.domain\r\n"},
+		{name: "rewrites to backend host", hostHeader: "backend.local:3000", wantHost: "Host: backend.local:3000\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return(tt.hostHeader)
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+
+			var mu sync.Mutex
+			var capturedHeaders []byte
+			mockSSHChannel.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+				mu.Lock()
+				capturedHeaders = append(capturedHeaders, args.Get(0).([]byte)...)
+				mu.Unlock()
+			}).Return(0, nil)
+			mockSSHChannel.On("Close").Return(nil)
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _ = io.ReadAll(clientConn)
+
+			mu.Lock()
+			hdrStr := string(capturedHeaders)
+			mu.Unlock()
+			assert.Contains(t, hdrStr, tt.wantHost)
+			if tt.hostHeader != "" {
+				assert.NotContains(t, hdrStr, "test.domain")
+			}
+		})
+	}
+}
+
+func TestHandlerRewriteLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		rewrite      bool
+		wantLocation string
+	}{
+		{name: "rewrites localhost redirect", rewrite: true, wantLocation: "Location: https://slug.domain/x\r\n"},
+		{name: "disabled by default", rewrite: false, wantLocation: "Location: http://localhost:3000/x\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true)
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("backend.local:3000")
+			mockForwarder.On("RewriteLocation").Return(tt.rewrite)
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "slug",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+			mockSSHChannel.On("Close").Return(nil)
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 302 Found\r\nLocation: http://localhost:3000/x\r\nContent-Length: 0\r\n\r\n"))
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: slug.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+			assert.Contains(t, string(response), tt.wantLocation)
+		})
+	}
+}
+
+func TestHandlerDefaultContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		backend     string
+		want        string
+	}{
+		{
+			name:        "injects default for headerless backend",
+			contentType: "text/html; charset=utf-8",
+			backend:     "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi",
+			want:        "Content-Type: text/html; charset=utf-8\r\n",
+		},
+		{
+			name:        "preserves backend Content-Type",
+			contentType: "text/html; charset=utf-8",
+			backend:     "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}",
+			want:        "Content-Type: application/json\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0).Maybe()
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true)
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("")
+			mockForwarder.On("RewriteLocation").Return(false)
+			mockForwarder.On("DefaultContentType").Return(tt.contentType)
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "slug",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+			mockSSHChannel.On("Close").Return(nil)
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte(tt.backend))
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: slug.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+			assert.Contains(t, string(response), tt.want)
+			assert.Equal(t, 1, strings.Count(string(response), "Content-Type:"))
+		})
+	}
+}
+
+func TestIsMethodAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		allowed  []string
+		expected bool
+	}{
+		{"no allowlist", "DELETE", nil, true},
+		{"allowed", "GET", []string{"GET", "HEAD"}, true},
+		{"not allowed", "POST", []string{"GET", "HEAD"}, false},
+		{"case sensitive", "get", []string{"GET"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isMethodAllowed(tt.method, tt.allowed))
+		})
+	}
+}
+
+func TestReadHTTPHeaderRequestLineLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   string
+		lineLimit int
+		wantErr   error
+	}{
+		{
+			name:      "request line within limit",
+			request:   "GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			lineLimit: 256,
+		},
+		{
+			name:      "request line exactly at limit",
+			request:   "GET /" + strings.Repeat("a", 242) + " HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			lineLimit: 256,
+		},
+		{
+			name:      "request line over limit",
+			request:   "GET /" + strings.Repeat("a", 243) + " HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			lineLimit: 256,
+			wantErr:   errRequestLineTooLong,
+		},
+		{
+			name:      "request line larger than read buffer",
+			request:   "GET /" + strings.Repeat("a", 10000) + " HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			lineLimit: 2048,
+			wantErr:   errRequestLineTooLong,
+		},
+		{
+			name:      "long header does not count as request line",
+			request:   "GET / HTTP/1.1\r\nHost: test.domain\r\nX-Long: " + strings.Repeat("a", 1000) + "\r\n\r\n",
+			lineLimit: 256,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReaderSize(strings.NewReader(tt.request), 4096)
+			headerBuf, err := readHTTPHeader(br, 16384, tt.lineLimit)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, headerBuf)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.request, string(headerBuf))
+		})
+	}
+}
+
+type shortWriter struct {
+	chunk  int
+	err    error
+	errAt  int
+	writes int
+	buf    bytes.Buffer
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	w.writes++
+	if w.err != nil && w.writes == w.errAt {
+		return 0, w.err
+	}
+	n := min(w.chunk, len(b))
+	w.buf.Write(b[:n])
+	return n, nil
+}
+
+func TestWriteFull(t *testing.T) {
+	payload := []byte("HTTP/1.1 400 Bad Request\r\n\r\n")
+
+	tests := []struct {
+		name       string
+		writer     *shortWriter
+		wantErr    error
+		wantWrites int
+		wantOutput string
+	}{
+		{
+			name:       "single write",
+			writer:     &shortWriter{chunk: len(payload)},
+			wantWrites: 1,
+			wantOutput: string(payload),
+		},
+		{
+			name:       "short writes are retried",
+			writer:     &shortWriter{chunk: 5},
+			wantWrites: 6,
+			wantOutput: string(payload),
+		},
+		{
+			name:       "one byte at a time",
+			writer:     &shortWriter{chunk: 1},
+			wantWrites: len(payload),
+			wantOutput: string(payload),
+		},
+		{
+			name:       "error mid write",
+			writer:     &shortWriter{chunk: 5, err: fmt.Errorf("write error"), errAt: 3},
+			wantErr:    fmt.Errorf("write error"),
+			wantWrites: 3,
+			wantOutput: string(payload[:10]),
+		},
+		{
+			name:       "zero length write",
+			writer:     &shortWriter{chunk: 0},
+			wantErr:    io.ErrShortWrite,
+			wantWrites: 1,
+			wantOutput: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeFull(tt.writer, payload)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantWrites, tt.writer.writes)
+			assert.Equal(t, tt.wantOutput, tt.writer.buf.String())
+		})
+	}
+}
+
+func TestBadRequestShortWrites(t *testing.T) {
+	mc := new(MockConn)
+	var written []byte
+	mc.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		b := args.Get(0).([]byte)
+		written = append(written, b[:min(4, len(b))]...)
+	}).Return(4, nil)
+
+	hh := &httpHandler{}
+	err := hh.badRequest(mc)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 400 Bad Request\r\n\r\n", string(written))
+	mc.AssertNumberOfCalls(t, "Write", 7)
+}
+
+func TestHandlerResponseWriteBuffer(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "buffering disabled", size: 0},
+		{name: "buffering enabled", size: 8192},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(tt.size)
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(false)
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+			mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+			mockSSHChannel.On("Close").Return(nil)
+			mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+				w := args.Get(0).(io.ReadWriter)
+				_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n"))
+				for _, chunk := range []string{"he", "ll", "o-", "wo", "rl"} {
+					_, _ = w.Write([]byte(chunk))
+				}
+			})
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, "HTTP/1.1 200 OK\r\n"))
+			assert.Contains(t, resStr, "Content-Length: 10\r\n")
+			assert.True(t, strings.HasSuffix(resStr, "\r\n\r\nhello-worl"))
+			mockConfig.AssertCalled(t, "ResponseWriteBuffer")
+		})
+	}
+}
+
+func TestHandlerBadGateway(t *testing.T) {
+	tests := []struct {
+		name       string
+		customPage string
+		openErr    error
+		wantBody   string
+	}{
+		{
+			name:     "backend closes without responding",
+			wantBody: "<h1>502 Bad Gateway</h1>",
+		},
+		{
+			name:       "custom page is served",
+			customPage: "<p>backend offline</p>",
+			wantBody:   "\r\n\r\n<p>backend offline</p>",
+		},
+		{
+			name:     "backend refuses the forwarded channel",
+			openErr:  &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "connection refused"},
+			wantBody: "<h1>502 Bad Gateway</h1>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("ResponseWriteBuffer").Return(0)
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("BadGatewayPage").Return(tt.customPage)
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false).Maybe()
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSSHChannel := new(MockSSHChannel)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			if tt.openErr != nil {
+				mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return((ssh.Channel)(nil), (<-chan *ssh.Request)(nil), tt.openErr)
+			} else {
+				reqCh := make(chan *ssh.Request)
+				close(reqCh)
+				mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+				mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+				mockSSHChannel.On("Close").Return(nil)
+				mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+					w := args.Get(0).(interface{ CloseWrite() error })
+					_ = w.CloseWrite()
+				})
+			}
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			resStr := string(response)
+			assert.True(t, strings.HasPrefix(resStr, "HTTP/1.1 502 Bad Gateway\r\n"))
+			assert.Contains(t, resStr, "Content-Type: text/html; charset=utf-8\r\n")
+			assert.Contains(t, resStr, tt.wantBody)
+		})
+	}
+}
+
+func TestHandlerChannelLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "global channel limit", err: forwarder.ErrChannelLimit},
+		{name: "channel open queue timeout", err: forwarder.ErrOpenQueueTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("ResponseWriteBuffer").Return(0)
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false).Maybe()
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			mockForwarder.On("AllowedMethods").Return(nil)
+			mockForwarder.On("Enabled").Return(true)
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return((ssh.Channel)(nil), (<-chan *ssh.Request)(nil), tt.err)
+
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, _ := io.ReadAll(clientConn)
+
+			assert.True(t, strings.HasPrefix(string(response), "HTTP/1.1 503 Service Unavailable\r\n"))
+			assert.NotContains(t, string(response), "502 Bad Gateway")
+			mockConfig.AssertNotCalled(t, "BadGatewayPage")
+			mockForwarder.AssertNotCalled(t, "HandleConnection", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandlerInvalidHost(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       types.HostAction
+		wantResponse string
+		wantLog      bool
+	}{
+		{
+			name:         "reject",
+			action:       types.HostActionREJECT,
+			wantResponse: "HTTP/1.1 400 Bad Request\r\n\r\n",
+		},
+		{
+			name:         "log",
+			action:       types.HostActionLOG,
+			wantResponse: "HTTP/1.1 400 Bad Request\r\n\r\n",
+			wantLog:      true,
+		},
+		{
+			name:   "drop",
+			action: types.HostActionDROP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("InvalidHostAction").Return(tt.action)
+			hh := &httpHandler{
+				sessionRegistry: new(MockSessionRegistry),
+				config:          mockConfig,
+			}
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "203.0.113.7:40000")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, false)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: scanner\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, err := io.ReadAll(clientConn)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.wantResponse, string(response))
+			if tt.wantLog {
+				assert.Contains(t, logs.String(), "203.0.113.7:40000")
+				assert.Contains(t, logs.String(), `"scanner"`)
+			} else {
+				assert.NotContains(t, logs.String(), "Invalid Host header")
+			}
+			mockConfig.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandlerMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		host         string
+		page         string
+		wantPrefix   string
+		wantContains string
+	}{
+		{
+			name:         "tunnel request gets built-in maintenance page",
+			host:         "test.domain",
+			wantPrefix:   "HTTP/1.1 503 Service Unavailable\r\n",
+			wantContains: "Down for Maintenance",
+		},
+		{
+			name:         "tunnel request gets configured maintenance page",
+			host:         "test.domain",
+			page:         "<h1>back at noon</h1>",
+			wantPrefix:   "HTTP/1.1 503 Service Unavailable\r\n",
+			wantContains: "\r\n\r\n<h1>back at noon</h1>",
+		},
+		{
+			name:       "ping still answers",
+			host:       "ping.domain",
+			wantPrefix: "HTTP/1.1 200 OK\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(true).Maybe()
+			mockConfig.On("MaintenancePage").Return(tt.page).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("TLSRedirect").Return(false).Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: " + tt.host + "\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, err := io.ReadAll(clientConn)
+			assert.NoError(t, err)
+
+			assert.True(t, strings.HasPrefix(string(response), tt.wantPrefix), string(response))
+			assert.Contains(t, string(response), tt.wantContains)
+			mockSessionRegistry.AssertNotCalled(t, "Get", mock.Anything)
+		})
+	}
+}
+
+func TestHandlerTunnelNotFoundWelcomeURL(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("WelcomeURL").Return("https://tunnl.live/docs?from=404&lang=en")
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return((registry.Session)(nil), fmt.Errorf("session not found"))
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+	go func() {
+		_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+	}()
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(clientConn)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(string(response), "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, string(response), "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, string(response), `<a href="https://tunnl.live/docs?from=404&amp;lang=en">`)
+	assert.NotContains(t, string(response), "Location:")
+	mockConfig.AssertNotCalled(t, "FrontendURL")
+}
+
+func TestHandlerTunnelDisabled(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockForwarder.On("Enabled").Return(false).Once()
+	mockForwarder.On("Enabled").Return(true).Once()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockSSHChannel := new(MockSSHChannel)
+
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockSSHChannel, (<-chan *ssh.Request)(reqCh), nil)
+	mockSSHChannel.On("Write", mock.Anything).Return(0, nil)
+	mockSSHChannel.On("Close").Return(nil)
+	mockForwarder.On("HandleConnection", mock.Anything, mockSSHChannel).Run(func(args mock.Arguments) {
+		w := args.Get(0).(io.ReadWriter)
+		_, _ = w.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	})
+
+	roundTrip := func() string {
+		serverConn, clientConn := net.Pipe()
+		defer func() {
+			_ = clientConn.Close()
+		}()
+
+		remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+		go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+		go func() {
+			_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+		}()
+
+		_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		response, _ := io.ReadAll(clientConn)
+		return string(response)
+	}
+
+	assert.Equal(t, "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", roundTrip())
+	mockForwarder.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+
+	resStr := roundTrip()
+	assert.True(t, strings.HasPrefix(resStr, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(resStr, "\r\n\r\nok"))
+	mockForwarder.AssertExpectations(t)
+}
+
+func TestHandlerMaxURILength(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		expect string
+	}{
+		{
+			name:   "within limit",
+			path:   "/search?q=short",
+			expect: "HTTP/1.1 301 Moved Permanently\r\n",
+		},
+		{
+			name:   "query over limit",
+			path:   "/search?q=" + strings.Repeat("a", 64),
+			expect: "HTTP/1.1 414 URI Too Long\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(32)
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("CustomDomains").Return(map[string]string{}).Maybe()
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("WelcomeURL").Return("").Maybe()
+			mockConfig.On("FrontendURL").Return("https://frontend").Maybe()
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+			mockSessionRegistry.On("Get", mock.Anything).Return((registry.Session)(nil), fmt.Errorf("session not found")).Maybe()
+
+			serverConn, clientConn := net.Pipe()
+			defer func() {
+				_ = clientConn.Close()
+			}()
+
+			remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+			go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+			go func() {
+				_, _ = clientConn.Write([]byte("GET " + tt.path + " HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+			}()
+
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, err := io.ReadAll(clientConn)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(response), tt.expect), string(response))
+		})
+	}
+}
+
+type closeDelimitedBackend struct {
+	ssh.Channel
+	response io.Reader
+}
+
+func (b *closeDelimitedBackend) Read(p []byte) (int, error)  { return b.response.Read(p) }
+func (b *closeDelimitedBackend) Write(p []byte) (int, error) { return len(p), nil }
+func (b *closeDelimitedBackend) CloseWrite() error           { return nil }
+func (b *closeDelimitedBackend) Close() error                { return nil }
+
+func TestHandlerCloseDelimitedResponse(t *testing.T) {
+	body := strings.Repeat("streamed until the backend hangs up\n", 512)
+
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("BufferSize").Return(1024)
+	mockConfig.On("TCPByteBudget").Return(int64(0))
+	mockConfig.On("NodeBandwidthLimit").Return(int64(0))
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	backend := &closeDelimitedBackend{
+		response: strings.NewReader("HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\n" + body),
+	}
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(backend, (<-chan *ssh.Request)(reqCh), nil)
+	copier := forwarder.New(mockConfig, slug.New(), nil)
+	mockForwarder.On("HandleConnection", mock.Anything, backend).Run(func(args mock.Arguments) {
+		copier.HandleConnection(args.Get(0).(io.ReadWriter), args.Get(1).(ssh.Channel))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		hh.Handler(conn, true)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	_, err = clientConn.Write([]byte("GET / HTTP/1.0\r\nHost: test.domain\r\n\r\n"))
+	assert.NoError(t, err)
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(clientConn)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(response), "HTTP/1.0 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(response), "\r\n\r\n"+body))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler kept the client connection open after the backend closed")
+	}
+}
+
+func TestHandlerOversizedResponseHeader(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(4096)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("BufferSize").Return(1024)
+	mockConfig.On("TCPByteBudget").Return(int64(0))
+	mockConfig.On("NodeBandwidthLimit").Return(int64(0))
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	backend := &closeDelimitedBackend{
+		response: strings.NewReader("HTTP/1.1 200 OK\r\nX-Padding: " + strings.Repeat("a", 8192) + "\r\n\r\nok"),
+	}
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(backend, (<-chan *ssh.Request)(reqCh), nil)
+	copier := forwarder.New(mockConfig, slug.New(), nil)
+	mockForwarder.On("HandleConnection", mock.Anything, backend).Run(func(args mock.Arguments) {
+		copier.HandleConnection(args.Get(0).(io.ReadWriter), args.Get(1).(ssh.Channel))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		hh.Handler(conn, true)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	_, err = clientConn.Write([]byte("GET / HTTP/1.0\r\nHost: test.domain\r\n\r\n"))
+	assert.NoError(t, err)
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(clientConn)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(response), "HTTP/1.1 502 Bad Gateway\r\n"), string(response))
+	assert.NotContains(t, string(response), "X-Padding")
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler kept the client connection open after rejecting the response")
+	}
+}
+
+func newSSHPair(t *testing.T) (*ssh.ServerConn, ssh.Conn, <-chan ssh.NewChannel) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	sCfg := &ssh.ServerConfig{NoClientAuth: true}
+	sCfg.AddHostKey(signer)
+	cCfg := &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	type result struct {
+		conn *ssh.ServerConn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		serverSide, err := listener.Accept()
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		conn, chans, reqs, err := ssh.NewServerConn(serverSide, sCfg)
+		if err == nil {
+			go ssh.DiscardRequests(reqs)
+			go func() {
+				for ch := range chans {
+					_ = ch.Reject(ssh.Prohibited, "")
+				}
+			}()
+		}
+		done <- result{conn, err}
+	}()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	cConn, cChans, cReqs, err := ssh.NewClientConn(clientSide, "pipe", cCfg)
+	require.NoError(t, err)
+	go ssh.DiscardRequests(cReqs)
+
+	res := <-done
+	require.NoError(t, res.err)
+	t.Cleanup(func() {
+		_ = cConn.Close()
+		_ = res.conn.Close()
+	})
+	return res.conn, cConn, cChans
+}
+
+// keepAliveBackend answers once it has seen want requests, so the test
+// can check that every request went down the same channel.
+type keepAliveBackend struct {
+	ssh.Channel
+	mu       sync.Mutex
+	received bytes.Buffer
+	want     int
+	ready    chan struct{}
+	response io.Reader
+}
+
+func (b *keepAliveBackend) Read(p []byte) (int, error) {
+	select {
+	case <-b.ready:
+	case <-time.After(5 * time.Second):
+		return 0, io.EOF
+	}
+	return b.response.Read(p)
+}
+
+func (b *keepAliveBackend) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.received.Write(p)
+	if strings.Count(b.received.String(), "HTTP/1.1\r\n") == b.want {
+		close(b.ready)
+	}
+	return len(p), nil
+}
+
+func (b *keepAliveBackend) CloseWrite() error { return nil }
+func (b *keepAliveBackend) Close() error      { return nil }
+
+func TestHandlerKeepAliveReusesChannel(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("BufferSize").Return(1024)
+	mockConfig.On("TCPByteBudget").Return(int64(0))
+	mockConfig.On("NodeBandwidthLimit").Return(int64(0))
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+
+	backend := &keepAliveBackend{
+		want:  2,
+		ready: make(chan struct{}),
+		response: strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\ntwo"),
+	}
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(backend, (<-chan *ssh.Request)(reqCh), nil)
+	copier := forwarder.New(mockConfig, slug.New(), nil)
+	mockForwarder.On("HandleConnection", mock.Anything, backend).Run(func(args mock.Arguments) {
+		copier.HandleConnection(args.Get(0).(io.ReadWriter), args.Get(1).(ssh.Channel))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		hh.Handler(conn, true)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	_, err = clientConn.Write([]byte("GET /first HTTP/1.1\r\nHost: test.domain\r\nConnection: keep-alive\r\n\r\n" +
+		"GET /second HTTP/1.1\r\nHost: test.domain\r\nConnection: keep-alive\r\n\r\n"))
+	require.NoError(t, err)
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, _ := io.ReadAll(clientConn)
+	<-done
+
+	assert.Equal(t, 2, strings.Count(string(response), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(response), "two"), string(response))
+
+	backend.mu.Lock()
+	received := backend.received.String()
+	backend.mu.Unlock()
+	assert.Contains(t, received, "GET /first HTTP/1.1\r\n")
+	assert.Contains(t, received, "GET /second HTTP/1.1\r\n")
+	mockForwarder.AssertNumberOfCalls(t, "OpenForwardedChannel", 1)
+}
+
+func TestHandlerClientClosesDuringChannelOpen(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("BufferSize").Return(1024).Maybe()
+	mockConfig.On("ChannelOpenQueue").Return(0)
+	mockConfig.On("MaxForwardedChannels").Return(0)
+	mockConfig.On("LogConnections").Return(false)
+	mockConfig.On("TunnelLogDir").Return("").Maybe()
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	sConn, cConn, cChans := newSSHPair(t)
+	go func() {
+		for ch := range cChans {
+			if ch.ChannelType() == "forwarded-tcpip" {
+				_ = cConn.Close()
+			}
+		}
+	}()
+
+	fw := forwarder.New(mockConfig, slug.New(), sConn)
+	fw.SetForwardedPort(80)
+	mockSession := new(MockSession)
+	mockSession.On("Forwarder").Return(fw)
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:12345")
+	go hh.Handler(&wrappedConn{Conn: serverConn, remoteAddr: remoteAddr}, true)
+
+	go func() {
+		_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\nHost: test.domain\r\n\r\n"))
+	}()
+
+	start := time.Now()
+	_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(clientConn)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(string(response), "HTTP/1.1 502 Bad Gateway\r\n"), string(response))
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Len(t, fw.RecentErrors(), 1)
+	assert.Contains(t, fw.RecentErrors()[0], forwarder.ErrClientDisconnected.Error())
+}
+
+// heldOpenBackend answers the first request and then keeps the channel open
+// until it is closed, like a keep-alive server waiting for the next request.
+type heldOpenBackend struct {
+	ssh.Channel
+	mu       sync.Mutex
+	received bytes.Buffer
+	answered bool
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (b *heldOpenBackend) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	answered := b.answered
+	b.answered = true
+	b.mu.Unlock()
+	if !answered {
+		return copy(p, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none"), nil
+	}
+	<-b.closed
+	return 0, io.EOF
+}
+
+func (b *heldOpenBackend) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.received.Write(p)
+	return len(p), nil
+}
+
+func (b *heldOpenBackend) CloseWrite() error { return b.Close() }
+func (b *heldOpenBackend) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func TestHandlerKeepAlivePolicy(t *testing.T) {
+	const firstRequest = "GET /first HTTP/1.1\r\nHost: test.domain\r\nAuthorization: Basic YWxpY2U6c2VjcmV0\r\n\r\n"
+
+	tests := []struct {
+		name          string
+		setup         func(mockConfig *MockConfig, mockForwarder *MockForwarder)
+		secondRequest string
+		expectStatus  string
+	}{
+		{
+			name: "disallowed method",
+			setup: func(_ *MockConfig, mockForwarder *MockForwarder) {
+				mockForwarder.On("AllowedMethods").Return([]string{"GET", "HEAD"})
+			},
+			secondRequest: "DELETE /second HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			expectStatus:  "HTTP/1.1 405 Method Not Allowed\r\n",
+		},
+		{
+			name: "missing basic auth",
+			setup: func(_ *MockConfig, mockForwarder *MockForwarder) {
+				mockForwarder.On("BasicAuthEnabled").Return(true)
+				mockForwarder.On("CheckBasicAuth", "alice", "secret").Return(true)
+			},
+			secondRequest: "GET /second HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			expectStatus:  "HTTP/1.1 401 Unauthorized\r\n",
+		},
+		{
+			name: "forbidden websocket origin",
+			setup: func(_ *MockConfig, mockForwarder *MockForwarder) {
+				mockForwarder.On("AllowedOrigins").Return([]string{"https://app.example.com"})
+			},
+			secondRequest: "GET /second HTTP/1.1\r\nHost: test.domain\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nOrigin: https://evil.example.com\r\n\r\n",
+			expectStatus:  "HTTP/1.1 403 Forbidden\r\n",
+		},
+		{
+			name: "tunnel disabled",
+			setup: func(_ *MockConfig, mockForwarder *MockForwarder) {
+				mockForwarder.On("Enabled").Return(true).Once()
+				mockForwarder.On("Enabled").Return(false)
+			},
+			secondRequest: "GET /second HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			expectStatus:  "HTTP/1.1 503 Service Unavailable\r\n",
+		},
+		{
+			name: "maintenance mode",
+			setup: func(mockConfig *MockConfig, _ *MockForwarder) {
+				mockConfig.On("MaintenanceMode").Return(false).Times(2)
+				mockConfig.On("MaintenanceMode").Return(true)
+			},
+			secondRequest: "GET /second HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			expectStatus:  "HTTP/1.1 503 Service Unavailable\r\n",
+		},
+		{
+			name: "uri too long",
+			setup: func(mockConfig *MockConfig, _ *MockForwarder) {
+				mockConfig.On("MaxURILength").Return(16)
+			},
+			secondRequest: "GET /second/path/that/is/too/long HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			expectStatus:  "HTTP/1.1 414 URI Too Long\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSessionRegistry := new(MockSessionRegistry)
+			mockConfig := &MockConfig{}
+			mockSession := new(MockSession)
+			mockForwarder := new(MockForwarder)
+			tt.setup(mockConfig, mockForwarder)
+
+			mockConfig.On("HeaderSize").Return(4096)
+			mockConfig.On("MaxRequestLineSize").Return(2048)
+			mockConfig.On("MaxURILength").Return(0).Maybe()
+			mockConfig.On("MetadataToken").Return("").Maybe()
+			mockConfig.On("MaintenanceMode").Return(false).Maybe()
+			mockConfig.On("MaintenancePage").Return("").Maybe()
+			mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+			mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+			mockConfig.On("BadGatewayPage").Return("").Maybe()
+			mockConfig.On("ResponseWriteBuffer").Return(0)
+			mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+			mockConfig.On("CustomDomains").Return(map[string]string{})
+			mockConfig.On("NodeRegion").Return("").Maybe()
+			mockConfig.On("Domains").Return([]string{}).Maybe()
+			mockConfig.On("ServedByHeader").Return(false)
+			mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+			mockConfig.On("TLSRedirect").Return(false)
+			mockConfig.On("BufferSize").Return(1024)
+			mockConfig.On("TCPByteBudget").Return(int64(0))
+			mockConfig.On("NodeBandwidthLimit").Return(int64(0))
+			hh := &httpHandler{
+				sessionRegistry: mockSessionRegistry,
+				config:          mockConfig,
+			}
+
+			mockForwarder.On("AllowedMethods").Return(nil).Maybe()
+			mockForwarder.On("AllowedOrigins").Return(nil).Maybe()
+			mockForwarder.On("Enabled").Return(true).Maybe()
+			mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+			mockForwarder.On("HostHeader").Return("").Maybe()
+			mockForwarder.On("RewriteLocation").Return(false).Maybe()
+			mockForwarder.On("DefaultContentType").Return("").Maybe()
+			mockForwarder.On("MirrorBodyLimit").Return(0).Maybe()
+			mockSessionRegistry.On("Get", types.SessionKey{
+				Id:   "test",
+				Type: types.TunnelTypeHTTP,
+			}).Return(mockSession, nil)
+			mockSession.On("Forwarder").Return(mockForwarder)
+
+			backend := &heldOpenBackend{closed: make(chan struct{})}
+			reqCh := make(chan *ssh.Request)
+			close(reqCh)
+			mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(backend, (<-chan *ssh.Request)(reqCh), nil)
+			copier := forwarder.New(mockConfig, slug.New(), nil)
+			mockForwarder.On("HandleConnection", mock.Anything, backend).Run(func(args mock.Arguments) {
+				copier.HandleConnection(args.Get(0).(io.ReadWriter), args.Get(1).(ssh.Channel))
+			})
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer func() {
+				_ = listener.Close()
+			}()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				conn, acceptErr := listener.Accept()
+				if acceptErr != nil {
+					return
+				}
+				hh.Handler(conn, true)
+			}()
+
+			clientConn, err := net.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			defer func() {
+				_ = clientConn.Close()
+			}()
+			_ = clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			reader := bufio.NewReader(clientConn)
+
+			_, err = clientConn.Write([]byte(firstRequest))
+			require.NoError(t, err)
+			first, err := http.ReadResponse(reader, nil)
+			require.NoError(t, err)
+			body, err := io.ReadAll(first.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, first.StatusCode)
+			assert.Equal(t, "one", string(body))
+
+			_, err = clientConn.Write([]byte(tt.secondRequest))
+			require.NoError(t, err)
+			rest, _ := io.ReadAll(reader)
+			<-done
+
+			assert.True(t, strings.HasPrefix(string(rest), tt.expectStatus), string(rest))
+			backend.mu.Lock()
+			received := backend.received.String()
+			backend.mu.Unlock()
+			assert.Contains(t, received, "GET /first HTTP/1.1\r\n")
+			assert.NotContains(t, received, "/second")
+		})
+	}
+}
@@ -1,18 +1,26 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"log"
 	"net"
+	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/registry"
 )
 
+const tlsHandshakeTimeout = 10 * time.Second
+
+var tlsHandshakeQueueWait = time.Second
+
 type https struct {
 	config      config.Config
 	tlsConfig   *tls.Config
 	httpHandler *httpHandler
+	limiter     *acceptLimiter
+	handshakes  chan struct{}
 }
 
 func NewHTTPSServer(config config.Config, sessionRegistry registry.Registry, tlsConfig *tls.Config) Transport {
@@ -20,7 +28,16 @@ func NewHTTPSServer(config config.Config, sessionRegistry registry.Registry, tls
 		config:      config,
 		tlsConfig:   tlsConfig,
 		httpHandler: newHTTPHandler(config, sessionRegistry),
+		limiter:     newAcceptLimiter(config.MaxConcurrentAccepts()),
+		handshakes:  newHandshakeSlots(config.MaxConcurrentTLSHandshakes()),
+	}
+}
+
+func newHandshakeSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
 	}
+	return make(chan struct{}, limit)
 }
 
 func (ht *https) Listen() (net.Listener, error) {
@@ -39,6 +56,42 @@ func (ht *https) Serve(listener net.Listener) error {
 			continue
 		}
 
-		go ht.httpHandler.Handler(conn, true)
+		tlsConn, _ := conn.(*tls.Conn)
+		conn, ok := ht.limiter.admit(conn)
+		if !ok {
+			go shed(conn, serviceUnavailableResponse)
+			continue
+		}
+		go ht.serve(conn, tlsConn)
+	}
+}
+
+func (ht *https) serve(conn net.Conn, tlsConn *tls.Conn) {
+	if tlsConn != nil && ht.handshakes != nil && !ht.handshake(tlsConn) {
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close connection: %v", err)
+		}
+		return
+	}
+	ht.httpHandler.Handler(conn, true)
+}
+
+func (ht *https) handshake(conn *tls.Conn) bool {
+	timer := time.NewTimer(tlsHandshakeQueueWait)
+	defer timer.Stop()
+	select {
+	case ht.handshakes <- struct{}{}:
+		defer func() { <-ht.handshakes }()
+	case <-timer.C:
+		log.Printf("Dropping connection from %s: too many concurrent TLS handshakes", conn.RemoteAddr())
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return false
 	}
+	return true
 }
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewHTTPSServer(t *testing.T) {
@@ -18,6 +22,8 @@ func TestNewHTTPSServer(t *testing.T) {
 	tlsConfig := &tls.Config{}
 	mockConfig.On("Domain").Return(mockConfig)
 	mockConfig.On("HTTPSPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
 	srv := NewHTTPSServer(mockConfig, msr, tlsConfig)
 	assert.NotNil(t, srv)
 
@@ -33,6 +39,8 @@ func TestHTTPSServer_Listen(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return(mockConfig)
 	mockConfig.On("HTTPSPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
 	tlsConfig := &tls.Config{
 		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 			return nil, nil
@@ -56,6 +64,8 @@ func TestHTTPSServer_Serve(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return(mockConfig)
 	mockConfig.On("HTTPSPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
 	srv := NewHTTPSServer(mockConfig, msr, &tls.Config{})
 
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -77,6 +87,8 @@ func TestHTTPSServer_Serve_AcceptError(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return(mockConfig)
 	mockConfig.On("HTTPSPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
 	srv := NewHTTPSServer(mockConfig, msr, &tls.Config{})
 
 	ml := new(mockListener)
@@ -94,7 +106,20 @@ func TestHTTPSServer_Serve_Success(t *testing.T) {
 	port := "0"
 	mockConfig.On("Domain").Return(mockConfig)
 	mockConfig.On("HTTPSPort").Return(port)
+	mockConfig.On("MaxConcurrentAccepts").Return(0).Maybe()
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(0).Maybe()
 	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
 
 	srv := NewHTTPSServer(mockConfig, msr, &tls.Config{})
 
@@ -117,3 +142,134 @@ func TestHTTPSServer_Serve_Success(t *testing.T) {
 	err = listener.Close()
 	assert.NoError(t, err)
 }
+
+func TestHTTPSServer_Serve_HandshakeConcurrency(t *testing.T) {
+	certFile, keyFile := createTestCert(t, "example.com", true, false, false)
+	defer func() {
+		_ = os.Remove(certFile)
+		_ = os.Remove(keyFile)
+	}()
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	var inflight, peak atomic.Int32
+	tlsConfig := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			n := inflight.Add(1)
+			defer inflight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			return &cert, nil
+		},
+	}
+
+	mockConfig := &MockConfig{}
+	mockConfig.On("HTTPSPort").Return("0")
+	mockConfig.On("MaxConcurrentAccepts").Return(0)
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(2)
+	mockConfig.On("HeaderSize").Return(4096).Maybe()
+	mockConfig.On("MaxRequestLineSize").Return(2048).Maybe()
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second).Maybe()
+	srv := NewHTTPSServer(mockConfig, new(MockSessionRegistry), tlsConfig)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	var wg sync.WaitGroup
+	var completed atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			if err != nil {
+				return
+			}
+			completed.Add(1)
+			_ = conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(8), completed.Load())
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestHTTPSServer_Serve_HandshakeQueueFull(t *testing.T) {
+	certFile, keyFile := createTestCert(t, "example.com", true, false, false)
+	defer func() {
+		_ = os.Remove(certFile)
+		_ = os.Remove(keyFile)
+	}()
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	original := tlsHandshakeQueueWait
+	tlsHandshakeQueueWait = 50 * time.Millisecond
+	defer func() {
+		tlsHandshakeQueueWait = original
+	}()
+
+	release := make(chan struct{})
+	tlsConfig := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			<-release
+			return &cert, nil
+		},
+	}
+
+	mockConfig := &MockConfig{}
+	mockConfig.On("HTTPSPort").Return("0")
+	mockConfig.On("MaxConcurrentAccepts").Return(0)
+	mockConfig.On("MaxConcurrentTLSHandshakes").Return(1)
+	mockConfig.On("HeaderSize").Return(4096).Maybe()
+	mockConfig.On("MaxRequestLineSize").Return(2048).Maybe()
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second).Maybe()
+	srv := NewHTTPSServer(mockConfig, new(MockSessionRegistry), tlsConfig)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	first := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			_ = conn.Close()
+		}
+		first <- err
+	}()
+	require.Eventually(t, func() bool {
+		return len(srv.(*https).handshakes) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	assert.Error(t, err)
+
+	close(release)
+	assert.NoError(t, <-first)
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"sync"
+	"tunnel_pls/internal/http/header"
+)
+
+type inflightKey struct {
+	tunnel any
+	ip     string
+}
+
+// clientInflight counts forwarded requests per client IP on each tunnel so a
+// single client cannot hold every backend connection.
+type clientInflight struct {
+	mu     sync.Mutex
+	counts map[inflightKey]int
+}
+
+func (c *clientInflight) acquire(tunnel any, addr net.Addr, limit int) (func(), bool) {
+	if limit <= 0 {
+		return func() {}, true
+	}
+	key := inflightKey{tunnel: tunnel, ip: clientIP(addr)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[inflightKey]int)
+	}
+	if c.counts[key] >= limit {
+		return nil, false
+	}
+	c.counts[key]++
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.counts[key]--; c.counts[key] <= 0 {
+			delete(c.counts, key)
+		}
+	}, true
+}
+
+// requestSlots holds the in-flight slots of one client connection. A slot is
+// taken as each request is parsed and handed back when its response starts,
+// so an idle keep-alive connection does not count against the limit.
+type requestSlots struct {
+	inflight *clientInflight
+	tunnel   any
+	addr     net.Addr
+	limit    int
+	reject   func(w io.Writer) error
+
+	mu       sync.Mutex
+	releases []func()
+}
+
+func (s *requestSlots) acquire() bool {
+	release, ok := s.inflight.acquire(s.tunnel, s.addr, s.limit)
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releases = append(s.releases, release)
+	return true
+}
+
+func (s *requestSlots) HandleRequest(reqhf header.RequestHeader) error {
+	if s.acquire() {
+		return nil
+	}
+	return &rejectedRequest{respond: s.reject, method: reqhf.Method(), path: reqhf.Path()}
+}
+
+func (s *requestSlots) HandleResponse(_ header.ResponseHeader, _ []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.releases) > 0 {
+		s.releases[0]()
+		s.releases = s.releases[1:]
+	}
+	return nil
+}
+
+// releaseAll hands back every slot still held once the connection is done.
+func (s *requestSlots) releaseAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, release := range s.releases {
+		release()
+	}
+	s.releases = nil
+}
+
+func clientIP(addr net.Addr) string {
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"tunnel_pls/internal/http/header"
+)
+
+// requestMirror copies each forwarded request's header and the first bytes
+// of its body to the tunnel owner. It sits on the client-to-backend copy, so
+// it only ever sees one request at a time and needs no locking.
+type requestMirror struct {
+	limit     int
+	origin    net.Addr
+	send      func(string) error
+	header    []byte
+	body      []byte
+	want      int
+	truncated bool
+	skip      int
+	active    bool
+}
+
+func newRequestMirror(limit int, origin net.Addr, send func(string) error) *requestMirror {
+	return &requestMirror{limit: limit, origin: origin, send: send}
+}
+
+// begin starts capturing a request. skip is the number of header bytes that
+// will still pass through capture before the body starts.
+func (m *requestMirror) begin(reqhf header.RequestHeader, skip int) {
+	m.flush()
+
+	m.header = reqhf.Finalize()
+	m.body = make([]byte, 0, min(m.limit, 4096))
+	m.skip = skip
+	m.active = true
+	m.want, m.truncated = 0, false
+	if te := reqhf.Value("Transfer-Encoding"); te != "" {
+		m.want = m.limit
+		m.truncated = true
+	} else if cl, err := strconv.Atoi(strings.TrimSpace(reqhf.Value("Content-Length"))); err == nil && cl > 0 {
+		m.want = min(cl, m.limit)
+		m.truncated = cl > m.limit
+	}
+	if m.want == 0 {
+		m.flush()
+	}
+}
+
+// HandleRequest picks up the requests that follow on a keep-alive
+// connection, whose header is replayed through the stream ahead of the body.
+func (m *requestMirror) HandleRequest(reqhf header.RequestHeader) error {
+	m.begin(reqhf, len(reqhf.Finalize()))
+	return nil
+}
+
+func (m *requestMirror) capture(p []byte) {
+	if !m.active {
+		return
+	}
+	if m.skip > 0 {
+		n := min(m.skip, len(p))
+		m.skip -= n
+		p = p[n:]
+	}
+	n := min(m.want-len(m.body), len(p))
+	m.body = append(m.body, p[:n]...)
+	if len(m.body) >= m.want {
+		m.flush()
+	}
+}
+
+func (m *requestMirror) flush() {
+	if !m.active {
+		return
+	}
+	m.active = false
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Mirrored request from %s:\r\n", m.origin)
+	b.Write(m.header)
+	b.Write(m.body)
+	if m.truncated && len(m.body) == m.limit {
+		fmt.Fprintf(&b, "\r\n[body truncated at %d bytes]", m.limit)
+	}
+	b.WriteString("\r\n")
+	if err := m.send(b.String()); err != nil {
+		log.Printf("Failed to send mirrored request: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"tunnel_pls/internal/http/header"
+	"tunnel_pls/internal/session/forwarder"
+	"tunnel_pls/internal/session/interaction"
+	"tunnel_pls/internal/session/slug"
+	"tunnel_pls/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRequestMirror(t *testing.T) {
+	origin := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242}
+
+	tests := []struct {
+		name     string
+		request  string
+		limit    int
+		chunks   []string
+		replayed bool
+		tail     string
+	}{
+		{
+			name:    "headers only for a request without a body",
+			request: "GET /hook HTTP/1.1\r\nHost: test.domain\r\n\r\n",
+			limit:   16,
+			tail:    "\r\n",
+		},
+		{
+			name:    "body within the limit",
+			request: "POST /hook HTTP/1.1\r\nContent-Length: 5\r\n\r\n",
+			limit:   16,
+			chunks:  []string{"hel", "lo"},
+			tail:    "hello\r\n",
+		},
+		{
+			name:    "body truncated at the limit",
+			request: "POST /hook HTTP/1.1\r\nContent-Length: 20\r\n\r\n",
+			limit:   8,
+			chunks:  []string{"0123", "456789", "abcdefghij"},
+			tail:    "01234567\r\n[body truncated at 8 bytes]\r\n",
+		},
+		{
+			name:    "chunked body shorter than the limit",
+			request: "POST /hook HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n",
+			limit:   64,
+			chunks:  []string{"2\r\nhi\r\n0\r\n\r\n"},
+			tail:    "2\r\nhi\r\n0\r\n\r\n\r\n",
+		},
+		{
+			name:     "keep-alive request skips the replayed header",
+			request:  "POST /next HTTP/1.1\r\nContent-Length: 3\r\n\r\n",
+			limit:    16,
+			chunks:   []string{"POST /next HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc"},
+			replayed: true,
+			tail:     "abc\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			m := newRequestMirror(tt.limit, origin, func(msg string) error {
+				sent = append(sent, msg)
+				return nil
+			})
+
+			reqhf, err := header.NewRequest([]byte(tt.request))
+			require.NoError(t, err)
+			if tt.replayed {
+				require.NoError(t, m.HandleRequest(reqhf))
+			} else {
+				m.begin(reqhf, 0)
+			}
+			for _, chunk := range tt.chunks {
+				m.capture([]byte(chunk))
+			}
+			m.flush()
+
+			assert.Equal(t, []string{"Mirrored request from 203.0.113.7:4242:\r\n" + string(reqhf.Finalize()) + tt.tail}, sent)
+		})
+	}
+}
+
+type diagnosticRecorder struct {
+	interaction.Interaction
+	messages chan string
+}
+
+func (r *diagnosticRecorder) SendDiagnostic(message string) error {
+	r.messages <- message
+	return nil
+}
+
+func TestHandlerMirrorsRequest(t *testing.T) {
+	mockSessionRegistry := new(MockSessionRegistry)
+	mockConfig := &MockConfig{}
+	mockConfig.On("HeaderSize").Return(4096)
+	mockConfig.On("MaxRequestLineSize").Return(2048)
+	mockConfig.On("MaxURILength").Return(0).Maybe()
+	mockConfig.On("MetadataToken").Return("").Maybe()
+	mockConfig.On("MaintenanceMode").Return(false).Maybe()
+	mockConfig.On("MaxRequestsPerIP").Return(0).Maybe()
+	mockConfig.On("HeaderReadTimeout").Return(10 * time.Second)
+	mockConfig.On("BadGatewayPage").Return("").Maybe()
+	mockConfig.On("ResponseWriteBuffer").Return(0)
+	mockConfig.On("MaxResponseHeaderSize").Return(0).Maybe()
+	mockConfig.On("CustomDomains").Return(map[string]string{})
+	mockConfig.On("NodeRegion").Return("").Maybe()
+	mockConfig.On("Domains").Return([]string{}).Maybe()
+	mockConfig.On("ServedByHeader").Return(false)
+	mockConfig.On("WhoamiEnabled").Return(false).Maybe()
+	mockConfig.On("TLSRedirect").Return(false)
+	mockConfig.On("BufferSize").Return(1024)
+	mockConfig.On("TCPByteBudget").Return(int64(0))
+	mockConfig.On("NodeBandwidthLimit").Return(int64(0))
+	hh := &httpHandler{
+		sessionRegistry: mockSessionRegistry,
+		config:          mockConfig,
+	}
+
+	recorder := &diagnosticRecorder{messages: make(chan string, 4)}
+	mockSession := new(MockSession)
+	mockForwarder := new(MockForwarder)
+	mockForwarder.On("AllowedMethods").Return(nil)
+	mockForwarder.On("Enabled").Return(true).Maybe()
+	mockForwarder.On("BasicAuthEnabled").Return(false).Maybe()
+	mockForwarder.On("HostHeader").Return("").Maybe()
+	mockForwarder.On("RewriteLocation").Return(false).Maybe()
+	mockForwarder.On("DefaultContentType").Return("").Maybe()
+	mockForwarder.On("MirrorBodyLimit").Return(8)
+	mockSessionRegistry.On("Get", types.SessionKey{
+		Id:   "test",
+		Type: types.TunnelTypeHTTP,
+	}).Return(mockSession, nil)
+	mockSession.On("Forwarder").Return(mockForwarder)
+	mockSession.On("Interaction").Return(recorder)
+
+	backend := &closeDelimitedBackend{
+		response: strings.NewReader("HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nok"),
+	}
+	reqCh := make(chan *ssh.Request)
+	close(reqCh)
+	mockForwarder.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(backend, (<-chan *ssh.Request)(reqCh), nil)
+	copier := forwarder.New(mockConfig, slug.New(), nil)
+	mockForwarder.On("HandleConnection", mock.Anything, backend).Run(func(args mock.Arguments) {
+		copier.HandleConnection(args.Get(0).(io.ReadWriter), args.Get(1).(ssh.Channel))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		hh.Handler(conn, true)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	_, err = clientConn.Write([]byte("POST /hook HTTP/1.0\r\nHost: test.domain\r\nContent-Length: 20\r\n\r\n0123456789abcdefghij"))
+	require.NoError(t, err)
+
+	select {
+	case msg := <-recorder.messages:
+		assert.Contains(t, msg, "POST /hook HTTP/1.0\r\n")
+		assert.Contains(t, msg, "Host: test.domain\r\n")
+		assert.Contains(t, msg, "Content-Length: 20\r\n")
+		assert.True(t, strings.HasSuffix(msg, "\r\n\r\n01234567\r\n[body truncated at 8 bytes]\r\n"), msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"tunnel_pls/internal/http/header"
+	"tunnel_pls/internal/session/forwarder"
+)
+
+// rejectedRequest is returned by requestPolicy when a request on an open
+// connection may not reach the backend. respond writes the answer the
+// client gets instead.
+type rejectedRequest struct {
+	respond func(w io.Writer) error
+	method  string
+	path    string
+}
+
+func (r *rejectedRequest) Error() string {
+	return fmt.Sprintf("request %s %s rejected by tunnel policy", r.method, r.path)
+}
+
+// rejectRequest applies the checks every request on a connection must pass:
+// URI length, maintenance mode, the tunnel being enabled, basic auth, the
+// method allowlist and the WebSocket Origin allowlist. It returns the
+// response to send instead, or nil if the request may be forwarded.
+func (hh *httpHandler) rejectRequest(reqhf header.RequestHeader, fw forwarder.Forwarder) func(w io.Writer) error {
+	if limit := hh.config.MaxURILength(); limit > 0 && len(reqhf.Path()) > limit {
+		return hh.uriTooLong
+	}
+	if hh.config.MaintenanceMode() {
+		return hh.maintenance
+	}
+	if !fw.Enabled() {
+		return hh.serviceUnavailable
+	}
+	if !hh.authorized(reqhf, fw) {
+		return hh.unauthorized
+	}
+	if allowed := fw.AllowedMethods(); !isMethodAllowed(reqhf.Method(), allowed) {
+		return func(w io.Writer) error {
+			return hh.methodNotAllowed(w, allowed)
+		}
+	}
+	if isWebSocketUpgrade(reqhf) && !isOriginAllowed(reqhf.Value("Origin"), fw.AllowedOrigins()) {
+		return hh.forbidden
+	}
+	return nil
+}
+
+// requestPolicy runs rejectRequest on each request the stream parses, so
+// keep-alive requests after the first are held to the same rules.
+type requestPolicy struct {
+	handler   *httpHandler
+	forwarder forwarder.Forwarder
+}
+
+func (rp *requestPolicy) HandleRequest(reqhf header.RequestHeader) error {
+	respond := rp.handler.rejectRequest(reqhf, rp.forwarder)
+	if respond == nil {
+		return nil
+	}
+	return &rejectedRequest{respond: respond, method: reqhf.Method(), path: reqhf.Path()}
+}
+
+// respondToRejection writes the refusal carried by err to w. It reports
+// whether err was a policy rejection.
+func respondToRejection(w io.Writer, err error) bool {
+	var rejected *rejectedRequest
+	if !errors.As(err, &rejected) {
+		return false
+	}
+	if respErr := rejected.respond(w); respErr != nil {
+		log.Printf("Failed to write rejection response: %v", respErr)
+	}
+	return true
+}
@@ -7,25 +7,42 @@ import (
 	"io"
 	"log"
 	"net"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
 type tcp struct {
-	port      uint16
-	forwarder Forwarder
+	port               uint16
+	forwarder          Forwarder
+	initialReadTimeout time.Duration
+	limiter            *acceptLimiter
+	keepAlive          net.KeepAliveConfig
 }
 
 type Forwarder interface {
+	Enabled() bool
 	OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error)
 	HandleConnection(dst io.ReadWriter, src ssh.Channel)
 }
 
-func NewTCPServer(port uint16, forwarder Forwarder) Transport {
+// AcceptHook is called with the origin of every connection a TCP tunnel
+// accepts, before a channel is opened to the SSH client. Returning an error
+// drops the connection without forwarding it.
+type AcceptHook func(origin net.Addr) error
+
+// TCPAcceptHook lets operators add their own logging or admission checks to
+// TCP tunnels. The default accepts every connection.
+var TCPAcceptHook AcceptHook = func(net.Addr) error { return nil }
+
+func NewTCPServer(port uint16, forwarder Forwarder, initialReadTimeout time.Duration, maxConcurrentAccepts int, keepAlive net.KeepAliveConfig) Transport {
 	return &tcp{
-		port:      port,
-		forwarder: forwarder,
+		port:               port,
+		forwarder:          forwarder,
+		initialReadTimeout: initialReadTimeout,
+		limiter:            newAcceptLimiter(maxConcurrentAccepts),
+		keepAlive:          keepAlive,
 	}
 }
 
@@ -43,6 +60,14 @@ func (tt *tcp) Serve(listener net.Listener) error {
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
+		if err = applyKeepAlive(conn, tt.keepAlive); err != nil {
+			log.Printf("Failed to enable keep-alive probes: %v", err)
+		}
+		conn, ok := tt.limiter.admit(conn)
+		if !ok {
+			go shed(conn, nil)
+			continue
+		}
 		go tt.handleTcp(conn)
 	}
 }
@@ -54,6 +79,13 @@ func (tt *tcp) handleTcp(conn net.Conn) {
 			log.Printf("Failed to close connection: %v", err)
 		}
 	}()
+	if !tt.forwarder.Enabled() {
+		return
+	}
+	if err := TCPAcceptHook(conn.RemoteAddr()); err != nil {
+		log.Printf("Dropping TCP connection from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	channel, reqs, err := tt.forwarder.OpenForwardedChannel(ctx, conn.RemoteAddr())
@@ -62,6 +94,45 @@ func (tt *tcp) handleTcp(conn net.Conn) {
 		return
 	}
 
+	markForwarded(conn)
 	go ssh.DiscardRequests(reqs)
+	if tt.initialReadTimeout > 0 {
+		if err = conn.SetReadDeadline(time.Now().Add(tt.initialReadTimeout)); err != nil {
+			log.Printf("Failed to set initial read deadline: %v", err)
+		}
+		conn = &initialReadConn{Conn: conn, timeout: tt.initialReadTimeout}
+	}
 	tt.forwarder.HandleConnection(conn, channel)
 }
+
+// applyKeepAlive turns on TCP keep-alive probes so a client that vanished
+// without closing is detected and its forwarded channel released.
+func applyKeepAlive(conn net.Conn, keepAlive net.KeepAliveConfig) error {
+	if !keepAlive.Enable {
+		return nil
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	return tcpConn.SetKeepAliveConfig(keepAlive)
+}
+
+type initialReadConn struct {
+	net.Conn
+	timeout time.Duration
+	once    sync.Once
+}
+
+func (c *initialReadConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.once.Do(func() {
+			_ = c.Conn.SetReadDeadline(time.Time{})
+		})
+	}
+	if isTimeout(err) {
+		log.Printf("Closing TCP connection from %s: no data received within %s", c.RemoteAddr(), c.timeout)
+	}
+	return n, err
+}
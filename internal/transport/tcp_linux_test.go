@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyKeepAlive_TCPConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = applyKeepAlive(conn, net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     7 * time.Second,
+		Interval: 3 * time.Second,
+		Count:    4,
+	})
+	assert.NoError(t, err)
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+
+	opts := map[string]int{}
+	err = raw.Control(func(fd uintptr) {
+		opts["keepalive"], _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		opts["idle"], _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+		opts["interval"], _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL)
+		opts["count"], _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, opts["keepalive"])
+	assert.Equal(t, 7, opts["idle"])
+	assert.Equal(t, 3, opts["interval"])
+	assert.Equal(t, 4, opts["count"])
+}
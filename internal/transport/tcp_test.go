@@ -3,9 +3,12 @@ package transport
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
+	"tunnel_pls/internal/session/forwarder"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -16,7 +19,7 @@ func TestNewTCPServer(t *testing.T) {
 	mf := new(MockForwarder)
 	port := uint16(9000)
 
-	srv := NewTCPServer(port, mf)
+	srv := NewTCPServer(port, mf, 0, 0, net.KeepAliveConfig{})
 	assert.NotNil(t, srv)
 
 	tcpSrv, ok := srv.(*tcp)
@@ -27,7 +30,7 @@ func TestNewTCPServer(t *testing.T) {
 
 func TestTCPServer_Listen(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{})
 
 	listener, err := srv.Listen()
 	assert.NoError(t, err)
@@ -38,7 +41,7 @@ func TestTCPServer_Listen(t *testing.T) {
 
 func TestTCPServer_Serve(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{})
 
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	assert.NoError(t, err)
@@ -54,7 +57,7 @@ func TestTCPServer_Serve(t *testing.T) {
 
 func TestTCPServer_Serve_AcceptError(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{})
 
 	ml := new(mockListener)
 	ml.On("Accept").Return(nil, errors.New("accept error")).Once()
@@ -67,13 +70,14 @@ func TestTCPServer_Serve_AcceptError(t *testing.T) {
 
 func TestTCPServer_Serve_Success(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{})
 
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	assert.NoError(t, err)
 	port := listener.Addr().(*net.TCPAddr).Port
 
 	reqs := make(chan *ssh.Request)
+	mf.On("Enabled").Return(true).Maybe()
 	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(new(MockSSHChannel), (<-chan *ssh.Request)(reqs), nil)
 	mf.On("HandleConnection", mock.Anything, mock.Anything).Return()
 
@@ -94,7 +98,7 @@ func TestTCPServer_Serve_Success(t *testing.T) {
 
 func TestTCPServer_handleTcp_Success(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf).(*tcp)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
 
 	serverConn, clientConn := net.Pipe()
 	defer func(clientConn net.Conn) {
@@ -104,6 +108,7 @@ func TestTCPServer_handleTcp_Success(t *testing.T) {
 
 	reqs := make(chan *ssh.Request)
 	mockChannel := new(MockSSHChannel)
+	mf.On("Enabled").Return(true).Maybe()
 	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockChannel, (<-chan *ssh.Request)(reqs), nil)
 
 	mf.On("HandleConnection", serverConn, mockChannel).Return()
@@ -115,12 +120,13 @@ func TestTCPServer_handleTcp_Success(t *testing.T) {
 
 func TestTCPServer_handleTcp_CloseError(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf).(*tcp)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
 
 	mc := new(MockConn)
 	mc.On("Close").Return(errors.New("close error"))
 	mc.On("RemoteAddr").Return(&net.TCPAddr{})
 
+	mf.On("Enabled").Return(true).Maybe()
 	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(nil, (<-chan *ssh.Request)(nil), errors.New("open error"))
 
 	srv.handleTcp(mc)
@@ -129,7 +135,7 @@ func TestTCPServer_handleTcp_CloseError(t *testing.T) {
 
 func TestTCPServer_handleTcp_OpenChannelError(t *testing.T) {
 	mf := new(MockForwarder)
-	srv := NewTCPServer(0, mf).(*tcp)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
 
 	serverConn, clientConn := net.Pipe()
 	defer func(clientConn net.Conn) {
@@ -137,9 +143,178 @@ func TestTCPServer_handleTcp_OpenChannelError(t *testing.T) {
 		assert.NoError(t, err)
 	}(clientConn)
 
+	mf.On("Enabled").Return(true).Maybe()
 	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(nil, (<-chan *ssh.Request)(nil), errors.New("open error"))
 
 	srv.handleTcp(serverConn)
 
 	mf.AssertExpectations(t)
 }
+
+func TestTCPServer_handleTcp_Disabled(t *testing.T) {
+	mf := new(MockForwarder)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
+
+	mc := new(MockConn)
+	mc.On("Close").Return(nil)
+
+	mf.On("Enabled").Return(false)
+
+	srv.handleTcp(mc)
+
+	mf.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+	mc.AssertExpectations(t)
+}
+
+func TestTCPServer_handleTcp_ChannelLimit(t *testing.T) {
+	mf := new(MockForwarder)
+	srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
+
+	mc := new(MockConn)
+	mc.On("RemoteAddr").Return(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+	mc.On("Close").Return(nil)
+
+	mf.On("Enabled").Return(true)
+	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(nil, (<-chan *ssh.Request)(nil), forwarder.ErrChannelLimit)
+
+	srv.handleTcp(mc)
+
+	mf.AssertNotCalled(t, "HandleConnection", mock.Anything, mock.Anything)
+	mc.AssertExpectations(t)
+}
+
+func TestTCPServer_handleTcp_AcceptHook(t *testing.T) {
+	blocked := &net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+	var seen []string
+	TCPAcceptHook = func(origin net.Addr) error {
+		seen = append(seen, origin.String())
+		if blocked.Contains(origin.(*net.TCPAddr).IP) {
+			return errors.New("origin not allowed")
+		}
+		return nil
+	}
+	defer func() {
+		TCPAcceptHook = func(net.Addr) error { return nil }
+	}()
+
+	t.Run("rejected origin is dropped", func(t *testing.T) {
+		mf := new(MockForwarder)
+		srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
+
+		mc := new(MockConn)
+		mc.On("RemoteAddr").Return(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 4000})
+		mc.On("Close").Return(nil)
+		mf.On("Enabled").Return(true)
+
+		srv.handleTcp(mc)
+
+		mf.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+		mf.AssertNotCalled(t, "HandleConnection", mock.Anything, mock.Anything)
+		mc.AssertExpectations(t)
+	})
+
+	t.Run("allowed origin is forwarded", func(t *testing.T) {
+		mf := new(MockForwarder)
+		srv := NewTCPServer(0, mf, 0, 0, net.KeepAliveConfig{}).(*tcp)
+
+		mc := new(MockConn)
+		mc.On("RemoteAddr").Return(&net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 4001})
+		mc.On("Close").Return(nil)
+
+		reqs := make(chan *ssh.Request)
+		mockChannel := new(MockSSHChannel)
+		mf.On("Enabled").Return(true)
+		mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(mockChannel, (<-chan *ssh.Request)(reqs), nil)
+		mf.On("HandleConnection", mock.Anything, mockChannel).Return()
+
+		srv.handleTcp(mc)
+
+		mf.AssertExpectations(t)
+	})
+
+	assert.Equal(t, []string{"10.1.2.3:4000", "192.0.2.10:4001"}, seen)
+}
+
+func TestTCPServer_InitialReadTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		wantErr bool
+	}{
+		{name: "silent connection is closed", chunks: nil, wantErr: true},
+		{name: "data clears the deadline", chunks: []string{"hello", "world"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mf := new(MockForwarder)
+			srv := NewTCPServer(0, mf, 100*time.Millisecond, 0, net.KeepAliveConfig{})
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer func() {
+				_ = listener.Close()
+			}()
+
+			type result struct {
+				data string
+				err  error
+			}
+			done := make(chan result, 1)
+			reqs := make(chan *ssh.Request)
+			mf.On("Enabled").Return(true)
+			mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(new(MockSSHChannel), (<-chan *ssh.Request)(reqs), nil)
+			mf.On("HandleConnection", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				dst := args.Get(0).(io.ReadWriter)
+				want := len(strings.Join(tt.chunks, ""))
+				buf := make([]byte, want+1)
+				n, err := io.ReadAtLeast(dst, buf, max(want, 1))
+				done <- result{data: string(buf[:n]), err: err}
+			})
+
+			go func() {
+				_ = srv.Serve(listener)
+			}()
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			assert.NoError(t, err)
+			defer func() {
+				_ = conn.Close()
+			}()
+			for _, chunk := range tt.chunks {
+				_, err = conn.Write([]byte(chunk))
+				assert.NoError(t, err)
+				time.Sleep(300 * time.Millisecond)
+			}
+
+			select {
+			case res := <-done:
+				if tt.wantErr {
+					assert.True(t, isTimeout(res.err), "expected timeout, got %v", res.err)
+				} else {
+					assert.NoError(t, res.err)
+					assert.Equal(t, strings.Join(tt.chunks, ""), res.data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("connection was not handled")
+			}
+
+			if tt.wantErr {
+				_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err = conn.Read(make([]byte, 1))
+				assert.ErrorIs(t, err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestApplyKeepAlive_Disabled(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	}()
+
+	assert.NoError(t, applyKeepAlive(serverConn, net.KeepAliveConfig{}))
+	assert.NoError(t, applyKeepAlive(serverConn, net.KeepAliveConfig{Enable: true, Interval: time.Second}))
+}
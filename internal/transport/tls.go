@@ -5,10 +5,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"tunnel_pls/internal/config"
@@ -17,24 +23,33 @@ import (
 	"github.com/libdns/cloudflare"
 )
 
+// NewTLSConfig returns the TLS config of the process-wide TLS manager,
+// initialising it on first use. A failed initialisation is torn down and
+// retried on the next call, so callers can wait for TLS to become ready.
 func NewTLSConfig(config config.Config) (*tls.Config, error) {
-	var initErr error
+	tlsManagerMu.Lock()
+	defer tlsManagerMu.Unlock()
 
-	tlsManagerOnce.Do(func() {
+	if globalTLSManager == nil {
 		tm := createTLSManager(config)
-		initErr = tm.initialize()
-		if initErr == nil {
-			globalTLSManager = tm
+		if err := tm.initialize(); err != nil {
+			tm.stopChallengeListener()
+			tm.stopCache()
+			return nil, err
 		}
-	})
-
-	if initErr != nil {
-		return nil, initErr
+		globalTLSManager = tm
 	}
 
 	return globalTLSManager.getTLSConfig(), nil
 }
 
+func StopTLSManager() {
+	if globalTLSManager != nil {
+		globalTLSManager.stopCertWatcher()
+		globalTLSManager.stopChallengeListener()
+	}
+}
+
 type tlsManager struct {
 	config config.Config
 
@@ -46,12 +61,19 @@ type tlsManager struct {
 	userCertMu sync.RWMutex
 
 	magic *certmagic.Config
+	cache *certmagic.Cache
+
+	httpIssuer      *certmagic.ACMEIssuer
+	challengeServer *http.Server
 
 	useCertMagic bool
+
+	watcherCancel context.CancelFunc
+	watcherDone   chan struct{}
 }
 
 var globalTLSManager *tlsManager
-var tlsManagerOnce sync.Once
+var tlsManagerMu sync.Mutex
 
 func createTLSManager(cfg config.Config) *tlsManager {
 	storagePath := cfg.TLSStoragePath()
@@ -100,7 +122,7 @@ func (tm *tlsManager) userCertsExistAndValid() bool {
 	if !tm.certFilesExist() {
 		return false
 	}
-	return validateCertDomains(tm.certPath, tm.config.Domain())
+	return validateCertDomains(tm.certPath, tm.config.Domain(), config.TunnelDomain(tm.config), tm.config.CertRenewBeforeDays())
 }
 
 func (tm *tlsManager) certFilesExist() bool {
@@ -130,24 +152,50 @@ func (tm *tlsManager) loadUserCerts() error {
 }
 
 func (tm *tlsManager) startCertWatcher() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	tm.watcherCancel = cancel
+	tm.watcherDone = done
+
 	go func() {
+		defer close(done)
 		watcher := newCertWatcher(tm)
-		watcher.watch()
+		watcher.watch(ctx)
 	}()
 }
 
+func (tm *tlsManager) stopCertWatcher() {
+	if tm.watcherCancel == nil {
+		return
+	}
+	tm.watcherCancel()
+	<-tm.watcherDone
+}
+
+func (tm *tlsManager) stopCache() {
+	if tm.cache == nil {
+		return
+	}
+	tm.cache.Stop()
+	tm.cache = nil
+}
+
 func (tm *tlsManager) initCertMagic() error {
 	if err := tm.createStorageDirectory(); err != nil {
 		return err
 	}
 
-	if tm.config.CFAPIToken() == "" {
-		return fmt.Errorf("CF_API_TOKEN environment variable is required for automatic certificate generation")
+	if tm.config.CFAPIToken() == "" && tm.config.ACMEHTTPPort() == "" {
+		return fmt.Errorf("CF_API_TOKEN or ACME_HTTP_PORT environment variable is required for automatic certificate generation")
 	}
 
 	magic := tm.createCertMagicConfig()
 	tm.magic = magic
 
+	if err := tm.startChallengeListener(); err != nil {
+		return err
+	}
+
 	return tm.obtainCertificates(magic)
 }
 
@@ -158,11 +206,10 @@ func (tm *tlsManager) createStorageDirectory() error {
 	return nil
 }
 
+// createCertMagicConfig sets up the issuers the configuration allows: an
+// HTTP-01 issuer when ACME_HTTP_PORT is set, tried first, and a Cloudflare
+// DNS-01 issuer when CF_API_TOKEN is set.
 func (tm *tlsManager) createCertMagicConfig() *certmagic.Config {
-	cfProvider := &cloudflare.Provider{
-		APIToken: tm.config.CFAPIToken(),
-	}
-
 	storage := &certmagic.FileStorage{Path: tm.storagePath}
 
 	cache := certmagic.NewCache(certmagic.CacheOptions{
@@ -170,17 +217,93 @@ func (tm *tlsManager) createCertMagicConfig() *certmagic.Config {
 			return tm.magic, nil
 		},
 	})
+	tm.cache = cache
 
 	magic := certmagic.New(cache, certmagic.Config{
 		Storage: storage,
 	})
 
-	acmeIssuer := tm.createACMEIssuer(magic, cfProvider)
-	magic.Issuers = []certmagic.Issuer{acmeIssuer}
+	var issuers []certmagic.Issuer
+	if tm.config.ACMEHTTPPort() != "" {
+		tm.httpIssuer = tm.createHTTPIssuer(magic)
+		issuers = append(issuers, http01Issuer{tm.httpIssuer})
+	}
+	if token := tm.config.CFAPIToken(); token != "" {
+		cfProvider := &cloudflare.Provider{
+			APIToken: token,
+		}
+		issuers = append(issuers, tm.createACMEIssuer(magic, cfProvider))
+	}
+	magic.Issuers = issuers
 
 	return magic
 }
 
+// http01Issuer restricts an HTTP-01 issuer to names it can validate. CAs
+// refuse HTTP-01 for wildcard names, so PreCheck rejects them and CertMagic
+// moves on to the DNS-01 issuer.
+type http01Issuer struct {
+	*certmagic.ACMEIssuer
+}
+
+func (i http01Issuer) PreCheck(ctx context.Context, names []string, interactive bool) error {
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") {
+			return fmt.Errorf("HTTP-01 challenge cannot validate wildcard name %s", name)
+		}
+	}
+	return i.ACMEIssuer.PreCheck(ctx, names, interactive)
+}
+
+func (tm *tlsManager) createHTTPIssuer(magic *certmagic.Config) *certmagic.ACMEIssuer {
+	port, _ := strconv.Atoi(tm.config.ACMEHTTPPort())
+
+	httpIssuer := certmagic.NewACMEIssuer(magic, certmagic.ACMEIssuer{
+		Email:                   tm.config.ACMEEmail(),
+		Agreed:                  true,
+		AltHTTPPort:             port,
+		DisableTLSALPNChallenge: true,
+	})
+	httpIssuer.CA = tm.acmeCA()
+
+	return httpIssuer
+}
+
+func (tm *tlsManager) startChallengeListener() error {
+	if tm.httpIssuer == nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", ":"+tm.config.ACMEHTTPPort())
+	if err != nil {
+		return fmt.Errorf("failed to start ACME HTTP challenge listener: %w", err)
+	}
+
+	tm.challengeServer = &http.Server{
+		Handler:           tm.httpIssuer.HTTPChallengeHandler(http.NotFoundHandler()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func(srv *http.Server) {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("ACME HTTP challenge listener stopped: %v", err)
+		}
+	}(tm.challengeServer)
+
+	log.Printf("ACME HTTP challenge listener running on port %s", tm.config.ACMEHTTPPort())
+	return nil
+}
+
+func (tm *tlsManager) stopChallengeListener() {
+	if tm.challengeServer == nil {
+		return
+	}
+	if err := tm.challengeServer.Close(); err != nil {
+		log.Printf("Failed to close ACME HTTP challenge listener: %v", err)
+	}
+	tm.challengeServer = nil
+}
+
 func (tm *tlsManager) createACMEIssuer(magic *certmagic.Config, cfProvider *cloudflare.Provider) *certmagic.ACMEIssuer {
 	acmeIssuer := certmagic.NewACMEIssuer(magic, certmagic.ACMEIssuer{
 		Email:  tm.config.ACMEEmail(),
@@ -192,19 +315,43 @@ func (tm *tlsManager) createACMEIssuer(magic *certmagic.Config, cfProvider *clou
 		},
 	})
 
-	if tm.config.ACMEStaging() {
-		acmeIssuer.CA = certmagic.LetsEncryptStagingCA
+	acmeIssuer.CA = tm.acmeCA()
+	switch {
+	case tm.config.ACMEDirectoryURL() != "":
+		log.Printf("Using ACME directory %s", acmeIssuer.CA)
+	case tm.config.ACMEStaging():
 		log.Printf("Using Let's Encrypt staging server")
-	} else {
-		acmeIssuer.CA = certmagic.LetsEncryptProductionCA
+	default:
 		log.Printf("Using Let's Encrypt production server")
 	}
 
 	return acmeIssuer
 }
 
+func (tm *tlsManager) acmeCA() string {
+	if directory := tm.config.ACMEDirectoryURL(); directory != "" {
+		return directory
+	}
+	if tm.config.ACMEStaging() {
+		return certmagic.LetsEncryptStagingCA
+	}
+	return certmagic.LetsEncryptProductionCA
+}
+
 func (tm *tlsManager) obtainCertificates(magic *certmagic.Config) error {
 	domains := []string{tm.config.Domain(), "*." + tm.config.Domain()}
+	if tm.config.NodeRegion() != "" {
+		domains = append(domains, "*."+config.TunnelDomain(tm.config))
+	}
+	for _, domain := range tm.config.Domains() {
+		if domain != tm.config.Domain() {
+			domains = append(domains, domain, "*."+domain)
+		}
+	}
+	if tm.config.CFAPIToken() == "" {
+		domains = withoutWildcards(domains)
+		log.Printf("WARNING: CF_API_TOKEN is not set, wildcard certificates will not be requested")
+	}
 	log.Printf("Requesting certificates for: %v", domains)
 
 	ctx := context.Background()
@@ -216,6 +363,17 @@ func (tm *tlsManager) obtainCertificates(magic *certmagic.Config) error {
 	return nil
 }
 
+// withoutWildcards keeps the names an HTTP-01 issuer can obtain on its own.
+func withoutWildcards(domains []string) []string {
+	kept := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if !strings.HasPrefix(domain, "*.") {
+			kept = append(kept, domain)
+		}
+	}
+	return kept
+}
+
 func (tm *tlsManager) getTLSConfig() *tls.Config {
 	return &tls.Config{
 		GetCertificate: tm.getCertificate,
@@ -247,17 +405,20 @@ func (tm *tlsManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certifica
 	return tm.userCert, nil
 }
 
-func validateCertDomains(certPath, domain string) bool {
+// validateCertDomains reports whether the certificate at certPath is current
+// and covers domain and *.domain, plus *.tunnelDomain when a region places
+// tunnels under a subdomain of domain.
+func validateCertDomains(certPath, domain, tunnelDomain string, renewBeforeDays int) bool {
 	cert, err := loadAndParseCertificate(certPath)
 	if err != nil {
 		return false
 	}
 
-	if !isCertificateValid(cert) {
+	if !isCertificateValid(cert, renewBeforeDays) {
 		return false
 	}
 
-	return certCoversRequiredDomains(cert, domain)
+	return certCoversRequiredDomains(cert, domain, tunnelDomain)
 }
 
 func loadAndParseCertificate(certPath string) (*x509.Certificate, error) {
@@ -282,7 +443,9 @@ func loadAndParseCertificate(certPath string) (*x509.Certificate, error) {
 	return cert, nil
 }
 
-func isCertificateValid(cert *x509.Certificate) bool {
+// isCertificateValid reports whether cert can keep being served. A cert that
+// expires within renewBeforeDays is treated as needing renewal.
+func isCertificateValid(cert *x509.Certificate, renewBeforeDays int) bool {
 	now := time.Now()
 
 	if now.After(cert.NotAfter) {
@@ -290,21 +453,31 @@ func isCertificateValid(cert *x509.Certificate) bool {
 		return false
 	}
 
-	thirtyDaysFromNow := now.Add(30 * 24 * time.Hour)
-	if thirtyDaysFromNow.After(cert.NotAfter) {
-		log.Printf("Certificate expiring soon (NotAfter: %v), will use CertMagic for renewal", cert.NotAfter)
+	renewAt := cert.NotAfter.Add(-time.Duration(renewBeforeDays) * 24 * time.Hour)
+	if now.After(renewAt) {
+		log.Printf("WARNING: certificate expires within %d days (NotAfter: %v), will use CertMagic for renewal", renewBeforeDays, cert.NotAfter)
 		return false
 	}
 
 	return true
 }
 
-func certCoversRequiredDomains(cert *x509.Certificate, domain string) bool {
+func certCoversRequiredDomains(cert *x509.Certificate, domain, tunnelDomain string) bool {
 	certDomains := extractCertDomains(cert)
 	hasBase, hasWildcard := checkDomainCoverage(certDomains, domain)
 
 	logDomainCoverage(hasBase, hasWildcard, domain)
-	return hasBase && hasWildcard
+	if !hasBase || !hasWildcard {
+		return false
+	}
+	if tunnelDomain == domain {
+		return true
+	}
+	if !slices.Contains(certDomains, "*."+tunnelDomain) {
+		log.Printf("Certificate does not cover region wildcard domain: *.%s", tunnelDomain)
+		return false
+	}
+	return true
 }
 
 func extractCertDomains(cert *x509.Certificate) []string {
@@ -361,13 +534,18 @@ func (cw *certWatcher) initializeModTimes() {
 	}
 }
 
-func (cw *certWatcher) watch() {
+func (cw *certWatcher) watch(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if cw.checkAndReloadCerts() {
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			if cw.checkAndReloadCerts() {
+				return
+			}
 		}
 	}
 }
@@ -379,7 +557,7 @@ func (cw *certWatcher) checkAndReloadCerts() bool {
 	}
 
 	if !cw.filesModified(certInfo, keyInfo) {
-		return false
+		return cw.checkExpiry()
 	}
 
 	return cw.handleCertificateChange(certInfo, keyInfo)
@@ -403,7 +581,8 @@ func (cw *certWatcher) filesModified(certInfo, keyInfo os.FileInfo) bool {
 func (cw *certWatcher) handleCertificateChange(certInfo, keyInfo os.FileInfo) bool {
 	log.Printf("Certificate files changed, reloading...")
 
-	if !validateCertDomains(cw.tm.certPath, cw.tm.config.Domain()) {
+	if !validateCertDomains(cw.tm.certPath, cw.tm.config.Domain(), config.TunnelDomain(cw.tm.config), cw.tm.config.CertRenewBeforeDays()) {
+		log.Printf("New certificates are not usable for the required domains")
 		return cw.switchToCertMagic()
 	}
 
@@ -417,9 +596,17 @@ func (cw *certWatcher) handleCertificateChange(certInfo, keyInfo os.FileInfo) bo
 	return false
 }
 
-func (cw *certWatcher) switchToCertMagic() bool {
-	log.Printf("New certificates don't cover required domains")
+// checkExpiry hands renewal over to CertMagic once an unchanged user
+// certificate gets within the renewal window.
+func (cw *certWatcher) checkExpiry() bool {
+	cert, err := loadAndParseCertificate(cw.tm.certPath)
+	if err != nil || isCertificateValid(cert, cw.tm.config.CertRenewBeforeDays()) {
+		return false
+	}
+	return cw.switchToCertMagic()
+}
 
+func (cw *certWatcher) switchToCertMagic() bool {
 	if err := cw.tm.initCertMagic(); err != nil {
 		log.Printf("Failed to initialize CertMagic: %v", err)
 		return false
@@ -1,21 +1,26 @@
 package transport
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io"
 	"math/big"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"strconv"
 	"testing"
 	"time"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/types"
 
+	"github.com/caddyserver/certmagic"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -24,30 +29,102 @@ type MockConfig struct {
 	mock.Mock
 }
 
-func (m *MockConfig) Domain() string            { return m.Called().String(0) }
-func (m *MockConfig) FrontendURL() string       { return m.Called().String(0) }
-func (m *MockConfig) SSHPort() string           { return m.Called().String(0) }
-func (m *MockConfig) HTTPPort() string          { return m.Called().String(0) }
-func (m *MockConfig) HTTPSPort() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSEnabled() bool          { return m.Called().Bool(0) }
-func (m *MockConfig) TLSRedirect() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) ACMEEmail() string         { return m.Called().String(0) }
-func (m *MockConfig) CFAPIToken() string        { return m.Called().String(0) }
-func (m *MockConfig) ACMEStaging() bool         { return m.Called().Bool(0) }
-func (m *MockConfig) AllowedPortsStart() uint16 { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) AllowedPortsEnd() uint16   { return uint16(m.Called().Int(0)) }
-func (m *MockConfig) BufferSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) HeaderSize() int           { return m.Called().Int(0) }
-func (m *MockConfig) PprofEnabled() bool        { return m.Called().Bool(0) }
-func (m *MockConfig) PprofPort() string         { return m.Called().String(0) }
-func (m *MockConfig) Mode() types.ServerMode    { return m.Called().Get(0).(types.ServerMode) }
-func (m *MockConfig) GRPCAddress() string       { return m.Called().String(0) }
-func (m *MockConfig) GRPCPort() string          { return m.Called().String(0) }
-func (m *MockConfig) NodeToken() string         { return m.Called().String(0) }
-func (m *MockConfig) TLSStoragePath() string    { return m.Called().String(0) }
-func (m *MockConfig) KeyLoc() string            { return m.Called().String(0) }
-
-func createTestCert(t *testing.T, domain string, wildcard bool, expired bool, soon bool) (string, string) {
+func (m *MockConfig) Domain() string                   { return m.Called().String(0) }
+func (m *MockConfig) Domains() []string                { return m.Called().Get(0).([]string) }
+func (m *MockConfig) FrontendURL() string              { return m.Called().String(0) }
+func (m *MockConfig) CustomDomains() map[string]string { return m.Called().Get(0).(map[string]string) }
+func (m *MockConfig) SSHPort() string                  { return m.Called().String(0) }
+func (m *MockConfig) HTTPPort() string                 { return m.Called().String(0) }
+func (m *MockConfig) HTTPSPort() string                { return m.Called().String(0) }
+func (m *MockConfig) TLSEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) TLSRedirect() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) HTTPSOnly() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEEmail() string                { return m.Called().String(0) }
+func (m *MockConfig) CFAPIToken() string               { return m.Called().String(0) }
+func (m *MockConfig) ACMEStaging() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) ACMEDirectoryURL() string         { return m.Called().String(0) }
+func (m *MockConfig) ACMEHTTPPort() string             { return m.Called().String(0) }
+func (m *MockConfig) CertRenewBeforeDays() int         { return m.Called().Int(0) }
+func (m *MockConfig) AllowedPortsStart() uint16        { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) AllowedPortsEnd() uint16          { return uint16(m.Called().Int(0)) }
+func (m *MockConfig) TCPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) UDPEnabled() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPEnabled() bool         { return m.Called().Bool(0) }
+func (m *MockConfig) DirectTCPIPAllowlist() []string   { return m.Called().Get(0).([]string) }
+func (m *MockConfig) HTTPForwardPorts() []uint16       { return m.Called().Get(0).([]uint16) }
+func (m *MockConfig) DefaultTunnelType() types.TunnelType {
+	return m.Called().Get(0).(types.TunnelType)
+}
+func (m *MockConfig) InvalidHostAction() types.HostAction {
+	return m.Called().Get(0).(types.HostAction)
+}
+func (m *MockConfig) SlugCollisionPolicy() types.CollisionPolicy {
+	return m.Called().Get(0).(types.CollisionPolicy)
+}
+func (m *MockConfig) BufferSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) ResponseWriteBuffer() int            { return m.Called().Int(0) }
+func (m *MockConfig) HeaderSize() int                     { return m.Called().Int(0) }
+func (m *MockConfig) MaxResponseHeaderSize() int          { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestLineSize() int             { return m.Called().Int(0) }
+func (m *MockConfig) MaxURILength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) HeaderReadTimeout() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) BadGatewayPage() string              { return m.Called().String(0) }
+func (m *MockConfig) MaintenanceMode() bool               { return m.Called().Bool(0) }
+func (m *MockConfig) MaintenancePage() string             { return m.Called().String(0) }
+func (m *MockConfig) WelcomeURL() string                  { return m.Called().String(0) }
+func (m *MockConfig) MaxInteractiveSessions() int         { return m.Called().Int(0) }
+func (m *MockConfig) InteractiveKeepalive() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) ComingSoonDisabled() bool            { return m.Called().Bool(0) }
+func (m *MockConfig) RandomKeybindingDisabled() bool      { return m.Called().Bool(0) }
+func (m *MockConfig) MaxForwardedChannels() int           { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueue() int               { return m.Called().Int(0) }
+func (m *MockConfig) ChannelOpenQueueTimeout() time.Duration {
+	return m.Called().Get(0).(time.Duration)
+}
+func (m *MockConfig) TCPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) UDPByteBudget() int64                 { return m.Called().Get(0).(int64) }
+func (m *MockConfig) NodeBandwidthLimit() int64            { return m.Called().Get(0).(int64) }
+func (m *MockConfig) TCPInitialReadTimeout() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveInterval() time.Duration  { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TCPKeepAliveCount() int               { return m.Called().Int(0) }
+func (m *MockConfig) SlugChangeCooldown() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) SlugReuseGrace() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) MaxSlugLength() int                   { return m.Called().Int(0) }
+func (m *MockConfig) RequireStrongSlugs() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) RequireTLSForAdmin() bool             { return m.Called().Bool(0) }
+func (m *MockConfig) MaxConcurrentAccepts() int            { return m.Called().Int(0) }
+func (m *MockConfig) MaxConcurrentTLSHandshakes() int      { return m.Called().Int(0) }
+func (m *MockConfig) MaxRequestsPerIP() int                { return m.Called().Int(0) }
+func (m *MockConfig) PprofEnabled() bool                   { return m.Called().Bool(0) }
+func (m *MockConfig) PprofPort() string                    { return m.Called().String(0) }
+func (m *MockConfig) Mode() types.ServerMode               { return m.Called().Get(0).(types.ServerMode) }
+func (m *MockConfig) GRPCAddress() string                  { return m.Called().String(0) }
+func (m *MockConfig) GRPCPort() string                     { return m.Called().String(0) }
+func (m *MockConfig) NodeToken() string                    { return m.Called().String(0) }
+func (m *MockConfig) NodeTokenFile() string                { return m.Called().String(0) }
+func (m *MockConfig) NodeID() string                       { return m.Called().String(0) }
+func (m *MockConfig) NodeRegion() string                   { return m.Called().String(0) }
+func (m *MockConfig) ServedByHeader() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) WhoamiEnabled() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) MetadataToken() string                { return m.Called().String(0) }
+func (m *MockConfig) TunnelEventsWebhook() string          { return m.Called().String(0) }
+func (m *MockConfig) TunnelURLBanner() bool                { return m.Called().Bool(0) }
+func (m *MockConfig) LogConnections() bool                 { return m.Called().Bool(0) }
+func (m *MockConfig) LogTunnelType() bool                  { return m.Called().Bool(0) }
+func (m *MockConfig) AccessLogSampleRate() float64         { return m.Called().Get(0).(float64) }
+func (m *MockConfig) TunnelLogDir() string                 { return m.Called().String(0) }
+func (m *MockConfig) TunnelLogMaxSize() int64              { return m.Called().Get(0).(int64) }
+func (m *MockConfig) GRPCInitialBackoff() time.Duration    { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCBackoffMultiplier() float64       { return m.Called().Get(0).(float64) }
+func (m *MockConfig) GRPCMaxBackoff() time.Duration        { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) GRPCEventConcurrency() int            { return m.Called().Int(0) }
+func (m *MockConfig) GRPCHealthRetries() int               { return m.Called().Int(0) }
+func (m *MockConfig) RegistrySweepInterval() time.Duration { return m.Called().Get(0).(time.Duration) }
+func (m *MockConfig) TLSStoragePath() string               { return m.Called().String(0) }
+func (m *MockConfig) KeyLoc() string                       { return m.Called().String(0) }
+func (m *MockConfig) SSHHostKey() string                   { return m.Called().String(0) }
+
+func createTestCert(t *testing.T, domain string, wildcard bool, expired bool, soon bool, extraNames ...string) (string, string) {
 	t.Helper()
 
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -73,6 +150,7 @@ func createTestCert(t *testing.T, domain string, wildcard bool, expired bool, so
 	if wildcard {
 		template.DNSNames = append(template.DNSNames, "*."+domain)
 	}
+	template.DNSNames = append(template.DNSNames, extraNames...)
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
 	assert.NoError(t, err)
@@ -110,10 +188,11 @@ func setupTestDir(t *testing.T) string {
 
 func TestValidateCertDomains(t *testing.T) {
 	tests := []struct {
-		name     string
-		setup    func(t *testing.T) (certPath string, cleanup func())
-		domain   string
-		expected bool
+		name         string
+		setup        func(t *testing.T) (certPath string, cleanup func())
+		domain       string
+		tunnelDomain string
+		expected     bool
 	}{
 		{
 			name: "file not found",
@@ -187,6 +266,32 @@ func TestValidateCertDomains(t *testing.T) {
 			domain:   "example.com",
 			expected: false,
 		},
+		{
+			name: "missing region wildcard",
+			setup: func(t *testing.T) (string, func()) {
+				certPath, keyPath := createTestCert(t, "example.com", true, false, false)
+				return certPath, func() {
+					_ = os.Remove(certPath)
+					_ = os.Remove(keyPath)
+				}
+			},
+			domain:       "example.com",
+			tunnelDomain: "eu-west.example.com",
+			expected:     false,
+		},
+		{
+			name: "valid cert with region wildcard",
+			setup: func(t *testing.T) (string, func()) {
+				certPath, keyPath := createTestCert(t, "example.com", true, false, false, "*.eu-west.example.com")
+				return certPath, func() {
+					_ = os.Remove(certPath)
+					_ = os.Remove(keyPath)
+				}
+			},
+			domain:       "example.com",
+			tunnelDomain: "eu-west.example.com",
+			expected:     true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -194,7 +299,11 @@ func TestValidateCertDomains(t *testing.T) {
 			certPath, cleanup := tt.setup(t)
 			defer cleanup()
 
-			result := validateCertDomains(certPath, tt.domain)
+			tunnelDomain := tt.tunnelDomain
+			if tunnelDomain == "" {
+				tunnelDomain = tt.domain
+			}
+			result := validateCertDomains(certPath, tt.domain, tunnelDomain, 30)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -254,28 +363,40 @@ func TestLoadAndParseCertificate(t *testing.T) {
 
 func TestIsCertificateValid(t *testing.T) {
 	tests := []struct {
-		name     string
-		expired  bool
-		soon     bool
-		expected bool
+		name            string
+		expired         bool
+		soon            bool
+		renewBeforeDays int
+		expected        bool
 	}{
 		{
-			name:     "valid certificate",
-			expired:  false,
-			soon:     false,
-			expected: true,
+			name:            "valid certificate",
+			renewBeforeDays: 30,
+			expected:        true,
 		},
 		{
-			name:     "expired certificate",
-			expired:  true,
-			soon:     false,
-			expected: false,
+			name:            "expired certificate",
+			expired:         true,
+			renewBeforeDays: 30,
+			expected:        false,
 		},
 		{
-			name:     "expiring soon",
-			expired:  false,
-			soon:     true,
-			expected: false,
+			name:            "expiring soon",
+			soon:            true,
+			renewBeforeDays: 30,
+			expected:        false,
+		},
+		{
+			name:            "expiring within a custom threshold",
+			soon:            true,
+			renewBeforeDays: 20,
+			expected:        false,
+		},
+		{
+			name:            "expiring outside a custom threshold",
+			soon:            true,
+			renewBeforeDays: 10,
+			expected:        true,
 		},
 	}
 
@@ -294,7 +415,7 @@ func TestIsCertificateValid(t *testing.T) {
 			cert, err := loadAndParseCertificate(certPath)
 			assert.NoError(t, err)
 
-			result := isCertificateValid(cert)
+			result := isCertificateValid(cert, tt.renewBeforeDays)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -450,6 +571,9 @@ func TestTLSManager_userCertsExistAndValid(t *testing.T) {
 			setup: func(t *testing.T) *tlsManager {
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				return &tlsManager{
 					config:   mockCfg,
@@ -464,6 +588,9 @@ func TestTLSManager_userCertsExistAndValid(t *testing.T) {
 			setup: func(t *testing.T) *tlsManager {
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				certPath, keyPath := createTestCert(t, "example.com", true, false, false)
 				t.Cleanup(func() { _ = os.Remove(certPath) })
@@ -779,8 +906,11 @@ func TestCertWatcher_checkAndReloadCerts(t *testing.T) {
 					_ = os.Remove(keyPath)
 				})
 
+				mockCfg := &MockConfig{}
+				mockCfg.On("CertRenewBeforeDays").Return(30)
+
 				tm := &tlsManager{
-					config:   &MockConfig{},
+					config:   mockCfg,
 					certPath: certPath,
 					keyPath:  keyPath,
 				}
@@ -799,6 +929,9 @@ func TestCertWatcher_checkAndReloadCerts(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				tm := &tlsManager{
 					config:   mockCfg,
@@ -844,6 +977,9 @@ func TestCertWatcher_handleCertificateChange(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				tm := &tlsManager{
 					config:   mockCfg,
@@ -873,7 +1009,11 @@ func TestCertWatcher_handleCertificateChange(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 				mockCfg.On("CFAPIToken").Return("")
+				mockCfg.On("ACMEHTTPPort").Return("").Maybe()
 
 				tm := &tlsManager{
 					config:      mockCfg,
@@ -902,6 +1042,9 @@ func TestCertWatcher_handleCertificateChange(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				tm := &tlsManager{
 					config:   mockCfg,
@@ -929,6 +1072,54 @@ func TestCertWatcher_handleCertificateChange(t *testing.T) {
 	}
 }
 
+func TestCertWatcher_checkExpiry(t *testing.T) {
+	tests := []struct {
+		name            string
+		renewBeforeDays int
+		wantTakeover    bool
+	}{
+		{
+			name:            "outside the renewal window",
+			renewBeforeDays: 10,
+			wantTakeover:    false,
+		},
+		{
+			name:            "inside the renewal window",
+			renewBeforeDays: 20,
+			wantTakeover:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPath, keyPath := createTestCert(t, "example.com", true, false, true)
+			t.Cleanup(func() {
+				_ = os.Remove(certPath)
+				_ = os.Remove(keyPath)
+			})
+
+			mockCfg := &MockConfig{}
+			mockCfg.On("CertRenewBeforeDays").Return(tt.renewBeforeDays)
+			mockCfg.On("CFAPIToken").Return("").Maybe()
+			mockCfg.On("ACMEHTTPPort").Return("").Maybe()
+
+			tm := &tlsManager{
+				config:      mockCfg,
+				certPath:    certPath,
+				keyPath:     keyPath,
+				storagePath: setupTestDir(t),
+			}
+
+			assert.False(t, newCertWatcher(tm).checkExpiry())
+			if tt.wantTakeover {
+				mockCfg.AssertCalled(t, "CFAPIToken")
+			} else {
+				mockCfg.AssertNotCalled(t, "CFAPIToken")
+			}
+		})
+	}
+}
+
 func TestCertWatcher_switchToCertMagic(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -942,9 +1133,14 @@ func TestCertWatcher_switchToCertMagic(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 				mockCfg.On("CFAPIToken").Return("test-token")
 				mockCfg.On("ACMEEmail").Return("test@example.com")
 				mockCfg.On("ACMEStaging").Return(true)
+				mockCfg.On("ACMEDirectoryURL").Return("").Maybe()
+				mockCfg.On("ACMEHTTPPort").Return("")
 
 				return &tlsManager{
 					config:      mockCfg,
@@ -960,7 +1156,11 @@ func TestCertWatcher_switchToCertMagic(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 				mockCfg.On("CFAPIToken").Return("")
+				mockCfg.On("ACMEHTTPPort").Return("").Maybe()
 
 				return &tlsManager{
 					config:      mockCfg,
@@ -1000,7 +1200,11 @@ func TestCertWatcher_watch(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 				mockCfg.On("CFAPIToken").Return("")
+				mockCfg.On("ACMEHTTPPort").Return("").Maybe()
 
 				tm := &tlsManager{
 					config:      mockCfg,
@@ -1028,6 +1232,9 @@ func TestCertWatcher_watch(t *testing.T) {
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				tm := &tlsManager{
 					config:   mockCfg,
@@ -1063,6 +1270,9 @@ func TestCertWatcher_watch_Integration(t *testing.T) {
 
 	mockCfg := &MockConfig{}
 	mockCfg.On("Domain").Return("example.com")
+	mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+	mockCfg.On("NodeRegion").Return("").Maybe()
+	mockCfg.On("Domains").Return([]string{}).Maybe()
 
 	tm := &tlsManager{
 		config:   mockCfg,
@@ -1076,7 +1286,9 @@ func TestCertWatcher_watch_Integration(t *testing.T) {
 
 	watcher := newCertWatcher(tm)
 
-	go watcher.watch()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.watch(ctx)
 
 	time.Sleep(50 * time.Millisecond)
 
@@ -1106,6 +1318,255 @@ func TestCertWatcher_watch_Integration(t *testing.T) {
 	assert.Equal(t, initialCert, tm.userCert)
 }
 
+func TestCertWatcher_watch_Cancel(t *testing.T) {
+	mockCfg := &MockConfig{}
+	tm := &tlsManager{
+		config:   mockCfg,
+		certPath: filepath.Join(t.TempDir(), "cert.pem"),
+		keyPath:  filepath.Join(t.TempDir(), "privkey.pem"),
+	}
+	watcher := newCertWatcher(tm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.watch(ctx)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watcher did not return after cancel")
+	}
+}
+
+func TestTLSManager_stopCertWatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		start bool
+	}{
+		{name: "stops running watcher", start: true},
+		{name: "no watcher started", start: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := &tlsManager{
+				config:   &MockConfig{},
+				certPath: filepath.Join(t.TempDir(), "cert.pem"),
+				keyPath:  filepath.Join(t.TempDir(), "privkey.pem"),
+			}
+			if tt.start {
+				tm.startCertWatcher()
+			}
+
+			done := make(chan struct{})
+			go func() {
+				tm.stopCertWatcher()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("stopCertWatcher did not return")
+			}
+
+			if tt.start {
+				select {
+				case <-tm.watcherDone:
+				default:
+					t.Fatal("watcher goroutine still running")
+				}
+			}
+		})
+	}
+}
+
+func TestTLSManager_createCertMagicConfig_HTTPIssuer(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfToken     string
+		httpPort    string
+		wantIssuers int
+	}{
+		{name: "dns only", cfToken: "test-token", httpPort: "", wantIssuers: 1},
+		{name: "with http challenge port", cfToken: "test-token", httpPort: "8081", wantIssuers: 2},
+		{name: "http challenge port without token", cfToken: "", httpPort: "8081", wantIssuers: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCfg := &MockConfig{}
+			mockCfg.On("CFAPIToken").Return(tt.cfToken)
+			mockCfg.On("ACMEEmail").Return("test@example.com")
+			mockCfg.On("ACMEStaging").Return(true)
+			mockCfg.On("ACMEDirectoryURL").Return("").Maybe()
+			mockCfg.On("ACMEHTTPPort").Return(tt.httpPort)
+
+			tm := &tlsManager{config: mockCfg, storagePath: setupTestDir(t)}
+			magic := tm.createCertMagicConfig()
+
+			assert.Len(t, magic.Issuers, tt.wantIssuers)
+			if tt.httpPort == "" {
+				assert.Nil(t, tm.httpIssuer)
+				return
+			}
+			assert.Equal(t, http01Issuer{tm.httpIssuer}, magic.Issuers[0])
+			assert.Equal(t, 8081, tm.httpIssuer.AltHTTPPort)
+			assert.True(t, tm.httpIssuer.DisableTLSALPNChallenge)
+			assert.Nil(t, tm.httpIssuer.DNS01Solver)
+			assert.Equal(t, certmagic.LetsEncryptStagingCA, tm.httpIssuer.CA)
+		})
+	}
+}
+
+func TestHTTP01Issuer_PreCheck(t *testing.T) {
+	mockCfg := &MockConfig{}
+	mockCfg.On("CFAPIToken").Return("")
+	mockCfg.On("ACMEEmail").Return("test@example.com")
+	mockCfg.On("ACMEStaging").Return(true)
+	mockCfg.On("ACMEDirectoryURL").Return("").Maybe()
+	mockCfg.On("ACMEHTTPPort").Return("8081")
+
+	tm := &tlsManager{config: mockCfg, storagePath: setupTestDir(t)}
+	issuer := tm.createCertMagicConfig().Issuers[0].(http01Issuer)
+
+	err := issuer.PreCheck(context.Background(), []string{"*.example.com"}, false)
+	assert.ErrorContains(t, err, "wildcard")
+
+	assert.NoError(t, issuer.PreCheck(context.Background(), []string{"example.com"}, false))
+}
+
+func TestWithoutWildcards(t *testing.T) {
+	domains := []string{"example.com", "*.example.com", "example.org", "*.example.org"}
+	assert.Equal(t, []string{"example.com", "example.org"}, withoutWildcards(domains))
+}
+
+func TestTLSManager_acmeCA(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		staging   bool
+		expected  string
+	}{
+		{name: "production by default", expected: certmagic.LetsEncryptProductionCA},
+		{name: "staging", staging: true, expected: certmagic.LetsEncryptStagingCA},
+		{name: "custom directory", directory: "https://ca.internal/acme/directory", expected: "https://ca.internal/acme/directory"},
+		{name: "custom directory wins over staging", directory: "https://ca.internal/acme/directory", staging: true, expected: "https://ca.internal/acme/directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCfg := &MockConfig{}
+			mockCfg.On("CFAPIToken").Return("test-token")
+			mockCfg.On("ACMEEmail").Return("test@example.com")
+			mockCfg.On("ACMEStaging").Return(tt.staging).Maybe()
+			mockCfg.On("ACMEDirectoryURL").Return(tt.directory)
+			mockCfg.On("ACMEHTTPPort").Return("8081")
+
+			tm := &tlsManager{config: mockCfg, storagePath: setupTestDir(t)}
+			magic := tm.createCertMagicConfig()
+
+			assert.Len(t, magic.Issuers, 2)
+			assert.Equal(t, tt.expected, magic.Issuers[0].(http01Issuer).CA)
+			assert.Equal(t, tt.expected, magic.Issuers[1].(*certmagic.ACMEIssuer).CA)
+		})
+	}
+}
+
+func TestTLSManager_startChallengeListener(t *testing.T) {
+	t.Run("no http issuer", func(t *testing.T) {
+		tm := &tlsManager{config: &MockConfig{}}
+		assert.NoError(t, tm.startChallengeListener())
+		assert.Nil(t, tm.challengeServer)
+	})
+
+	t.Run("serves challenges on configured port", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+		assert.NoError(t, ln.Close())
+
+		mockCfg := &MockConfig{}
+		mockCfg.On("ACMEEmail").Return("test@example.com")
+		mockCfg.On("ACMEStaging").Return(true)
+		mockCfg.On("ACMEDirectoryURL").Return("").Maybe()
+		mockCfg.On("ACMEHTTPPort").Return(port)
+
+		storageDir := setupTestDir(t)
+		tm := &tlsManager{config: mockCfg, storagePath: storageDir}
+		magic := certmagic.New(certmagic.NewCache(certmagic.CacheOptions{
+			GetConfigForCert: func(cert certmagic.Certificate) (*certmagic.Config, error) {
+				return tm.magic, nil
+			},
+		}), certmagic.Config{Storage: &certmagic.FileStorage{Path: storageDir}})
+		tm.magic = magic
+		tm.httpIssuer = tm.createHTTPIssuer(magic)
+		magic.Issuers = []certmagic.Issuer{tm.httpIssuer}
+
+		tokenFile := filepath.Join(storageDir, "acme", certmagic.StorageKeys.Safe(tm.httpIssuer.IssuerKey()),
+			"challenge_tokens", "example.com.json")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(tokenFile), 0700))
+		assert.NoError(t, os.WriteFile(tokenFile, []byte(`{"type":"http-01","token":"testtoken",`+
+			`"keyAuthorization":"testtoken.thumbprint","identifier":{"type":"dns","value":"example.com"}}`), 0600))
+
+		assert.NoError(t, tm.startChallengeListener())
+		defer tm.stopChallengeListener()
+
+		get := func(path string) (int, string) {
+			req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+port+path, nil)
+			assert.NoError(t, err)
+			req.Host = "example.com"
+			resp, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return 0, ""
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			return resp.StatusCode, string(body)
+		}
+
+		status, body := get("/.well-known/acme-challenge/testtoken")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "testtoken.thumbprint", body)
+
+		status, _ = get("/not-a-challenge")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("port already in use", func(t *testing.T) {
+		ln, err := net.Listen("tcp", ":0")
+		assert.NoError(t, err)
+		defer ln.Close()
+
+		mockCfg := &MockConfig{}
+		mockCfg.On("ACMEHTTPPort").Return(strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+
+		tm := &tlsManager{config: mockCfg, httpIssuer: &certmagic.ACMEIssuer{}}
+		err = tm.startChallengeListener()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to start ACME HTTP challenge listener")
+	})
+}
+
+func TestTLSManager_stopChallengeListener(t *testing.T) {
+	tm := &tlsManager{}
+	tm.stopChallengeListener()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tm.challengeServer = &http.Server{Handler: http.NotFoundHandler()}
+	go func(srv *http.Server) { _ = srv.Serve(ln) }(tm.challengeServer)
+
+	tm.stopChallengeListener()
+	assert.Nil(t, tm.challengeServer)
+}
+
 func TestNewTLSConfig(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -1117,8 +1578,8 @@ func TestNewTLSConfig(t *testing.T) {
 		{
 			name: "with valid user certs",
 			setup: func(t *testing.T) config.Config {
+				StopTLSManager()
 				globalTLSManager = nil
-				tlsManagerOnce = sync.Once{}
 
 				tmpDir := setupTestDir(t)
 
@@ -1141,6 +1602,9 @@ func TestNewTLSConfig(t *testing.T) {
 				mockCfg := &MockConfig{}
 				mockCfg.On("TLSStoragePath").Return(tmpDir)
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 
 				return mockCfg
 			},
@@ -1153,15 +1617,19 @@ func TestNewTLSConfig(t *testing.T) {
 		{
 			name: "missing certs requires certmagic",
 			setup: func(t *testing.T) config.Config {
+				StopTLSManager()
 				globalTLSManager = nil
-				tlsManagerOnce = sync.Once{}
 
 				tmpDir := setupTestDir(t)
 
 				mockCfg := &MockConfig{}
 				mockCfg.On("TLSStoragePath").Return(tmpDir)
 				mockCfg.On("Domain").Return("example.com")
+				mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+				mockCfg.On("NodeRegion").Return("").Maybe()
+				mockCfg.On("Domains").Return([]string{}).Maybe()
 				mockCfg.On("CFAPIToken").Return("")
+				mockCfg.On("ACMEHTTPPort").Return("").Maybe()
 
 				return mockCfg
 			},
@@ -1191,9 +1659,50 @@ func TestNewTLSConfig(t *testing.T) {
 	}
 }
 
+func TestNewTLSConfig_RetriesAfterInitError(t *testing.T) {
+	StopTLSManager()
+	globalTLSManager = nil
+	t.Cleanup(func() {
+		StopTLSManager()
+		globalTLSManager = nil
+	})
+
+	tmpDir := setupTestDir(t)
+	mockCfg := &MockConfig{}
+	mockCfg.On("TLSStoragePath").Return(tmpDir)
+	mockCfg.On("Domain").Return("example.com")
+	mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+	mockCfg.On("NodeRegion").Return("").Maybe()
+	mockCfg.On("Domains").Return([]string{}).Maybe()
+	mockCfg.On("CFAPIToken").Return("")
+	mockCfg.On("ACMEHTTPPort").Return("").Maybe()
+
+	tlsConfig, err := NewTLSConfig(mockCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CF_API_TOKEN")
+	assert.Nil(t, tlsConfig)
+	assert.Nil(t, globalTLSManager)
+
+	certPath, keyPath := createTestCert(t, "example.com", true, false, false)
+	t.Cleanup(func() {
+		_ = os.Remove(certPath)
+		_ = os.Remove(keyPath)
+	})
+	certData, err := os.ReadFile(certPath)
+	assert.NoError(t, err)
+	keyData, err := os.ReadFile(keyPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "cert.pem"), certData, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "privkey.pem"), keyData, 0644))
+
+	tlsConfig, err = NewTLSConfig(mockCfg)
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig)
+}
+
 func TestNewTLSConfig_Singleton(t *testing.T) {
+	StopTLSManager()
 	globalTLSManager = nil
-	tlsManagerOnce = sync.Once{}
 
 	tmpDir := setupTestDir(t)
 
@@ -1220,6 +1729,9 @@ func TestNewTLSConfig_Singleton(t *testing.T) {
 	mockCfg := &MockConfig{}
 	mockCfg.On("TLSStoragePath").Return(tmpDir)
 	mockCfg.On("Domain").Return("example.com")
+	mockCfg.On("CertRenewBeforeDays").Return(30).Maybe()
+	mockCfg.On("NodeRegion").Return("").Maybe()
+	mockCfg.On("Domains").Return([]string{}).Maybe()
 
 	tlsConfig1, err1 := NewTLSConfig(mockCfg)
 	tlsConfig2, err2 := NewTLSConfig(mockCfg)
@@ -9,6 +9,13 @@ type Transport interface {
 	Serve(listener net.Listener) error
 }
 
+// PacketTransport is the datagram counterpart of Transport, used by UDP
+// tunnels.
+type PacketTransport interface {
+	Listen() (net.PacketConn, error)
+	Serve(conn net.PacketConn) error
+}
+
 type HTTP interface {
 	Handler(conn net.Conn, isTLS bool)
 }
@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+	"tunnel_pls/internal/session/forwarder"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	udpFlowQueue   = 64
+	udpIdleTimeout = 2 * time.Minute
+	udpMaxFlows    = 1024
+)
+
+type UDPForwarder interface {
+	Enabled() bool
+	OpenForwardedChannel(ctx context.Context, origin net.Addr) (ssh.Channel, <-chan *ssh.Request, error)
+	ForwardDatagram(dst ssh.Channel, p []byte) error
+	HandleDatagrams(dst net.PacketConn, peer net.Addr, src ssh.Channel)
+}
+
+// udp relays datagrams for a UDP tunnel. Each remote peer gets its own
+// forwarded channel, which is closed after idleTimeout without traffic from
+// that peer. At most maxFlows peers are relayed at once.
+type udp struct {
+	port        uint16
+	forwarder   UDPForwarder
+	idleTimeout time.Duration
+	maxFlows    int
+	mu          sync.Mutex
+	flows       map[string]*udpFlow
+	done        chan struct{}
+}
+
+type udpFlow struct {
+	packets chan []byte
+}
+
+func NewUDPServer(port uint16, forwarder UDPForwarder) PacketTransport {
+	return &udp{
+		port:        port,
+		forwarder:   forwarder,
+		idleTimeout: udpIdleTimeout,
+		maxFlows:    udpMaxFlows,
+		flows:       make(map[string]*udpFlow),
+		done:        make(chan struct{}),
+	}
+}
+
+func (u *udp) Listen() (net.PacketConn, error) {
+	return net.ListenPacket("udp", fmt.Sprintf("0.0.0.0:%d", u.port))
+}
+
+func (u *udp) Serve(conn net.PacketConn) error {
+	defer close(u.done)
+	buf := make([]byte, forwarder.MaxDatagramSize)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Error reading datagram: %v", err)
+			continue
+		}
+		if !u.forwarder.Enabled() {
+			continue
+		}
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		u.dispatch(conn, peer, packet)
+	}
+}
+
+// dispatch queues packet on the peer's flow, starting one if needed. A full
+// queue, or a new peer while maxFlows flows are open, drops the datagram, as
+// the network would.
+func (u *udp) dispatch(conn net.PacketConn, peer net.Addr, packet []byte) {
+	u.mu.Lock()
+	flow, ok := u.flows[peer.String()]
+	if !ok {
+		if len(u.flows) >= u.maxFlows {
+			u.mu.Unlock()
+			return
+		}
+		flow = &udpFlow{packets: make(chan []byte, udpFlowQueue)}
+		u.flows[peer.String()] = flow
+		go u.handleFlow(conn, peer, flow)
+	}
+	u.mu.Unlock()
+
+	select {
+	case flow.packets <- packet:
+	default:
+	}
+}
+
+func (u *udp) removeFlow(peer net.Addr, flow *udpFlow) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.flows[peer.String()] == flow {
+		delete(u.flows, peer.String())
+	}
+}
+
+func (u *udp) handleFlow(conn net.PacketConn, peer net.Addr, flow *udpFlow) {
+	defer u.removeFlow(peer, flow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	channel, reqs, err := u.forwarder.OpenForwardedChannel(ctx, peer)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to open forwarded-udpip channel: %v", err)
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	replies := make(chan struct{})
+	go func() {
+		defer close(replies)
+		u.forwarder.HandleDatagrams(conn, peer, channel)
+	}()
+	defer func() {
+		_ = channel.Close()
+		<-replies
+	}()
+
+	idle := time.NewTimer(u.idleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case packet := <-flow.packets:
+			if err = u.forwarder.ForwardDatagram(channel, packet); err != nil {
+				log.Printf("Failed to forward datagram from %s: %v", peer, err)
+				return
+			}
+			idle.Reset(u.idleTimeout)
+		case <-idle.C:
+			return
+		case <-replies:
+			return
+		case <-u.done:
+			return
+		}
+	}
+}
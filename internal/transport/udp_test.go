@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// blockingChannel returns a channel whose HandleDatagrams call, once wired up
+// with expectRelay, blocks until the channel is closed, as the real relay
+// does.
+func blockingChannel() (*MockSSHChannel, chan struct{}) {
+	closed := make(chan struct{})
+	var once sync.Once
+	channel := new(MockSSHChannel)
+	channel.On("Close").Run(func(mock.Arguments) {
+		once.Do(func() { close(closed) })
+	}).Return(nil)
+	return channel, closed
+}
+
+// expectRelay matches the channel by identity: comparing two mock channels
+// by value would walk their call records while other flows update them.
+func expectRelay(mf *MockForwarder, channel *MockSSHChannel, closed chan struct{}, received chan<- string) {
+	sameChannel := mock.MatchedBy(func(c ssh.Channel) bool {
+		return c == ssh.Channel(channel)
+	})
+	mf.On("OpenForwardedChannel", mock.Anything, mock.Anything).Return(channel, (<-chan *ssh.Request)(make(chan *ssh.Request)), nil).Once()
+	mf.On("HandleDatagrams", mock.Anything, mock.Anything, sameChannel).Run(func(mock.Arguments) {
+		<-closed
+	}).Return().Once()
+	mf.On("ForwardDatagram", sameChannel, mock.Anything).Run(func(args mock.Arguments) {
+		received <- string(args.Get(1).([]byte))
+	}).Return(nil)
+}
+
+func startUDPServer(t *testing.T, mf *MockForwarder, idleTimeout time.Duration, maxFlows int) (*udp, net.PacketConn) {
+	srv := NewUDPServer(0, mf).(*udp)
+	srv.idleTimeout = idleTimeout
+	srv.maxFlows = maxFlows
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(conn)
+	}()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		assert.NoError(t, <-served)
+	})
+	return srv, conn
+}
+
+func sendDatagram(t *testing.T, to net.Addr, payload string) net.PacketConn {
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	_, err = client.WriteTo([]byte(payload), to)
+	require.NoError(t, err)
+	return client
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	select {
+	case payload := <-received:
+		return payload
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a forwarded datagram")
+		return ""
+	}
+}
+
+func TestNewUDPServer(t *testing.T) {
+	mf := new(MockForwarder)
+	port := uint16(27015)
+
+	srv := NewUDPServer(port, mf)
+	assert.NotNil(t, srv)
+
+	udpSrv, ok := srv.(*udp)
+	assert.True(t, ok)
+	assert.Equal(t, port, udpSrv.port)
+	assert.Equal(t, mf, udpSrv.forwarder)
+	assert.Equal(t, udpIdleTimeout, udpSrv.idleTimeout)
+	assert.Equal(t, udpMaxFlows, udpSrv.maxFlows)
+}
+
+func TestUDPServer_Listen(t *testing.T) {
+	srv := NewUDPServer(0, new(MockForwarder))
+
+	conn, err := srv.Listen()
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	assert.NoError(t, conn.Close())
+}
+
+func TestUDPServer_Serve_OneChannelPerPeer(t *testing.T) {
+	mf := new(MockForwarder)
+	mf.On("Enabled").Return(true)
+	first, firstClosed := blockingChannel()
+	second, secondClosed := blockingChannel()
+	firstReceived := make(chan string, 4)
+	secondReceived := make(chan string, 4)
+	expectRelay(mf, first, firstClosed, firstReceived)
+
+	_, conn := startUDPServer(t, mf, time.Minute, udpMaxFlows)
+
+	alice := sendDatagram(t, conn.LocalAddr(), "alice 1")
+	assert.Equal(t, "alice 1", receive(t, firstReceived))
+	_, err := alice.WriteTo([]byte("alice 2"), conn.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, "alice 2", receive(t, firstReceived))
+
+	expectRelay(mf, second, secondClosed, secondReceived)
+	sendDatagram(t, conn.LocalAddr(), "bob 1")
+	assert.Equal(t, "bob 1", receive(t, secondReceived))
+
+	mf.AssertNumberOfCalls(t, "OpenForwardedChannel", 2)
+}
+
+func TestUDPServer_Serve_IdleFlowIsClosed(t *testing.T) {
+	mf := new(MockForwarder)
+	mf.On("Enabled").Return(true)
+	first, firstClosed := blockingChannel()
+	second, secondClosed := blockingChannel()
+	received := make(chan string, 4)
+	expectRelay(mf, first, firstClosed, received)
+
+	srv, conn := startUDPServer(t, mf, 50*time.Millisecond, udpMaxFlows)
+
+	client := sendDatagram(t, conn.LocalAddr(), "hello")
+	assert.Equal(t, "hello", receive(t, received))
+
+	select {
+	case <-firstClosed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle flow was not closed")
+	}
+	assert.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return len(srv.flows) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	expectRelay(mf, second, secondClosed, received)
+	_, err := client.WriteTo([]byte("back again"), conn.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, "back again", receive(t, received))
+	mf.AssertNumberOfCalls(t, "OpenForwardedChannel", 2)
+}
+
+func TestUDPServer_Serve_FlowLimit(t *testing.T) {
+	mf := new(MockForwarder)
+	mf.On("Enabled").Return(true)
+	first, firstClosed := blockingChannel()
+	received := make(chan string, 4)
+	expectRelay(mf, first, firstClosed, received)
+
+	srv, conn := startUDPServer(t, mf, time.Minute, 1)
+
+	alice := sendDatagram(t, conn.LocalAddr(), "alice 1")
+	assert.Equal(t, "alice 1", receive(t, received))
+
+	sendDatagram(t, conn.LocalAddr(), "bob 1")
+	_, err := alice.WriteTo([]byte("alice 2"), conn.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, "alice 2", receive(t, received))
+
+	srv.mu.Lock()
+	assert.Len(t, srv.flows, 1)
+	srv.mu.Unlock()
+	mf.AssertNumberOfCalls(t, "OpenForwardedChannel", 1)
+}
+
+func TestUDPServer_Serve_Disabled(t *testing.T) {
+	mf := new(MockForwarder)
+	checked := make(chan struct{}, 1)
+	mf.On("Enabled").Run(func(mock.Arguments) {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+	}).Return(false)
+
+	srv, conn := startUDPServer(t, mf, time.Minute, udpMaxFlows)
+	sendDatagram(t, conn.LocalAddr(), "ignored")
+
+	select {
+	case <-checked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("datagram was never read")
+	}
+
+	srv.mu.Lock()
+	assert.Empty(t, srv.flows)
+	srv.mu.Unlock()
+	mf.AssertNotCalled(t, "OpenForwardedChannel", mock.Anything, mock.Anything)
+}
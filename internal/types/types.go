@@ -23,6 +23,7 @@ const (
 	TunnelTypeUNKNOWN TunnelType = iota
 	TunnelTypeHTTP
 	TunnelTypeTCP
+	TunnelTypeUDP
 )
 
 type ServerMode int
@@ -32,6 +33,21 @@ const (
 	ServerModeNODE
 )
 
+type HostAction int
+
+const (
+	HostActionREJECT HostAction = iota
+	HostActionLOG
+	HostActionDROP
+)
+
+type CollisionPolicy int
+
+const (
+	CollisionPolicyREJECT CollisionPolicy = iota
+	CollisionPolicySUFFIX
+)
+
 type SessionKey struct {
 	Id   string
 	Type TunnelType
@@ -43,6 +59,7 @@ type Detail struct {
 	UserID         string    `json:"user_id,omitempty"`
 	Active         bool      `json:"active,omitempty"`
 	StartedAt      time.Time `json:"started_at,omitempty"`
+	Description    string    `json:"description,omitempty"`
 }
 
 var BadGatewayResponse = []byte("HTTP/1.1 502 Bad Gateway\r\n" +
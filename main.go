@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"tunnel_pls/internal/bootstrap"
 	"tunnel_pls/internal/config"
 	"tunnel_pls/internal/port"
@@ -29,6 +30,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("Startup error: %v", err)
 	}
+	boot.Quiet = slices.Contains(os.Args[1:], "--quiet")
+
+	if slices.Contains(os.Args[1:], "--self-test") {
+		if err = boot.SelfTest(os.Stdout); err != nil {
+			log.Fatalf("Self-test failed: %v", err)
+		}
+		return
+	}
 
 	if err = boot.Run(); err != nil {
 		log.Fatalf("Application error: %v", err)